@@ -0,0 +1,393 @@
+package beacon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Alias resolution groups the interface addresses which answer traceroutes into routers, with two techniques.
+//
+// Common source address: a udp probe to an unused port of an interface is answered with a port unreachable, which
+// many routers send from the address of the interface that routes back to the prober.  A reply from another
+// address makes the two addresses aliases.
+//
+// IP-ID sequences: many routers stamp the packets they originate with a single IP-ID counter.  Echo requests are sent
+// to every address in turn for a few rounds, and two addresses share a counter if the IP-IDs of their replies, merged
+// in the order they arrived, keep increasing by small steps.
+
+// AliasOption modifies how ResolveAliases probes
+type AliasOption func(*aliasConfig) error
+
+type aliasConfig struct {
+	rounds   int
+	spacing  time.Duration
+	timeout  time.Duration
+	maxIDGap uint16
+}
+
+// WithAliasRounds sets how many echo requests each address is sent for the IP-ID comparison, defaults to 5
+func WithAliasRounds(rounds int) AliasOption {
+	return func(c *aliasConfig) error {
+		if rounds < 2 {
+			return fmt.Errorf("alias resolution needs atleast 2 rounds, got %d", rounds)
+		}
+		c.rounds = rounds
+		return nil
+	}
+}
+
+// WithAliasSpacing sets the time between consecutive probes, defaults to 10ms
+func WithAliasSpacing(spacing time.Duration) AliasOption {
+	return func(c *aliasConfig) error {
+		if spacing <= 0 {
+			return fmt.Errorf("probe spacing must be positive, got %s", spacing)
+		}
+		c.spacing = spacing
+		return nil
+	}
+}
+
+// WithAliasTimeout sets how long to wait for replies after the last probe, defaults to 2s
+func WithAliasTimeout(timeout time.Duration) AliasOption {
+	return func(c *aliasConfig) error {
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be positive, got %s", timeout)
+		}
+		c.timeout = timeout
+		return nil
+	}
+}
+
+// WithMaxIPIDGap sets the largest step between consecutive IP-IDs of a shared counter, defaults to 1000.  Busy
+// routers need a larger gap, at the risk of matching unrelated counters.
+func WithMaxIPIDGap(gap uint16) AliasOption {
+	return func(c *aliasConfig) error {
+		if gap == 0 {
+			return errors.New("the IP-ID gap must be atleast 1")
+		}
+		c.maxIDGap = gap
+		return nil
+	}
+}
+
+// Aliases groups interface addresses into routers.  Every address added is a router of its own until it is joined
+// with another.  It implements DeviceResolver, naming each router after its lowest address.
+type Aliases struct {
+	parent map[string]string
+	ips    map[string]net.IP
+}
+
+// NewAliases returns Aliases without any addresses
+func NewAliases() *Aliases {
+	return &Aliases{parent: make(map[string]string), ips: make(map[string]net.IP)}
+}
+
+// Add adds an address as a router of its own, if it isn't known yet
+func (a *Aliases) Add(ip net.IP) {
+	key := ip.String()
+	if _, ok := a.parent[key]; !ok {
+		a.parent[key] = key
+		a.ips[key] = ip
+	}
+}
+
+// Join records that two addresses are on the same router, adding them if needed
+func (a *Aliases) Join(x, y net.IP) {
+	a.Add(x)
+	a.Add(y)
+	rootX, rootY := a.root(x.String()), a.root(y.String())
+	if rootX == rootY {
+		return
+	}
+	// the lower address stays the root, which names the router
+	if lessIP(a.ips[rootY], a.ips[rootX]) {
+		rootX, rootY = rootY, rootX
+	}
+	a.parent[rootY] = rootX
+}
+
+func (a *Aliases) root(key string) string {
+	for a.parent[key] != key {
+		a.parent[key] = a.parent[a.parent[key]]
+		key = a.parent[key]
+	}
+	return key
+}
+
+// Same returns whether two addresses are known to be on the same router
+func (a *Aliases) Same(x, y net.IP) bool {
+	if x.Equal(y) {
+		return true
+	}
+	if _, ok := a.parent[x.String()]; !ok {
+		return false
+	}
+	if _, ok := a.parent[y.String()]; !ok {
+		return false
+	}
+	return a.root(x.String()) == a.root(y.String())
+}
+
+// Device returns the lowest address of the router an address is on, or "" for an address which was never added
+func (a *Aliases) Device(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if _, ok := a.parent[ip.String()]; !ok {
+		return ""
+	}
+	return a.root(ip.String())
+}
+
+// Router returns the addresses of the router an address is on, lowest first
+func (a *Aliases) Router(ip net.IP) []net.IP {
+	root := a.Device(ip)
+	if root == "" {
+		return nil
+	}
+	var router []net.IP
+	for key, addr := range a.ips {
+		if a.root(key) == root {
+			router = append(router, addr)
+		}
+	}
+	sortIPs(router)
+	return router
+}
+
+// Routers returns the addresses of every router, ordered by their lowest address
+func (a *Aliases) Routers() [][]net.IP {
+	byRoot := make(map[string][]net.IP)
+	for key, addr := range a.ips {
+		root := a.root(key)
+		byRoot[root] = append(byRoot[root], addr)
+	}
+
+	routers := make([][]net.IP, 0, len(byRoot))
+	for _, router := range byRoot {
+		sortIPs(router)
+		routers = append(routers, router)
+	}
+	sort.Slice(routers, func(i, j int) bool {
+		return lessIP(routers[i][0], routers[j][0])
+	})
+	return routers
+}
+
+// RouterPath returns the path with every hop replaced by the lowest address of its router, and consecutive hops on
+// the same router merged into one.  Hops which didn't respond are kept.
+func (a *Aliases) RouterPath(p Path) Path {
+	routerPath := make(Path, 0, len(p))
+	for _, hop := range p {
+		if hop != nil {
+			if root := a.Device(hop); root != "" {
+				hop = a.ips[root]
+			}
+		}
+		if len(routerPath) > 0 && hop != nil && hop.Equal(routerPath[len(routerPath)-1]) {
+			continue
+		}
+		routerPath = append(routerPath, hop)
+	}
+	return routerPath
+}
+
+func sortIPs(ips []net.IP) {
+	sort.Slice(ips, func(i, j int) bool {
+		return lessIP(ips[i], ips[j])
+	})
+}
+
+// lessIP orders addresses by their 16 byte form, so that the 4 and 16 byte forms of an IPv4 address sort alike
+func lessIP(x, y net.IP) bool {
+	return bytes.Compare(x.To16(), y.To16()) < 0
+}
+
+// ipIDSample is the IP-ID of a reply and when it arrived
+type ipIDSample struct {
+	id uint16
+	at time.Time
+}
+
+// increasing returns whether each IP-ID of samples ordered by arrival is larger than the one before, by no more than
+// maxGap modulo 2^16
+func increasing(samples []ipIDSample, maxGap uint16) bool {
+	for idx := 1; idx < len(samples); idx++ {
+		step := samples[idx].id - samples[idx-1].id
+		if step == 0 || step > maxGap {
+			return false
+		}
+	}
+	return true
+}
+
+// sharedCounter returns whether two series of IP-IDs, each ordered by arrival, come from one counter
+func sharedCounter(x, y []ipIDSample, maxGap uint16) bool {
+	if len(x) < 2 || len(y) < 2 || !increasing(x, maxGap) || !increasing(y, maxGap) {
+		return false
+	}
+
+	merged := make([]ipIDSample, 0, len(x)+len(y))
+	merged = append(merged, x...)
+	merged = append(merged, y...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].at.Before(merged[j].at)
+	})
+	return increasing(merged, maxGap)
+}
+
+// ResolveAliases probes a set of IPv4 interface addresses, such as the hops of traceroutes, and groups them into
+// routers.  IPv6 addresses are added as routers of their own.  The TransportChannel must capture icmp.
+func (tc *TransportChannel) ResolveAliases(ips []net.IP, options ...AliasOption) (*Aliases, error) {
+	config := &aliasConfig{rounds: 5, spacing: 10 * time.Millisecond, timeout: 2 * time.Second, maxIDGap: 1000}
+	for _, option := range options {
+		if err := option(config); err != nil {
+			return nil, fmt.Errorf("Failed to apply AliasOption: %s", err)
+		}
+	}
+	if !tc.filterIncludes("icmp") {
+		return nil, fmt.Errorf("BPF filter must be icmp: got %s instead", tc.filter)
+	}
+
+	aliases := NewAliases()
+	var targets []net.IP
+	for _, ip := range ips {
+		if ip == nil {
+			continue
+		}
+		if _, ok := aliases.parent[ip.String()]; ok {
+			continue
+		}
+		aliases.Add(ip)
+		if ip.To4() != nil {
+			targets = append(targets, ip.To4())
+		}
+	}
+	if len(targets) == 0 {
+		return aliases, nil
+	}
+	// the echo requests of every round are told apart by a 16 bit sequence number
+	if config.rounds*len(targets) > 1<<16 {
+		return nil, fmt.Errorf("Can't resolve %d addresses in %d rounds, atmost %d echo requests can be numbered", len(targets), config.rounds, 1<<16)
+	}
+
+	sourceIP, err := tc.SourceFor(targets[0])
+	if err != nil {
+		return nil, err
+	}
+
+	echoID := uint16(rand.Intn(1 << 16))
+	basePort := aliasBasePort(len(targets))
+	sub, err := tc.Subscribe(func(dp *DecodedPacket) bool {
+		if !dp.Has(layers.LayerTypeICMPv4) || !dp.Has(layers.LayerTypeIPv4) || !dp.IPv4.DstIP.Equal(sourceIP) {
+			return false
+		}
+		switch int(dp.ICMPv4.TypeCode) {
+		case icmpEchoReply:
+			return dp.ICMPv4.Id == echoID
+		case icmpPortUnreachable:
+			udp, err := dp.QuotedUDP()
+			return err == nil && udp.SrcPort >= basePort && int(udp.SrcPort) < int(basePort)+len(targets)
+		}
+		return false
+	}, 2*len(targets)*(config.rounds+1))
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	// one udp probe per address for the common source address, then the rounds of echo requests
+	buf := gopacket.NewSerializeBuffer()
+	for idx, target := range targets {
+		if err := buildUDPTraceroutePacket(sourceIP, target, basePort+layers.UDPPort(idx), 33434, 64, []byte("alias"), buf); err != nil {
+			return nil, fmt.Errorf("Failed to build alias probe: %s", err)
+		}
+		if err := tc.SendTo(buf.Bytes(), target); err != nil {
+			log.Printf("Failed to send alias probe to %s: %s\n", target, err)
+		}
+		time.Sleep(config.spacing)
+	}
+	for round := 0; round < config.rounds; round++ {
+		for idx, target := range targets {
+			seq := uint16(round*len(targets) + idx)
+			if err := buildICMPv4TraceroutePacket(sourceIP, target, 64, []byte("alias"), buf, seq, echoID); err != nil {
+				return nil, fmt.Errorf("Failed to build alias probe: %s", err)
+			}
+			if err := tc.SendTo(buf.Bytes(), target); err != nil {
+				log.Printf("Failed to send alias probe to %s: %s\n", target, err)
+			}
+			time.Sleep(config.spacing)
+		}
+	}
+
+	samples := make([][]ipIDSample, len(targets))
+	deadline := time.NewTimer(config.timeout)
+	defer deadline.Stop()
+	for collecting := true; collecting; {
+		select {
+		case match, ok := <-sub.Packets():
+			if !ok {
+				collecting = false
+				break
+			}
+			recordAliasReply(match, targets, basePort, aliases, samples)
+		case <-deadline.C:
+			collecting = false
+		}
+	}
+
+	for i := range targets {
+		for j := i + 1; j < len(targets); j++ {
+			if sharedCounter(samples[i], samples[j], config.maxIDGap) {
+				aliases.Join(targets[i], targets[j])
+			}
+		}
+	}
+	return aliases, nil
+}
+
+// aliasBasePort returns a random source port for the first of the udp probes, leaving room for one port per target
+// below 65536 so that the source ports of the probes don't wrap
+func aliasBasePort(targets int) layers.UDPPort {
+	basePort := generateRandomUDPPort()
+	if int(basePort)+targets > 1<<16 {
+		basePort = layers.UDPPort(1<<16 - targets)
+	}
+	return basePort
+}
+
+// recordAliasReply joins the source of a port unreachable with the address probed, or records the IP-ID of an echo
+// reply
+func recordAliasReply(match Match, targets []net.IP, basePort layers.UDPPort, aliases *Aliases, samples [][]ipIDSample) {
+	ip4, _ := match.Packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	icmp4, _ := match.Packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+	if ip4 == nil || icmp4 == nil {
+		return
+	}
+
+	if icmp4.TypeCode.Type() == layers.ICMPv4TypeEchoReply {
+		idx := int(icmp4.Seq) % len(targets)
+		if ip4.SrcIP.Equal(targets[idx]) {
+			samples[idx] = append(samples[idx], ipIDSample{id: ip4.Id, at: match.CaptureInfo.Timestamp})
+		}
+		return
+	}
+
+	quoted := gopacket.NewPacket(icmp4.Payload, layers.LayerTypeIPv4, gopacket.Default)
+	udp, _ := quoted.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if udp == nil {
+		return
+	}
+	idx := int(udp.SrcPort - basePort)
+	if idx >= 0 && idx < len(targets) && !ip4.SrcIP.Equal(targets[idx]) {
+		aliases.Join(targets[idx], ip4.SrcIP)
+	}
+}
@@ -0,0 +1,109 @@
+package beacon
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAliasesJoin(t *testing.T) {
+	a := NewAliases()
+	par1, par2, par3 := net.IP{104, 44, 17, 78}, net.IP{104, 44, 11, 237}, net.IP{104, 44, 11, 238}
+	lon := net.IP{104, 44, 18, 155}
+	a.Add(lon)
+	a.Join(par1, par2)
+	a.Join(par3, par2)
+
+	if !a.Same(par1, par3) || a.Same(par1, lon) {
+		t.Errorf("Expected only the par30 interfaces to be on the same router")
+	}
+	if device := a.Device(par3); device != "104.44.11.237" {
+		t.Errorf("Expected the router to be named after its lowest address, got %s", device)
+	}
+	if device := a.Device(net.IP{10, 0, 0, 1}); device != "" {
+		t.Errorf("Expected an unknown address to have no device, got %s", device)
+	}
+	if router := a.Router(par1); len(router) != 3 || !router[0].Equal(par2) || !router[2].Equal(par1) {
+		t.Errorf("Expected the par30 router to have 3 interfaces lowest first, got %v", router)
+	}
+	if routers := a.Routers(); len(routers) != 2 || !routers[1][0].Equal(lon) {
+		t.Errorf("Expected 2 routers ordered by their lowest address, got %v", routers)
+	}
+
+	path := Path{net.IP{10, 20, 30, 96}, lon, par1, par3, nil, net.IP{207, 46, 33, 149}}
+	expected := Path{net.IP{10, 20, 30, 96}, lon, par2, nil, net.IP{207, 46, 33, 149}}
+	if routerPath := a.RouterPath(path); !routerPath.Equal(expected) {
+		t.Errorf("Expected the router level path %s, got %s", expected, routerPath)
+	}
+}
+
+func TestAliasesMixedAddressForms(t *testing.T) {
+	a := NewAliases()
+	// ParseIP returns the 16 byte form of an IPv4 address, which must not sort before every 4 byte one
+	high, low := net.ParseIP("104.44.11.240"), net.IP{104, 44, 11, 239}
+	a.Join(high, low)
+	other := net.ParseIP("104.44.18.155")
+	a.Add(other)
+
+	if device := a.Device(high); device != "104.44.11.239" {
+		t.Errorf("Expected the router to be named after its lowest address, got %s", device)
+	}
+	if routers := a.Routers(); len(routers) != 2 || !routers[0][0].Equal(low) || !routers[1][0].Equal(other) {
+		t.Errorf("Expected 2 routers ordered by their lowest address, got %v", routers)
+	}
+}
+
+func ipIDSeries(start time.Time, offset time.Duration, ids ...uint16) []ipIDSample {
+	samples := make([]ipIDSample, len(ids))
+	for idx, id := range ids {
+		samples[idx] = ipIDSample{id: id, at: start.Add(offset + time.Duration(idx)*100*time.Millisecond)}
+	}
+	return samples
+}
+
+func TestSharedCounter(t *testing.T) {
+	start := time.Now()
+
+	// replies to x and y alternate, and their IP-IDs interleave across the wrap of the counter
+	x := ipIDSeries(start, 0, 65500, 65530, 20)
+	y := ipIDSeries(start, 50*time.Millisecond, 65510, 5, 40)
+	if !sharedCounter(x, y, 1000) {
+		t.Errorf("Expected interleaved IP-IDs to share a counter")
+	}
+
+	// separate counters which happen to be close
+	z := ipIDSeries(start, 50*time.Millisecond, 65400, 65420, 65440)
+	if sharedCounter(x, z, 1000) {
+		t.Errorf("Expected IP-IDs which go backwards when merged not to share a counter")
+	}
+
+	constant := ipIDSeries(start, 50*time.Millisecond, 0, 0, 0)
+	if sharedCounter(constant, ipIDSeries(start, 0, 0, 0, 0), 1000) {
+		t.Errorf("Expected routers which don't set the IP-ID not to share a counter")
+	}
+	if sharedCounter(x[:1], y, 1000) {
+		t.Errorf("Expected a single sample not to be enough to compare counters")
+	}
+}
+
+func TestAliasBasePortDoesNotWrap(t *testing.T) {
+	for _, targets := range []int{1, 1000, 40000} {
+		for i := 0; i < 100; i++ {
+			if basePort := aliasBasePort(targets); int(basePort)+targets > 1<<16 {
+				t.Fatalf("Expected the ports of %d targets to fit below 65536, got a base port of %d", targets, basePort)
+			}
+		}
+	}
+}
+
+func TestResolveAliasesRejectsTooManyProbes(t *testing.T) {
+	tc := &TransportChannel{filter: "icmp"}
+	ips := make([]net.IP, 1<<15+1)
+	for idx := range ips {
+		ips[idx] = net.IP{10, 0, byte(idx >> 8), byte(idx)}
+	}
+
+	if _, err := tc.ResolveAliases(ips, WithAliasRounds(2)); err == nil {
+		t.Errorf("Expected more echo requests than 16 bit sequence numbers to be rejected")
+	}
+}
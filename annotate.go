@@ -0,0 +1,420 @@
+package beacon
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Annotation describes the hop at an address.  Fields which an annotator knows nothing about are left empty.
+type Annotation struct {
+	Hostname  string
+	ASN       uint32
+	ASName    string
+	Device    string
+	Interface string
+}
+
+// Name returns the most useful name of the hop, the device and interface from an inventory if there is one, and the
+// hostname otherwise
+func (a Annotation) Name() string {
+	switch {
+	case a.Device != "" && a.Interface != "":
+		return a.Device + " " + a.Interface
+	case a.Device != "":
+		return a.Device
+	}
+	return strings.TrimSuffix(a.Hostname, ".")
+}
+
+// String returns the name of the hop followed by its AS, such as "ibr02.par30 be-6-0 [AS8075 MICROSOFT]"
+func (a Annotation) String() string {
+	s := a.Name()
+	if a.ASN != 0 {
+		as := fmt.Sprintf("AS%d", a.ASN)
+		if a.ASName != "" {
+			as += " " + a.ASName
+		}
+		if s != "" {
+			s += " "
+		}
+		s += "[" + as + "]"
+	}
+	return s
+}
+
+// merge fills in the fields of a which are empty from other
+func (a Annotation) merge(other Annotation) Annotation {
+	if a.Hostname == "" {
+		a.Hostname = other.Hostname
+	}
+	if a.ASN == 0 {
+		a.ASN, a.ASName = other.ASN, other.ASName
+	}
+	if a.Device == "" {
+		a.Device, a.Interface = other.Device, other.Interface
+	}
+	return a
+}
+
+// HopAnnotator annotates the hops of a path.  Annotate may be called concurrently, and is never called for a hop which
+// didn't respond.
+type HopAnnotator interface {
+	Annotate(ip net.IP) Annotation
+}
+
+// HopAnnotatorFunc adapts a function to a HopAnnotator
+type HopAnnotatorFunc func(ip net.IP) Annotation
+
+// Annotate calls f
+func (f HopAnnotatorFunc) Annotate(ip net.IP) Annotation {
+	return f(ip)
+}
+
+// Annotators composes annotators, an earlier annotator wins over a later one for the fields they both fill in
+type Annotators []HopAnnotator
+
+// Annotate runs every annotator on the hop
+func (annotators Annotators) Annotate(ip net.IP) Annotation {
+	var annotation Annotation
+	for _, annotator := range annotators {
+		annotation = annotation.merge(annotator.Annotate(ip))
+	}
+	return annotation
+}
+
+// AnnotationDevices names devices from the annotations of their interfaces, preferring the device of an inventory
+// over the one a hostname implies
+func AnnotationDevices(annotator HopAnnotator) DeviceResolver {
+	return DeviceResolverFunc(func(ip net.IP) string {
+		annotation := annotator.Annotate(ip)
+		if annotation.Device != "" {
+			return annotation.Device
+		}
+		if annotation.Hostname == "" {
+			return ""
+		}
+		return DeviceFromHostname(annotation.Hostname)
+	})
+}
+
+// AnnotatePath annotates every hop of a path concurrently.  Hops which didn't respond get an empty annotation.
+func AnnotatePath(annotator HopAnnotator, path Path) []Annotation {
+	annotations := make([]Annotation, len(path))
+	var wg sync.WaitGroup
+	for idx, hop := range path {
+		if hop == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(idx int, hop net.IP) {
+			defer wg.Done()
+			annotations[idx] = annotator.Annotate(hop)
+		}(idx, hop)
+	}
+	wg.Wait()
+	return annotations
+}
+
+// AnnotatedHop is a hop of a path channel along with its annotation
+type AnnotatedHop struct {
+	IP         net.IP
+	Annotation Annotation
+}
+
+// AnnotatePathChannel annotates the hops of a path channel as they arrive, in order.  The path channel is drained
+// without waiting on annotations, so a slow lookup doesn't hold up the traceroute behind it.
+func AnnotatePathChannel(annotator HopAnnotator, pc PathChannel) <-chan AnnotatedHop {
+	pending := make(chan chan AnnotatedHop, maxHops)
+	annotated := make(chan AnnotatedHop)
+
+	go func() {
+		defer close(pending)
+		for hop := range pc {
+			result := make(chan AnnotatedHop, 1)
+			pending <- result
+			if hop == nil {
+				result <- AnnotatedHop{}
+				continue
+			}
+			go func(hop net.IP) {
+				result <- AnnotatedHop{IP: hop, Annotation: annotator.Annotate(hop)}
+			}(hop)
+		}
+	}()
+
+	go func() {
+		defer close(annotated)
+		for result := range pending {
+			annotated <- <-result
+		}
+	}()
+
+	return annotated
+}
+
+// ReverseDNS annotates hops with the first PTR record of their address.  Lookups are cached for the life of the
+// ReverseDNS, and concurrent lookups of one address share a query.
+type ReverseDNS struct {
+	timeout time.Duration
+
+	lock    sync.Mutex
+	lookups map[string]*ptrLookup
+}
+
+type ptrLookup struct {
+	done     chan struct{}
+	hostname string
+}
+
+// NewReverseDNS creates a ReverseDNS which gives up on a lookup after timeout, zero waits on the resolver
+func NewReverseDNS(timeout time.Duration) *ReverseDNS {
+	return &ReverseDNS{timeout: timeout, lookups: make(map[string]*ptrLookup)}
+}
+
+// Annotate looks up the hostname of the hop
+func (r *ReverseDNS) Annotate(ip net.IP) Annotation {
+	key := ip.String()
+
+	r.lock.Lock()
+	lookup, ok := r.lookups[key]
+	if !ok {
+		lookup = &ptrLookup{done: make(chan struct{})}
+		r.lookups[key] = lookup
+	}
+	r.lock.Unlock()
+
+	if !ok {
+		lookup.hostname = r.lookup(key)
+		close(lookup.done)
+	}
+	<-lookup.done
+	return Annotation{Hostname: lookup.hostname}
+}
+
+func (r *ReverseDNS) lookup(addr string) string {
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	hostnames, err := net.DefaultResolver.LookupAddr(ctx, addr)
+	if err != nil || len(hostnames) == 0 {
+		return ""
+	}
+	return hostnames[0]
+}
+
+// ASNTable annotates hops with the origin AS of the longest prefix which covers them
+type ASNTable struct {
+	v4 *prefixNode
+	v6 *prefixNode
+}
+
+type prefixNode struct {
+	children [2]*prefixNode
+	origin   *asOrigin
+}
+
+type asOrigin struct {
+	asn  uint32
+	name string
+}
+
+// NewASNTable creates an empty ASNTable
+func NewASNTable() *ASNTable {
+	return &ASNTable{v4: &prefixNode{}, v6: &prefixNode{}}
+}
+
+// LoadASNTable reads a prefix table from a file, see ParseASNTable for the format
+func LoadASNTable(path string) (*ASNTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open ASN table: %s", err)
+	}
+	defer f.Close()
+
+	table, err := ParseASNTable(f)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load ASN table %s: %s", path, err)
+	}
+	return table, nil
+}
+
+// ParseASNTable reads a prefix table with one prefix per line, followed by its origin AS and optionally the name of
+// the AS, separated by commas or whitespace:
+//
+//	104.44.0.0/14,8075,MICROSOFT
+//	1.0.0.0/24	13335
+//
+// The second form is the ipasn format which pyasn converts MRT RIB dumps to.  The AS may be prefixed with "AS", and
+// empty lines and lines starting with # are skipped.
+func ParseASNTable(r io.Reader) (*ASNTable, error) {
+	table := NewASNTable()
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var fields []string
+		if strings.Contains(line, ",") {
+			fields = strings.SplitN(line, ",", 3)
+		} else {
+			fields = strings.SplitN(strings.Join(strings.Fields(line), " "), " ", 3)
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected atleast a prefix and an AS, got %q", lineNum, line)
+		}
+
+		_, prefix, err := net.ParseCIDR(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		asField := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(fields[1])), "AS")
+		asn, err := strconv.ParseUint(asField, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid AS %q", lineNum, fields[1])
+		}
+		var name string
+		if len(fields) == 3 {
+			name = strings.TrimSpace(fields[2])
+		}
+		table.Insert(prefix, uint32(asn), name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// Insert adds a prefix originated by an AS, replacing the origin of the prefix if it was already in the table
+func (t *ASNTable) Insert(prefix *net.IPNet, asn uint32, name string) {
+	node, addr := t.root(prefix.IP)
+	ones, _ := prefix.Mask.Size()
+	for bit := 0; bit < ones; bit++ {
+		b := addrBit(addr, bit)
+		if node.children[b] == nil {
+			node.children[b] = &prefixNode{}
+		}
+		node = node.children[b]
+	}
+	node.origin = &asOrigin{asn: asn, name: name}
+}
+
+// Lookup returns the origin AS of the longest prefix covering ip, and false if no prefix does
+func (t *ASNTable) Lookup(ip net.IP) (uint32, string, bool) {
+	node, addr := t.root(ip)
+	var origin *asOrigin
+	for bit := 0; node != nil; bit++ {
+		if node.origin != nil {
+			origin = node.origin
+		}
+		if bit == len(addr)*8 {
+			break
+		}
+		node = node.children[addrBit(addr, bit)]
+	}
+	if origin == nil {
+		return 0, "", false
+	}
+	return origin.asn, origin.name, true
+}
+
+// Annotate looks up the origin AS of the hop
+func (t *ASNTable) Annotate(ip net.IP) Annotation {
+	asn, name, _ := t.Lookup(ip)
+	return Annotation{ASN: asn, ASName: name}
+}
+
+// root returns the trie of the family of ip, along with ip in the length of the family
+func (t *ASNTable) root(ip net.IP) (*prefixNode, net.IP) {
+	if v4 := ip.To4(); v4 != nil {
+		return t.v4, v4
+	}
+	return t.v6, ip.To16()
+}
+
+func addrBit(addr net.IP, bit int) int {
+	return int(addr[bit/8]>>(7-uint(bit%8))) & 1
+}
+
+// InventoryEntry is the device and interface an address is configured on
+type InventoryEntry struct {
+	Device    string
+	Interface string
+}
+
+// Inventory annotates hops with the device and interface names of a network inventory, keyed by address
+type Inventory map[string]InventoryEntry
+
+// LoadInventory reads an inventory from a CSV file, see ParseInventory for the format
+func LoadInventory(path string) (Inventory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open inventory: %s", err)
+	}
+	defer f.Close()
+
+	inventory, err := ParseInventory(f)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load inventory %s: %s", path, err)
+	}
+	return inventory, nil
+}
+
+// ParseInventory reads an inventory from CSV with a row per address of the form ip,device[,interface].  A header row
+// whose first column isn't an address is skipped, as are lines starting with #.
+func ParseInventory(r io.Reader) (Inventory, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	inventory := make(Inventory)
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ip := net.ParseIP(strings.TrimSpace(record[0]))
+		if ip == nil {
+			if row == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("row %d: invalid IP %q", row, record[0])
+		}
+		if len(record) < 2 || strings.TrimSpace(record[1]) == "" {
+			return nil, fmt.Errorf("row %d: expected atleast an IP and a device", row)
+		}
+
+		entry := InventoryEntry{Device: strings.TrimSpace(record[1])}
+		if len(record) > 2 {
+			entry.Interface = strings.TrimSpace(record[2])
+		}
+		inventory[ip.String()] = entry
+	}
+	return inventory, nil
+}
+
+// Annotate looks up the device and interface of the hop
+func (inv Inventory) Annotate(ip net.IP) Annotation {
+	entry := inv[ip.String()]
+	return Annotation{Device: entry.Device, Interface: entry.Interface}
+}
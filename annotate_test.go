@@ -0,0 +1,153 @@
+package beacon
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseASNTable(t *testing.T) {
+	table, err := ParseASNTable(strings.NewReader(`# prefix,asn,name
+104.44.0.0/14,8075,MICROSOFT
+104.44.7.0/24,AS65001,CUSTOMER
+1.0.0.0/24	13335
+2620:1ec::/36 8075
+
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse ASN table: %s", err)
+	}
+
+	cases := []struct {
+		ip   string
+		asn  uint32
+		name string
+		ok   bool
+	}{
+		{"104.44.7.99", 65001, "CUSTOMER", true},
+		{"104.44.17.78", 8075, "MICROSOFT", true},
+		{"104.48.0.1", 0, "", false},
+		{"1.0.0.1", 13335, "", true},
+		{"2620:1ec:c::10", 8075, "", true},
+		{"2001:db8::1", 0, "", false},
+	}
+	for _, c := range cases {
+		asn, name, ok := table.Lookup(net.ParseIP(c.ip))
+		if asn != c.asn || name != c.name || ok != c.ok {
+			t.Errorf("Expected %s to be in AS%d %q (%t), got AS%d %q (%t)", c.ip, c.asn, c.name, c.ok, asn, name, ok)
+		}
+	}
+}
+
+func TestParseASNTableInvalid(t *testing.T) {
+	for _, table := range []string{"104.44.0.0/14", "104.44.0.0,8075", "104.44.0.0/14,MICROSOFT"} {
+		if _, err := ParseASNTable(strings.NewReader(table)); err == nil {
+			t.Errorf("Expected an error parsing %q", table)
+		}
+	}
+}
+
+func TestParseInventory(t *testing.T) {
+	inventory, err := ParseInventory(strings.NewReader(`ip,device,interface
+104.44.7.99,ibr02.ewr30,et-0/0/1
+# decommissioned
+104.44.9.1, ibr01.ewr30
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse inventory: %s", err)
+	}
+
+	if annotation := inventory.Annotate(net.IP{104, 44, 7, 99}); annotation.Name() != "ibr02.ewr30 et-0/0/1" {
+		t.Errorf("Expected 104.44.7.99 to be ibr02.ewr30 et-0/0/1, got %q", annotation.Name())
+	}
+	if annotation := inventory.Annotate(net.IP{104, 44, 9, 1}); annotation.Name() != "ibr01.ewr30" {
+		t.Errorf("Expected 104.44.9.1 to be ibr01.ewr30, got %q", annotation.Name())
+	}
+	if annotation := inventory.Annotate(net.IP{104, 44, 9, 2}); annotation != (Annotation{}) {
+		t.Errorf("Expected 104.44.9.2 not to be annotated, got %+v", annotation)
+	}
+
+	if _, err := ParseInventory(strings.NewReader("ip,device\n104.44.7.99,ibr02.ewr30\nibr01.ewr30,104.44.9.1\n")); err == nil {
+		t.Errorf("Expected an error parsing an inventory with an invalid IP")
+	}
+}
+
+func TestAnnotators(t *testing.T) {
+	hostnames := HopAnnotatorFunc(func(ip net.IP) Annotation {
+		return Annotation{Hostname: "be-6-0.ibr02.ewr30.ntwk.msn.net."}
+	})
+	inventory := Inventory{"104.44.7.99": {Device: "ibr02.ewr30", Interface: "et-0/0/1"}}
+	table := NewASNTable()
+	_, prefix, _ := net.ParseCIDR("104.44.0.0/14")
+	table.Insert(prefix, 8075, "MICROSOFT")
+
+	annotator := Annotators{inventory, table, hostnames}
+	annotation := annotator.Annotate(net.IP{104, 44, 7, 99})
+	if annotation.String() != "ibr02.ewr30 et-0/0/1 [AS8075 MICROSOFT]" {
+		t.Errorf("Expected the inventory name and the AS, got %q", annotation)
+	}
+	if annotation.Hostname != "be-6-0.ibr02.ewr30.ntwk.msn.net." {
+		t.Errorf("Expected the hostname to be kept, got %q", annotation.Hostname)
+	}
+	if annotation := annotator.Annotate(net.IP{104, 44, 9, 1}); annotation.String() != "be-6-0.ibr02.ewr30.ntwk.msn.net [AS8075 MICROSOFT]" {
+		t.Errorf("Expected the hostname and the AS, got %q", annotation)
+	}
+
+	devices := AnnotationDevices(annotator)
+	if device := devices.Device(net.IP{104, 44, 7, 99}); device != "ibr02.ewr30" {
+		t.Errorf("Expected the inventory device, got %q", device)
+	}
+	if device := devices.Device(net.IP{104, 44, 9, 1}); device != "ibr02.ewr30.ntwk.msn.net" {
+		t.Errorf("Expected the device of the hostname, got %q", device)
+	}
+}
+
+func TestAnnotatePathChannel(t *testing.T) {
+	// the first hop is the slowest to annotate, but must still come out first
+	annotator := HopAnnotatorFunc(func(ip net.IP) Annotation {
+		time.Sleep(time.Duration(10-ip[3]) * 5 * time.Millisecond)
+		return Annotation{Device: ip.String()}
+	})
+
+	pc := make(chan net.IP)
+	go func() {
+		pc <- net.IP{10, 0, 0, 1}
+		pc <- nil
+		pc <- net.IP{10, 0, 0, 3}
+		pc <- net.IP{10, 0, 0, 4}
+		close(pc)
+	}()
+
+	var hops []AnnotatedHop
+	for hop := range AnnotatePathChannel(annotator, pc) {
+		hops = append(hops, hop)
+	}
+
+	expected := []string{"10.0.0.1", "", "10.0.0.3", "10.0.0.4"}
+	if len(hops) != len(expected) {
+		t.Fatalf("Expected %d hops, got %+v", len(expected), hops)
+	}
+	for idx, hop := range hops {
+		if hop.Annotation.Device != expected[idx] {
+			t.Errorf("Expected hop %d to be %q, got %q", idx, expected[idx], hop.Annotation.Device)
+		}
+	}
+}
+
+func TestAnnotatePath(t *testing.T) {
+	var calls int32
+	annotator := HopAnnotatorFunc(func(ip net.IP) Annotation {
+		atomic.AddInt32(&calls, 1)
+		return Annotation{Device: ip.String()}
+	})
+
+	annotations := AnnotatePath(annotator, Path{net.IP{10, 0, 0, 1}, nil, net.IP{10, 0, 0, 3}})
+	if annotations[0].Device != "10.0.0.1" || annotations[1] != (Annotation{}) || annotations[2].Device != "10.0.0.3" {
+		t.Errorf("Unexpected annotations %+v", annotations)
+	}
+	if calls != 2 {
+		t.Errorf("Expected the hop which didn't respond not to be annotated, got %d calls", calls)
+	}
+}
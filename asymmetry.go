@@ -0,0 +1,152 @@
+package beacon
+
+import (
+	"net"
+	"strings"
+)
+
+// DeviceResolver names the device an interface address belongs to, so that the different interfaces a router
+// answers from in each direction can be recognized as one router.  Device returns "" for an unknown address.
+type DeviceResolver interface {
+	Device(ip net.IP) string
+}
+
+// DeviceResolverFunc adapts a function to a DeviceResolver
+type DeviceResolverFunc func(ip net.IP) string
+
+// Device calls f
+func (f DeviceResolverFunc) Device(ip net.IP) string {
+	return f(ip)
+}
+
+// ReverseDNSDevices names devices from the PTR records of their interfaces, dropping the first label which names the
+// interface, so be-6-0.ibr02.par30.ntwk.msn.net. is on ibr02.par30.ntwk.msn.net
+var ReverseDNSDevices = AnnotationDevices(NewReverseDNS(0))
+
+// DeviceFromHostname returns the device part of an interface hostname, which is everything after the first label.
+// Hostnames with fewer than 3 labels are returned whole, since they are unlikely to name an interface.
+func DeviceFromHostname(hostname string) string {
+	hostname = strings.TrimSuffix(hostname, ".")
+	labels := strings.Split(hostname, ".")
+	if len(labels) < 3 {
+		return hostname
+	}
+	return strings.Join(labels[1:], ".")
+}
+
+// DirectionalHop aligns a hop of the forward path, in Old, with a hop of the reverse path, in New
+type DirectionalHop struct {
+	HopDiff
+	ForwardDevice string
+	ReverseDevice string
+}
+
+// SameDevice returns whether the hop is on the same device in both directions, either because the addresses are
+// equal or because they resolved to the same device
+func (h DirectionalHop) SameDevice() bool {
+	if h.Op == HopEqual {
+		return true
+	}
+	return h.Op == HopSubstituted && h.ForwardDevice != "" && h.ForwardDevice == h.ReverseDevice
+}
+
+// diverged returns whether the hop differs between the directions, a hop which didn't respond in one direction
+// may not
+func (h DirectionalHop) diverged() bool {
+	switch {
+	case h.Op == HopUnknown:
+		return false
+	case h.Op == HopInserted && h.New == nil, h.Op == HopRemoved && h.Old == nil:
+		return false
+	}
+	return !h.SameDevice()
+}
+
+// Divergence is a stretch of hops over which the forward and reverse paths take different devices
+type Divergence struct {
+	// After is the last hop of the forward path before the paths diverge, nil if they diverge from the start
+	After net.IP
+	// Rejoin is the first hop of the forward path at which the paths meet again, nil if they never do
+	Rejoin net.IP
+	Hops   []DirectionalHop
+}
+
+// AsymmetryReport compares the forward path to a destination with the reverse path back from it
+type AsymmetryReport struct {
+	Forward Path
+	// Reverse is the reverse path turned around to run in the forward direction
+	Reverse Path
+	Hops    []DirectionalHop
+}
+
+// CompareDirections aligns a forward path with a reverse one, which is given as traced from the destination back to
+// the caller.  Interfaces which resolver puts on the same device align with each other, a nil resolver only aligns
+// equal addresses.  Every address is resolved once.
+func CompareDirections(forward, reverse Path, resolver DeviceResolver) AsymmetryReport {
+	report := AsymmetryReport{Forward: forward, Reverse: reverse.Reverse()}
+
+	devices := make(map[string]string)
+	device := func(ip net.IP) string {
+		if resolver == nil || ip == nil {
+			return ""
+		}
+		key := ip.String()
+		if name, ok := devices[key]; ok {
+			return name
+		}
+		devices[key] = resolver.Device(ip)
+		return devices[key]
+	}
+	sameDevice := func(a, b net.IP) bool {
+		if a.Equal(b) {
+			return true
+		}
+		name := device(a)
+		return name != "" && name == device(b)
+	}
+
+	for _, hop := range forward.align(report.Reverse, sameDevice) {
+		directional := DirectionalHop{HopDiff: hop}
+		if hop.Op != HopEqual {
+			directional.ForwardDevice = device(hop.Old)
+			directional.ReverseDevice = device(hop.New)
+		}
+		report.Hops = append(report.Hops, directional)
+	}
+	return report
+}
+
+// Symmetric returns whether both directions cross the same devices, hops which didn't respond aside
+func (r AsymmetryReport) Symmetric() bool {
+	return len(r.Divergences()) == 0
+}
+
+// Divergences returns the stretches of hops over which the directions differ, in forward path order
+func (r AsymmetryReport) Divergences() []Divergence {
+	var divergences []Divergence
+	var current *Divergence
+	var lastCommon net.IP
+	for _, hop := range r.Hops {
+		if hop.diverged() {
+			if current == nil {
+				current = &Divergence{After: lastCommon}
+			}
+			current.Hops = append(current.Hops, hop)
+			continue
+		}
+		if hop.Old == nil || hop.New == nil {
+			// a hop which didn't respond neither ends nor starts a divergence
+			continue
+		}
+		if current != nil {
+			current.Rejoin = hop.Old
+			divergences = append(divergences, *current)
+			current = nil
+		}
+		lastCommon = hop.Old
+	}
+	if current != nil {
+		divergences = append(divergences, *current)
+	}
+	return divergences
+}
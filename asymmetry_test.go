@@ -0,0 +1,65 @@
+package beacon
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDeviceFromHostname(t *testing.T) {
+	cases := map[string]string{
+		"be-6-0.ibr02.par30.ntwk.msn.net.":  "ibr02.par30.ntwk.msn.net",
+		"be-120-0.ibr02.par30.ntwk.msn.net": "ibr02.par30.ntwk.msn.net",
+		"router.example":                    "router.example",
+	}
+	for hostname, expected := range cases {
+		if device := DeviceFromHostname(hostname); device != expected {
+			t.Errorf("Expected %s to be on %s, got %s", hostname, expected, device)
+		}
+	}
+}
+
+func TestCompareDirections(t *testing.T) {
+	source := net.IP{10, 20, 30, 96}
+	dest := net.IP{207, 46, 33, 149}
+	devices := map[string]string{
+		"104.44.17.78":  "ibr02.par30",
+		"104.44.11.237": "ibr02.par30",
+		"104.44.7.104":  "ibr02.nyc30",
+		"104.44.18.154": "ibr02.nyc30",
+		"104.44.7.99":   "ibr02.ewr30",
+		"104.44.9.1":    "ibr01.ewr30",
+	}
+	resolver := DeviceResolverFunc(func(ip net.IP) string { return devices[ip.String()] })
+
+	forward := Path{source, net.IP{104, 44, 7, 99}, net.IP{104, 44, 7, 104}, net.IP{104, 44, 17, 78}, dest}
+	// traced from the destination back, through a different router in ewr30
+	reverse := Path{dest, net.IP{104, 44, 11, 237}, net.IP{104, 44, 18, 154}, net.IP{104, 44, 9, 1}, source}
+
+	report := CompareDirections(forward, reverse, resolver)
+	if report.Symmetric() {
+		t.Errorf("Expected the paths to be asymmetric")
+	}
+
+	divergences := report.Divergences()
+	if len(divergences) != 1 {
+		t.Fatalf("Expected a single divergence, got %+v", divergences)
+	}
+	divergence := divergences[0]
+	if !divergence.After.Equal(source) || !divergence.Rejoin.Equal(net.IP{104, 44, 7, 104}) {
+		t.Errorf("Expected the paths to diverge after %s and rejoin at 104.44.7.104, got %s and %s", source, divergence.After, divergence.Rejoin)
+	}
+	if len(divergence.Hops) != 1 || divergence.Hops[0].ForwardDevice != "ibr02.ewr30" || divergence.Hops[0].ReverseDevice != "ibr01.ewr30" {
+		t.Errorf("Expected ibr02.ewr30 to be taken forward and ibr01.ewr30 in reverse, got %+v", divergence.Hops)
+	}
+
+	// without the detour through ibr01.ewr30 every router is the same in both directions, or didn't respond
+	reverse = Path{dest, net.IP{104, 44, 11, 237}, nil, net.IP{104, 44, 7, 98}, source}
+	devices["104.44.7.98"] = "ibr02.ewr30"
+	report = CompareDirections(forward, reverse, resolver)
+	if !report.Symmetric() {
+		t.Errorf("Expected the paths to cross the same routers, got %+v", report.Divergences())
+	}
+	if CompareDirections(forward, reverse, nil).Symmetric() {
+		t.Errorf("Expected the paths to differ without a resolver to match the interfaces")
+	}
+}
@@ -0,0 +1,168 @@
+package beacon
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// batchSendAttempts is how many times in a row a batch is sent without any packet going out before the first of its
+// packets is failed, so that a socket which keeps returning EAGAIN or nothing can't stall a flush forever
+const batchSendAttempts = 16
+
+// TxBatch queues packets and sends them with as few syscalls as the platform allows, on linux this is one sendmmsg
+// per address family.  A TxBatch is not safe for concurrent use, but many batches may share one TransportChannel.
+type TxBatch struct {
+	tc      *TransportChannel
+	packets []batchedPacket
+	errs    []error
+	buffers sendBuffers
+
+	// the transmit timestamp of each packet of the last flush, and where to collect kernel timestamps from
+	stamps       []txTimestamp
+	ids          []uint32
+	timestampers []*txTimestamper
+}
+
+type batchedPacket struct {
+	data []byte
+	dest net.IP
+}
+
+// NewTxBatch returns an empty batch with room for size packets before it needs to grow
+func (tc *TransportChannel) NewTxBatch(size int) *TxBatch {
+	return &TxBatch{
+		tc:      tc,
+		packets: make([]batchedPacket, 0, size),
+	}
+}
+
+// Queue adds a packet to the batch and returns its index in the slice of errors returned by Flush.
+// The packet data must not be modified until the batch is flushed.
+func (b *TxBatch) Queue(packetData []byte, destAddr net.IP) int {
+	b.packets = append(b.packets, batchedPacket{data: packetData, dest: destAddr})
+	return len(b.packets) - 1
+}
+
+// Len returns the number of packets waiting to be flushed
+func (b *TxBatch) Len() int {
+	return len(b.packets)
+}
+
+// Flush sends every queued packet and empties the batch.  The returned slice holds the error for each packet in the
+// order they were queued, nil if it was sent.  It is only valid until the next call to Flush.  If the TransportChannel
+// collects kernel transmit timestamps, Flush waits for them before returning, see Timestamp.
+func (b *TxBatch) Flush() []error {
+	n := len(b.packets)
+	if cap(b.errs) < n {
+		b.errs = make([]error, n)
+		b.stamps = make([]txTimestamp, n)
+		b.ids = make([]uint32, n)
+		b.timestampers = make([]*txTimestamper, n)
+	}
+	b.errs, b.stamps = b.errs[:n], b.stamps[:n]
+	b.ids, b.timestampers = b.ids[:n], b.timestampers[:n]
+	for idx := range b.errs {
+		b.errs[idx] = nil
+		b.timestampers[idx] = nil
+	}
+
+	var v4, v6 []int
+	for idx, packet := range b.packets {
+		if packet.dest.To4() != nil {
+			v4 = append(v4, idx)
+		} else {
+			v6 = append(v6, idx)
+		}
+	}
+
+	if len(v4) > 0 {
+		b.send(v4, func() (int, *txTimestamper) { return b.tc.sharedSocket(false) }, b.tc.socketFailureMsgQueue)
+	}
+	if len(v6) > 0 {
+		b.send(v6, func() (int, *txTimestamper) { return b.tc.sharedSocket(true) }, b.tc.socket6FailureMsgQueue)
+	}
+
+	b.collectTimestamps(txTimestampTimeout)
+
+	for idx := range b.packets {
+		b.packets[idx] = batchedPacket{}
+	}
+	b.packets = b.packets[:0]
+
+	return b.errs
+}
+
+// collectTimestamps waits for the kernel timestamps of the packets of the flush.  The whole batch shares one deadline,
+// so lost timestamps delay the flush by timeout at most, however many packets they are lost for.
+func (b *TxBatch) collectTimestamps(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for idx, timestamper := range b.timestampers {
+		if timestamper == nil {
+			continue
+		}
+		if stamp, ok := timestamper.wait(b.ids[idx], time.Until(deadline)); ok {
+			b.stamps[idx] = stamp
+		}
+	}
+}
+
+// Timestamp returns the time the packet in the given slot of the last flush was sent, and the clock it was taken from
+func (b *TxBatch) Timestamp(idx int) (time.Time, TimestampSource) {
+	return b.stamps[idx].ts, b.stamps[idx].source
+}
+
+// send sends the packets at the given indices of the batch, all of one address family.  A packet which fails to send
+// is skipped and the rest are retried, after asking for the socket to be renewed like SendTo does.  A packet which
+// can't be sent after batchSendAttempts interrupted or empty sends is skipped too.
+func (b *TxBatch) send(indices []int, socket func() (int, *txTimestamper), failures chan int) {
+	attempts := 0
+	for len(indices) > 0 {
+		socketFD, timestamper := socket()
+
+		var sent int
+		var first uint32
+		var err error
+		if timestamper != nil {
+			socketFD = timestamper.fd
+			first, sent, err = timestamper.send(true, func() (int, error) {
+				return b.buffers.sendmmsg(socketFD, b.packets, indices)
+			})
+		} else {
+			sent, err = b.buffers.sendmmsg(socketFD, b.packets, indices)
+		}
+
+		now := time.Now().UTC()
+		for i, idx := range indices[:sent] {
+			b.stamps[idx] = txTimestamp{ts: now, source: UserspaceTimestamp}
+			if timestamper != nil {
+				b.ids[idx] = first + uint32(i)
+				b.timestampers[idx] = timestamper
+			}
+		}
+		indices = indices[sent:]
+		if err != nil && err != syscall.EINTR && err != syscall.EAGAIN {
+			if len(indices) > 0 {
+				b.errs[indices[0]] = fmt.Errorf("Failed to send batched packetData to socket %d: %s", socketFD, err)
+				indices = indices[1:]
+			}
+			failures <- socketFD
+			continue
+		}
+
+		if sent > 0 {
+			attempts = 0
+			continue
+		}
+		attempts++
+		if attempts >= batchSendAttempts {
+			if err == nil {
+				err = fmt.Errorf("no packets were sent")
+			}
+			b.errs[indices[0]] = fmt.Errorf("Failed to send batched packetData to socket %d after %d attempts: %s", socketFD, attempts, err)
+			indices = indices[1:]
+			attempts = 0
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package beacon
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// newBatchTestTransportChannel returns a TransportChannel with only its raw sockets set up, skipping the test if the
+// sockets can't be created without privileges
+func newBatchTestTransportChannel(t *testing.T, timestamps TimestampSource) *TransportChannel {
+	tc := &TransportChannel{
+		socketFailureMsgQueue:  make(chan int, 16),
+		socket6FailureMsgQueue: make(chan int, 16),
+		timestampSource:        timestamps,
+	}
+	if _, err := tc.setupSocket("IPv4"); err != nil {
+		t.Skipf("Skipping, raw sockets are unavailable: %s", err)
+	}
+	if _, err := tc.setupSocket("IPv6"); err != nil {
+		syscall.Close(tc.socketFD)
+		t.Skipf("Skipping, raw sockets are unavailable: %s", err)
+	}
+	return tc
+}
+
+func createTestUDPPacket(t *testing.T, dst *net.UDPAddr, payload []byte) []byte {
+	ip := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IP{127, 0, 0, 1},
+		DstIP:    dst.IP.To4(),
+	}
+	udp := &layers.UDP{SrcPort: 33434, DstPort: layers.UDPPort(dst.Port)}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatalf("Failed to serialize udp packet: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestTxBatchFlush(t *testing.T) {
+	tc := newBatchTestTransportChannel(t, UserspaceTimestamp)
+	defer syscall.Close(tc.socketFD)
+	defer syscall.Close(tc.socket6FD)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatalf("Failed to listen on udp: %s", err)
+	}
+	defer conn.Close()
+	dst := conn.LocalAddr().(*net.UDPAddr)
+
+	batch := tc.NewTxBatch(4)
+	payloads := []string{"one", "two", "three"}
+	for idx, payload := range payloads {
+		if slot := batch.Queue(createTestUDPPacket(t, dst, []byte(payload)), dst.IP); slot != idx {
+			t.Errorf("Expected packet %d to be queued in slot %d, got %d", idx, idx, slot)
+		}
+	}
+	if batch.Len() != len(payloads) {
+		t.Errorf("Expected %d queued packets, got %d", len(payloads), batch.Len())
+	}
+
+	errs := batch.Flush()
+	if len(errs) != len(payloads) {
+		t.Fatalf("Expected %d errors, got %d", len(payloads), len(errs))
+	}
+	for idx, err := range errs {
+		if err != nil {
+			t.Errorf("Failed to send packet %d: %s", idx, err)
+		}
+	}
+	if batch.Len() != 0 {
+		t.Errorf("Expected batch to be empty after flush, got %d packets", batch.Len())
+	}
+
+	received := map[string]bool{}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for range payloads {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Failed to receive batched packet: %s", err)
+		}
+		received[string(buf[:n])] = true
+	}
+	for _, payload := range payloads {
+		if !received[payload] {
+			t.Errorf("Packet with payload %q was not received", payload)
+		}
+	}
+}
+
+func TestTxBatchFlushReportsPerPacketErrors(t *testing.T) {
+	tc := newBatchTestTransportChannel(t, UserspaceTimestamp)
+	defer syscall.Close(tc.socketFD)
+	defer syscall.Close(tc.socket6FD)
+
+	dst := &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 9}
+	batch := tc.NewTxBatch(3)
+	good := batch.Queue(createTestUDPPacket(t, dst, []byte("ok")), dst.IP)
+	// a packet too short to hold an IP header is rejected by the kernel
+	bad := batch.Queue([]byte{0x45}, dst.IP)
+	after := batch.Queue(createTestUDPPacket(t, dst, []byte("ok")), dst.IP)
+
+	errs := batch.Flush()
+	if errs[good] != nil || errs[after] != nil {
+		t.Errorf("Expected valid packets around a bad one to be sent, got %v", errs)
+	}
+	if errs[bad] == nil {
+		t.Errorf("Expected an error for the truncated packet")
+	}
+}
+
+func TestTxBatchCollectTimestampsSharesDeadline(t *testing.T) {
+	timestamper := &txTimestamper{waiters: make(map[uint32]chan txTimestamp), source: KernelTimestamp}
+	if _, _, err := timestamper.send(true, func() (int, error) { return 3, nil }); err != nil {
+		t.Fatalf("Failed to register waiters: %s", err)
+	}
+	sent := time.Now()
+	timestamper.deliver(2, txTimestamp{ts: sent, source: KernelTimestamp})
+
+	b := &TxBatch{
+		stamps:       make([]txTimestamp, 3),
+		ids:          []uint32{0, 1, 2},
+		timestampers: []*txTimestamper{timestamper, timestamper, timestamper},
+	}
+	timeout := 50 * time.Millisecond
+	start := time.Now()
+	b.collectTimestamps(timeout)
+	if elapsed := time.Since(start); elapsed >= 2*timeout {
+		t.Errorf("Expected the lost timestamps to share one deadline, waited %s", elapsed)
+	}
+	if !b.stamps[2].ts.Equal(sent) {
+		t.Errorf("Expected the delivered timestamp after the deadline passed, got %v", b.stamps[2].ts)
+	}
+	if !b.stamps[0].ts.IsZero() || !b.stamps[1].ts.IsZero() {
+		t.Errorf("Expected no timestamps for the lost packets, got %v and %v", b.stamps[0].ts, b.stamps[1].ts)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+
+	"github.com/trstruth/beacon"
+)
+
+var noDNS bool
+var asnTable string
+var inventory string
+
+// dnsTimeout is how long a hop waits on its PTR record before it is printed without one
+const dnsTimeout = 2 * time.Second
+
+var annotator beacon.HopAnnotator
+
+// hopAnnotator returns the annotator selected by the flags, the inventory winning over reverse DNS for the name of a
+// hop.  The tables are loaded on the first call.
+func hopAnnotator() (beacon.HopAnnotator, error) {
+	if annotator != nil {
+		return annotator, nil
+	}
+
+	var annotators beacon.Annotators
+	if inventory != "" {
+		inv, err := beacon.LoadInventory(inventory)
+		if err != nil {
+			return nil, err
+		}
+		annotators = append(annotators, inv)
+	}
+	if asnTable != "" {
+		table, err := beacon.LoadASNTable(asnTable)
+		if err != nil {
+			return nil, err
+		}
+		annotators = append(annotators, table)
+	}
+	if !noDNS {
+		annotators = append(annotators, beacon.NewReverseDNS(dnsTimeout))
+	}
+	annotator = annotators
+	return annotator, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+	"github.com/trstruth/beacon"
+)
+
+var resolveAliases bool
+
+// AsymmetryCmd represents the asymmetry subcommand which compares the forward and reverse paths to a destination
+var AsymmetryCmd = &cobra.Command{
+	Use:   "asymmetry <dest>",
+	Short: "trace the forward and reverse paths to a destination at the same time, and report where they diverge",
+	Long: `trace the path to a destination and, with IP in IP, the path back from it at the same time.  the reverse path
+is aligned against the forward one, and interfaces which reverse DNS or the --inventory put on the same router are matched, since routers
+answer from a different interface in each direction.  with --aliases the interfaces are instead grouped into routers
+by probing them, see the --routers flag of the root command.`,
+	Args: cobra.ExactArgs(1),
+	RunE: asymmetryRun,
+}
+
+func initAsymmetry() {
+	AsymmetryCmd.Flags().BoolVar(&resolveAliases, "aliases", false, "match the interfaces which alias resolution puts on the same router, instead of reverse DNS")
+}
+
+func asymmetryRun(cmd *cobra.Command, args []string) error {
+	destIP, err := beacon.ParseIPFromString(args[0])
+	if err != nil {
+		return err
+	}
+	if interfaceDevice == "" {
+		discoveredOutboundInterface, err := network().GetInterfaceDeviceFromDestIP(destIP)
+		if err != nil {
+			return fmt.Errorf("Failed to find an interface for %s: %s, explicitly provide an interface with -i", destIP.String(), err)
+		}
+		interfaceDevice = discoveredOutboundInterface
+	}
+
+	tc, err := beacon.NewTransportChannel(
+		beacon.WithBPFFilter("icmp"),
+		beacon.WithHasher(beacon.V4TraceRouteHasher{}),
+		beacon.WithHasher(beacon.V6TraceRouteHasher{}),
+		beacon.WithInterface(interfaceDevice),
+		beacon.WithNetworkContext(network()),
+	)
+	if err != nil {
+		return fmt.Errorf("Error creating transport channel: %s", err)
+	}
+	defer tc.Close()
+
+	sourceIP, err := tc.SourceFor(destIP)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Tracing the paths to and from %s\n", destIP)
+
+	type traced struct {
+		path beacon.Path
+		err  error
+	}
+	forwardDone := make(chan traced, 1)
+	reverseDone := make(chan traced, 1)
+	go func() {
+		path, err := tc.GetPathTo(destIP, timeout)
+		forwardDone <- traced{path, err}
+	}()
+	go func() {
+		// the reverse traceroute takes its timeout in milliseconds
+		path, err := tc.GetPathFrom(destIP, timeout*1000)
+		reverseDone <- traced{path, err}
+	}()
+
+	forward, reverse := <-forwardDone, <-reverseDone
+	if forward.err != nil {
+		return fmt.Errorf("Failed to trace the path to %s: %s", destIP, forward.err)
+	}
+	if reverse.err != nil {
+		return fmt.Errorf("Failed to trace the path from %s: %s", destIP, reverse.err)
+	}
+
+	forwardPath := withEndpoints(trimTimeouts(forward.path), sourceIP, destIP)
+	reversePath := withEndpoints(trimTimeouts(reverse.path), destIP, sourceIP)
+
+	var resolver beacon.DeviceResolver
+	switch {
+	case resolveAliases:
+		hops := append(beacon.Path{}, forwardPath...)
+		aliases, err := tc.ResolveAliases(append(hops, reversePath...))
+		if err != nil {
+			return fmt.Errorf("Failed to resolve aliases: %s", err)
+		}
+		resolver = aliases
+	case !noDNS || inventory != "":
+		annotator, err := hopAnnotator()
+		if err != nil {
+			return err
+		}
+		resolver = beacon.AnnotationDevices(annotator)
+	}
+	fmt.Print(asymmetryString(beacon.CompareDirections(forwardPath, reversePath, resolver)))
+	return nil
+}
+
+// trimTimeouts drops the hops which didn't respond from the end of a path, which a traceroute reports until it gives
+// up on a destination which doesn't answer
+func trimTimeouts(path beacon.Path) beacon.Path {
+	for len(path) > 0 && path[len(path)-1] == nil {
+		path = path[:len(path)-1]
+	}
+	return path
+}
+
+// withEndpoints makes a traced path start at from and end at to, if it doesn't already
+func withEndpoints(path beacon.Path, from, to net.IP) beacon.Path {
+	if len(path) == 0 || !path[0].Equal(from) {
+		path = append(beacon.Path{from}, path...)
+	}
+	if !path[len(path)-1].Equal(to) {
+		path = append(path, to)
+	}
+	return path
+}
@@ -8,6 +8,11 @@ import (
 func init() {
 	initRoot()
 	initProbe()
+	initServe()
+	initMonitor()
+	initHistory()
+	initDiff()
+	initAsymmetry()
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
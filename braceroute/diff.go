@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/trstruth/beacon"
+)
+
+var reverseNew bool
+
+// DiffCmd represents the diff subcommand which aligns two paths side by side
+var DiffCmd = &cobra.Command{
+	Use:   "diff <old path> <new path>",
+	Short: "align two paths side by side, and show the hops which were inserted, removed or substituted",
+	Long: `align two comma separated lists of hops, such as the output of traceroute before and after a maintenance.
+hops which didn't respond are written as * and may match any hop.  with -R the new path is reversed first, to
+compare a reverse traceroute with a forward one.`,
+	Args: cobra.ExactArgs(2),
+	RunE: diffRun,
+}
+
+func initDiff() {
+	DiffCmd.Flags().BoolVarP(&reverseNew, "reverse-new", "R", false, "reverse the new path before aligning it")
+}
+
+func diffRun(cmd *cobra.Command, args []string) error {
+	oldPath, err := parseTracedPath(args[0])
+	if err != nil {
+		return err
+	}
+	newPath, err := parseTracedPath(args[1])
+	if err != nil {
+		return err
+	}
+	if reverseNew {
+		newPath = newPath.Reverse()
+	}
+
+	cmd.Print(pathDiffString(oldPath, newPath))
+	return nil
+}
+
+// parseTracedPath parses a comma separated list of hops in which a hop that didn't respond is "*"
+func parseTracedPath(hops string) (beacon.Path, error) {
+	hopStrings := strings.Split(hops, ",")
+	path := make(beacon.Path, len(hopStrings))
+	for idx, hop := range hopStrings {
+		hop = strings.TrimSpace(hop)
+		if hop == "*" {
+			continue
+		}
+		ipAddr, err := beacon.ParseIPFromString(hop)
+		if err != nil {
+			return nil, err
+		}
+		path[idx] = ipAddr
+	}
+	return path, nil
+}
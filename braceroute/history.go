@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/trstruth/beacon/history"
+)
+
+var historyAt string
+
+// HistoryCmd represents the history subcommand which queries the path history recorded by monitor --history
+var HistoryCmd = &cobra.Command{
+	Use:   "history <db> [target]",
+	Short: "show the path history recorded by monitor --history",
+	Long: `list the targets of a path history, or the distinct paths and path changes of a target, or with --at the path
+of a target at a time.  the history of a running monitor is served on its /history endpoint instead, since the
+database can only be opened by one process at a time.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: historyRun,
+}
+
+func initHistory() {
+	HistoryCmd.Flags().StringVar(&historyAt, "at", "", "RFC 3339 time to show the path of the target at")
+}
+
+func historyRun(cmd *cobra.Command, args []string) error {
+	store, err := history.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if len(args) == 1 {
+		targets, err := store.Targets()
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			fmt.Println(target)
+		}
+		return nil
+	}
+	target := args[1]
+
+	if historyAt != "" {
+		at, err := time.Parse(time.RFC3339, historyAt)
+		if err != nil {
+			return err
+		}
+		run, ok, err := store.PathAt(target, at)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("No path of %s was recorded at or before %s", target, historyAt)
+		}
+		fmt.Printf("%s (seen from %s to %s)\n", run.Path, formatTime(run.FirstSeen), formatTime(run.LastSeen))
+		return nil
+	}
+
+	paths, err := store.Paths(target)
+	if err != nil {
+		return err
+	}
+	changes, err := store.Changes(target, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	fmt.Print(historyString(target, paths, changes))
+	return nil
+}
+
+func historyString(target string, paths []history.PathRecord, changes []history.Change) string {
+	tableString := &strings.Builder{}
+	tableString.WriteString(fmt.Sprintf("%d distinct paths to %s\n\n", len(paths), target))
+
+	rows := make([][]string, len(paths))
+	for idx, record := range paths {
+		rows[idx] = []string{
+			formatTime(record.FirstSeen),
+			formatTime(record.LastSeen),
+			fmt.Sprintf("%d", record.Runs),
+			record.Path.String(),
+		}
+	}
+
+	table := newTable(tableString, []string{"first seen", "last seen", "runs", "path"})
+	table.AppendBulk(rows)
+	table.Render()
+
+	if len(changes) > 0 {
+		tableString.WriteString("\nchanges:\n")
+	}
+	for _, change := range changes {
+		tableString.WriteString(fmt.Sprintf("%s %s\n", formatTime(change.Time), change))
+	}
+	return tableString.String()
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format(time.RFC3339)
+}
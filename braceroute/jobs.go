@@ -0,0 +1,476 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trstruth/beacon"
+)
+
+// the kinds of job the daemon runs
+const (
+	tracerouteJob        = "traceroute"
+	reverseTracerouteJob = "reverse_traceroute"
+	probeJob             = "probe"
+)
+
+// the states a job moves through
+const (
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+var errTooManyJobs = errors.New("too many jobs are running, try again later")
+
+// jobRequest is the body of a request to start a job
+type jobRequest struct {
+	Type string `json:"type"`
+	// Dest is the destination of a traceroute, or of the path to discover and probe if Path is empty
+	Dest string `json:"dest,omitempty"`
+	// Source is the address a traceroute is sent from, other jobs reject it
+	Source string `json:"source,omitempty"`
+	// Path is the list of hops to probe, starting with the source
+	Path       []string `json:"path,omitempty"`
+	NumPackets int      `json:"num_packets,omitempty"`
+	Timeout    int      `json:"timeout,omitempty"`
+	Batch      bool     `json:"batch,omitempty"`
+}
+
+// jobResult is one result streamed by a job, a hop of a traceroute or one probe
+type jobResult struct {
+	Hop         int     `json:"hop,omitempty"`
+	IP          string  `json:"ip,omitempty"`
+	Mode        string  `json:"mode,omitempty"`
+	Success     *bool   `json:"success,omitempty"`
+	RTTMs       float64 `json:"rtt_ms,omitempty"`
+	RxInterface string  `json:"rx_interface,omitempty"`
+	TxInterface string  `json:"tx_interface,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// probeSummary is the loss of each hop of a probe job, and where it was localized
+type probeSummary struct {
+	Path    []string     `json:"path"`
+	Hops    []hopSummary `json:"hops"`
+	Verdict string       `json:"verdict,omitempty"`
+}
+
+type hopSummary struct {
+	IP       string `json:"ip"`
+	Sent     int    `json:"sent"`
+	Received int    `json:"received"`
+}
+
+// jobStatus is the state of a job as reported by the API
+type jobStatus struct {
+	ID       string        `json:"id"`
+	Request  jobRequest    `json:"request"`
+	State    string        `json:"state"`
+	Error    string        `json:"error,omitempty"`
+	Created  time.Time     `json:"created"`
+	Finished *time.Time    `json:"finished,omitempty"`
+	Results  []jobResult   `json:"results,omitempty"`
+	Summary  *probeSummary `json:"summary,omitempty"`
+}
+
+type job struct {
+	sync.Mutex
+	id       string
+	request  jobRequest
+	state    string
+	err      error
+	created  time.Time
+	finished time.Time
+	results  []jobResult
+	summary  *probeSummary
+	// updated is closed and replaced whenever a result is added or the job finishes
+	updated chan struct{}
+	cancel  chan struct{}
+}
+
+func (j *job) canceled() bool {
+	select {
+	case <-j.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// add records a result, unless the job was canceled
+func (j *job) add(result jobResult) {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.state != jobRunning {
+		return
+	}
+	j.results = append(j.results, result)
+	close(j.updated)
+	j.updated = make(chan struct{})
+}
+
+func (j *job) finish(err error) {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.state != jobRunning {
+		return
+	}
+	j.state = jobDone
+	if err != nil {
+		j.state = jobFailed
+		j.err = err
+	}
+	j.finished = time.Now()
+	close(j.updated)
+	j.updated = make(chan struct{})
+}
+
+// since returns the results from index on, whether the job has finished, and a channel closed on the next update
+func (j *job) since(index int) ([]jobResult, bool, <-chan struct{}) {
+	j.Lock()
+	defer j.Unlock()
+
+	var results []jobResult
+	if index < len(j.results) {
+		results = append(results, j.results[index:]...)
+	}
+	return results, j.state != jobRunning, j.updated
+}
+
+func (j *job) status(withResults bool) jobStatus {
+	j.Lock()
+	defer j.Unlock()
+
+	status := jobStatus{
+		ID:      j.id,
+		Request: j.request,
+		State:   j.state,
+		Created: j.created,
+		Summary: j.summary,
+	}
+	if j.err != nil {
+		status.Error = j.err.Error()
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		status.Finished = &finished
+	}
+	if withResults {
+		status.Results = append(status.Results, j.results...)
+	}
+	return status
+}
+
+// jobManager runs jobs on one shared TransportChannel, at most as many at a time as slots has room for, and
+// remembers the last maxFinished jobs which finished.  The slots may be shared with the gRPC server.
+type jobManager struct {
+	sync.Mutex
+	tc          *beacon.TransportChannel
+	jobs        map[string]*job
+	slots       chan struct{}
+	maxFinished int
+	maxPackets  int
+	timeout     int
+}
+
+func newJobManager(tc *beacon.TransportChannel, slots chan struct{}, maxFinished, maxPackets, timeout int) *jobManager {
+	return &jobManager{
+		tc:          tc,
+		jobs:        make(map[string]*job),
+		slots:       slots,
+		maxFinished: maxFinished,
+		maxPackets:  maxPackets,
+		timeout:     timeout,
+	}
+}
+
+// start validates a request and starts running it
+func (m *jobManager) start(request jobRequest) (*job, error) {
+	if request.Timeout <= 0 {
+		request.Timeout = m.timeout
+	}
+	if request.NumPackets <= 0 {
+		request.NumPackets = 30
+	}
+	run, err := m.runner(request)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		return nil, errTooManyJobs
+	}
+
+	m.Lock()
+	j := &job{
+		id:      uuid.New().String(),
+		request: request,
+		state:   jobRunning,
+		created: time.Now(),
+		updated: make(chan struct{}),
+		cancel:  make(chan struct{}),
+	}
+	m.jobs[j.id] = j
+	m.Unlock()
+
+	go func() {
+		err := run(j)
+		j.finish(err)
+
+		<-m.slots
+		m.Lock()
+		m.evictFinished()
+		m.Unlock()
+	}()
+
+	return j, nil
+}
+
+// runner returns the function which runs a request, or an error if the request is invalid
+func (m *jobManager) runner(request jobRequest) (func(*job) error, error) {
+	switch request.Type {
+	case tracerouteJob, reverseTracerouteJob:
+		if request.Dest == "" {
+			return nil, fmt.Errorf("a %s job requires a dest", request.Type)
+		}
+		destIP, err := beacon.ParseIPFromString(request.Dest)
+		if err != nil {
+			return nil, err
+		}
+		var sourceIP net.IP
+		if request.Source != "" && request.Type == reverseTracerouteJob {
+			return nil, fmt.Errorf("a %s job can't take a source, the path always comes back to this host", request.Type)
+		}
+		if request.Source != "" {
+			if sourceIP, err = beacon.ParseIPFromString(request.Source); err != nil {
+				return nil, err
+			}
+		}
+		if request.Type == reverseTracerouteJob {
+			return func(j *job) error { return m.runReverseTraceroute(j, destIP) }, nil
+		}
+		return func(j *job) error { return m.runTraceroute(j, destIP, sourceIP) }, nil
+
+	case probeJob:
+		if (request.Dest == "") == (len(request.Path) == 0) {
+			return nil, fmt.Errorf("a probe job requires exactly one of a dest or a path")
+		}
+		if request.Source != "" {
+			return nil, fmt.Errorf("a probe job can't take a source, a path starts with its source")
+		}
+		if request.NumPackets > m.maxPackets {
+			return nil, fmt.Errorf("a probe job may send at most %d packets per hop, got %d", m.maxPackets, request.NumPackets)
+		}
+		var path beacon.Path
+		for _, hop := range request.Path {
+			hopIP, err := beacon.ParseIPFromString(hop)
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, hopIP)
+		}
+		if request.Dest != "" {
+			destIP, err := beacon.ParseIPFromString(request.Dest)
+			if err != nil {
+				return nil, err
+			}
+			return func(j *job) error { return m.runProbe(j, nil, destIP) }, nil
+		}
+		if len(path) < 2 {
+			return nil, fmt.Errorf("a probe path must have atleast 2 hops")
+		}
+		return func(j *job) error { return m.runProbe(j, path, nil) }, nil
+	}
+
+	return nil, fmt.Errorf("unknown job type %q, expected %s, %s or %s", request.Type, tracerouteJob, reverseTracerouteJob, probeJob)
+}
+
+// get returns the job with the given id
+func (m *jobManager) get(id string) (*job, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// list returns the status of every job, oldest first
+func (m *jobManager) list() []jobStatus {
+	m.Lock()
+	jobs := make([]*job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	m.Unlock()
+
+	statuses := make([]jobStatus, len(jobs))
+	for idx, j := range jobs {
+		statuses[idx] = j.status(false)
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Created.Before(statuses[k].Created) })
+	return statuses
+}
+
+// cancel stops a running job from sending any more packets and recording their results.  Returns false if the job
+// had already finished.
+func (m *jobManager) cancel(j *job) bool {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.state != jobRunning {
+		return false
+	}
+	j.state = jobCanceled
+	j.finished = time.Now()
+	close(j.cancel)
+	close(j.updated)
+	j.updated = make(chan struct{})
+	return true
+}
+
+// evictFinished forgets the oldest finished jobs beyond maxFinished, the lock must be held
+func (m *jobManager) evictFinished() {
+	var finished []*job
+	for _, j := range m.jobs {
+		if j.status(false).Finished != nil {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= m.maxFinished {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool { return finished[i].finished.Before(finished[k].finished) })
+	for _, j := range finished[:len(finished)-m.maxFinished] {
+		delete(m.jobs, j.id)
+	}
+}
+
+// drainPath consumes a PathChannel into a job.  After the job is canceled the hop in flight is still consumed, until
+// the traceroute stops and closes the channel.
+func drainPath(j *job, pc beacon.PathChannel) {
+	hopIdx := 1
+	for hop := range pc {
+		result := jobResult{Hop: hopIdx}
+		if hop != nil {
+			result.IP = hop.String()
+		}
+		hopIdx++
+		if !j.canceled() {
+			j.add(result)
+		}
+	}
+}
+
+func (m *jobManager) runTraceroute(j *job, destIP, sourceIP net.IP) error {
+	pc, err := m.tc.GetPathChannelTo(destIP, sourceIP, j.request.Timeout, beacon.WithTracerouteStop(j.cancel))
+	if err != nil {
+		return err
+	}
+	drainPath(j, pc)
+	return nil
+}
+
+func (m *jobManager) runReverseTraceroute(j *job, destIP net.IP) error {
+	// GetPathChannelFrom waits on each hop for timeout milliseconds
+	pc, err := m.tc.GetPathChannelFrom(destIP, j.request.Timeout*1000, beacon.WithTracerouteStop(j.cancel))
+	if err != nil {
+		return err
+	}
+	drainPath(j, pc)
+	return nil
+}
+
+func (m *jobManager) runProbe(j *job, path beacon.Path, destIP net.IP) error {
+	if path == nil {
+		sourceIP, err := m.tc.SourceFor(destIP)
+		if err != nil {
+			return err
+		}
+		discovered, err := m.tc.GetPathTo(destIP, j.request.Timeout, beacon.WithTracerouteStop(j.cancel))
+		if err != nil {
+			return fmt.Errorf("Failed to discover path to %s: %s", destIP, err)
+		}
+		if j.canceled() {
+			return nil
+		}
+		path = beacon.Path{sourceIP}
+		for _, hop := range discovered {
+			if hop != nil {
+				path = append(path, hop)
+			}
+		}
+		if len(path) < 2 {
+			return fmt.Errorf("Found no hops to probe on the path to %s", destIP)
+		}
+	}
+
+	summary := &probeSummary{}
+	hopToIdx := make(map[string]int)
+	for idx, hop := range path {
+		summary.Path = append(summary.Path, hop.String())
+		if idx > 0 {
+			hopToIdx[hop.String()] = idx - 1
+			summary.Hops = append(summary.Hops, hopSummary{IP: hop.String()})
+		}
+	}
+
+	var resultChan <-chan beacon.BoomerangResult
+	if j.request.Batch {
+		resultChan = m.tc.ProbeEachHopOfPathBatched(path, j.request.NumPackets, j.request.Timeout, beacon.WithStop(j.cancel))
+	} else {
+		resultChan = m.tc.ProbeEachHopOfPath(path, j.request.NumPackets, j.request.Timeout, beacon.WithStop(j.cancel))
+	}
+
+	for res := range resultChan {
+		if res.Err != nil && res.IsFatal() {
+			// a fatal result is the only one sent, and the channel is left open
+			return res.Err
+		}
+		if j.canceled() {
+			continue
+		}
+
+		success := res.Err == nil
+		result := jobResult{IP: res.Payload.DestIP.String(), Mode: res.Payload.Mode.String(), Success: &success}
+		if success {
+			result.RTTMs = float64(res.Payload.RxTimestamp.Sub(res.Payload.TxTimestamp)) / float64(time.Millisecond)
+			result.RxInterface = res.Payload.RxInterface
+			result.TxInterface = res.Payload.TxInterface
+		} else {
+			result.Error = res.Err.Error()
+		}
+		j.add(result)
+
+		if idx, ok := hopToIdx[result.IP]; ok {
+			summary.Hops[idx].Sent++
+			if success {
+				summary.Hops[idx].Received++
+			}
+		}
+	}
+
+	hops := make([]beacon.HopResult, len(summary.Hops))
+	for idx, hop := range summary.Hops {
+		hops[idx] = beacon.HopResult{Sent: hop.Sent, Received: hop.Received}
+	}
+	verdict, err := beacon.LocalizeLoss(path, hops)
+	if err == nil {
+		summary.Verdict = verdict.String()
+	}
+	j.Lock()
+	j.summary = summary
+	j.Unlock()
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/trstruth/beacon"
+	"github.com/trstruth/beacon/history"
+	"github.com/trstruth/beacon/monitor"
+)
+
+var monitorPaths []string
+var monitorDests []string
+var monitorPackets int
+var monitorInterval time.Duration
+var metricsAddr string
+var monitorConfig string
+var monitorHistory string
+
+// MonitorCmd represents the monitor subcommand which probes paths continuously and exports the results as metrics
+var MonitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "probe paths continuously and serve per hop loss and latency as Prometheus metrics",
+	Long: `probe each target path every interval, and serve the loss ratio, round trip time histogram and probe counts
+of each hop, the path changes of each discovered path and the receive counters of beacon on /metrics.
+
+with --history, the path discovered every round is recorded, and the distinct paths and changes of each target
+are served on /history and can be queried with the history subcommand.
+
+the targets are either given with -p/-d, or described by a YAML or JSON --config file which is reloaded on SIGHUP.`,
+	Args: cobra.NoArgs,
+	RunE: monitorRun,
+}
+
+func initMonitor() {
+	MonitorCmd.Flags().StringArrayVarP(&monitorPaths, "path", "p", nil, "comma separated list of hops to probe, may be repeated")
+	MonitorCmd.Flags().StringSliceVarP(&monitorDests, "dest", "d", nil, "destination IP/host to discover the path to before every round, may be repeated")
+	MonitorCmd.Flags().IntVarP(&monitorPackets, "num-packets", "n", 10, "number of probes to send per hop every round")
+	MonitorCmd.Flags().DurationVar(&monitorInterval, "interval", time.Minute, "time between the start of each round")
+	MonitorCmd.Flags().StringVarP(&metricsAddr, "listen", "l", "127.0.0.1:9100", "address to serve /metrics on")
+	MonitorCmd.Flags().StringVar(&monitorConfig, "config", "", "YAML or JSON file of monitoring jobs, reloaded on SIGHUP")
+	MonitorCmd.Flags().StringVar(&monitorHistory, "history", "", "database file to record the discovered paths of targets in, served on /history")
+}
+
+func monitorRun(cmd *cobra.Command, args []string) error {
+	var targets []monitor.Target
+	var err error
+	if monitorConfig != "" {
+		if len(monitorPaths) != 0 || len(monitorDests) != 0 {
+			return errors.New("--config can't be combined with -d or -p")
+		}
+		targets, err = loadMonitorConfig(monitorConfig)
+	} else {
+		targets, err = monitorFlagTargets()
+	}
+	if err != nil {
+		return err
+	}
+
+	tc, err := beacon.NewSharedTransportChannel(listenOn(interfaceDevice), beacon.WithNetworkContext(network()))
+	if err != nil {
+		return fmt.Errorf("Failed to create new TransportChannel on interface %s: %s", interfaceDevice, err)
+	}
+	defer tc.Close()
+
+	var options []monitor.Option
+	mux := http.NewServeMux()
+	if monitorHistory != "" {
+		store, err := history.Open(monitorHistory)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		options = append(options, monitor.WithHistory(store))
+		mux.Handle("/history", store)
+	}
+
+	mon := monitor.New(tc, options...)
+	// the rounds in progress must finish before the history store and the TransportChannel are closed
+	defer mon.Stop()
+	if err := mon.Update(targets); err != nil {
+		return err
+	}
+	mux.Handle("/metrics", mon)
+	server := &http.Server{Addr: metricsAddr, Handler: mux}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				reloadMonitorConfig(mon)
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			server.Shutdown(ctx)
+			cancel()
+			return
+		}
+	}()
+
+	log.Printf("monitoring %d targets, serving metrics on %s/metrics\n", len(targets), metricsAddr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func monitorFlagTargets() ([]monitor.Target, error) {
+	if len(monitorPaths) == 0 && len(monitorDests) == 0 {
+		return nil, errors.New("At least one destination (-d) or path (-p) must be supplied")
+	}
+
+	var targets []monitor.Target
+	for _, hops := range monitorPaths {
+		path, err := parsePathFromHopsString(hops)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, monitor.Target{Path: path, NumPackets: monitorPackets, Timeout: timeout, Interval: monitorInterval})
+	}
+	for _, dest := range monitorDests {
+		destIP, err := beacon.ParseIPFromString(dest)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, monitor.Target{Dest: destIP, NumPackets: monitorPackets, Timeout: timeout, Interval: monitorInterval})
+	}
+	return targets, nil
+}
+
+func loadMonitorConfig(path string) ([]monitor.Target, error) {
+	config, err := monitor.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return config.Targets()
+}
+
+// reloadMonitorConfig replaces the targets of the monitor with those of the config file, the old targets keep
+// running if the file is invalid
+func reloadMonitorConfig(mon *monitor.Monitor) {
+	if monitorConfig == "" {
+		log.Printf("ignoring SIGHUP, there is no --config to reload\n")
+		return
+	}
+	targets, err := loadMonitorConfig(monitorConfig)
+	if err == nil {
+		err = mon.Update(targets)
+	}
+	if err != nil {
+		log.Printf("Failed to reload %s, keeping the previous targets: %s\n", monitorConfig, err)
+		return
+	}
+	log.Printf("reloaded %s, monitoring %d targets\n", monitorConfig, len(targets))
+}
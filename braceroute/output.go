@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 
@@ -21,6 +23,8 @@ type probeStats struct {
 	hopStatSlice    []hopStats
 	totalPackets    int
 	interfaceDevice string
+	// multiInterface shows the interfaces probes came back on, when listening on several
+	multiInterface bool
 }
 
 func newProbeStats(path beacon.Path, totalPackets int, interfaceDevice string) *probeStats {
@@ -32,6 +36,7 @@ func newProbeStats(path beacon.Path, totalPackets int, interfaceDevice string) *
 		hopStatSlice:    make([]hopStats, len(path)-1),
 		totalPackets:    totalPackets,
 		interfaceDevice: interfaceDevice,
+		multiInterface:  strings.Contains(interfaceDevice, ","),
 	}
 
 	for idx, hop := range path[1:] {
@@ -42,7 +47,18 @@ func newProbeStats(path beacon.Path, totalPackets int, interfaceDevice string) *
 	return &s
 }
 
-func (s *probeStats) recordResponse(hop string, successful bool) {
+// annotate names the hops of the path with annotator
+func (s *probeStats) annotate(annotator beacon.HopAnnotator) {
+	annotations := beacon.AnnotatePath(annotator, s.path[1:])
+
+	s.Lock()
+	for idx, annotation := range annotations {
+		s.hopStatSlice[idx].annotation = annotation.String()
+	}
+	s.Unlock()
+}
+
+func (s *probeStats) recordResponse(hop string, successful bool, rxInterface string) {
 	s.Lock()
 	if successful {
 		idx, ok := s.hopToIdxMapping[hop]
@@ -50,7 +66,7 @@ func (s *probeStats) recordResponse(hop string, successful bool) {
 			// TODO: refactor to allow this function to propagate lookup errors
 			log.Fatalf("tried to record response for hop: %s which doesn't exist in the mapping: %+v\n", hop, s.hopToIdxMapping)
 		}
-		s.hopStatSlice[idx].success()
+		s.hopStatSlice[idx].success(rxInterface)
 	} else {
 		idx := s.hopToIdxMapping[hop]
 		s.hopStatSlice[idx].failure()
@@ -58,45 +74,77 @@ func (s *probeStats) recordResponse(hop string, successful bool) {
 	s.Unlock()
 }
 
+// newTable returns a table rendered to w under header, with left aligned columns padded by tabs and no borders
+func newTable(w io.Writer, header []string) *tablewriter.Table {
+	table := tablewriter.NewWriter(w)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetTablePadding("\t") // pad with tabs
+	table.SetNoWhiteSpace(true)
+	table.SetHeader(header)
+	return table
+}
+
 func (s *probeStats) String() string {
 	tableString := &strings.Builder{}
 	tableString.WriteString(fmt.Sprintf("Probe %d packets through interface %s over path %v\n\n", s.totalPackets, s.interfaceDevice, s.path))
 
-	table := tablewriter.NewWriter(tableString)
-
 	rows := make([][]string, len(s.path)-1)
 	for idx, hopStats := range s.hopStatSlice {
 		rows[idx] = []string{
 			fmt.Sprintf("%d", idx+1),
 			hopStats.name,
+			hopStats.annotation,
 			fmt.Sprintf("%.3f%%", hopStats.calculateSuccessRate()),
 			fmt.Sprintf("%d", hopStats.packetsRecvd),
 			fmt.Sprintf("%d", hopStats.packetsSent),
 		}
+		if s.multiInterface {
+			rows[idx] = append(rows[idx], hopStats.rxInterfacesString())
+		}
 	}
 
-	table.SetHeader([]string{"idx", "hop", "success rate", "rx", "tx"})
-	table.SetAutoWrapText(false)
-	table.SetAutoFormatHeaders(true)
-	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.SetCenterSeparator("")
-	table.SetColumnSeparator("")
-	table.SetRowSeparator("")
-	table.SetHeaderLine(false)
-	table.SetBorder(false)
-	table.SetTablePadding("\t") // pad with tabs
-	table.SetNoWhiteSpace(true)
+	header := []string{"idx", "hop", "name", "success rate", "rx", "tx"}
+	if s.multiInterface {
+		header = append(header, "rx interfaces")
+	}
+	table := newTable(tableString, header)
 	table.AppendBulk(rows)
 	table.Render()
 
 	return tableString.String()
 }
 
+// verdict localizes loss over the probed path using the results recorded so far
+func (s *probeStats) verdict() (beacon.LossVerdict, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	hops := make([]beacon.HopResult, len(s.hopStatSlice))
+	for idx, hopStats := range s.hopStatSlice {
+		hops[idx] = beacon.HopResult{
+			Sent:     hopStats.packetsSent,
+			Received: hopStats.packetsRecvd,
+		}
+	}
+
+	return beacon.LocalizeLoss(s.path, hops)
+}
+
 type hopStats struct {
 	name         string
+	annotation   string
 	packetsSent  int
 	packetsRecvd int
+	// rxInterfaces counts the probes which came back on each interface
+	rxInterfaces map[string]int
 }
 
 func newHopStats(addr net.IP) *hopStats {
@@ -104,9 +152,25 @@ func newHopStats(addr net.IP) *hopStats {
 		name:         addr.String(),
 		packetsSent:  0,
 		packetsRecvd: 0,
+		rxInterfaces: make(map[string]int),
 	}
 }
 
+// rxInterfacesString lists the interfaces probes came back on along with their counts, such as "eth0:28 eth1:2"
+func (hs *hopStats) rxInterfacesString() string {
+	names := make([]string, 0, len(hs.rxInterfaces))
+	for name := range hs.rxInterfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	counts := make([]string, len(names))
+	for idx, name := range names {
+		counts[idx] = fmt.Sprintf("%s:%d", name, hs.rxInterfaces[name])
+	}
+	return strings.Join(counts, " ")
+}
+
 func (hs *hopStats) calculateSuccessRate() float32 {
 	if hs.packetsSent == 0 {
 		return 0
@@ -115,11 +179,206 @@ func (hs *hopStats) calculateSuccessRate() float32 {
 	return 100 * float32(hs.packetsRecvd) / float32(hs.packetsSent)
 }
 
-func (hs *hopStats) success() {
+func (hs *hopStats) success(rxInterface string) {
 	hs.packetsSent++
 	hs.packetsRecvd++
+	if rxInterface != "" {
+		hs.rxInterfaces[rxInterface]++
+	}
 }
 
 func (hs *hopStats) failure() {
 	hs.packetsSent++
 }
+
+type directionalStats struct {
+	sync.RWMutex
+	path            beacon.Path
+	hopToIdxMapping map[string]int
+	hopResults      []beacon.DirectionalHopResult
+	totalPackets    int
+	interfaceDevice string
+}
+
+func newDirectionalStats(path beacon.Path, totalPackets int, interfaceDevice string) *directionalStats {
+	s := directionalStats{
+		path:            path,
+		hopToIdxMapping: make(map[string]int),
+		hopResults:      make([]beacon.DirectionalHopResult, len(path)-1),
+		totalPackets:    totalPackets,
+		interfaceDevice: interfaceDevice,
+	}
+
+	for idx, hop := range path[1:] {
+		s.hopToIdxMapping[hop.String()] = idx
+	}
+
+	return &s
+}
+
+func (s *directionalStats) recordResponse(hop string, mode beacon.ProbeMode, successful bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	idx, ok := s.hopToIdxMapping[hop]
+	if !ok {
+		return fmt.Errorf("tried to record response for hop: %s which doesn't exist in the mapping: %+v", hop, s.hopToIdxMapping)
+	}
+	s.hopResults[idx].Record(mode, successful)
+
+	return nil
+}
+
+func (s *directionalStats) verdict() (beacon.DirectionVerdict, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return beacon.InferLossDirection(s.path, s.hopResults)
+}
+
+func (s *directionalStats) String() string {
+	tableString := &strings.Builder{}
+	tableString.WriteString(fmt.Sprintf("Probe %d packets per mode through interface %s over path %v\n\n", s.totalPackets, s.interfaceDevice, s.path))
+
+	verdict, err := s.verdict()
+	if err != nil {
+		tableString.WriteString(fmt.Sprintf("Failed to infer loss direction: %s\n", err))
+		return tableString.String()
+	}
+
+	s.RLock()
+	rows := make([][]string, len(s.path)-1)
+	for idx, hop := range s.hopResults {
+		link := verdict.Links[idx]
+		forwardLoss := fmt.Sprintf("%.3f%%", 100*link.ForwardLoss)
+		reverseLoss := fmt.Sprintf("%.3f%%", 100*link.ReverseLoss)
+		if link.Unreliable {
+			forwardLoss += "?"
+			reverseLoss += "?"
+		}
+		rows[idx] = []string{
+			fmt.Sprintf("%d", idx+1),
+			s.path[idx+1].String(),
+			fmt.Sprintf("%.3f%%", 100*hop.RoundTrip.SuccessRate()),
+			fmt.Sprintf("%.3f%%", 100*hop.ForwardPinned.SuccessRate()),
+			fmt.Sprintf("%.3f%%", 100*hop.ReversePinned.SuccessRate()),
+			fmt.Sprintf("%.3f%%", 100*hop.Native.SuccessRate()),
+			forwardLoss,
+			reverseLoss,
+		}
+	}
+	s.RUnlock()
+
+	table := newTable(tableString, []string{"idx", "hop", "round trip", "fwd pinned", "rev pinned", "native", "fwd loss", "rev loss"})
+	table.AppendBulk(rows)
+	table.Render()
+
+	return tableString.String()
+}
+
+// hopOpSymbols mark each row of a path diff
+var hopOpSymbols = map[beacon.HopOp]string{
+	beacon.HopEqual:       "=",
+	beacon.HopUnknown:     "?",
+	beacon.HopSubstituted: "~",
+	beacon.HopInserted:    "+",
+	beacon.HopRemoved:     "-",
+}
+
+// pathDiffString renders the alignment of two paths side by side
+func pathDiffString(oldPath, newPath beacon.Path) string {
+	diff := oldPath.Diff(newPath)
+
+	tableString := &strings.Builder{}
+	tableString.WriteString(fmt.Sprintf("Diff of path %v and path %v\n\n", oldPath, newPath))
+
+	rows := make([][]string, len(diff))
+	for idx, hop := range diff {
+		row := []string{"", "", hopOpSymbols[hop.Op], "", ""}
+		if hop.OldIdx >= 0 {
+			row[0] = fmt.Sprintf("%d", hop.OldIdx)
+			row[1] = beacon.HopString(hop.Old)
+		}
+		if hop.NewIdx >= 0 {
+			row[3] = fmt.Sprintf("%d", hop.NewIdx)
+			row[4] = beacon.HopString(hop.New)
+		}
+		rows[idx] = row
+	}
+
+	table := newTable(tableString, []string{"idx", "old", "", "idx", "new"})
+	table.AppendBulk(rows)
+	table.Render()
+
+	tableString.WriteString(fmt.Sprintf("\ncommon prefix %d hops, common suffix %d hops", oldPath.CommonPrefix(newPath), oldPath.CommonSuffix(newPath)))
+	if changed := diff.Changed(); len(changed) > 0 {
+		tableString.WriteString(fmt.Sprintf(", %d hops changed: %s\n", len(changed), changed))
+	} else {
+		tableString.WriteString(", no hops changed\n")
+	}
+	return tableString.String()
+}
+
+// directionalHopDescription describes how a hop of the forward path compares with the reverse path
+func directionalHopDescription(hop beacon.DirectionalHop) string {
+	switch {
+	case hop.Op == beacon.HopEqual:
+		return "same"
+	case hop.SameDevice():
+		return "same router"
+	case hop.Op == beacon.HopUnknown, hop.Old == nil && hop.New == nil:
+		return "unknown"
+	case hop.Op == beacon.HopInserted:
+		return "reverse only"
+	case hop.Op == beacon.HopRemoved:
+		return "forward only"
+	}
+	return "differs"
+}
+
+// asymmetryString renders the forward and reverse paths to a destination side by side, followed by where they diverge
+func asymmetryString(report beacon.AsymmetryReport) string {
+	tableString := &strings.Builder{}
+	tableString.WriteString(fmt.Sprintf("Forward path %v\nReverse path %v\n\n", report.Forward, report.Reverse))
+
+	rows := make([][]string, len(report.Hops))
+	for idx, hop := range report.Hops {
+		row := []string{"", "", "", directionalHopDescription(hop), "", ""}
+		if hop.OldIdx >= 0 {
+			row[0] = fmt.Sprintf("%d", hop.OldIdx)
+			row[1] = beacon.HopString(hop.Old)
+			row[2] = hop.ForwardDevice
+		}
+		if hop.NewIdx >= 0 {
+			row[4] = beacon.HopString(hop.New)
+			row[5] = hop.ReverseDevice
+		}
+		rows[idx] = row
+	}
+
+	table := newTable(tableString, []string{"idx", "forward", "router", "", "reverse", "router"})
+	table.AppendBulk(rows)
+	table.Render()
+
+	divergences := report.Divergences()
+	if len(divergences) == 0 {
+		tableString.WriteString("\nthe paths cross the same routers in both directions\n")
+		return tableString.String()
+	}
+	tableString.WriteString(fmt.Sprintf("\nthe paths diverge %d times\n", len(divergences)))
+	for _, divergence := range divergences {
+		var forwardHops, reverseHops []string
+		for _, hop := range divergence.Hops {
+			if hop.Old != nil {
+				forwardHops = append(forwardHops, beacon.HopString(hop.Old))
+			}
+			if hop.New != nil {
+				reverseHops = append(reverseHops, beacon.HopString(hop.New))
+			}
+		}
+		tableString.WriteString(fmt.Sprintf("after %s until %s: forward via [%s], reverse via [%s]\n",
+			beacon.HopString(divergence.After), beacon.HopString(divergence.Rejoin),
+			strings.Join(forwardHops, ", "), strings.Join(reverseHops, ", ")))
+	}
+	return tableString.String()
+}
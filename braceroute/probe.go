@@ -14,6 +14,11 @@ var dest string
 var numPackets int
 var hops string
 var block bool
+var directional bool
+var batched bool
+var timestamps string
+var egress string
+var uplinks bool
 
 // ProbeCmd represents the probe subcommand which allows a user to send
 // a probe of packets over a path from source to dest
@@ -30,6 +35,11 @@ func initProbe() {
 	ProbeCmd.Flags().IntVarP(&numPackets, "num-packets", "n", 30, "number of probes to send per hop")
 	ProbeCmd.Flags().StringVarP(&hops, "path", "p", "", "manually define a comma separated list of hops to probe")
 	ProbeCmd.Flags().BoolVarP(&block, "block", "b", false, "block on receiving a result from each hop per packet")
+	ProbeCmd.Flags().BoolVarP(&directional, "directional", "D", false, "also probe with asymmetric paths to attribute loss to the forward or reverse direction")
+	ProbeCmd.Flags().BoolVarP(&batched, "batch", "B", false, "send one probe to every hop per round with a single batched send")
+	ProbeCmd.Flags().StringVar(&timestamps, "timestamps", "userspace", "clock to timestamp probes with: userspace, kernel or hardware")
+	ProbeCmd.Flags().StringVar(&egress, "egress", "", "send the probes out of this interface, instead of the one the routing table picks")
+	ProbeCmd.Flags().BoolVarP(&uplinks, "uplinks", "U", false, "probe the path out of every uplink, the interfaces of -i or every up interface for any")
 }
 
 func probePreRun(cmd *cobra.Command, args []string) error {
@@ -37,6 +47,12 @@ func probePreRun(cmd *cobra.Command, args []string) error {
 		return errors.New("At least one of destination (-d) or path (-p) must be supplied")
 	} else if dest != "" && hops != "" {
 		return errors.New("Both destination (-d) and path (-p) cannot be supplied")
+	} else if directional && block {
+		return errors.New("Blocking (-b) is not supported with directional probes (-D)")
+	} else if batched && (block || directional) {
+		return errors.New("Batching (-B) is not supported with blocking (-b) or directional probes (-D)")
+	} else if uplinks && (block || directional || batched || egress != "") {
+		return errors.New("Probing every uplink (-U) is not supported with blocking (-b), directional probes (-D), batching (-B) or an egress interface")
 	} else if dest != "" && hops == "" {
 		if interfaceDevice == "" {
 			interfaceDeviceName, err := beacon.GetInterfaceDeviceFromDestString(dest)
@@ -73,10 +89,16 @@ func probeRun(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Printf("%v\n", path)
-	stats := newProbeStats(path, numPackets, interfaceDevice)
+
+	timestampSource, err := beacon.ParseTimestampSource(timestamps)
+	if err != nil {
+		return err
+	}
 
 	tc, err := beacon.NewBoomerangTransportChannel(
-		beacon.WithInterface(interfaceDevice),
+		listenOn(interfaceDevice),
+		beacon.WithTimestamping(timestampSource),
+		beacon.WithNetworkContext(network()),
 	)
 
 	if err != nil {
@@ -84,24 +106,46 @@ func probeRun(cmd *cobra.Command, args []string) error {
 	}
 	fmt.Printf("filtering packets using bpf filter: %s\n", tc.GetFilter())
 
+	if uplinks {
+		return probeUplinks(tc, path)
+	}
+
+	var options []beacon.ProbeOption
+	if egress != "" {
+		options = append(options, beacon.WithEgressInterface(egress))
+	}
+
+	if directional {
+		return probeDirectional(tc, path, options...)
+	}
+
+	stats := newProbeStats(path, numPackets, interfaceDevice)
+	annotator, err := hopAnnotator()
+	if err != nil {
+		return err
+	}
+	stats.annotate(annotator)
+
 	handleResult := func(result beacon.BoomerangResult) error {
 		if result.Err != nil {
 			if result.IsFatal() {
 				return fmt.Errorf("Fatal error while handling boomerang result: %s", result.Err)
 			}
-			stats.recordResponse(result.Payload.DestIP.String(), false)
+			stats.recordResponse(result.Payload.DestIP.String(), false, "")
 			return nil
 		}
 
-		stats.recordResponse(result.Payload.DestIP.String(), true)
+		stats.recordResponse(result.Payload.DestIP.String(), true, result.Payload.RxInterface)
 		return nil
 	}
 
 	var resultChan <-chan beacon.BoomerangResult
 	if block {
-		resultChan = tc.ProbeEachHopOfPathSync(path, numPackets, timeout)
+		resultChan = tc.ProbeEachHopOfPathSync(path, numPackets, timeout, options...)
+	} else if batched {
+		resultChan = tc.ProbeEachHopOfPathBatched(path, numPackets, timeout, options...)
 	} else {
-		resultChan = tc.ProbeEachHopOfPath(path, numPackets, timeout)
+		resultChan = tc.ProbeEachHopOfPath(path, numPackets, timeout, options...)
 	}
 
 	for res := range resultChan {
@@ -113,6 +157,111 @@ func probeRun(cmd *cobra.Command, args []string) error {
 		fmt.Println(stats)
 	}
 
+	verdict, err := stats.verdict()
+	if err != nil {
+		return fmt.Errorf("Failed to localize loss: %s", err)
+	}
+	fmt.Printf("verdict: %s\n", verdict)
+	if len(verdict.RateLimited) > 0 {
+		fmt.Printf("ignored hops which appear to be rate limited: %v\n", verdict.RateLimited)
+	}
+	warnOnReceiveDrops(tc)
+
+	return nil
+}
+
+// warnOnReceiveDrops warns if packets were dropped on this host, in which case some of the loss is not the network's
+func warnOnReceiveDrops(tc *beacon.TransportChannel) {
+	stats, err := tc.Stats()
+	if err != nil {
+		fmt.Printf("could not read receive stats: %s\n", err)
+		return
+	}
+	if stats.QueueDropped > 0 || stats.CaptureDropped > 0 {
+		fmt.Printf("warning: %d packets were dropped by beacon and %d by the capture backend, loss may be overstated\n", stats.QueueDropped, stats.CaptureDropped)
+	}
+}
+
+// probeDirectional probes the path with every probe mode and attributes loss to the forward or reverse direction
+func probeDirectional(tc *beacon.TransportChannel, path beacon.Path, options ...beacon.ProbeOption) error {
+	stats := newDirectionalStats(path, numPackets, interfaceDevice)
+
+	for result := range tc.ProbeEachHopOfPathDirectional(path, numPackets, timeout, options...) {
+		if result.Err != nil && result.IsFatal() {
+			return fmt.Errorf("Fatal error while handling boomerang result: %s", result.Err)
+		}
+
+		err := stats.recordResponse(result.Payload.DestIP.String(), result.Payload.Mode, result.Err == nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println("\033[H\033[2J")
+		fmt.Println(stats)
+	}
+
+	verdict, err := stats.verdict()
+	if err != nil {
+		return fmt.Errorf("Failed to infer loss direction: %s", err)
+	}
+	fmt.Println(verdict)
+	warnOnReceiveDrops(tc)
+
+	return nil
+}
+
+// probeUplinks probes the path out of every uplink of the host, from the address of each, to compare them
+func probeUplinks(tc *beacon.TransportChannel, path beacon.Path) error {
+	var discoverer beacon.InterfaceDiscoverer
+	if interfaceDevice != "any" {
+		discoverer = beacon.InterfaceList(strings.Split(interfaceDevice, ","))
+	}
+	var found []beacon.Uplink
+	err := tc.Network().Run(func() error {
+		var err error
+		found, err = beacon.FindUplinks(discoverer, path[len(path)-1])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	annotator, err := hopAnnotator()
+	if err != nil {
+		return err
+	}
+	statsByUplink := make(map[string]*probeStats)
+	for _, uplink := range found {
+		stats := newProbeStats(append(beacon.Path{uplink.Source}, path[1:]...), numPackets, uplink.Interface)
+		stats.annotate(annotator)
+		statsByUplink[uplink.Interface] = stats
+	}
+
+	for result := range tc.ProbeEachUplink(path, found, numPackets, timeout) {
+		if result.Err != nil && result.IsFatal() {
+			return fmt.Errorf("Fatal error while handling boomerang result: %s", result.Err)
+		}
+
+		stats, ok := statsByUplink[result.Payload.TxInterface]
+		if !ok {
+			return fmt.Errorf("Received a result for uplink %s which wasn't probed", result.Payload.TxInterface)
+		}
+		stats.recordResponse(result.Payload.DestIP.String(), result.Err == nil, result.Payload.RxInterface)
+
+		fmt.Println("\033[H\033[2J")
+		for _, uplink := range found {
+			fmt.Println(statsByUplink[uplink.Interface])
+		}
+	}
+
+	for _, uplink := range found {
+		verdict, err := statsByUplink[uplink.Interface].verdict()
+		if err != nil {
+			return fmt.Errorf("Failed to localize loss out of %s: %s", uplink, err)
+		}
+		fmt.Printf("verdict out of %s: %s\n", uplink, verdict)
+	}
+	warnOnReceiveDrops(tc)
+
 	return nil
 }
 
@@ -128,6 +277,7 @@ func findPathFromSourceToDest() (beacon.Path, error) {
 		beacon.WithHasher(beacon.V4TraceRouteHasher{}),
 		beacon.WithHasher(beacon.V6TraceRouteHasher{}),
 		beacon.WithBPFFilter(filter),
+		beacon.WithNetworkContext(network()),
 	)
 	if err != nil {
 		return nil, err
@@ -142,7 +292,7 @@ func findPathFromSourceToDest() (beacon.Path, error) {
 
 	if source == "" {
 		// if no source was provided via cli flag, use best source for dest
-		srcIP, err = beacon.FindSourceIPForDest(destIP)
+		srcIP, err = pathFinderTC.SourceFor(destIP)
 		if err != nil {
 			return nil, err
 		}
@@ -163,7 +313,7 @@ func findPathFromSourceToDest() (beacon.Path, error) {
 			return nil, err
 		}
 
-		vantageIP, err := pathFinderTC.FindLocalIP()
+		vantageIP, err := pathFinderTC.SourceFor(srcIP)
 		if err != nil {
 			return nil, err
 		}
@@ -9,15 +9,18 @@ import (
 
 // ReverseTraceroute uses IP in IP to perform traceroute from the remote back to the caller
 func ReverseTraceroute(destIP net.IP, timeout int) error {
-	destHostname, err := net.LookupAddr(destIP.String())
+	annotator, err := hopAnnotator()
 	if err != nil {
+		return err
+	}
+	if destName := annotator.Annotate(destIP).String(); destName == "" {
 		fmt.Printf("Doing reverse traceroute from %s\n", destIP)
 	} else {
-		fmt.Printf("Doing reverse traceroute from %s (%s)\n", destHostname[0], destIP)
+		fmt.Printf("Doing reverse traceroute from %s (%s)\n", destName, destIP)
 	}
 
 	if interfaceDevice == "" {
-		discoveredOutboundInterface, err := beacon.GetInterfaceDeviceFromDestIP(destIP)
+		discoveredOutboundInterface, err := network().GetInterfaceDeviceFromDestIP(destIP)
 		if err != nil {
 			return fmt.Errorf("Failed to find an interface for %s: %s, explicitly provide an interface with -i", destIP.String(), err)
 		}
@@ -29,6 +32,7 @@ func ReverseTraceroute(destIP net.IP, timeout int) error {
 		beacon.WithHasher(beacon.V4TraceRouteHasher{}),
 		beacon.WithHasher(beacon.V6TraceRouteHasher{}),
 		beacon.WithInterface(interfaceDevice),
+		beacon.WithNetworkContext(network()),
 	)
 	if err != nil {
 		return fmt.Errorf("Error creating transport channel: %s", err)
@@ -39,20 +43,19 @@ func ReverseTraceroute(destIP net.IP, timeout int) error {
 	}
 
 	hopIdx := 1
-	for hop := range pc {
+	for hop := range beacon.AnnotatePathChannel(annotator, pc) {
 		fmt.Printf("%d: ", hopIdx)
 		hopIdx++
 
-		if hop == nil {
+		if hop.IP == nil {
 			fmt.Println("*")
 			continue
 		}
 
-		hostname, err := net.LookupAddr(hop.String())
-		if err != nil {
-			fmt.Println(hop.String())
+		if name := hop.Annotation.String(); name == "" {
+			fmt.Println(hop.IP.String())
 		} else {
-			fmt.Printf("%s (%s)\n", hostname[0], hop.String())
+			fmt.Printf("%s (%s)\n", name, hop.IP.String())
 		}
 	}
 
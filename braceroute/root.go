@@ -1,6 +1,8 @@
 package main
 
 import (
+	"strings"
+
 	"github.com/spf13/cobra"
 	"github.com/trstruth/beacon"
 )
@@ -9,6 +11,9 @@ var reverse bool
 var interfaceDevice string
 var timeout int
 var source string
+var routers bool
+var netns string
+var vrf string
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
@@ -22,10 +27,21 @@ var RootCmd = &cobra.Command{
 
 func initRoot() {
 	RootCmd.Flags().BoolVarP(&reverse, "reverse", "r", false, "trace the route in reverse from target back to caller")
-	RootCmd.PersistentFlags().StringVarP(&interfaceDevice, "interface", "i", "any", "outbound interface to use")
+	RootCmd.Flags().BoolVar(&routers, "routers", false, "resolve the aliases of the hops, and print the path router by router as well")
+	RootCmd.PersistentFlags().StringVarP(&interfaceDevice, "interface", "i", "any", "outbound interface to use, probe, serve and monitor listen on each of a comma separated list")
 	RootCmd.PersistentFlags().IntVarP(&timeout, "timeout", "t", 3, "time (second) to wait on a packet to return")
-	RootCmd.PersistentFlags().StringVarP(&source, "source", "s", "", "source IP/host (defaults to eth0 interface)")
+	RootCmd.PersistentFlags().StringVarP(&source, "source", "s", "", "source IP/host (defaults to the source the routing table picks for the destination)")
+	RootCmd.PersistentFlags().StringVar(&netns, "netns", "", "network namespace (as created by ip netns add) to probe from")
+	RootCmd.PersistentFlags().StringVar(&vrf, "vrf", "", "VRF device to route probes with the table of")
+	RootCmd.PersistentFlags().BoolVar(&noDNS, "no-dns", false, "don't name hops by their reverse DNS")
+	RootCmd.PersistentFlags().StringVar(&asnTable, "asn-table", "", "prefix table (prefix,asn[,name] per line) to annotate hops with their origin AS")
+	RootCmd.PersistentFlags().StringVar(&inventory, "inventory", "", "inventory CSV (ip,device[,interface] per row) to name hops by, instead of reverse DNS")
 	RootCmd.AddCommand(ProbeCmd)
+	RootCmd.AddCommand(ServeCmd)
+	RootCmd.AddCommand(MonitorCmd)
+	RootCmd.AddCommand(HistoryCmd)
+	RootCmd.AddCommand(DiffCmd)
+	RootCmd.AddCommand(AsymmetryCmd)
 }
 
 func rootRun(cmd *cobra.Command, args []string) error {
@@ -34,6 +50,10 @@ func rootRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if routers {
+		return RouterTraceroute(destIP, source, timeout, interfaceDevice, reverse)
+	}
+
 	if reverse {
 		if err := ReverseTraceroute(destIP, timeout); err != nil {
 			return err
@@ -46,3 +66,16 @@ func rootRun(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// listenOn returns the option which listens on the interfaces of a comma separated list, with a capture handle each
+func listenOn(devices string) beacon.TransportChannelOption {
+	if !strings.Contains(devices, ",") {
+		return beacon.WithInterface(devices)
+	}
+	return beacon.WithInterfaces(strings.Split(devices, ",")...)
+}
+
+// network returns the network namespace and VRF of the --netns and --vrf flags
+func network() beacon.NetworkContext {
+	return beacon.NetworkContext{NetNS: netns, VRF: vrf}
+}
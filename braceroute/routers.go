@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/trstruth/beacon"
+)
+
+// RouterTraceroute traces the path to, or with reverse from, a destination, and then resolves the aliases of its
+// hops to print the path router by router as well
+func RouterTraceroute(destIP net.IP, sourceIP string, timeout int, interfaceDevice string, reverse bool) error {
+	if destIP.To4() == nil {
+		return fmt.Errorf("Alias resolution only supports IPv4, %s is IPv6", destIP)
+	}
+	if interfaceDevice == "" {
+		discoveredOutboundInterface, err := network().GetInterfaceDeviceFromDestIP(destIP)
+		if err != nil {
+			return fmt.Errorf("Failed to find an interface for %s: %s, explicitly provide an interface with -i", destIP.String(), err)
+		}
+		interfaceDevice = discoveredOutboundInterface
+	}
+
+	tc, err := beacon.NewTransportChannel(
+		beacon.WithBPFFilter("icmp"),
+		beacon.WithHasher(beacon.V4TraceRouteHasher{}),
+		beacon.WithHasher(beacon.V6TraceRouteHasher{}),
+		beacon.WithInterface(interfaceDevice),
+		beacon.WithNetworkContext(network()),
+	)
+	if err != nil {
+		return fmt.Errorf("Error creating transport channel: %s", err)
+	}
+	defer tc.Close()
+
+	var pc beacon.PathChannel
+	if reverse {
+		fmt.Printf("Doing reverse traceroute from %s\n", destIP)
+		pc, err = tc.GetPathChannelFrom(destIP, timeout*1000)
+	} else {
+		var srcIP net.IP
+		if sourceIP != "" {
+			if srcIP, err = beacon.ParseIPFromString(sourceIP); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Doing traceroute to %s\n", destIP)
+		pc, err = tc.GetPathChannelTo(destIP, srcIP, timeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	annotator, err := hopAnnotator()
+	if err != nil {
+		return err
+	}
+	var path beacon.Path
+	for hop := range beacon.AnnotatePathChannel(annotator, pc) {
+		path = append(path, hop.IP)
+		if name := hop.Annotation.String(); name != "" {
+			fmt.Printf("%d: %s (%s)\n", len(path), name, hop.IP)
+		} else {
+			fmt.Printf("%d: %s\n", len(path), beacon.HopString(hop.IP))
+		}
+	}
+	path = trimTimeouts(path)
+
+	aliases, err := tc.ResolveAliases(path)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve aliases: %s", err)
+	}
+	fmt.Print(routerPathString(aliases, path))
+	return nil
+}
+
+// routerPathString renders a path router by router, listing the interfaces of routers which answered from several
+func routerPathString(aliases *beacon.Aliases, path beacon.Path) string {
+	sb := &strings.Builder{}
+	sb.WriteString("\nRouter level path:\n")
+	for idx, hop := range aliases.RouterPath(path) {
+		sb.WriteString(fmt.Sprintf("%d: %s", idx+1, beacon.HopString(hop)))
+		if router := aliases.Router(hop); len(router) > 1 {
+			interfaces := make([]string, len(router))
+			for i, addr := range router {
+				interfaces[i] = addr.String()
+			}
+			sb.WriteString(fmt.Sprintf(" (%s)", strings.Join(interfaces, ", ")))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/trstruth/beacon"
+	"github.com/trstruth/beacon/rpc"
+	"google.golang.org/grpc"
+)
+
+var listenAddr string
+var grpcListenAddr string
+var maxJobs int
+var maxFinishedJobs int
+var maxProbePackets int
+
+// ServeCmd represents the serve subcommand which runs braceroute as a daemon
+var ServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "run a daemon which accepts traceroute and probe jobs over an HTTP JSON API and gRPC",
+	Long: `run a long lived daemon sharing one TransportChannel between traceroute, reverse traceroute and probe jobs.
+
+  POST   /jobs              start a job, the body is a JSON job request, responds with the job and its id
+  GET    /jobs              list jobs
+  GET    /jobs/{id}         get a job and its results so far
+  GET    /jobs/{id}/results stream the results of a job as newline delimited JSON until it finishes
+  DELETE /jobs/{id}         cancel a job
+
+With --grpc-listen the daemon also serves the Beacon gRPC service defined in rpc/beacon.proto, which streams the
+results of each RPC back to the caller instead of running it as a job.`,
+	Args: cobra.NoArgs,
+	RunE: serveRun,
+}
+
+func initServe() {
+	ServeCmd.Flags().StringVarP(&listenAddr, "listen", "l", "127.0.0.1:8080", "address to serve the HTTP API on, empty disables it")
+	ServeCmd.Flags().StringVar(&grpcListenAddr, "grpc-listen", "", "address to serve the gRPC API on, empty disables it")
+	ServeCmd.Flags().IntVar(&maxJobs, "max-jobs", 8, "maximum number of jobs running at once")
+	ServeCmd.Flags().IntVar(&maxFinishedJobs, "max-finished-jobs", 100, "number of finished jobs to remember")
+	ServeCmd.Flags().IntVar(&maxProbePackets, "max-probe-packets", 1000, "maximum number of packets a probe job may send per hop")
+}
+
+func serveRun(cmd *cobra.Command, args []string) error {
+	if maxJobs < 1 {
+		return fmt.Errorf("--max-jobs must be atleast 1, got %d", maxJobs)
+	}
+	if listenAddr == "" && grpcListenAddr == "" {
+		return fmt.Errorf("atleast one of --listen or --grpc-listen is required")
+	}
+
+	tc, err := beacon.NewSharedTransportChannel(listenOn(interfaceDevice), beacon.WithNetworkContext(network()))
+	if err != nil {
+		return fmt.Errorf("Failed to create new TransportChannel on interface %s: %s", interfaceDevice, err)
+	}
+	defer tc.Close()
+
+	// the jobs and the RPCs share the TransportChannel, so they share one limit on how many run at once
+	slots := make(chan struct{}, maxJobs)
+
+	var grpcServer *grpc.Server
+	var grpcListener net.Listener
+	if grpcListenAddr != "" {
+		grpcListener, err = net.Listen("tcp", grpcListenAddr)
+		if err != nil {
+			return fmt.Errorf("Failed to listen on %s: %s", grpcListenAddr, err)
+		}
+		grpcServer = grpc.NewServer()
+		rpc.NewServer(tc, rpc.WithDefaultTimeout(timeout), rpc.WithMaxProbePackets(maxProbePackets), rpc.WithSlots(slots)).Register(grpcServer)
+	}
+
+	var server *http.Server
+	if listenAddr != "" {
+		manager := newJobManager(tc, slots, maxFinishedJobs, maxProbePackets, timeout)
+		server = &http.Server{Addr: listenAddr, Handler: newServeMux(manager)}
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if server != nil {
+			server.Shutdown(ctx)
+		}
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+	}()
+
+	log.Printf("filtering packets using bpf filter: %s\n", tc.GetFilter())
+	errs := make(chan error, 2)
+	if grpcServer != nil {
+		log.Printf("serving gRPC on %s\n", grpcListenAddr)
+		go func() { errs <- grpcServer.Serve(grpcListener) }()
+	}
+	if server != nil {
+		log.Printf("serving HTTP on %s\n", listenAddr)
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				errs <- err
+				return
+			}
+			errs <- nil
+		}()
+	}
+
+	// the first server to stop takes the other down with it
+	err = <-errs
+	if server != nil {
+		server.Close()
+	}
+	if grpcServer != nil {
+		grpcServer.Stop()
+	}
+	return err
+}
+
+func newServeMux(manager *jobManager) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, manager.list())
+		case http.MethodPost:
+			handleStartJob(manager, w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		}
+	})
+	mux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		handleJob(manager, w, r)
+	})
+	return mux
+}
+
+func handleStartJob(manager *jobManager, w http.ResponseWriter, r *http.Request) {
+	var request jobRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Failed to decode job request: %s", err))
+		return
+	}
+
+	j, err := manager.start(request)
+	if err == errTooManyJobs {
+		writeError(w, http.StatusTooManyRequests, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, j.status(false))
+}
+
+func handleJob(manager *jobManager, w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	j, ok := manager.get(parts[0])
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job with id %q", parts[0]))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, j.status(true))
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if !manager.cancel(j) {
+			writeError(w, http.StatusConflict, errors.New("the job has already finished"))
+			return
+		}
+		writeJSON(w, http.StatusOK, j.status(false))
+	case len(parts) == 2 && parts[1] == "results" && r.Method == http.MethodGet:
+		streamResults(j, w, r)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// streamResults writes each result of a job as a line of JSON as soon as it is recorded, and finishes with the
+// status of the job once it is done
+func streamResults(j *job, w http.ResponseWriter, r *http.Request) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+
+	next := 0
+	for {
+		results, finished, updated := j.since(next)
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return
+			}
+		}
+		next += len(results)
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if finished {
+			encoder.Encode(j.status(false))
+			return
+		}
+
+		select {
+		case <-updated:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write response: %s\n", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -9,7 +9,11 @@ func Traceroute(destIP string, sourceIP string, timeout int32, interfaceDevice s
 
 	timeoutInt := int(timeout)
 
-	_, err := beacon.Traceroute(destIP, sourceIP, timeoutInt, interfaceDevice)
+	annotator, err := hopAnnotator()
+	if err != nil {
+		return err
+	}
+	_, err = beacon.TracerouteInNetwork(destIP, sourceIP, timeoutInt, interfaceDevice, annotator, network())
 
 	return err
 }
@@ -1,7 +1,9 @@
 package beacon
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"math/rand"
 	"net"
 
@@ -186,7 +188,9 @@ func buildUDPTraceroutePacket(sourceIP, destIP net.IP, sourcePort, destPort laye
 	return err
 }
 
-func buildEncapTraceroutePacket(outerSourceIP, outerDestIP, innerSourceIP, innerDestIP net.IP, ttl uint8, payload []byte, buf gopacket.SerializeBuffer) error {
+// buildEncapTraceroutePacket builds an IP in IP packet carrying an echo request with the given ttl, id and sequence
+// number, which the replies to it can be correlated by
+func buildEncapTraceroutePacket(outerSourceIP, outerDestIP, innerSourceIP, innerDestIP net.IP, ttl uint8, id, seq uint16, payload []byte, buf gopacket.SerializeBuffer) error {
 	opts := gopacket.SerializeOptions{
 		ComputeChecksums: true,
 		FixLengths:       true,
@@ -197,7 +201,8 @@ func buildEncapTraceroutePacket(outerSourceIP, outerDestIP, innerSourceIP, inner
 
 	icmpLayer := &layers.ICMPv4{
 		TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0),
-		Seq:      1,
+		Id:       id,
+		Seq:      seq,
 	}
 
 	err := gopacket.SerializeLayers(buf, opts,
@@ -214,29 +219,75 @@ func buildEncapTraceroutePacket(outerSourceIP, outerDestIP, innerSourceIP, inner
 
 // CreateRoundTripPacketForPath builds an IP in IP packet which will perform roundtrip traversal over the hops in the given path
 func CreateRoundTripPacketForPath(path Path, payload []byte, buf gopacket.SerializeBuffer) error {
+	if len(path) < 2 {
+		return errors.New("Path must have atleast 2 hops")
+	}
+
+	// if path is A, B, C then the packet visits A -> B -> C -> B -> A
+	visits := make([]net.IP, 0, 2*len(path)-1)
+	visits = append(visits, path...)
+	for idx := len(path) - 2; idx >= 0; idx-- {
+		visits = append(visits, path[idx])
+	}
+
+	return createEncapPacketForVisits(visits, payload, buf)
+}
+
+// CreateForwardPacketForPath builds an IP in IP packet which traverses the hops in the given path on the way out,
+// and is then routed natively from the last hop back to the first.
+func CreateForwardPacketForPath(path Path, payload []byte, buf gopacket.SerializeBuffer) error {
+	if len(path) < 2 {
+		return errors.New("Path must have atleast 2 hops")
+	}
+
+	// if path is A, B, C then the packet visits A -> B -> C ~> A
+	visits := make([]net.IP, 0, len(path)+1)
+	visits = append(visits, path...)
+	visits = append(visits, path[0])
+
+	return createEncapPacketForVisits(visits, payload, buf)
+}
+
+// CreateReversePacketForPath builds an IP in IP packet which is routed natively from the first hop in the given path
+// to the last, and then traverses the hops in the path in reverse on the way back.
+func CreateReversePacketForPath(path Path, payload []byte, buf gopacket.SerializeBuffer) error {
+	if len(path) < 2 {
+		return errors.New("Path must have atleast 2 hops")
+	}
+
+	// if path is A, B, C then the packet visits A ~> C -> B -> A
+	visits := make([]net.IP, 0, len(path)+1)
+	visits = append(visits, path[0])
+	for idx := len(path) - 1; idx >= 0; idx-- {
+		visits = append(visits, path[idx])
+	}
+
+	return createEncapPacketForVisits(visits, payload, buf)
+}
+
+// createEncapPacketForVisits builds an IP in IP packet which visits each of the given IPs in order.  The innermost
+// packet is a udp packet carrying the payload from the second to last visit to the last.
+func createEncapPacketForVisits(visits []net.IP, payload []byte, buf gopacket.SerializeBuffer) error {
 	opts := gopacket.SerializeOptions{
 		ComputeChecksums: true,
 		FixLengths:       true,
 	}
 
-	if len(path) < 2 {
+	if len(visits) < 2 {
 		return errors.New("Path must have atleast 2 hops")
 	}
 
-	numHops := len(path)
-	numLayers := 2 * (numHops - 1)
-	constructedLayers := make([]gopacket.SerializableLayer, numLayers)
+	numLayers := len(visits) - 1
+	constructedLayers := make([]gopacket.SerializableLayer, numLayers, numLayers+2)
 
-	for idx := range path[:len(path)-1] {
-		hopA := path[idx]
-		hopB := path[idx+1]
+	for idx := range visits[:numLayers-1] {
+		hopA := visits[idx]
+		hopB := visits[idx+1]
 
 		if hopA.To4() != nil {
 			constructedLayers[idx] = buildIPv4EncapLayer(hopA, hopB)
-			constructedLayers[numLayers-idx-1] = buildIPv4EncapLayer(hopB, hopA)
 		} else {
 			constructedLayers[idx] = buildIPv6EncapLayer(hopA, hopB)
-			constructedLayers[numLayers-idx-1] = buildIPv6EncapLayer(hopB, hopA)
 		}
 	}
 
@@ -246,13 +297,15 @@ func CreateRoundTripPacketForPath(path Path, payload []byte, buf gopacket.Serial
 		Length:  uint16(udpHeaderLen + len(payload)),
 	}
 
-	if path[0].To4() != nil {
-		ipLayer := buildIPv4UDPLayer(path[1], path[0], 255)
-		constructedLayers[len(constructedLayers)-1] = ipLayer // overwrite the last encap layer
+	innerSrc := visits[numLayers-1]
+	innerDst := visits[numLayers]
+	if innerDst.To4() != nil {
+		ipLayer := buildIPv4UDPLayer(innerSrc, innerDst, 255)
+		constructedLayers[numLayers-1] = ipLayer
 		udpLayer.SetNetworkLayerForChecksum(ipLayer)
 	} else {
-		ipLayer := buildIPv6UDPLayer(path[1], path[0], 255)
-		constructedLayers[len(constructedLayers)-1] = ipLayer
+		ipLayer := buildIPv6UDPLayer(innerSrc, innerDst, 255)
+		constructedLayers[numLayers-1] = ipLayer
 		udpLayer.SetNetworkLayerForChecksum(ipLayer)
 	}
 
@@ -271,3 +324,55 @@ func generateRandomUDPPort() layers.UDPPort {
 	generatedPort := udpMinPort + rand.Intn(udpMaxPort-udpMinPort)
 	return layers.UDPPort(generatedPort)
 }
+
+// setDSCP marks every IP header of an encapsulated packet with the given DSCP, so that the packet keeps its class on
+// every leg of the path.  The ECN bits are left alone, and the checksums of IPv4 headers are recomputed.
+func setDSCP(packet []byte, dscp uint8) error {
+	if dscp > 63 {
+		return fmt.Errorf("DSCP must be between 0 and 63, got %d", dscp)
+	}
+
+	for len(packet) > 0 {
+		var next uint8
+		switch packet[0] >> 4 {
+		case 4:
+			headerLen := int(packet[0]&0x0f) * 4
+			if headerLen < 20 || len(packet) < headerLen {
+				return errors.New("Truncated IPv4 header")
+			}
+			packet[1] = dscp<<2 | packet[1]&0x03
+			packet[10], packet[11] = 0, 0
+			binary.BigEndian.PutUint16(packet[10:12], ipv4HeaderChecksum(packet[:headerLen]))
+			next = packet[9]
+			packet = packet[headerLen:]
+		case 6:
+			if len(packet) < 40 {
+				return errors.New("Truncated IPv6 header")
+			}
+			// the traffic class straddles the first two bytes of the header
+			trafficClass := dscp<<2 | (packet[1]>>4)&0x03
+			packet[0] = 0x60 | trafficClass>>4
+			packet[1] = trafficClass<<4 | packet[1]&0x0f
+			next = packet[6]
+			packet = packet[40:]
+		default:
+			return nil
+		}
+
+		if layers.IPProtocol(next) != layers.IPProtocolIPv4 && layers.IPProtocol(next) != layers.IPProtocolIPv6 {
+			return nil
+		}
+	}
+	return nil
+}
+
+func ipv4HeaderChecksum(header []byte) uint16 {
+	var sum uint32
+	for idx := 0; idx+1 < len(header); idx += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[idx:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
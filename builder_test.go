@@ -146,3 +146,147 @@ func TestIpv6UDPLayerIDField(t *testing.T) {
 		t.Errorf("ID Field contents differed in value:\nwanted: %s\ngot:    %s", hex.Dump(expectedIDField), hex.Dump(actualIDField))
 	}
 }
+
+func checkVisitedLayers(t *testing.T, packetBytes []byte, expectedLayerInfos []LayerInfo) {
+	packet := gopacket.NewPacket(packetBytes, layers.LayerTypeIPv4, gopacket.Default)
+
+	for idx, expected := range expectedLayerInfos {
+		ip4, ok := packet.Layers()[idx].(*layers.IPv4)
+		if !ok {
+			t.Errorf("Expected layer %d of the constructed packet to be IPv4", idx)
+			t.FailNow()
+		}
+
+		if !ip4.SrcIP.Equal(expected.src) || !ip4.DstIP.Equal(expected.dst) || ip4.Protocol != expected.proto {
+			t.Errorf("Mismatch in layer %d of constructed packet, expected %s -> %s (%s), got %s -> %s (%s)",
+				idx, expected.src, expected.dst, expected.proto, ip4.SrcIP, ip4.DstIP, ip4.Protocol)
+		}
+	}
+}
+
+func TestCreateForwardPacketForPath(t *testing.T) {
+	path := Path{
+		net.IP{10, 20, 30, 96},
+		net.IP{104, 44, 22, 235},
+		net.IP{104, 44, 19, 212},
+	}
+	buf := gopacket.NewSerializeBuffer()
+
+	err := CreateForwardPacketForPath(path, []byte("Test Payload"), buf)
+	if err != nil {
+		t.Errorf("Failed to create forward packet for path: %s", err)
+		t.FailNow()
+	}
+
+	// if path is A, B, C then expected trip is A -> B -> C ~> A
+	checkVisitedLayers(t, buf.Bytes(), []LayerInfo{
+		LayerInfo{src: net.IP{10, 20, 30, 96}, dst: net.IP{104, 44, 22, 235}, proto: 4},
+		LayerInfo{src: net.IP{104, 44, 22, 235}, dst: net.IP{104, 44, 19, 212}, proto: 4},
+		LayerInfo{src: net.IP{104, 44, 19, 212}, dst: net.IP{10, 20, 30, 96}, proto: 17},
+	})
+}
+
+func TestCreateReversePacketForPath(t *testing.T) {
+	path := Path{
+		net.IP{10, 20, 30, 96},
+		net.IP{104, 44, 22, 235},
+		net.IP{104, 44, 19, 212},
+	}
+	buf := gopacket.NewSerializeBuffer()
+
+	err := CreateReversePacketForPath(path, []byte("Test Payload"), buf)
+	if err != nil {
+		t.Errorf("Failed to create reverse packet for path: %s", err)
+		t.FailNow()
+	}
+
+	// if path is A, B, C then expected trip is A ~> C -> B -> A
+	checkVisitedLayers(t, buf.Bytes(), []LayerInfo{
+		LayerInfo{src: net.IP{10, 20, 30, 96}, dst: net.IP{104, 44, 19, 212}, proto: 4},
+		LayerInfo{src: net.IP{104, 44, 19, 212}, dst: net.IP{104, 44, 22, 235}, proto: 4},
+		LayerInfo{src: net.IP{104, 44, 22, 235}, dst: net.IP{10, 20, 30, 96}, proto: 17},
+	})
+}
+
+func TestSetDSCP(t *testing.T) {
+	paths := []Path{
+		{net.IP{10, 20, 30, 96}, net.IP{104, 44, 22, 235}, net.IP{104, 44, 19, 212}},
+		{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), net.ParseIP("2001:db8::3")},
+	}
+
+	for _, path := range paths {
+		buf := gopacket.NewSerializeBuffer()
+		if err := CreateRoundTripPacketForPath(path, []byte("Test Payload"), buf); err != nil {
+			t.Fatalf("Failed to create roundtrip packet for path: %s", err)
+		}
+		if err := setDSCP(buf.Bytes(), 46); err != nil {
+			t.Fatalf("Failed to set DSCP: %s", err)
+		}
+
+		firstLayer := layers.LayerTypeIPv4
+		if path[0].To4() == nil {
+			firstLayer = layers.LayerTypeIPv6
+		}
+		packet := gopacket.NewPacket(buf.Bytes(), firstLayer, gopacket.Default)
+
+		marked := 0
+		for _, layer := range packet.Layers() {
+			switch ip := layer.(type) {
+			case *layers.IPv4:
+				if ip.TOS>>2 != 46 {
+					t.Errorf("Expected the IPv4 header to %s to have DSCP 46, got %d", ip.DstIP, ip.TOS>>2)
+				}
+				if checksum := ipv4HeaderChecksum(ip.Contents); checksum != 0 {
+					t.Errorf("Expected the IPv4 header to %s to have a valid checksum", ip.DstIP)
+				}
+				marked++
+			case *layers.IPv6:
+				if ip.TrafficClass>>2 != 46 {
+					t.Errorf("Expected the IPv6 header to %s to have DSCP 46, got %d", ip.DstIP, ip.TrafficClass>>2)
+				}
+				marked++
+			}
+		}
+		if expected := 2*len(path) - 2; marked != expected {
+			t.Errorf("Expected %d IP headers to be marked, got %d", expected, marked)
+		}
+	}
+}
+
+func TestWithDSCPRejectsInvalidValues(t *testing.T) {
+	path := Path{net.IP{10, 20, 30, 96}, net.IP{104, 44, 22, 235}}
+	if _, err := newBoomerang(path, RoundTrip, []ProbeOption{WithDSCP(64)}); err == nil {
+		t.Errorf("Expected a DSCP of 64 to be rejected")
+	}
+}
+
+func TestWithSourceIP(t *testing.T) {
+	path := Path{net.IP{10, 20, 30, 96}, net.IP{104, 44, 22, 235}, net.IP{104, 44, 19, 212}}
+	source := net.IP{10, 20, 31, 96}
+
+	b, err := newBoomerang(path, RoundTrip, []ProbeOption{WithSourceIP(source), WithEgressInterface("eth1")})
+	if err != nil {
+		t.Fatalf("Failed to build boomerang: %s", err)
+	}
+	if !b.path[0].Equal(source) || !path[0].Equal(net.IP{10, 20, 30, 96}) {
+		t.Errorf("Expected the boomerang to come back to %s without modifying the path, got %v and %v", source, b.path, path)
+	}
+	if b.egress != "eth1" {
+		t.Errorf("Expected the boomerang to be sent out of eth1, got %q", b.egress)
+	}
+
+	packet := gopacket.NewPacket(b.packetData, layers.LayerTypeIPv4, gopacket.Default)
+	var innermost *layers.IPv4
+	for _, layer := range packet.Layers() {
+		if ip, ok := layer.(*layers.IPv4); ok {
+			innermost = ip
+		}
+	}
+	if innermost == nil || !innermost.DstIP.Equal(source) {
+		t.Errorf("Expected the innermost header to be addressed to %s, got %+v", source, innermost)
+	}
+
+	if _, err := newBoomerang(path, RoundTrip, []ProbeOption{WithSourceIP(net.ParseIP("2001:db8::1"))}); err == nil {
+		t.Errorf("Expected an IPv6 source to be rejected for an IPv4 path")
+	}
+}
@@ -0,0 +1,122 @@
+package beacon
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+)
+
+// CaptureBackend selects the mechanism a TransportChannel uses to capture packets
+type CaptureBackend int
+
+const (
+	// DefaultBackend uses libpcap when beacon was built with it, and AF_PACKET otherwise
+	DefaultBackend CaptureBackend = iota
+	// PcapBackend captures packets with libpcap
+	PcapBackend
+	// AFPacketBackend captures packets with a memory mapped TPACKET_V3 AF_PACKET ring, and is only available on linux.
+	// It does not depend on libpcap, so only the BPF filters understood by CompileBPFFilter can be used with it.
+	AFPacketBackend
+)
+
+// String returns the string representation of a CaptureBackend
+func (b CaptureBackend) String() string {
+	switch b {
+	case DefaultBackend:
+		return "default"
+	case PcapBackend:
+		return "pcap"
+	case AFPacketBackend:
+		return "afpacket"
+	}
+	return "unknown"
+}
+
+// CaptureStats holds the counters reported by a capture handle
+type CaptureStats struct {
+	PacketsReceived  int
+	PacketsDropped   int
+	PacketsIfDropped int
+}
+
+// captureConfig holds the settings a capture backend opens its handles with
+type captureConfig struct {
+	snaplen     int
+	bufferSize  int
+	timeout     int
+	filter      string
+	fanoutGroup uint16
+	sockets     int
+	// timestamps is the most precise clock the handle should timestamp packets with
+	timestamps TimestampSource
+}
+
+// captureHandle is a source of captured packets, implemented by each capture backend
+type captureHandle interface {
+	// ZeroCopyReadPacketData returns the next packet, the data is only valid until the next call
+	ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	// FirstLayerType returns the layer type packets read from the handle should be decoded from
+	FirstLayerType() gopacket.LayerType
+	// CaptureStats returns the counters of the handle since it was opened
+	CaptureStats() (CaptureStats, error)
+	// RxTimestampSource returns the clock packets read from the handle are timestamped with
+	RxTimestampSource() TimestampSource
+	Close()
+}
+
+// WithCaptureBackend sets the backend used to capture packets
+func WithCaptureBackend(backend CaptureBackend) TransportChannelOption {
+	return func(tc *TransportChannel) error {
+		tc.backend = backend
+		return nil
+	}
+}
+
+// WithFanout opens the given number of AF_PACKET sockets per interface, joined in a fanout group which spreads
+// packets across them by flow, each read by its own goroutine.  groupID must be unique on the host, one group
+// is created per interface starting at groupID.  Only supported by the AFPacketBackend.
+func WithFanout(groupID uint16, sockets int) TransportChannelOption {
+	return func(tc *TransportChannel) error {
+		if sockets < 1 {
+			return fmt.Errorf("fanout requires atleast 1 socket, got %d", sockets)
+		}
+		tc.fanoutGroup = groupID
+		tc.fanoutSockets = sockets
+		return nil
+	}
+}
+
+// openHandles opens the capture handles for the idx'th device with the configured backend
+func (tc *TransportChannel) openHandles(idx int, deviceName string) ([]captureHandle, error) {
+	backend := tc.backend
+	if backend == DefaultBackend {
+		backend = defaultBackend
+	}
+
+	if tc.fanoutSockets > 1 && backend != AFPacketBackend {
+		return nil, fmt.Errorf("fanout is only supported by the %s backend", AFPacketBackend)
+	}
+
+	cfg := captureConfig{
+		snaplen:     tc.snaplen,
+		bufferSize:  tc.bufferSize,
+		timeout:     tc.timeout,
+		filter:      tc.filter,
+		fanoutGroup: tc.fanoutGroup + uint16(idx),
+		sockets:     tc.fanoutSockets,
+		timestamps:  tc.timestampSource,
+	}
+
+	switch backend {
+	case PcapBackend:
+		handle, err := openPcapHandle(deviceName, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return []captureHandle{handle}, nil
+	case AFPacketBackend:
+		return openAFPacketHandles(deviceName, cfg)
+	}
+
+	return nil, fmt.Errorf("unknown capture backend %d", backend)
+}
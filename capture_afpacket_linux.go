@@ -0,0 +1,320 @@
+package beacon
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/google/gopacket"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	afPacketBlockSize = 1 << 20
+	afPacketFrameSize = 2048
+
+	// offsets into struct tpacket_block_desc, whose tpacket_hdr_v1 starts after the version and offset_to_priv
+	afPacketBlockStatusOffset  = 8
+	afPacketBlockNumPktsOffset = 12
+	afPacketBlockFirstOffset   = 16
+
+	// the sockaddr_ll of each packet follows its tpacket3_hdr, aligned to TPACKET_ALIGNMENT
+	afPacketSockaddrOffset = (unix.SizeofTpacket3Hdr + unix.TPACKET_ALIGNMENT - 1) &^ (unix.TPACKET_ALIGNMENT - 1)
+	afPacketIfindexOffset  = afPacketSockaddrOffset + 4
+)
+
+// the lifecycle of an afPacketHandle, whichever of the reader or Close gets to the ring last releases it
+const (
+	afPacketOpen int32 = iota
+	afPacketReading
+	afPacketReleased
+)
+
+// afPacketHandle reads packets from a memory mapped TPACKET_V3 ring of an AF_PACKET datagram socket.  Packets are
+// delivered starting at the network header, the link layer header is stripped by the kernel.
+type afPacketHandle struct {
+	fd        int
+	ring      []byte
+	blockSize int
+	numBlocks int
+	timeout   int
+
+	// state of the block currently being read, only touched by the reader
+	current int
+	block   []byte
+	pending uint32
+	offset  uint32
+
+	closed   int32
+	state    int32
+	rxSource TimestampSource
+
+	statsLock sync.Mutex
+	stats     CaptureStats
+}
+
+// openAFPacketHandles opens the given number of AF_PACKET sockets on a device, joined in a fanout group if there is more than one
+func openAFPacketHandles(deviceName string, cfg captureConfig) ([]captureHandle, error) {
+	program, err := CompileBPFFilter(cfg.filter, cfg.snaplen)
+	if err != nil {
+		return nil, err
+	}
+
+	ifindex := 0
+	if deviceName != "any" {
+		iface, err := net.InterfaceByName(deviceName)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find interface %s: %s", deviceName, err)
+		}
+		ifindex = iface.Index
+	}
+
+	sockets := cfg.sockets
+	if sockets < 1 {
+		sockets = 1
+	}
+
+	handles := make([]captureHandle, 0, sockets)
+	for i := 0; i < sockets; i++ {
+		handle, err := openAFPacketHandle(ifindex, cfg.bufferSize/sockets, cfg.timeout, program)
+		if err == nil && sockets > 1 {
+			err = handle.joinFanout(cfg.fanoutGroup)
+		}
+		if err == nil && cfg.timestamps == HardwareTimestamp {
+			if tsErr := handle.enableHardwareTimestamps(); tsErr != nil {
+				log.Printf("Hardware rx timestamps are unavailable on %s, falling back to kernel timestamps: %s", deviceName, tsErr)
+			}
+		}
+		if err != nil {
+			if handle != nil {
+				handle.Close()
+			}
+			for _, opened := range handles {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("Failed to open AF_PACKET socket on %s: %s", deviceName, err)
+		}
+		handles = append(handles, handle)
+	}
+
+	return handles, nil
+}
+
+func openAFPacketHandle(ifindex, bufferSize, timeout int, program []BPFInstruction) (*afPacketHandle, error) {
+	// the socket is created without a protocol so that it doesn't receive anything until the ring and filter are
+	// in place, it starts receiving once it is bound below
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create socket: %s", err)
+	}
+
+	h := &afPacketHandle{
+		fd:        fd,
+		rxSource:  KernelTimestamp,
+		blockSize: afPacketBlockSize,
+		numBlocks: bufferSize / afPacketBlockSize,
+		timeout:   timeout,
+	}
+	if h.numBlocks < 1 {
+		h.numBlocks = 1
+	}
+	if h.timeout <= 0 {
+		h.timeout = 1
+	}
+
+	if err := h.setup(ifindex, program); err != nil {
+		h.release()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *afPacketHandle) setup(ifindex int, program []BPFInstruction) error {
+	filter := make([]unix.SockFilter, len(program))
+	for idx, ins := range program {
+		filter[idx] = unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	fprog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.SetsockoptSockFprog(h.fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &fprog); err != nil {
+		return fmt.Errorf("Failed to attach filter: %s", err)
+	}
+
+	if err := unix.SetsockoptInt(h.fd, unix.SOL_PACKET, unix.PACKET_VERSION, unix.TPACKET_V3); err != nil {
+		return fmt.Errorf("Failed to set TPACKET_V3: %s", err)
+	}
+
+	req := unix.TpacketReq3{
+		Block_size:     uint32(h.blockSize),
+		Block_nr:       uint32(h.numBlocks),
+		Frame_size:     afPacketFrameSize,
+		Frame_nr:       uint32(h.blockSize / afPacketFrameSize * h.numBlocks),
+		Retire_blk_tov: uint32(h.timeout),
+	}
+	if err := unix.SetsockoptTpacketReq3(h.fd, unix.SOL_PACKET, unix.PACKET_RX_RING, &req); err != nil {
+		return fmt.Errorf("Failed to set up rx ring: %s", err)
+	}
+
+	// the ring is kernel memory which is never swapped out, so it isn't mapped with MAP_LOCKED, which would need
+	// CAP_IPC_LOCK or a RLIMIT_MEMLOCK as big as the ring
+	ring, err := unix.Mmap(h.fd, 0, h.blockSize*h.numBlocks, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("Failed to map rx ring: %s", err)
+	}
+	h.ring = ring
+
+	addr := unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ALL),
+		Ifindex:  ifindex,
+	}
+	if err := unix.Bind(h.fd, &addr); err != nil {
+		return fmt.Errorf("Failed to bind socket: %s", err)
+	}
+
+	return nil
+}
+
+// joinFanout adds the socket to a fanout group which spreads packets over its members by flow
+func (h *afPacketHandle) joinFanout(group uint16) error {
+	arg := int(group) | (unix.PACKET_FANOUT_HASH|unix.PACKET_FANOUT_FLAG_DEFRAG)<<16
+	if err := unix.SetsockoptInt(h.fd, unix.SOL_PACKET, unix.PACKET_FANOUT, arg); err != nil {
+		return fmt.Errorf("Failed to join fanout group %d: %s", group, err)
+	}
+	return nil
+}
+
+// enableHardwareTimestamps has the ring timestamp packets with the time the NIC received them.  The NIC must have
+// hardware timestamping enabled, see enableHardwareTimestamping.
+func (h *afPacketHandle) enableHardwareTimestamps() error {
+	if err := unix.SetsockoptInt(h.fd, unix.SOL_PACKET, unix.PACKET_TIMESTAMP, unix.SOF_TIMESTAMPING_RAW_HARDWARE); err != nil {
+		return fmt.Errorf("Failed to set PACKET_TIMESTAMP: %s", err)
+	}
+	h.rxSource = HardwareTimestamp
+	return nil
+}
+
+func (h *afPacketHandle) RxTimestampSource() TimestampSource {
+	return h.rxSource
+}
+
+// ZeroCopyReadPacketData returns the next packet in the ring, the data is only valid until the next call.
+// syscall.EAGAIN is returned if no packet arrived within the timeout.
+func (h *afPacketHandle) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if !atomic.CompareAndSwapInt32(&h.state, afPacketOpen, afPacketReading) && atomic.LoadInt32(&h.state) != afPacketReading {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+
+	for {
+		if atomic.LoadInt32(&h.closed) != 0 {
+			// the reader owns the ring once it has started, so it is responsible for releasing it
+			atomic.StoreInt32(&h.state, afPacketReleased)
+			h.release()
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+
+		if h.pending > 0 {
+			return h.nextPacket()
+		}
+
+		if h.block != nil {
+			// hand the block we are done with back to the kernel
+			atomic.StoreUint32(h.blockWord(afPacketBlockStatusOffset), unix.TP_STATUS_KERNEL)
+			h.block = nil
+			h.current = (h.current + 1) % h.numBlocks
+		}
+
+		block := h.ring[h.current*h.blockSize : (h.current+1)*h.blockSize]
+		if atomic.LoadUint32((*uint32)(unsafe.Pointer(&block[afPacketBlockStatusOffset])))&unix.TP_STATUS_USER == 0 {
+			fds := []unix.PollFd{{Fd: int32(h.fd), Events: unix.POLLIN | unix.POLLERR}}
+			n, err := unix.Poll(fds, h.timeout)
+			if err != nil && err != unix.EINTR {
+				return nil, gopacket.CaptureInfo{}, err
+			}
+			if n == 0 {
+				return nil, gopacket.CaptureInfo{}, syscall.EAGAIN
+			}
+			continue
+		}
+
+		h.block = block
+		h.pending = *h.blockWord(afPacketBlockNumPktsOffset)
+		h.offset = *h.blockWord(afPacketBlockFirstOffset)
+	}
+}
+
+// nextPacket returns the packet at the current offset of the current block and moves on to the next one
+func (h *afPacketHandle) nextPacket() ([]byte, gopacket.CaptureInfo, error) {
+	hdr := (*unix.Tpacket3Hdr)(unsafe.Pointer(&h.block[h.offset]))
+	ifindex := *(*int32)(unsafe.Pointer(&h.block[h.offset+afPacketIfindexOffset]))
+
+	start := h.offset + uint32(hdr.Net)
+	data := h.block[start : start+hdr.Snaplen]
+	ci := gopacket.CaptureInfo{
+		Timestamp:      time.Unix(int64(hdr.Sec), int64(hdr.Nsec)),
+		CaptureLength:  int(hdr.Snaplen),
+		Length:         int(hdr.Len),
+		InterfaceIndex: int(ifindex),
+	}
+
+	h.pending--
+	h.offset += hdr.Next_offset
+
+	return data, ci, nil
+}
+
+func (h *afPacketHandle) blockWord(offset int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&h.block[offset]))
+}
+
+func (h *afPacketHandle) FirstLayerType() gopacket.LayerType {
+	return RawIPLayerType
+}
+
+// CaptureStats returns the counters of the socket since it was opened.  The kernel resets its counters every time
+// they are read, so they are accumulated here.
+func (h *afPacketHandle) CaptureStats() (CaptureStats, error) {
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+
+	if atomic.LoadInt32(&h.state) == afPacketReleased {
+		return h.stats, nil
+	}
+
+	stats, err := unix.GetsockoptTpacketStatsV3(h.fd, unix.SOL_PACKET, unix.PACKET_STATISTICS)
+	if err != nil {
+		return h.stats, err
+	}
+	// tp_packets includes the packets which were dropped
+	h.stats.PacketsReceived += int(stats.Packets)
+	h.stats.PacketsDropped += int(stats.Drops)
+
+	return h.stats, nil
+}
+
+// Close stops the handle.  If a reader has started, it releases the ring on its next read, which returns io.EOF.
+func (h *afPacketHandle) Close() {
+	atomic.StoreInt32(&h.closed, 1)
+	if atomic.CompareAndSwapInt32(&h.state, afPacketOpen, afPacketReleased) {
+		h.release()
+	}
+}
+
+func (h *afPacketHandle) release() {
+	h.statsLock.Lock()
+	defer h.statsLock.Unlock()
+
+	if h.ring != nil {
+		unix.Munmap(h.ring)
+		h.ring = nil
+	}
+	unix.Close(h.fd)
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
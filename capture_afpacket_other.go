@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package beacon
+
+import (
+	"errors"
+)
+
+func openAFPacketHandles(deviceName string, cfg captureConfig) ([]captureHandle, error) {
+	return nil, errors.New("the afpacket capture backend is only supported on linux")
+}
@@ -0,0 +1,23 @@
+//go:build nopcap
+// +build nopcap
+
+package beacon
+
+import (
+	"errors"
+)
+
+// beacon was built without libpcap, so only the AF_PACKET backend is available
+const defaultBackend = AFPacketBackend
+
+type pcapHandle struct {
+	captureHandle
+}
+
+func openPcapHandle(deviceName string, cfg captureConfig) (*pcapHandle, error) {
+	return nil, errors.New("beacon was built with the nopcap tag, the pcap capture backend is unavailable")
+}
+
+func pcapVersion() string {
+	return "libpcap not linked (built with nopcap)"
+}
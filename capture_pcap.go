@@ -0,0 +1,95 @@
+//go:build !linux || !nopcap
+// +build !linux !nopcap
+
+package beacon
+
+import (
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+)
+
+const defaultBackend = PcapBackend
+
+// pcapHandle adapts a libpcap handle to a captureHandle
+type pcapHandle struct {
+	*pcap.Handle
+	rxSource TimestampSource
+}
+
+func openPcapHandle(deviceName string, cfg captureConfig) (*pcapHandle, error) {
+	inactive, err := pcap.NewInactiveHandle(deviceName)
+	if err != nil {
+		return nil, err
+	}
+	defer inactive.CleanUp()
+
+	if err := inactive.SetImmediateMode(true); err != nil {
+		return nil, err
+	} else if err := inactive.SetSnapLen(cfg.snaplen); err != nil {
+		return nil, err
+	} else if err := inactive.SetBufferSize(cfg.bufferSize); err != nil {
+		return nil, err
+	} else if err := inactive.SetTimeout(time.Millisecond * time.Duration(cfg.timeout)); err != nil { // set negative timeout, mechanics described here: https://godoc.org/github.com/google/gopacket/pcap#hdr-PCAP_Timeouts
+		return nil, err
+	}
+
+	rxSource := KernelTimestamp
+	if cfg.timestamps == HardwareTimestamp {
+		if err := setPcapHardwareTimestamps(inactive); err != nil {
+			log.Printf("Hardware rx timestamps are unavailable on %s, falling back to kernel timestamps: %s", deviceName, err)
+		} else {
+			rxSource = HardwareTimestamp
+		}
+	}
+
+	handle, err := inactive.Activate()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.filter != "" {
+		err = handle.SetBPFFilter(cfg.filter)
+		if err != nil {
+			handle.Close()
+			return nil, err
+		}
+	}
+
+	return &pcapHandle{Handle: handle, rxSource: rxSource}, nil
+}
+
+// setPcapHardwareTimestamps asks libpcap for timestamps taken by the NIC, which are not synced to the host clock
+func setPcapHardwareTimestamps(inactive *pcap.InactiveHandle) error {
+	source, err := pcap.TimestampSourceFromString("adapter_unsynced")
+	if err != nil {
+		return err
+	}
+	return inactive.SetTimestampSource(source)
+}
+
+func (h *pcapHandle) RxTimestampSource() TimestampSource {
+	return h.rxSource
+}
+
+func (h *pcapHandle) FirstLayerType() gopacket.LayerType {
+	return firstLayerType(h.Handle)
+}
+
+func (h *pcapHandle) CaptureStats() (CaptureStats, error) {
+	stats, err := h.Stats()
+	if err != nil {
+		return CaptureStats{}, err
+	}
+
+	return CaptureStats{
+		PacketsReceived:  stats.PacketsReceived,
+		PacketsDropped:   stats.PacketsDropped,
+		PacketsIfDropped: stats.PacketsIfDropped,
+	}, nil
+}
+
+func pcapVersion() string {
+	return pcap.Version()
+}
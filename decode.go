@@ -0,0 +1,210 @@
+package beacon
+
+import (
+	"errors"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	errNoPayload      = errors.New("packet didn't have an application layer or payload was less than 20 bytes")
+	errNoICMPv4       = errors.New("packet didn't have an ICMPv4 layer")
+	errNoICMPv6       = errors.New("packet didn't have an ICMPv6 layer")
+	errShortICMPv6    = errors.New("Incoming traceroute packet must have payload of len >= 4")
+	errNoQuotedUDP    = errors.New("Could not find udp layer in quoted traceroute packet")
+	errShortQuotedUDP = errors.New("udp layer contents must be of length at least 6")
+)
+
+// DecodedPacket is a view of a captured packet which has been decoded into preallocated layers.  The receive path
+// decodes each packet exactly once into a DecodedPacket owned by the reader, and hands the same view to every hasher,
+// so that packets which nobody is waiting for are never allocated.
+//
+// A DecodedPacket and the slices it exposes are only valid until the next call to Decode.  Use Packet to obtain a
+// gopacket.Packet which outlives the view.
+type DecodedPacket struct {
+	CaptureInfo gopacket.CaptureInfo
+	// Decoded lists the layers which were successfully decoded, outermost first
+	Decoded []gopacket.LayerType
+
+	Ethernet   layers.Ethernet
+	LinuxSLL   layers.LinuxSLL
+	Loopback   layers.Loopback
+	Dot1Q      layers.Dot1Q
+	Juniper    JuniperLayer
+	RawIP      RawIPLayer
+	IPv4       layers.IPv4
+	IPv6       layers.IPv6
+	ICMPv4     layers.ICMPv4
+	ICMPv6     layers.ICMPv6
+	ICMPv6Echo layers.ICMPv6Echo
+	UDP        layers.UDP
+	Payload    gopacket.Payload
+
+	data       []byte
+	firstLayer gopacket.LayerType
+	parser     *gopacket.DecodingLayerParser
+	payload    []byte
+	packet     gopacket.Packet
+
+	quoted quotedPacket
+}
+
+// quotedPacket holds the decoded IP and udp headers which an ICMP error quotes from the packet that caused it
+type quotedPacket struct {
+	ipv4    layers.IPv4
+	ipv6    layers.IPv6
+	udp     layers.UDP
+	v4      *gopacket.DecodingLayerParser
+	v6      *gopacket.DecodingLayerParser
+	decoded []gopacket.LayerType
+	done    bool
+	found   bool
+}
+
+// NewDecodedPacket returns a DecodedPacket which decodes packets starting from the given link layer type
+func NewDecodedPacket(firstLayer gopacket.LayerType) *DecodedPacket {
+	dp := &DecodedPacket{
+		firstLayer: firstLayer,
+		Decoded:    make([]gopacket.LayerType, 0, 16),
+	}
+
+	dp.parser = gopacket.NewDecodingLayerParser(
+		firstLayer,
+		&dp.Ethernet,
+		&dp.LinuxSLL,
+		&dp.Loopback,
+		&dp.Dot1Q,
+		&dp.Juniper,
+		&dp.RawIP,
+		&dp.IPv4,
+		&dp.IPv6,
+		&dp.ICMPv4,
+		&dp.ICMPv6,
+		&dp.ICMPv6Echo,
+		&dp.UDP,
+		&dp.Payload,
+	)
+	dp.parser.IgnoreUnsupported = true
+
+	dp.quoted.v4 = gopacket.NewDecodingLayerParser(layers.LayerTypeIPv4, &dp.quoted.ipv4, &dp.quoted.udp)
+	dp.quoted.v4.IgnoreUnsupported = true
+	dp.quoted.v6 = gopacket.NewDecodingLayerParser(layers.LayerTypeIPv6, &dp.quoted.ipv6, &dp.quoted.udp)
+	dp.quoted.v6.IgnoreUnsupported = true
+	dp.quoted.decoded = make([]gopacket.LayerType, 0, 4)
+
+	return dp
+}
+
+// Decode decodes the given packet data into the view, replacing whatever was previously decoded.
+// The data is not copied, the caller must not modify it until it is done with the view.
+func (dp *DecodedPacket) Decode(data []byte, ci gopacket.CaptureInfo) error {
+	dp.data = data
+	dp.CaptureInfo = ci
+	dp.payload = nil
+	dp.packet = nil
+	dp.quoted.done = false
+	dp.quoted.found = false
+
+	err := dp.parser.DecodeLayers(data, &dp.Decoded)
+	dp.payload = dp.innermostPayload()
+
+	return err
+}
+
+// innermostPayload finds the payload of the innermost transport layer.  An IP in IP packet decodes the same
+// layer type more than once, in which case the last one decoded is the innermost.
+func (dp *DecodedPacket) innermostPayload() []byte {
+	for idx := len(dp.Decoded) - 1; idx >= 0; idx-- {
+		switch dp.Decoded[idx] {
+		case gopacket.LayerTypePayload:
+			return dp.Payload
+		case layers.LayerTypeUDP:
+			return dp.UDP.Payload
+		case layers.LayerTypeICMPv4:
+			return dp.ICMPv4.Payload
+		case layers.LayerTypeICMPv6:
+			return dp.ICMPv6.Payload
+		case layers.LayerTypeICMPv6Echo:
+			return dp.ICMPv6Echo.Payload
+		case layers.LayerTypeIPv4, layers.LayerTypeIPv6:
+			// there is no transport layer, so there is no application payload
+			return nil
+		}
+	}
+	return nil
+}
+
+// Has returns true if the given layer type was decoded from the current packet
+func (dp *DecodedPacket) Has(layerType gopacket.LayerType) bool {
+	for _, decoded := range dp.Decoded {
+		if decoded == layerType {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplicationPayload returns the payload carried by the innermost transport layer of the packet, or nil
+func (dp *DecodedPacket) ApplicationPayload() []byte {
+	return dp.payload
+}
+
+// Data returns the raw bytes of the current packet
+func (dp *DecodedPacket) Data() []byte {
+	return dp.data
+}
+
+// QuotedUDP decodes the IP and udp headers quoted in the payload of an ICMP error, and returns the udp layer.
+// The quoted packet is decoded at most once per packet.
+func (dp *DecodedPacket) QuotedUDP() (*layers.UDP, error) {
+	if dp.quoted.done {
+		if !dp.quoted.found {
+			return nil, errNoQuotedUDP
+		}
+		return &dp.quoted.udp, nil
+	}
+	dp.quoted.done = true
+
+	var parser *gopacket.DecodingLayerParser
+	var quoted []byte
+	if dp.Has(layers.LayerTypeICMPv4) {
+		parser = dp.quoted.v4
+		quoted = dp.ICMPv4.Payload
+	} else if dp.Has(layers.LayerTypeICMPv6) {
+		if len(dp.ICMPv6.Payload) < 4 {
+			return nil, errShortICMPv6
+		}
+		// skip the unused 4 bytes which precede the quoted packet in ICMPv6 errors
+		parser = dp.quoted.v6
+		quoted = dp.ICMPv6.Payload[4:]
+	} else {
+		return nil, errNoQuotedUDP
+	}
+
+	parser.DecodeLayers(quoted, &dp.quoted.decoded)
+	for _, decoded := range dp.quoted.decoded {
+		if decoded == layers.LayerTypeUDP {
+			dp.quoted.found = true
+			return &dp.quoted.udp, nil
+		}
+	}
+
+	return nil, errNoQuotedUDP
+}
+
+// Packet returns a gopacket.Packet for the current packet which remains valid after the view moves on.
+// This copies the packet data, so it should only be called for packets which are actually wanted.
+func (dp *DecodedPacket) Packet() gopacket.Packet {
+	if dp.packet != nil {
+		return dp.packet
+	}
+
+	data := make([]byte, len(dp.data))
+	copy(data, dp.data)
+
+	dp.packet = gopacket.NewPacket(data, dp.firstLayer, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	dp.packet.Metadata().CaptureInfo = dp.CaptureInfo
+
+	return dp.packet
+}
@@ -0,0 +1,204 @@
+package beacon
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// createTestTTLExceededPacket wraps the given packet in an ethernet framed ICMP time exceeded error sent from router
+func createTestTTLExceededPacket(t testing.TB, router, dest net.IP, original []byte) []byte {
+	opts := gopacket.SerializeOptions{
+		ComputeChecksums: true,
+		FixLengths:       true,
+	}
+
+	ethLayer := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{5, 4, 3, 2, 1, 0},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	icmpLayer := &layers.ICMPv4{
+		TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeTimeExceeded, layers.ICMPv4CodeTTLExceeded),
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, opts,
+		ethLayer,
+		buildIPv4ICMPLayer(router, dest, 64),
+		icmpLayer,
+		// routers quote the IP header and the first 8 bytes of its payload
+		gopacket.Payload(original[:ipHeaderLen+udpHeaderLen]),
+	)
+	if err != nil {
+		t.Errorf("Failed to create a ttl exceeded packet for the test: %s", err)
+		t.FailNow()
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecodeBoomerangPacket(t *testing.T) {
+	idHash, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 20, 30, 96}, net.IP{104, 44, 22, 235})
+
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	if err := dp.Decode(packetBytes, gopacket.CaptureInfo{}); err != nil {
+		t.Errorf("Failed to decode boomerang packet: %s", err)
+		t.FailNow()
+	}
+
+	if !dp.Has(layers.LayerTypeUDP) {
+		t.Errorf("Expected the decoded packet to have a udp layer, decoded: %v", dp.Decoded)
+	}
+
+	hash, err := BoomerangPacketHasher{}.HashDecodedPacket(dp)
+	if err != nil {
+		t.Errorf("Failed to hash decoded boomerang packet: %s", err)
+		t.FailNow()
+	}
+
+	if !bytes.Equal(hash, idHash) {
+		t.Errorf("Decoded hash %x does not match the id %x the packet was built with", hash, idHash)
+	}
+}
+
+func TestDecodeTracerouteHashMatchesSentPacket(t *testing.T) {
+	source := net.IP{10, 20, 30, 96}
+	dest := net.IP{104, 44, 19, 212}
+
+	buf := gopacket.NewSerializeBuffer()
+	err := buildUDPTraceroutePacket(source, dest, layers.UDPPort(33440), layers.UDPPort(33450), 3, []byte("tra"), buf)
+	if err != nil {
+		t.Errorf("Failed to build traceroute packet: %s", err)
+		t.FailNow()
+	}
+	expectedHash, err := computeTraceRouteHash(buf.Bytes(), true)
+	if err != nil {
+		t.Errorf("Failed to hash traceroute packet: %s", err)
+		t.FailNow()
+	}
+
+	reply := createTestTTLExceededPacket(t, net.IP{104, 44, 22, 235}, source, buf.Bytes())
+
+	dp := NewDecodedPacket(layers.LayerTypeEthernet)
+	dp.Decode(reply, gopacket.CaptureInfo{})
+
+	hash, err := V4TraceRouteHasher{}.HashDecodedPacket(dp)
+	if err != nil {
+		t.Errorf("Failed to hash decoded ttl exceeded packet: %s", err)
+		t.FailNow()
+	}
+	if string(hash) != expectedHash {
+		t.Errorf("Decoded traceroute hash %x does not match the hash of the sent packet %x", hash, expectedHash)
+	}
+
+	// the slow path must agree with the fast path
+	packetHash, err := V4TraceRouteHasher{}.HashPacket(dp.Packet())
+	if err != nil {
+		t.Errorf("Failed to hash materialized ttl exceeded packet: %s", err)
+		t.FailNow()
+	}
+	if packetHash != expectedHash {
+		t.Errorf("Materialized traceroute hash %x does not match the hash of the sent packet %x", packetHash, expectedHash)
+	}
+
+	v6Hasher := V6TraceRouteHasher{}
+	if _, err := v6Hasher.HashDecodedPacket(dp); err == nil {
+		t.Errorf("Expected the v6 hasher to reject a v4 packet")
+	}
+}
+
+func TestDecodedPacketOutlivesView(t *testing.T) {
+	_, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 20, 30, 96}, net.IP{104, 44, 22, 235})
+	ci := gopacket.CaptureInfo{Length: len(packetBytes), CaptureLength: len(packetBytes)}
+
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	dp.Decode(packetBytes, ci)
+	packet := dp.Packet()
+
+	// reuse the view and scribble over the capture buffer, as the receive path would
+	dp.Decode([]byte{}, gopacket.CaptureInfo{})
+	for idx := range packetBytes {
+		packetBytes[idx] = 0
+	}
+
+	if packet.Metadata().CaptureInfo.Length != ci.Length {
+		t.Errorf("Expected materialized packet to keep its capture info")
+	}
+	app := packet.ApplicationLayer()
+	if app == nil || !bytes.HasPrefix(app.Payload(), []byte("moby")) {
+		t.Errorf("Materialized packet was modified when the view was reused")
+	}
+}
+
+func TestRunDecodedDoesNotAllocateForUnmatchedPackets(t *testing.T) {
+	_, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 20, 30, 96}, net.IP{104, 44, 22, 235})
+
+	phm := NewPacketHashMap()
+	phm.AttachHasher(BoomerangPacketHasher{})
+	phm.store("some other hash", make(chan gopacket.Packet, 1))
+
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	allocs := testing.AllocsPerRun(100, func() {
+		dp.Decode(packetBytes, gopacket.CaptureInfo{})
+		phm.runDecoded(dp)
+	})
+
+	if allocs != 0 {
+		t.Errorf("Expected decoding and dispatching an unmatched packet not to allocate, got %f allocations", allocs)
+	}
+}
+
+func TestRunDecodedMatch(t *testing.T) {
+	idHash, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 20, 30, 96}, net.IP{104, 44, 22, 235})
+
+	phm := NewPacketHashMap()
+	phm.AttachHasher(BoomerangPacketHasher{})
+	packetChan := make(chan gopacket.Packet, 1)
+	phm.store(string(idHash), packetChan)
+
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	phm.runDecoded(dp)
+
+	matchedPacket, ok := <-packetChan
+	if !ok || matchedPacket == nil {
+		t.Errorf("Expected the registered hash to receive the decoded packet")
+	}
+	if _, ok := <-packetChan; ok {
+		t.Errorf("Expected the match channel to be closed after the first match")
+	}
+}
+
+func BenchmarkDecodeAndDispatch(b *testing.B) {
+	testSize := 10000
+	packetArray := make([][]byte, testSize)
+	hashArray := make([]string, testSize)
+	srcIP := net.IP{0, 0, 0, 0}
+	destIP := net.IP{10, 20, 8, 129}
+
+	phm := NewPacketHashMap()
+	phm.AttachHasher(BoomerangPacketHasher{})
+
+	for i := 0; i < testSize; i++ {
+		idHash, packetBytes := createTestIncomingBoomerangPacket(srcIP, destIP)
+		packetArray[i] = packetBytes
+		hashArray[i] = string(idHash)
+	}
+
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i, packetBytes := range packetArray {
+			packetChan := make(chan gopacket.Packet, 1)
+			phm.store(hashArray[i], packetChan)
+			dp.Decode(packetBytes, gopacket.CaptureInfo{})
+			phm.runDecoded(dp)
+			<-packetChan
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package beacon
+
+import (
+	"fmt"
+	"math"
+	"net"
+)
+
+// DirectionalHopResult holds the results of probing a single hop of a path with each ProbeMode
+type DirectionalHopResult struct {
+	RoundTrip     HopResult
+	ForwardPinned HopResult
+	ReversePinned HopResult
+	Native        HopResult
+}
+
+// Record counts one probe sent with the given mode, and whether it made it back
+func (d *DirectionalHopResult) Record(mode ProbeMode, successful bool) {
+	var hop *HopResult
+	switch mode {
+	case RoundTrip:
+		hop = &d.RoundTrip
+	case ForwardPinned:
+		hop = &d.ForwardPinned
+	case ReversePinned:
+		hop = &d.ReversePinned
+	case Native:
+		hop = &d.Native
+	default:
+		return
+	}
+
+	hop.Sent++
+	if successful {
+		hop.Received++
+	}
+}
+
+// LinkDirectionalLoss is the estimated loss in each direction of the link between From and To
+type LinkDirectionalLoss struct {
+	From        net.IP
+	To          net.IP
+	ForwardLoss float64
+	ReverseLoss float64
+	// Unreliable is set when the native round trip to To saw too much loss to use as a reference
+	Unreliable bool
+}
+
+// DirectionVerdict is the result of attributing loss over a probed path to the forward or reverse direction
+type DirectionVerdict struct {
+	Links   []LinkDirectionalLoss
+	Forward LossVerdict
+	Reverse LossVerdict
+}
+
+// String returns a human readable summary of the verdict
+func (v DirectionVerdict) String() string {
+	return fmt.Sprintf("forward: %s\nreverse: %s", v.Forward, v.Reverse)
+}
+
+// minReferenceRate is the lowest native round trip success rate at which a hop is used to attribute loss
+const minReferenceRate = 0.5
+
+// InferLossDirection attributes loss over a probed path to the forward or reverse direction of each link, given the
+// per-hop results of ProbeEachHopOfPathDirectional.  hops[i] must hold the results for path[i+1].
+//
+// A forward pinned probe crosses the pinned forward legs and the native return route, a reverse pinned probe crosses
+// the native forward route and the pinned reverse legs, and a native probe crosses both native routes.  Dividing the
+// success rate of a pinned probe by that of the native probe cancels out the native leg they share, leaving an
+// estimate of the success rate of only the pinned legs in one direction.
+func InferLossDirection(path Path, hops []DirectionalHopResult) (DirectionVerdict, error) {
+	if len(path) < 2 {
+		return DirectionVerdict{}, fmt.Errorf("Path must have atleast 2 hops")
+	}
+	if len(hops) != len(path)-1 {
+		return DirectionVerdict{}, fmt.Errorf("Expected %d hop results for path of length %d, got %d", len(path)-1, len(path), len(hops))
+	}
+
+	verdict := DirectionVerdict{
+		Links: make([]LinkDirectionalLoss, len(hops)),
+	}
+	forward := make([]HopResult, len(hops))
+	reverse := make([]HopResult, len(hops))
+
+	prevForwardRate, prevReverseRate := 1.0, 1.0
+	for idx, hop := range hops {
+		link := LinkDirectionalLoss{
+			From: path[idx],
+			To:   path[idx+1],
+		}
+
+		reference := hop.Native.SuccessRate()
+		if hop.Native.Sent == 0 || reference < minReferenceRate {
+			// the native legs are too lossy to cancel out, fall back to the raw pinned results
+			link.Unreliable = true
+			reference = 1
+		}
+
+		forward[idx] = normalizeHopResult(hop.ForwardPinned, reference)
+		reverse[idx] = normalizeHopResult(hop.ReversePinned, reference)
+
+		forwardRate := forward[idx].SuccessRate()
+		reverseRate := reverse[idx].SuccessRate()
+		link.ForwardLoss = segmentLoss(prevForwardRate, forwardRate)
+		link.ReverseLoss = segmentLoss(prevReverseRate, reverseRate)
+		if forward[idx].Sent > 0 {
+			prevForwardRate = math.Min(prevForwardRate, forwardRate)
+		}
+		if reverse[idx].Sent > 0 {
+			prevReverseRate = math.Min(prevReverseRate, reverseRate)
+		}
+
+		verdict.Links[idx] = link
+	}
+
+	var err error
+	verdict.Forward, err = LocalizeLoss(path, forward)
+	if err != nil {
+		return verdict, err
+	}
+	verdict.Reverse, err = LocalizeLoss(path, reverse)
+	if err != nil {
+		return verdict, err
+	}
+
+	return verdict, nil
+}
+
+// normalizeHopResult scales the number of received probes by the success rate of a reference leg
+func normalizeHopResult(hop HopResult, reference float64) HopResult {
+	if hop.Sent == 0 || reference <= 0 {
+		return hop
+	}
+
+	received := int(math.Round(float64(hop.Received) / reference))
+	if received > hop.Sent {
+		received = hop.Sent
+	}
+
+	return HopResult{Sent: hop.Sent, Received: received}
+}
+
+// segmentLoss returns the fraction of probes lost between two consecutive hops given their success rates
+func segmentLoss(prevRate, rate float64) float64 {
+	if prevRate <= 0 || rate >= prevRate {
+		return 0
+	}
+	return 1 - rate/prevRate
+}
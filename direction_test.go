@@ -0,0 +1,70 @@
+package beacon
+
+import (
+	"testing"
+)
+
+func TestInferLossDirectionForward(t *testing.T) {
+	clean := HopResult{30, 30}
+	hops := []DirectionalHopResult{
+		{RoundTrip: clean, ForwardPinned: clean, ReversePinned: clean, Native: clean},
+		{RoundTrip: clean, ForwardPinned: clean, ReversePinned: clean, Native: clean},
+		{RoundTrip: HopResult{30, 15}, ForwardPinned: HopResult{30, 15}, ReversePinned: clean, Native: clean},
+		{RoundTrip: HopResult{30, 14}, ForwardPinned: HopResult{30, 16}, ReversePinned: clean, Native: clean},
+	}
+
+	verdict, err := InferLossDirection(localizeTestPath, hops)
+	if err != nil {
+		t.Errorf("Failed to infer loss direction: %s", err)
+		t.FailNow()
+	}
+
+	if verdict.Forward.Kind != LossLocalized || verdict.Forward.FarIdx != 3 {
+		t.Errorf("Expected forward loss to be localized to hop 3, got: %s", verdict.Forward)
+	}
+	if verdict.Reverse.Kind != NoLoss {
+		t.Errorf("Expected no reverse loss, got: %s", verdict.Reverse)
+	}
+
+	link := verdict.Links[2]
+	if link.ForwardLoss < 0.4 || link.ReverseLoss != 0 {
+		t.Errorf("Expected link %s -> %s to show only forward loss, got forward %f reverse %f", link.From, link.To, link.ForwardLoss, link.ReverseLoss)
+	}
+}
+
+func TestInferLossDirectionCancelsNativeLoss(t *testing.T) {
+	clean := HopResult{100, 100}
+	hops := []DirectionalHopResult{
+		{RoundTrip: clean, ForwardPinned: clean, ReversePinned: clean, Native: clean},
+		{RoundTrip: clean, ForwardPinned: clean, ReversePinned: clean, Native: clean},
+		{RoundTrip: clean, ForwardPinned: HopResult{100, 80}, ReversePinned: HopResult{100, 40}, Native: HopResult{100, 80}},
+		{RoundTrip: clean, ForwardPinned: HopResult{100, 80}, ReversePinned: HopResult{100, 40}, Native: HopResult{100, 80}},
+	}
+
+	verdict, err := InferLossDirection(localizeTestPath, hops)
+	if err != nil {
+		t.Errorf("Failed to infer loss direction: %s", err)
+		t.FailNow()
+	}
+
+	if verdict.Forward.Kind == LossLocalized {
+		t.Errorf("Loss shared with the native route should not be attributed to the forward direction, got: %s", verdict.Forward)
+	}
+	if verdict.Reverse.Kind != LossLocalized || verdict.Reverse.FarIdx != 3 {
+		t.Errorf("Expected reverse loss to be localized to hop 3, got: %s", verdict.Reverse)
+	}
+}
+
+func TestDirectionalHopResultRecord(t *testing.T) {
+	d := DirectionalHopResult{}
+	d.Record(ForwardPinned, true)
+	d.Record(ForwardPinned, false)
+	d.Record(Native, true)
+
+	if d.ForwardPinned.Sent != 2 || d.ForwardPinned.Received != 1 {
+		t.Errorf("Expected forward pinned to have 2 sent and 1 received, got %+v", d.ForwardPinned)
+	}
+	if d.Native.Sent != 1 || d.RoundTrip.Sent != 0 {
+		t.Errorf("Results were recorded against the wrong mode: %+v", d)
+	}
+}
@@ -0,0 +1,204 @@
+package beacon
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// bsdanyDevice is the interface name which selects the interfaces with an ISIS adjacency on a Junos device
+const bsdanyDevice = "bsdany"
+
+// junosCLI is the path of the Junos CLI, which runs operational commands
+const junosCLI = "/usr/sbin/cli"
+
+// InterfaceDiscoverer selects the interfaces a TransportChannel captures on
+type InterfaceDiscoverer interface {
+	Interfaces() ([]string, error)
+}
+
+// InterfaceDiscovererFunc adapts a function to an InterfaceDiscoverer
+type InterfaceDiscovererFunc func() ([]string, error)
+
+// Interfaces calls f
+func (f InterfaceDiscovererFunc) Interfaces() ([]string, error) {
+	return f()
+}
+
+// InterfaceList is an explicit list of interfaces
+type InterfaceList []string
+
+// Interfaces returns the list
+func (l InterfaceList) Interfaces() ([]string, error) {
+	if len(l) == 0 {
+		return nil, fmt.Errorf("no interfaces were listed")
+	}
+	return l, nil
+}
+
+// UpInterfaces selects every interface which is up and has an address assigned
+type UpInterfaces struct {
+	// IncludeLoopback selects loopback interfaces as well
+	IncludeLoopback bool
+}
+
+// Interfaces lists the interfaces of the host
+func (u UpInterfaces) Interfaces() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list interfaces: %s", err)
+	}
+
+	var devices []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || (!u.IncludeLoopback && iface.Flags&net.FlagLoopback != 0) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get addresses of %s: %s", iface.Name, err)
+		}
+		if len(addrs) > 0 {
+			devices = append(devices, iface.Name)
+		}
+	}
+	return devices, nil
+}
+
+// MatchingInterfaces selects the interfaces of another discoverer whose names match a pattern
+type MatchingInterfaces struct {
+	Pattern *regexp.Regexp
+	// From is the discoverer to filter, nil filters the UpInterfaces
+	From InterfaceDiscoverer
+}
+
+// InterfacesMatching selects the up interfaces whose names match a regular expression
+func InterfacesMatching(pattern string) (MatchingInterfaces, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return MatchingInterfaces{}, fmt.Errorf("Failed to parse interface pattern %q: %s", pattern, err)
+	}
+	return MatchingInterfaces{Pattern: re}, nil
+}
+
+// Interfaces returns the matching interfaces
+func (m MatchingInterfaces) Interfaces() ([]string, error) {
+	from := m.From
+	if from == nil {
+		from = UpInterfaces{}
+	}
+	candidates, err := from.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []string
+	for _, device := range candidates {
+		if m.Pattern.MatchString(device) {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+// JunosISISAdjacencies selects the interfaces with an ISIS adjacency on a Junos device, as reported by the CLI
+type JunosISISAdjacencies struct {
+	// CLI is the path of the Junos CLI, empty runs /usr/sbin/cli
+	CLI string
+}
+
+// Interfaces runs "show isis adjacency" and parses the interfaces out of its output
+func (j JunosISISAdjacencies) Interfaces() ([]string, error) {
+	cli := j.CLI
+	if cli == "" {
+		cli = junosCLI
+	}
+	out, err := exec.Command(cli, "-c", "show isis adjacency").Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to show isis adjacency: %s", err)
+	}
+	return ParseISISAdjacencies(string(out))
+}
+
+// ParseISISAdjacencies parses the interfaces out of the output of the Junos "show isis adjacency" command:
+//
+//	Interface             System         L State        Hold (secs) SNPA
+//	ae0.0                 rtr2           2  Up                   23
+//	xe-0/0/1.100          rtr3           1  Up                    7  0:5:85:8f:c8:bd
+//
+// Every adjacency row names an interface, followed by the system and the level of the adjacency.  The logical unit is
+// dropped from the interface name, an interface with several adjacencies is returned once, and the output is an error
+// if it doesn't have the header.
+func ParseISISAdjacencies(output string) ([]string, error) {
+	var devices []string
+	seen := make(map[string]bool)
+	header := false
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if !header {
+			header = fields[0] == "Interface"
+			continue
+		}
+		if len(fields) < 4 || !isISISLevel(fields[2]) {
+			continue
+		}
+
+		device := fields[0]
+		if idx := strings.LastIndex(device, "."); idx > 0 {
+			device = device[:idx]
+		}
+		if !seen[device] {
+			seen[device] = true
+			devices = append(devices, device)
+		}
+	}
+	if !header {
+		return nil, fmt.Errorf("unrecognized isis adjacency output, expected a header starting with Interface")
+	}
+	return devices, nil
+}
+
+func isISISLevel(field string) bool {
+	return field == "1" || field == "2" || field == "3"
+}
+
+// WithInterfaces captures on every one of a list of interfaces, with a handle per interface so the ingress interface
+// of each packet is known, which the "any" device loses on some platforms
+func WithInterfaces(devices ...string) TransportChannelOption {
+	return WithInterfaceDiscoverer(InterfaceList(devices))
+}
+
+// WithInterfaceDiscoverer captures on every interface the discoverer selects.  The discoverer runs once all the options
+// are applied, inside the network namespace of the TransportChannel.
+func WithInterfaceDiscoverer(discoverer InterfaceDiscoverer) TransportChannelOption {
+	return func(tc *TransportChannel) error {
+		tc.discoverer = discoverer
+		return nil
+	}
+}
+
+// discoverInterfaces replaces the devices of the TransportChannel with the ones its discoverer selects
+func (tc *TransportChannel) discoverInterfaces() error {
+	var devices []string
+	err := tc.network.Run(func() error {
+		var err error
+		devices, err = tc.discoverer.Interfaces()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to discover interfaces: %s", err)
+	}
+	if len(devices) == 0 {
+		return fmt.Errorf("Failed to discover interfaces: found no devices to listen on")
+	}
+	for _, device := range devices {
+		log.Printf("Listening on %s\n", device)
+	}
+	tc.deviceNames = devices
+	return nil
+}
@@ -0,0 +1,107 @@
+package beacon
+
+import (
+	"net"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// captured from cli -c "show isis adjacency" on an MX, including the LAN adjacency with a SNPA which the column
+// count used to skip
+const isisAdjacencyOutput = `Interface             System         L State        Hold (secs) SNPA
+ae0.0                 re0-core-02    2  Up                   22
+ae1.0                 re0-core-03    2  Up                   25
+et-0/0/48.0           spine-01       2  Up                   19
+et-0/0/48.0           spine-01       1  Up                   21
+xe-0/1/0.100          edge-01        1  Up                    6  0:1c:73:d2:aa:1
+ge-0/0/10.0           edge-02        2  Initializing         26
+
+{master}
+`
+
+func TestParseISISAdjacencies(t *testing.T) {
+	devices, err := ParseISISAdjacencies(isisAdjacencyOutput)
+	if err != nil {
+		t.Fatalf("Failed to parse isis adjacencies: %s", err)
+	}
+
+	expected := []string{"ae0", "ae1", "et-0/0/48", "xe-0/1/0", "ge-0/0/10"}
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("Expected devices %v, got %v", expected, devices)
+	}
+}
+
+func TestParseISISAdjacenciesEmpty(t *testing.T) {
+	devices, err := ParseISISAdjacencies("Interface             System         L State        Hold (secs) SNPA\n\n{master}\n")
+	if err != nil {
+		t.Fatalf("Failed to parse isis adjacencies: %s", err)
+	}
+	if len(devices) != 0 {
+		t.Errorf("Expected no devices, got %v", devices)
+	}
+
+	if _, err := ParseISISAdjacencies("error: the isis subsystem is not running\n"); err == nil {
+		t.Errorf("Expected an error parsing output without a header")
+	}
+}
+
+func TestMatchingInterfaces(t *testing.T) {
+	matching := MatchingInterfaces{
+		Pattern: regexp.MustCompile(`^(eth|ens)\d+$`),
+		From:    InterfaceList{"lo", "eth0", "eth1", "ens3", "docker0", "eth0.100"},
+	}
+	devices, err := matching.Interfaces()
+	if err != nil {
+		t.Fatalf("Failed to match interfaces: %s", err)
+	}
+
+	expected := []string{"eth0", "eth1", "ens3"}
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("Expected devices %v, got %v", expected, devices)
+	}
+
+	if _, err := InterfacesMatching("eth("); err == nil {
+		t.Errorf("Expected an error compiling an invalid pattern")
+	}
+}
+
+func TestWithInterfaceDiscoverer(t *testing.T) {
+	tc := &TransportChannel{}
+	if err := WithInterfaceDiscoverer(InterfaceList{"eth0", "eth1"})(tc); err != nil {
+		t.Fatalf("Failed to apply discoverer: %s", err)
+	}
+	if err := tc.discoverInterfaces(); err != nil {
+		t.Fatalf("Failed to discover interfaces: %s", err)
+	}
+	if !reflect.DeepEqual(tc.deviceNames, []string{"eth0", "eth1"}) {
+		t.Errorf("Expected to listen on eth0 and eth1, got %v", tc.deviceNames)
+	}
+
+	WithInterfaceDiscoverer(MatchingInterfaces{Pattern: regexp.MustCompile("^bond"), From: InterfaceList{"eth0"}})(tc)
+	if err := tc.discoverInterfaces(); err == nil {
+		t.Errorf("Expected an error when no interfaces are discovered")
+	}
+}
+
+func TestInterfaceName(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil || len(ifaces) == 0 {
+		t.Skipf("No interfaces to name: %v", err)
+	}
+	iface := ifaces[0]
+
+	tc := &TransportChannel{}
+	if name := tc.InterfaceName(iface.Index); name != iface.Name {
+		t.Errorf("Expected interface %d to be %s, got %q", iface.Index, iface.Name, name)
+	}
+	if index := deviceIndex(iface.Name); index != iface.Index {
+		t.Errorf("Expected %s to have index %d, got %d", iface.Name, iface.Index, index)
+	}
+	if index := deviceIndex("any"); index != 0 {
+		t.Errorf("Expected any not to have an index, got %d", index)
+	}
+	if name := tc.InterfaceName(0); name != "" {
+		t.Errorf("Expected no interface for index 0, got %q", name)
+	}
+}
@@ -0,0 +1,355 @@
+package beacon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/uuid"
+)
+
+// Every captured packet is decoded once and offered to the rules registered with the TransportChannel in two
+// stages.  Keyed rules, which includes hashes registered with RegisterHash, are found with a single map lookup on the
+// hashes computed by the attached PacketHashers.  Filter rules, which includes Listeners, are then evaluated in order
+// of priority against the DecodedPacket on the receive path.  A matching exclusive rule keeps the packet from every
+// stage and rule after it.
+
+// Predicate reports whether a packet matches a filter rule.  It runs on the receive path, so it must be cheap and
+// must not retain the DecodedPacket or any slice of it.
+type Predicate func(dp *DecodedPacket) bool
+
+// Rule describes the packets a registration receives.  Exactly one of Key and Filter must be set.
+type Rule struct {
+	// Key matches packets which the attached PacketHashers hash to Key
+	Key string
+	// Filter matches packets for which it returns true
+	Filter Predicate
+	// Priority orders the evaluation of filter rules, highest first.  Keyed rules are always looked up before filters.
+	Priority int
+	// Exclusive keeps a packet this rule matched from the rules after it
+	Exclusive bool
+	// Persistent keeps the rule registered after it matches, otherwise it is removed by its first match
+	Persistent bool
+	// Timeout removes the rule once it passes, 0 never expires
+	Timeout time.Duration
+}
+
+// Match is a packet delivered to a rule
+type Match struct {
+	Packet gopacket.Packet
+	// CaptureInfo holds the capture metadata of the packet, including its receive timestamp
+	CaptureInfo gopacket.CaptureInfo
+	// Hasher is the name of the PacketHasher which computed the matching hash, empty for filter rules
+	Hasher string
+	// Seq counts the packets which matched the rule, starting at 1.  Anything above 1 is a duplicate.
+	Seq uint64
+}
+
+// Registration identifies a rule registered with Register
+type Registration struct {
+	id  uuid.UUID
+	key string
+}
+
+// Register adds a rule to the dispatch engine of the TransportChannel and starts capturing if it hasn't already.
+// Matching packets are sent over matches, which is closed once the rule is removed by a match, by its timeout or by
+// Unregister.  The receive path never blocks on matches, a match which finds it full is dropped, which shows up as a
+// gap in Seq.
+func (tc *TransportChannel) Register(rule Rule, matches chan Match) (Registration, error) {
+	if (rule.Key == "") == (rule.Filter == nil) {
+		return Registration{}, fmt.Errorf("a rule must have exactly one of a key or a filter")
+	}
+	if matches == nil {
+		return Registration{}, fmt.Errorf("a rule must have a matches channel")
+	}
+
+	reg := Registration{id: uuid.New(), key: rule.Key}
+	if rule.Key != "" {
+		var deadline time.Time
+		if rule.Timeout > 0 {
+			deadline = time.Now().Add(rule.Timeout)
+		}
+		tc.packetHashes.storeRegistration(&hashRegistration{
+			id:         reg.id,
+			hash:       rule.Key,
+			matches:    matches,
+			persistent: rule.Persistent,
+			exclusive:  rule.Exclusive,
+			deadline:   deadline,
+		})
+	} else {
+		tc.filters.add(&filterRule{
+			id:         reg.id,
+			filter:     rule.Filter,
+			priority:   rule.Priority,
+			exclusive:  rule.Exclusive,
+			persistent: rule.Persistent,
+			matches:    matches,
+		}, &tc.packetHashes.sweeper, rule.Timeout)
+	}
+
+	tc.startCapture()
+	return reg, nil
+}
+
+// Unregister removes rules registered with Register and closes their channels, taking each lock once however many
+// rules are removed.  Returns how many of the rules were still registered.
+func (tc *TransportChannel) Unregister(regs ...Registration) int {
+	ids := make([]uuid.UUID, 0, len(regs))
+	for _, reg := range regs {
+		if reg.key == "" {
+			ids = append(ids, reg.id)
+		}
+	}
+	return tc.packetHashes.delRegistrations(regs) + tc.filters.remove(ids...)
+}
+
+// dispatch hands a decoded packet to the rules and subscriptions waiting on it
+func (tc *TransportChannel) dispatch(dp *DecodedPacket) {
+	atomic.AddUint64(&tc.counters.received, 1)
+
+	matched, exclusive, dropped := tc.packetHashes.runDecoded(dp)
+	if !exclusive {
+		var filterMatched, filterDropped bool
+		filterMatched, exclusive, filterDropped = tc.filters.run(dp)
+		matched = matched || filterMatched
+		dropped = dropped || filterDropped
+	}
+	if matched {
+		atomic.AddUint64(&tc.counters.matched, 1)
+	}
+
+	if dropped {
+		atomic.AddUint64(&tc.counters.queueDropped, 1)
+	} else if !matched {
+		atomic.AddUint64(&tc.counters.unmatched, 1)
+	}
+}
+
+// filterRule is a rule registered with a Predicate
+type filterRule struct {
+	// seq and dropped are updated atomically, so they come first to stay 64 bit aligned
+	seq        uint64
+	dropped    uint64
+	id         uuid.UUID
+	filter     Predicate
+	priority   int
+	exclusive  bool
+	persistent bool
+	matches    chan Match
+	// packets receives the matches of a Listener in place of matches
+	packets chan gopacket.Packet
+	expiry  *expiry
+
+	// lock guards closed, so that matches isn't closed in the middle of a delivery
+	lock   sync.Mutex
+	closed bool
+}
+
+// filterRules holds the filter rules ordered by priority.  The receive path reads the rules without locking, every
+// change replaces the whole slice.  The zero value is ready to use.
+type filterRules struct {
+	lock  sync.Mutex
+	rules atomic.Value // []*filterRule
+}
+
+func (fr *filterRules) load() []*filterRule {
+	rules, _ := fr.rules.Load().([]*filterRule)
+	return rules
+}
+
+// add inserts a rule after the existing rules of the same priority, and has the sweeper expire it after timeout
+func (fr *filterRules) add(rule *filterRule, sweeper *expirySweeper, timeout time.Duration) {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
+	current := fr.load()
+	rules := make([]*filterRule, len(current), len(current)+1)
+	copy(rules, current)
+	idx := sort.Search(len(rules), func(i int) bool { return rules[i].priority < rule.priority })
+	rules = append(rules, nil)
+	copy(rules[idx+1:], rules[idx:])
+	rules[idx] = rule
+
+	if timeout > 0 {
+		rule.expiry = sweeper.schedule(time.Now().Add(timeout), func() { fr.remove(rule.id) })
+	}
+	fr.rules.Store(rules)
+}
+
+// remove drops the rules with the given ids and closes their channels.  Returns how many were found.
+func (fr *filterRules) remove(ids ...uuid.UUID) int {
+	if len(ids) == 0 {
+		return 0
+	}
+
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
+	current := fr.load()
+	rules := make([]*filterRule, 0, len(current))
+	removed := 0
+	for _, rule := range current {
+		if !containsID(ids, rule.id) {
+			rules = append(rules, rule)
+			continue
+		}
+		if rule.expiry != nil {
+			rule.expiry.cancel()
+		}
+		rule.close()
+		removed++
+	}
+	if removed > 0 {
+		fr.rules.Store(rules)
+	}
+	return removed
+}
+
+// find returns the rule with the given id, or nil if it isn't registered
+func (fr *filterRules) find(id uuid.UUID) *filterRule {
+	for _, rule := range fr.load() {
+		if rule.id == id {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (fr *filterRules) len() int {
+	return len(fr.load())
+}
+
+// closeAll removes every rule and closes their channels
+func (fr *filterRules) closeAll() {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
+	for _, rule := range fr.load() {
+		if rule.expiry != nil {
+			rule.expiry.cancel()
+		}
+		rule.close()
+	}
+	fr.rules.Store([]*filterRule(nil))
+}
+
+// run offers a packet to each filter rule in order of priority.  Returns true if any rule matched, whether an
+// exclusive rule did, and whether a rule had to drop the packet because its channel was full.
+func (fr *filterRules) run(dp *DecodedPacket) (bool, bool, bool) {
+	matched, dropped := false, false
+	var fired []uuid.UUID
+	for _, rule := range fr.load() {
+		if !rule.filter(dp) {
+			continue
+		}
+		delivered, full := rule.deliver(dp)
+		if !delivered {
+			// removed since the rules were loaded
+			continue
+		}
+		matched = true
+		dropped = dropped || full
+		if !rule.persistent {
+			fired = append(fired, rule.id)
+		}
+		if rule.exclusive {
+			fr.remove(fired...)
+			return true, true, dropped
+		}
+	}
+	fr.remove(fired...)
+	return matched, false, dropped
+}
+
+// deliver sends a packet to the rule without blocking, and closes the rule if it only wanted one packet.
+// Returns false if the rule was already closed, and true if the packet had to be dropped because the channel of the
+// rule was full.
+func (rule *filterRule) deliver(dp *DecodedPacket) (bool, bool) {
+	rule.lock.Lock()
+	defer rule.lock.Unlock()
+
+	if rule.closed {
+		return false, false
+	}
+
+	if rule.packets != nil {
+		return true, !rule.deliverPacket(dp.Packet())
+	}
+
+	match := Match{
+		Packet:      dp.Packet(),
+		CaptureInfo: dp.CaptureInfo,
+		Seq:         atomic.AddUint64(&rule.seq, 1),
+	}
+	if rule.persistent {
+		select {
+		case rule.matches <- match:
+			return true, false
+		default:
+			atomic.AddUint64(&rule.dropped, 1)
+			return true, true
+		}
+	}
+
+	rule.closed = true
+	return true, !deliverMatch(rule.matches, match)
+}
+
+// deliverPacket is deliver for the rules of Listeners.  A one-shot listener is always handed its packet, like a
+// hash registered with RegisterHash.  Returns false if the packet had to be dropped, the lock must be held.
+func (rule *filterRule) deliverPacket(packet gopacket.Packet) bool {
+	if !rule.persistent {
+		rule.closed = true
+		deliver(rule.packets, packet)
+		return true
+	}
+
+	select {
+	case rule.packets <- packet:
+		return true
+	default:
+		atomic.AddUint64(&rule.dropped, 1)
+		return false
+	}
+}
+
+// close closes the channel of the rule unless a delivery already did
+func (rule *filterRule) close() {
+	rule.lock.Lock()
+	defer rule.lock.Unlock()
+
+	if rule.closed {
+		return
+	}
+	rule.closed = true
+	if rule.packets != nil {
+		close(rule.packets)
+	} else {
+		close(rule.matches)
+	}
+}
+
+// deliverMatch is deliver for rules which receive a Match
+func deliverMatch(matches chan Match, match Match) bool {
+	defer close(matches)
+
+	select {
+	case matches <- match:
+		return true
+	default:
+		return false
+	}
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package beacon
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func matchAll(dp *DecodedPacket) bool { return true }
+
+// dispatchTestPacket dispatches a boomerang packet nobody registered a hash for
+func dispatchTestPacket(tc *TransportChannel) {
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	_, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+}
+
+func TestRegisterRejectsInvalidRules(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	if _, err := tc.Register(Rule{}, make(chan Match, 1)); err == nil {
+		t.Errorf("Expected a rule without a key or filter to be rejected")
+	}
+	if _, err := tc.Register(Rule{Key: "key", Filter: matchAll}, make(chan Match, 1)); err == nil {
+		t.Errorf("Expected a rule with both a key and a filter to be rejected")
+	}
+	if _, err := tc.Register(Rule{Filter: matchAll}, nil); err == nil {
+		t.Errorf("Expected a rule without a matches channel to be rejected")
+	}
+}
+
+func TestFilterRulesRunInPriorityOrder(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	low := make(chan Match, 1)
+	high := make(chan Match, 1)
+	tc.Register(Rule{Filter: matchAll, Priority: 1, Persistent: true}, low)
+	tc.Register(Rule{Filter: matchAll, Priority: 10, Persistent: true, Exclusive: true}, high)
+
+	dispatchTestPacket(tc)
+
+	select {
+	case <-high:
+	default:
+		t.Fatalf("Expected the high priority rule to match")
+	}
+	select {
+	case <-low:
+		t.Errorf("Expected the exclusive high priority rule to keep the packet from the low priority rule")
+	default:
+	}
+
+	stats, _ := tc.Stats()
+	if stats.Matched != 1 || stats.LiveRegistrations != 2 {
+		t.Errorf("Expected 1 match and both persistent rules to stay registered, got %+v", stats)
+	}
+}
+
+func TestOneShotFilterRuleIsRemovedByMatch(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	matches := make(chan Match, 1)
+	tc.Register(Rule{Filter: matchAll}, matches)
+
+	dispatchTestPacket(tc)
+	dispatchTestPacket(tc)
+
+	match, ok := <-matches
+	if !ok || match.Seq != 1 || match.Packet == nil {
+		t.Fatalf("Expected the first packet to be delivered, got %+v", match)
+	}
+	if _, ok := <-matches; ok {
+		t.Errorf("Expected matches to be closed after the first match")
+	}
+	if live := tc.LiveRegistrations(); live != 0 {
+		t.Errorf("Expected the one shot rule to be removed, got %d live registrations", live)
+	}
+}
+
+func TestOneShotRulesCountFullChannels(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	// nobody is receiving on unbuffered channels, so the matches find them full
+	filtered := make(chan Match)
+	tc.Register(Rule{Filter: matchAll}, filtered)
+	idHash, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	keyed := make(chan Match)
+	tc.Register(Rule{Key: string(idHash)}, keyed)
+
+	dispatchTestPacket(tc)
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+
+	if _, ok := <-filtered; ok {
+		t.Errorf("Expected the filtered channel to be closed without a match")
+	}
+	if _, ok := <-keyed; ok {
+		t.Errorf("Expected the keyed channel to be closed without a match")
+	}
+	stats, _ := tc.Stats()
+	if stats.Matched != 2 || stats.QueueDropped != 2 || stats.LiveRegistrations != 0 {
+		t.Errorf("Expected 2 matched and 2 dropped by the full channels, got %+v", stats)
+	}
+}
+
+func TestExclusiveKeyedRuleSkipsFilters(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	idHash, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	keyed := make(chan Match, 1)
+	filtered := make(chan Match, 1)
+	tc.Register(Rule{Key: string(idHash), Exclusive: true}, keyed)
+	tc.Register(Rule{Filter: matchAll, Priority: 100}, filtered)
+
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+
+	if match, ok := <-keyed; !ok || match.Hasher != (BoomerangPacketHasher{}).Name() {
+		t.Fatalf("Expected the keyed rule to match, got %+v", match)
+	}
+	select {
+	case <-filtered:
+		t.Errorf("Expected the exclusive keyed rule to keep the packet from the filter")
+	default:
+	}
+}
+
+func TestUnregisterRemovesRulesInBulk(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	var regs []Registration
+	var channels []chan Match
+	for _, rule := range []Rule{{Key: "one"}, {Key: "two", Persistent: true}, {Filter: matchAll}, {Filter: matchAll, Persistent: true}} {
+		matches := make(chan Match, 1)
+		reg, err := tc.Register(rule, matches)
+		if err != nil {
+			t.Fatalf("Failed to register rule: %s", err)
+		}
+		regs = append(regs, reg)
+		channels = append(channels, matches)
+	}
+
+	if removed := tc.Unregister(regs...); removed != len(regs) {
+		t.Errorf("Expected %d rules to be removed, got %d", len(regs), removed)
+	}
+	if removed := tc.Unregister(regs...); removed != 0 {
+		t.Errorf("Expected nothing left to remove, got %d", removed)
+	}
+	for idx, matches := range channels {
+		if _, ok := <-matches; ok {
+			t.Errorf("Expected the channel of rule %d to be closed", idx)
+		}
+	}
+	if live := tc.LiveRegistrations(); live != 0 {
+		t.Errorf("Expected no live registrations, got %d", live)
+	}
+}
+
+func TestUnregisterLeavesReplacedKeyedRule(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	old, _ := tc.Register(Rule{Key: "key"}, make(chan Match, 1))
+	current := make(chan Match, 1)
+	tc.Register(Rule{Key: "key"}, current)
+
+	if removed := tc.Unregister(old); removed != 0 {
+		t.Errorf("Expected the stale registration not to remove its replacement, removed %d", removed)
+	}
+	if live := tc.LiveRegistrations(); live != 1 {
+		t.Errorf("Expected the replacement to stay registered, got %d live registrations", live)
+	}
+}
+
+func TestFilterRuleTimeout(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	matches := make(chan Match, 1)
+	tc.Register(Rule{Filter: matchAll, Persistent: true, Timeout: 20 * time.Millisecond}, matches)
+
+	select {
+	case _, ok := <-matches:
+		if ok {
+			t.Fatalf("Expected no match before the timeout")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Filter rule did not expire")
+	}
+	if live := tc.LiveRegistrations(); live != 0 {
+		t.Errorf("Expected the expired rule to be removed, got %d live registrations", live)
+	}
+}
+
+func TestMatchedFilterRuleCancelsExpiry(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	matches := make(chan Match, 1)
+	tc.Register(Rule{Filter: matchAll, Timeout: time.Hour}, matches)
+	if pending := tc.packetHashes.sweeper.len(); pending != 1 {
+		t.Fatalf("Expected the filter rule to expire with the sweeper, got %d pending expiries", pending)
+	}
+
+	dispatchTestPacket(tc)
+
+	if _, ok := <-matches; !ok {
+		t.Fatalf("Expected the packet to be delivered")
+	}
+	if pending := tc.packetHashes.sweeper.len(); pending != 0 {
+		t.Errorf("Expected the matched rule to be removed from the sweeper, got %d pending expiries", pending)
+	}
+}
@@ -0,0 +1,219 @@
+package beacon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// egressSockets are raw sockets bound to an interface each, which send probes out of that interface whatever the
+// routing table says.  They are opened on first use.
+type egressSockets struct {
+	lock     sync.Mutex
+	byDevice map[string]*egressSocket
+}
+
+// egressSocket is the socket of each address family bound to one interface, -1 if it hasn't been opened, and the
+// timestamper of each socket
+type egressSocket struct {
+	fd           int
+	fd6          int
+	timestamper  *txTimestamper
+	timestamper6 *txTimestamper
+}
+
+// get returns the socket bound to device for the family of v6 and its timestamper, opening it in network with
+// transmit timestamps taken with source if needed
+func (e *egressSockets) get(device string, v6 bool, network NetworkContext, source TimestampSource) (int, *txTimestamper, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.byDevice == nil {
+		e.byDevice = make(map[string]*egressSocket)
+	}
+	socket, ok := e.byDevice[device]
+	if !ok {
+		socket = &egressSocket{fd: -1, fd6: -1}
+		e.byDevice[device] = socket
+	}
+
+	fd, timestamper := &socket.fd, &socket.timestamper
+	if v6 {
+		fd, timestamper = &socket.fd6, &socket.timestamper6
+	}
+	if *fd >= 0 {
+		return *fd, *timestamper, nil
+	}
+
+	newFD, err := network.socket(v6)
+	if err != nil {
+		return -1, nil, err
+	}
+	if err := bindToDevice(newFD, device); err != nil {
+		syscall.Close(newFD)
+		return -1, nil, fmt.Errorf("Failed to bind socket to %s: %s", device, err)
+	}
+	*fd, *timestamper = newFD, socketTimestamper(newFD, source)
+	return *fd, *timestamper, nil
+}
+
+// drop closes a socket which failed to send, so the next send out of its interface opens a new one
+func (e *egressSockets) drop(device string, fd int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	socket, ok := e.byDevice[device]
+	if !ok {
+		return
+	}
+	switch fd {
+	case socket.fd:
+		socket.fd = -1
+		socket.timestamper = closeTimestamper(socket.timestamper)
+	case socket.fd6:
+		socket.fd6 = -1
+		socket.timestamper6 = closeTimestamper(socket.timestamper6)
+	default:
+		return
+	}
+	syscall.Close(fd)
+}
+
+func (e *egressSockets) close() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for device, socket := range e.byDevice {
+		if socket.fd >= 0 {
+			syscall.Close(socket.fd)
+		}
+		if socket.fd6 >= 0 {
+			syscall.Close(socket.fd6)
+		}
+		closeTimestamper(socket.timestamper)
+		closeTimestamper(socket.timestamper6)
+		delete(e.byDevice, device)
+	}
+}
+
+// closeTimestamper stops a timestamper unless it is nil, and returns nil to clear it with
+func closeTimestamper(timestamper *txTimestamper) *txTimestamper {
+	if timestamper != nil {
+		timestamper.close()
+	}
+	return nil
+}
+
+// sendOut sends a packet to the specified ip address out of the given interface, and returns the most precise
+// transmit timestamp available
+func (tc *TransportChannel) sendOut(packetData []byte, destAddr net.IP, device string) (txTimestamp, error) {
+	var addr syscall.Sockaddr
+	v6 := destAddr.To4() == nil
+	if v6 {
+		addr6 := &syscall.SockaddrInet6{}
+		copy(addr6.Addr[:], destAddr.To16())
+		addr = addr6
+	} else {
+		addr4 := &syscall.SockaddrInet4{}
+		copy(addr4.Addr[:], destAddr.To4())
+		addr = addr4
+	}
+
+	fd, timestamper, err := tc.egressSockets.get(device, v6, tc.network, tc.timestampSource)
+	if err != nil {
+		return txTimestamp{ts: time.Now().UTC(), source: UserspaceTimestamp}, err
+	}
+	stamp, fd, err := timestampedSend(fd, timestamper, packetData, addr, true)
+	if err != nil {
+		tc.egressSockets.drop(device, fd)
+		return stamp, fmt.Errorf("Failed to send packetData out of %s: %s", device, err)
+	}
+	return stamp, nil
+}
+
+// Uplink is an interface probes can be sent out of, along with the source address they are sent from
+type Uplink struct {
+	Interface string
+	Source    net.IP
+}
+
+// String returns the uplink as "eth0 (10.0.0.2)"
+func (u Uplink) String() string {
+	return fmt.Sprintf("%s (%s)", u.Interface, u.Source)
+}
+
+// FindUplinks returns the interfaces the discoverer selects which have a global unicast address of the family of
+// dest, each with the first such address as its source.  A nil discoverer selects the UpInterfaces.
+func FindUplinks(discoverer InterfaceDiscoverer, dest net.IP) ([]Uplink, error) {
+	if discoverer == nil {
+		discoverer = UpInterfaces{}
+	}
+	devices, err := discoverer.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var uplinks []Uplink
+	for _, device := range devices {
+		iface, err := net.InterfaceByName(device)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't find a device named %s: %s", device, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get addresses of %s: %s", device, err)
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || !ipNet.IP.IsGlobalUnicast() || (ipNet.IP.To4() == nil) != (dest.To4() == nil) {
+				continue
+			}
+			uplinks = append(uplinks, Uplink{Interface: device, Source: ipNet.IP})
+			break
+		}
+	}
+	if len(uplinks) == 0 {
+		return nil, fmt.Errorf("Failed to find an uplink with an address to reach %s from", dest)
+	}
+	return uplinks, nil
+}
+
+// ProbeEachUplink probes each hop of a path like ProbeEachHopOfPath, out of every uplink.  The first hop of the path
+// is replaced by the source of each uplink, so the probes come back over the uplink they were sent out of.  The
+// results carry the uplink in the TxInterface of their payload.
+func (tc *TransportChannel) ProbeEachUplink(path Path, uplinks []Uplink, numPackets int, timeout int, options ...ProbeOption) <-chan BoomerangResult {
+	if !strings.Contains(tc.filter, "ip") && !strings.Contains(tc.filter, "ip6") {
+		resultChan := make(chan BoomerangResult)
+
+		go func() {
+			errMsg := fmt.Sprintf("The supplied TransportChannel must contain an ip or ip6 BPFFilter. The supplied filter was: %s\n", tc.filter)
+			resultChan <- BoomerangResult{Err: fmt.Errorf(errMsg), ErrorType: fatal}
+		}()
+
+		return resultChan
+	}
+
+	if len(path) < 2 {
+		resultChan := make(chan BoomerangResult)
+
+		go func() {
+			resultChan <- BoomerangResult{Err: errors.New("Path must have atleast 2 hops"), ErrorType: fatal}
+		}()
+
+		return resultChan
+	}
+
+	resultChannels := make([]chan BoomerangResult, 0, len(uplinks)*(len(path)-1))
+	for _, uplink := range uplinks {
+		uplinkOptions := append([]ProbeOption{WithEgressInterface(uplink.Interface), WithSourceIP(uplink.Source)}, options...)
+		for i := 2; i <= len(path); i++ {
+			resultChannels = append(resultChannels, tc.Probe(path[0:i], numPackets, timeout, uplinkOptions...))
+		}
+	}
+
+	return Merge(resultChannels...)
+}
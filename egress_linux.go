@@ -0,0 +1,10 @@
+package beacon
+
+import (
+	"syscall"
+)
+
+// bindToDevice makes a socket send out of device, whatever interface the routing table picks
+func bindToDevice(fd int, device string) error {
+	return syscall.SetsockoptString(fd, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, device)
+}
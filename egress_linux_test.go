@@ -0,0 +1,66 @@
+package beacon
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendOut(t *testing.T) {
+	tc := &TransportChannel{}
+	defer tc.egressSockets.close()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatalf("Failed to listen on udp: %s", err)
+	}
+	defer conn.Close()
+	dst := conn.LocalAddr().(*net.UDPAddr)
+
+	if _, err := tc.sendOut(createTestUDPPacket(t, dst, []byte("egress")), dst.IP, "lo"); err != nil {
+		t.Skipf("Skipping, raw sockets bound to lo are unavailable: %s", err)
+	}
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("Failed to receive the packet sent out of lo: %s", err)
+	}
+	if string(buf[:n]) != "egress" {
+		t.Errorf("Expected to receive egress, got %q", buf[:n])
+	}
+
+	if _, err := tc.sendOut(createTestUDPPacket(t, dst, []byte("egress")), dst.IP, "nonexistent0"); err == nil {
+		t.Errorf("Expected sending out of a nonexistent interface to fail")
+	}
+}
+
+func TestSendOutTimestamps(t *testing.T) {
+	tc := &TransportChannel{timestampSource: KernelTimestamp}
+	defer tc.egressSockets.close()
+
+	dst := &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 9}
+	before := time.Now()
+	stamp, err := tc.sendOut(createTestUDPPacket(t, dst, []byte("egress")), dst.IP, "lo")
+	if err != nil {
+		t.Skipf("Skipping, raw sockets bound to lo are unavailable: %s", err)
+	}
+	if _, timestamper, _ := tc.egressSockets.get("lo", false, tc.network, tc.timestampSource); timestamper == nil {
+		t.Skipf("Skipping, SO_TIMESTAMPING is unavailable")
+	}
+	if stamp.source != KernelTimestamp {
+		t.Errorf("Expected a kernel tx timestamp for a packet sent out of lo, got a %s one", stamp.source)
+	}
+	if stamp.ts.Before(before) || stamp.ts.After(time.Now()) {
+		t.Errorf("Kernel tx timestamp %s is outside of the send", stamp.ts)
+	}
+}
+
+func TestProbeEachUplinkShortPath(t *testing.T) {
+	tc := &TransportChannel{filter: "ip"}
+	result := <-tc.ProbeEachUplink(Path{}, []Uplink{{Interface: "lo"}}, 1, 1)
+	if !result.IsFatal() {
+		t.Errorf("Expected a fatal result for an empty path, got %+v", result)
+	}
+}
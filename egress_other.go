@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package beacon
+
+import (
+	"fmt"
+)
+
+// bindToDevice is only supported on linux, which has SO_BINDTODEVICE
+func bindToDevice(fd int, device string) error {
+	return fmt.Errorf("binding to an interface is only supported on linux")
+}
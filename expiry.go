@@ -0,0 +1,116 @@
+package beacon
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired registrations are removed, and so the precision of their timeouts
+const sweepInterval = 10 * time.Millisecond
+
+// expirySweeper removes registrations once their deadline passes.  Expiry is driven by a single goroutine, which
+// runs while there are deadlines pending, rather than a timer per registration.  The zero value is ready to use.
+type expirySweeper struct {
+	lock     sync.Mutex
+	expiries expiryHeap
+	sweeping bool
+}
+
+// expiry is a deadline scheduled with an expirySweeper
+type expiry struct {
+	deadline time.Time
+	// expire removes the registration, it is called without the lock of the sweeper held
+	expire  func()
+	sweeper *expirySweeper
+	// index is the position of the expiry in the heap, or -1 once it was swept or cancelled
+	index int
+}
+
+// schedule arranges for expire to be called once the deadline passes, unless the returned expiry is cancelled first
+func (s *expirySweeper) schedule(deadline time.Time, expire func()) *expiry {
+	e := &expiry{deadline: deadline, expire: expire, sweeper: s, index: -1}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	heap.Push(&s.expiries, e)
+	if !s.sweeping {
+		s.sweeping = true
+		go s.sweep()
+	}
+	return e
+}
+
+// cancel removes the expiry from its sweeper, no-op if it was already swept or cancelled
+func (e *expiry) cancel() {
+	e.sweeper.lock.Lock()
+	defer e.sweeper.lock.Unlock()
+
+	if e.index >= 0 {
+		heap.Remove(&e.sweeper.expiries, e.index)
+	}
+}
+
+func (s *expirySweeper) len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.expiries)
+}
+
+// sweep expires the registrations whose deadline has passed.  It runs while there are expiries pending and is
+// restarted by schedule when needed.
+func (s *expirySweeper) sweep() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		var expired []*expiry
+		s.lock.Lock()
+		for len(s.expiries) > 0 && !s.expiries[0].deadline.After(now) {
+			expired = append(expired, heap.Pop(&s.expiries).(*expiry))
+		}
+		idle := len(s.expiries) == 0
+		if idle {
+			s.sweeping = false
+		}
+		s.lock.Unlock()
+
+		// the registrations take their own locks to remove themselves, which may be held while cancelling
+		for _, e := range expired {
+			e.expire()
+		}
+		if idle {
+			return
+		}
+	}
+}
+
+// expiryHeap is a min heap of expiries ordered by deadline, implementing heap.Interface
+type expiryHeap []*expiry
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	e := x.(*expiry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*h = old[:len(old)-1]
+	return e
+}
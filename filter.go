@@ -0,0 +1,175 @@
+package beacon
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BPFInstruction is a single classic BPF instruction, laid out like struct sock_filter
+type BPFInstruction struct {
+	Op uint16
+	Jt uint8
+	Jf uint8
+	K  uint32
+}
+
+const (
+	bpfLdW    = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfLdH    = 0x28 // BPF_LD | BPF_H | BPF_ABS
+	bpfLdB    = 0x30 // BPF_LD | BPF_B | BPF_ABS
+	bpfJeqK   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfRetK   = 0x06 // BPF_RET | BPF_K
+	bpfMaxJmp = 255
+
+	// bpfProtocolOffset loads the ethertype of the packet from the socket buffer rather than the packet data
+	// (SKF_AD_OFF + SKF_AD_PROTOCOL), since AF_PACKET datagram sockets strip the link layer header
+	bpfProtocolOffset = 0xfffff000
+
+	ethertypeIPv4 = 0x0800
+	ethertypeIPv6 = 0x86dd
+)
+
+// bpfCondition is a load followed by a comparison against a constant
+type bpfCondition struct {
+	load   uint16
+	offset uint32
+	value  uint32
+}
+
+var bpfIndexPattern = regexp.MustCompile(`^(ip6?)\[(\d+)(?::([124]))?\]=(\S+)$`)
+
+// CompileBPFFilter compiles a filter expression into a classic BPF program which accepts up to snaplen bytes of
+// matching packets.  Packets are expected to start at the network header, as they do on an AF_PACKET datagram
+// socket.  Only the subset of the pcap filter syntax which beacon uses is understood: the primitives icmp, icmp6,
+// udp, ip, ip6, "ip proto N", "ip6 proto N" and "ip[off:size] = value" (or ip6[...]), combined with && / and and
+// || / or.  An empty filter accepts every packet.
+func CompileBPFFilter(filter string, snaplen int) ([]BPFInstruction, error) {
+	accept := BPFInstruction{Op: bpfRetK, K: uint32(snaplen)}
+	reject := BPFInstruction{Op: bpfRetK, K: 0}
+
+	if strings.TrimSpace(filter) == "" {
+		return []BPFInstruction{accept}, nil
+	}
+
+	var clauses [][]bpfCondition
+	for _, disjunct := range splitBPFExpression(filter, "||", "or") {
+		conjunction := [][]bpfCondition{{}}
+		for _, primitive := range splitBPFExpression(disjunct, "&&", "and") {
+			alternatives, err := compileBPFPrimitive(primitive)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to compile filter %q: %s", filter, err)
+			}
+			// distribute the primitive over the conjunction so far, keeping the filter in disjunctive normal form
+			var product [][]bpfCondition
+			for _, clause := range conjunction {
+				for _, alternative := range alternatives {
+					joined := append(append([]bpfCondition{}, clause...), alternative...)
+					product = append(product, joined)
+				}
+			}
+			conjunction = product
+		}
+		clauses = append(clauses, conjunction...)
+	}
+
+	var program []BPFInstruction
+	for idx, clause := range clauses {
+		// every condition is a load and a jump, and every clause ends with a return
+		clauseEnd := len(program) + 2*len(clause) + 1
+		for _, cond := range clause {
+			program = append(program, BPFInstruction{Op: cond.load, K: cond.offset})
+			jf := clauseEnd - (len(program) + 1)
+			if jf > bpfMaxJmp {
+				return nil, fmt.Errorf("Failed to compile filter %q: clause %d is too long", filter, idx)
+			}
+			program = append(program, BPFInstruction{Op: bpfJeqK, Jf: uint8(jf), K: cond.value})
+		}
+		program = append(program, accept)
+	}
+	program = append(program, reject)
+
+	return program, nil
+}
+
+// splitBPFExpression splits an expression on either the symbolic or the word form of an operator
+func splitBPFExpression(expr, symbol, word string) []string {
+	var parts []string
+	for _, part := range strings.Split(expr, symbol) {
+		fields := strings.Fields(part)
+		start := 0
+		for idx, field := range fields {
+			if field == word {
+				parts = append(parts, strings.Join(fields[start:idx], " "))
+				start = idx + 1
+			}
+		}
+		parts = append(parts, strings.Join(fields[start:], " "))
+	}
+	return parts
+}
+
+// compileBPFPrimitive returns the alternatives which satisfy a single primitive, each a list of conditions
+func compileBPFPrimitive(primitive string) ([][]bpfCondition, error) {
+	isIPv4 := bpfCondition{load: bpfLdH, offset: bpfProtocolOffset, value: ethertypeIPv4}
+	isIPv6 := bpfCondition{load: bpfLdH, offset: bpfProtocolOffset, value: ethertypeIPv6}
+	ipv4Proto := func(proto uint32) bpfCondition { return bpfCondition{load: bpfLdB, offset: 9, value: proto} }
+	ipv6Proto := func(proto uint32) bpfCondition { return bpfCondition{load: bpfLdB, offset: 6, value: proto} }
+
+	fields := strings.Fields(primitive)
+	switch {
+	case len(fields) == 0:
+		return nil, fmt.Errorf("empty expression")
+	case len(fields) == 1 && fields[0] == "ip":
+		return [][]bpfCondition{{isIPv4}}, nil
+	case len(fields) == 1 && fields[0] == "ip6":
+		return [][]bpfCondition{{isIPv6}}, nil
+	case len(fields) == 1 && fields[0] == "icmp":
+		return [][]bpfCondition{{isIPv4, ipv4Proto(1)}}, nil
+	case len(fields) == 1 && fields[0] == "icmp6":
+		return [][]bpfCondition{{isIPv6, ipv6Proto(58)}}, nil
+	case len(fields) == 1 && fields[0] == "udp":
+		return [][]bpfCondition{{isIPv4, ipv4Proto(17)}, {isIPv6, ipv6Proto(17)}}, nil
+	case len(fields) == 3 && fields[1] == "proto":
+		proto, err := strconv.ParseUint(fields[2], 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protocol %q", fields[2])
+		}
+		switch fields[0] {
+		case "ip":
+			return [][]bpfCondition{{isIPv4, ipv4Proto(uint32(proto))}}, nil
+		case "ip6":
+			return [][]bpfCondition{{isIPv6, ipv6Proto(uint32(proto))}}, nil
+		}
+	}
+
+	match := bpfIndexPattern.FindStringSubmatch(strings.Join(fields, ""))
+	if match == nil {
+		return nil, fmt.Errorf("unsupported expression %q", primitive)
+	}
+
+	offset, err := strconv.ParseUint(match[2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid offset %q", match[2])
+	}
+
+	load, size := uint16(bpfLdB), 8
+	switch match[3] {
+	case "2":
+		load, size = bpfLdH, 16
+	case "4":
+		load, size = bpfLdW, 32
+	}
+
+	value, err := strconv.ParseUint(match[4], 0, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for a %d byte field", match[4], size/8)
+	}
+
+	cond := bpfCondition{load: load, offset: uint32(offset), value: uint32(value)}
+	if match[1] == "ip6" {
+		return [][]bpfCondition{{isIPv6, cond}}, nil
+	}
+	return [][]bpfCondition{{isIPv4, cond}}, nil
+}
@@ -0,0 +1,139 @@
+package beacon
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// runBPF interprets the subset of classic BPF emitted by CompileBPFFilter against a packet starting at the
+// network header, returning the number of bytes the program accepts
+func runBPF(t *testing.T, program []BPFInstruction, ethertype uint16, data []byte) uint32 {
+	var acc uint32
+	for pc := 0; pc < len(program); pc++ {
+		ins := program[pc]
+		switch ins.Op {
+		case bpfLdH, bpfLdW, bpfLdB:
+			if ins.K == bpfProtocolOffset {
+				acc = uint32(ethertype)
+				continue
+			}
+			size := map[uint16]int{bpfLdB: 1, bpfLdH: 2, bpfLdW: 4}[ins.Op]
+			if int(ins.K)+size > len(data) {
+				// out of bounds loads reject the packet
+				return 0
+			}
+			switch size {
+			case 1:
+				acc = uint32(data[ins.K])
+			case 2:
+				acc = uint32(binary.BigEndian.Uint16(data[ins.K:]))
+			case 4:
+				acc = binary.BigEndian.Uint32(data[ins.K:])
+			}
+		case bpfJeqK:
+			if acc == ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case bpfRetK:
+			return ins.K
+		default:
+			t.Fatalf("Unexpected opcode 0x%x at %d", ins.Op, pc)
+		}
+	}
+	t.Fatalf("Program fell off the end without returning")
+	return 0
+}
+
+func TestCompileBPFFilterBoomerang(t *testing.T) {
+	program, err := CompileBPFFilter("ip[4:2] = 0x6d || ip6[48:4] = 0x6d6f6279", 4800)
+	if err != nil {
+		t.Fatalf("Failed to compile filter: %s", err)
+	}
+
+	v4 := make([]byte, 40)
+	v4[0] = 0x45
+	binary.BigEndian.PutUint16(v4[4:], 0x6d)
+	if runBPF(t, program, ethertypeIPv4, v4) != 4800 {
+		t.Errorf("Expected v4 boomerang packet to be accepted")
+	}
+
+	binary.BigEndian.PutUint16(v4[4:], 0x6e)
+	if runBPF(t, program, ethertypeIPv4, v4) != 0 {
+		t.Errorf("Expected v4 packet with a different id to be rejected")
+	}
+
+	v6 := make([]byte, 80)
+	v6[0] = 0x60
+	binary.BigEndian.PutUint32(v6[48:], 0x6d6f6279)
+	if runBPF(t, program, ethertypeIPv6, v6) != 4800 {
+		t.Errorf("Expected v6 boomerang packet to be accepted")
+	}
+
+	// the v6 signature must not match a v4 packet carrying the same bytes
+	v4Long := make([]byte, 80)
+	copy(v4Long, v6)
+	v4Long[0] = 0x45
+	if runBPF(t, program, ethertypeIPv4, v4Long) != 0 {
+		t.Errorf("Expected v4 packet with the v6 signature to be rejected")
+	}
+
+	if runBPF(t, program, ethertypeIPv6, v6[:40]) != 0 {
+		t.Errorf("Expected truncated v6 packet to be rejected")
+	}
+}
+
+func TestCompileBPFFilterProtocols(t *testing.T) {
+	icmpV4 := make([]byte, 28)
+	icmpV4[9] = 1
+	udpV4 := make([]byte, 28)
+	udpV4[9] = 17
+	icmpV6 := make([]byte, 48)
+	icmpV6[6] = 58
+	udpV6 := make([]byte, 48)
+	udpV6[6] = 17
+
+	testCases := []struct {
+		filter                       string
+		icmpV4, udpV4, icmpV6, udpV6 bool
+	}{
+		{"", true, true, true, true},
+		{"icmp", true, false, false, false},
+		{"icmp6", false, false, true, false},
+		{"udp", false, true, false, true},
+		{"ip", true, true, false, false},
+		{"ip6", false, false, true, true},
+		{"ip proto 17", false, true, false, false},
+		{"icmp or icmp6", true, false, true, false},
+		{"ip and ip[9] = 1", true, false, false, false},
+		{"udp && ip6", false, false, false, true},
+		{"icmp || icmp6 || ip[4:2] = 0x6d", true, false, true, false},
+	}
+
+	for _, tc := range testCases {
+		program, err := CompileBPFFilter(tc.filter, 1500)
+		if err != nil {
+			t.Errorf("Failed to compile filter %q: %s", tc.filter, err)
+			continue
+		}
+
+		check := func(name string, ethertype uint16, data []byte, want bool) {
+			if got := runBPF(t, program, ethertype, data) != 0; got != want {
+				t.Errorf("Filter %q on %s packet: expected accept=%t, got %t", tc.filter, name, want, got)
+			}
+		}
+		check("icmp", ethertypeIPv4, icmpV4, tc.icmpV4)
+		check("udp", ethertypeIPv4, udpV4, tc.udpV4)
+		check("icmp6", ethertypeIPv6, icmpV6, tc.icmpV6)
+		check("udp6", ethertypeIPv6, udpV6, tc.udpV6)
+	}
+}
+
+func TestCompileBPFFilterUnsupported(t *testing.T) {
+	for _, filter := range []string{"tcp port 80", "ip[4:3] = 1", "ip[4:2] = 0x10000", "(icmp)", "icmp or"} {
+		if _, err := CompileBPFFilter(filter, 1500); err == nil {
+			t.Errorf("Expected an error compiling unsupported filter %q", filter)
+		}
+	}
+}
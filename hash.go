@@ -3,9 +3,12 @@ package beacon
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
 )
 
 // PacketHasher produces some hash for a given packet which uniquely identifies a packet.
@@ -14,6 +17,14 @@ type PacketHasher interface {
 	HashPacket(gopacket.Packet) (string, error)
 }
 
+// DecodedPacketHasher is a PacketHasher which can also hash the shared DecodedPacket view produced by the receive path.
+// The returned hash may alias the packet data and is only valid until the view is reused, so it must not be retained.
+// Hashers which don't implement this interface are handed a fully decoded gopacket.Packet instead.
+type DecodedPacketHasher interface {
+	PacketHasher
+	HashDecodedPacket(*DecodedPacket) ([]byte, error)
+}
+
 // AttachHasher attaches a packet hasher to the current transport channel.
 // When a packet is receieved by the transport channel, its hash will be computed
 // by the each of the attached Hashers, and if the resulting hash identifies a packet
@@ -43,6 +54,15 @@ func (b BoomerangPacketHasher) HashPacket(p gopacket.Packet) (string, error) {
 	return string(payloadBytes), nil
 }
 
+func (b BoomerangPacketHasher) HashDecodedPacket(dp *DecodedPacket) ([]byte, error) {
+	payload := dp.ApplicationPayload()
+	if len(payload) < 20 {
+		return nil, errNoPayload
+	}
+
+	return payload[:20], nil // 4 bytes for "moby" + 16 bytes for guid
+}
+
 func (b BoomerangPacketHasher) Name() string {
 	return "BoomerangPacketHasher"
 }
@@ -65,6 +85,14 @@ func (v V6TraceRouteHasher) HashPacket(packet gopacket.Packet) (string, error) {
 	return computeTraceRouteHashFromPacket(decodedPayloadPacket)
 }
 
+func (v V6TraceRouteHasher) HashDecodedPacket(dp *DecodedPacket) ([]byte, error) {
+	if !dp.Has(layers.LayerTypeICMPv6) {
+		return nil, errNoICMPv6
+	}
+
+	return computeTraceRouteHashFromDecodedPacket(dp)
+}
+
 func (v V6TraceRouteHasher) Name() string {
 	return "V6TraceRouteHasher"
 }
@@ -83,6 +111,14 @@ func (v V4TraceRouteHasher) HashPacket(packet gopacket.Packet) (string, error) {
 	return computeTraceRouteHashFromPacket(decodedPayloadPacket)
 }
 
+func (v V4TraceRouteHasher) HashDecodedPacket(dp *DecodedPacket) ([]byte, error) {
+	if !dp.Has(layers.LayerTypeICMPv4) {
+		return nil, errNoICMPv4
+	}
+
+	return computeTraceRouteHashFromDecodedPacket(dp)
+}
+
 func (v V4TraceRouteHasher) Name() string {
 	return "V4TraceRouteHasher"
 }
@@ -93,26 +129,76 @@ func (v V4TraceRouteHasher) Name() string {
 // being listened for, it will be sent over the returned channel.
 func (tc *TransportChannel) RegisterHash(hash string, packetChan chan gopacket.Packet) {
 	tc.packetHashes.store(hash, packetChan)
+	tc.startCapture()
+}
+
+// RegisterHashWithTimeout registers a hash like RegisterHash, but the registration expires once the timeout passes.
+// An expired registration is removed and its channel is closed without a packet being sent on it, so the waiter sees
+// a receive of nil, false.  Expiry is driven by a single sweeper per TransportChannel rather than a timer per hash.
+func (tc *TransportChannel) RegisterHashWithTimeout(hash string, packetChan chan gopacket.Packet, timeout time.Duration) {
+	tc.packetHashes.storeWithDeadline(hash, packetChan, time.Now().Add(timeout))
+	tc.startCapture()
 }
 
+// RegisterPersistentHash registers a hash which stays registered after it is matched, so that every packet with the
+// hash is delivered over matches, duplicates included.  The registration lasts until it is removed with UnregisterHash
+// or the timeout passes, a timeout of 0 never expires.  Either way matches is closed once the registration is gone.
+// The receive path never blocks on matches, a match which finds it full is dropped, which shows up as a gap in Seq.
+// If the hash can't be registered, such as an empty hash, matches is closed at once.
+func (tc *TransportChannel) RegisterPersistentHash(hash string, matches chan HashMatch, timeout time.Duration) {
+	if _, err := tc.Register(Rule{Key: hash, Persistent: true, Timeout: timeout}, matches); err != nil && matches != nil {
+		close(matches)
+	}
+}
+
+// HashMatch is a packet delivered to a persistent hash registration.
+//
+// Deprecated: HashMatch is the same type as Match, which is delivered to every kind of rule.
+type HashMatch = Match
+
 // UnregisterHash removes the given hash from the packetHashes map.
 func (tc *TransportChannel) UnregisterHash(hash string) bool {
 	return tc.packetHashes.del(hash)
 }
 
+// LiveRegistrations returns the number of hashes and rules currently registered on the TransportChannel
+func (tc *TransportChannel) LiveRegistrations() int {
+	return tc.packetHashes.len() + tc.filters.len()
+}
+
 type packetHashMap struct {
-	m       sync.Map
+	sync.RWMutex
+	m       map[string]*hashRegistration
 	hashers []PacketHasher
+	// sweeper expires the registrations with a deadline, and the filter rules of the TransportChannel
+	sweeper expirySweeper
+}
+
+// hashRegistration is a channel waiting on a hash, and the deadline it expires at if it has one.  Registrations made
+// with RegisterHash deliver the bare packet over ch, those made with Register deliver a Match over matches instead.
+// A registration which isn't persistent is removed by its first match.
+type hashRegistration struct {
+	// seq is updated atomically, so it comes first to stay 64 bit aligned
+	seq        uint64
+	id         uuid.UUID
+	hash       string
+	ch         chan gopacket.Packet
+	matches    chan Match
+	persistent bool
+	exclusive  bool
+	deadline   time.Time
+	expiry     *expiry
 }
 
 func NewPacketHashMap() *packetHashMap {
 	return &packetHashMap{
-		m: sync.Map{},
+		m: make(map[string]*hashRegistration),
 	}
 }
 
 func (phm *packetHashMap) run(p gopacket.Packet) {
 	computedHashSlice := []string{}
+	hasherNames := []string{}
 
 	for _, hasher := range phm.hashers {
 		computedHash, err := hasher.HashPacket(p)
@@ -120,33 +206,212 @@ func (phm *packetHashMap) run(p gopacket.Packet) {
 			continue
 		}
 		computedHashSlice = append(computedHashSlice, computedHash)
+		hasherNames = append(hasherNames, hasher.Name())
+	}
+
+	for idx, computedHash := range computedHashSlice {
+		phm.match([]byte(computedHash), hasherNames[idx], func() gopacket.Packet { return p })
 	}
+}
 
-	for _, computedHash := range computedHashSlice {
-		if packetMatchChannel, ok := phm.m.LoadAndDelete(computedHash); ok {
-			assertedChannel := packetMatchChannel.(chan gopacket.Packet)
-			assertedChannel <- p
-			close(assertedChannel)
+// runDecoded is the allocation free counterpart of run.  Hashers which implement DecodedPacketHasher hash the
+// shared view directly, and a gopacket.Packet is only materialized when a hash is actually registered.
+// Returns true if the packet was delivered to a registered hash, whether that registration was exclusive, and whether
+// the packet had to be dropped because the channel of the registration was full.
+func (phm *packetHashMap) runDecoded(dp *DecodedPacket) (bool, bool, bool) {
+	matched, exclusive, dropped := false, false, false
+	for _, hasher := range phm.hashers {
+		var hashMatched, hashExclusive, hashDropped bool
+		if decodedHasher, ok := hasher.(DecodedPacketHasher); ok {
+			computedHash, err := decodedHasher.HashDecodedPacket(dp)
+			if err != nil {
+				continue
+			}
+			hashMatched, hashExclusive, hashDropped = phm.match(computedHash, hasher.Name(), dp.Packet)
+		} else {
+			computedHash, err := hasher.HashPacket(dp.Packet())
+			if err != nil {
+				continue
+			}
+			hashMatched, hashExclusive, hashDropped = phm.match([]byte(computedHash), hasher.Name(), dp.Packet)
 		}
+		matched = matched || hashMatched
+		exclusive = exclusive || hashExclusive
+		dropped = dropped || hashDropped
+	}
+	return matched, exclusive, dropped
+}
+
+// match delivers a packet to the registration for a hash, if there is one.  A persistent registration is delivered
+// to in place, any other registration is removed first.  packet is only called once the hash is known to be registered.
+// Returns whether the packet matched a registration, whether the registration was exclusive, and whether the packet
+// was dropped because the channel of the registration was full.
+func (phm *packetHashMap) match(hash []byte, hasherName string, packet func() gopacket.Packet) (bool, bool, bool) {
+	// the conversion in the map index expression does not allocate
+	phm.RLock()
+	reg, registered := phm.m[string(hash)]
+	full := false
+	if registered && reg.persistent {
+		// holding the read lock keeps the registration from being closed during the send
+		select {
+		case reg.matches <- reg.newMatch(packet(), hasherName):
+		default:
+			full = true
+		}
+	}
+	phm.RUnlock()
+
+	if !registered {
+		return false, false, false
+	}
+	if reg.persistent {
+		return true, reg.exclusive, full
+	}
+
+	if !phm.loadAndDelete(reg) {
+		// it was unregistered or expired in the meantime
+		return false, false, false
+	}
+	delivered := true
+	if reg.matches != nil {
+		delivered = deliverMatch(reg.matches, reg.newMatch(packet(), hasherName))
+	} else {
+		deliver(reg.ch, packet())
+	}
+	return true, reg.exclusive, !delivered
+}
+
+// newMatch numbers a packet delivered to the registration
+func (reg *hashRegistration) newMatch(p gopacket.Packet, hasherName string) Match {
+	return Match{
+		Packet:      p,
+		CaptureInfo: p.Metadata().CaptureInfo,
+		Hasher:      hasherName,
+		Seq:         atomic.AddUint64(&reg.seq, 1),
+	}
+}
+
+// deliver sends the matched packet to the registered channel and closes it.  The receive path must never block on
+// a slow consumer, so if the channel has no room the send is finished in the background.
+func deliver(packetMatchChannel chan gopacket.Packet, p gopacket.Packet) {
+	select {
+	case packetMatchChannel <- p:
+		close(packetMatchChannel)
+	default:
+		go func() {
+			packetMatchChannel <- p
+			close(packetMatchChannel)
+		}()
+	}
+}
+
+// loadAndDelete removes a registration if it is still the one registered for its hash
+func (phm *packetHashMap) loadAndDelete(reg *hashRegistration) bool {
+	phm.Lock()
+	defer phm.Unlock()
+
+	if phm.m[reg.hash] != reg {
+		return false
+	}
+	phm.remove(reg)
+	return true
+}
+
+// remove drops a registration from the map and cancels its expiry, the lock must be held
+func (phm *packetHashMap) remove(reg *hashRegistration) {
+	delete(phm.m, reg.hash)
+	if reg.expiry != nil {
+		reg.expiry.cancel()
+	}
+}
+
+// closeRegistration closes the channel of a registration which was removed without a match, the lock must be held
+// so that a persistent registration isn't closed in the middle of a delivery
+func closeRegistration(reg *hashRegistration) {
+	if reg.matches != nil {
+		close(reg.matches)
+	} else {
+		close(reg.ch)
 	}
 }
 
 func (phm *packetHashMap) store(hash string, packetChan chan gopacket.Packet) {
-	phm.m.Store(hash, packetChan)
+	phm.storeWithDeadline(hash, packetChan, time.Time{})
+}
 
-	return
+// storeWithDeadline registers a channel for a hash, which expires at the deadline unless it is zero
+func (phm *packetHashMap) storeWithDeadline(hash string, packetChan chan gopacket.Packet, deadline time.Time) {
+	phm.storeRegistration(&hashRegistration{hash: hash, ch: packetChan, deadline: deadline})
 }
 
-func (phm *packetHashMap) del(hash string) bool {
+// storeRegistration adds a registration, replacing any previous registration of its hash
+func (phm *packetHashMap) storeRegistration(reg *hashRegistration) {
+	phm.Lock()
+	defer phm.Unlock()
 
-	packetMatchChannel, exists := phm.m.LoadAndDelete(hash)
+	// the waiter of a replaced registration is notified like one which expired, unless it registered again itself
+	if previous, ok := phm.m[reg.hash]; ok {
+		phm.remove(previous)
+		if previous.ch != reg.ch || previous.matches != reg.matches {
+			closeRegistration(previous)
+		}
+	}
 
-	if exists {
+	phm.m[reg.hash] = reg
 
-		assertedChannel := packetMatchChannel.(chan gopacket.Packet)
-		close(assertedChannel)
+	if !reg.deadline.IsZero() {
+		reg.expiry = phm.sweeper.schedule(reg.deadline, func() { phm.expire(reg) })
+	}
+}
+
+// expire removes a registration whose deadline passed and closes its channel to notify the waiter, unless it was
+// removed in the meantime
+func (phm *packetHashMap) expire(reg *hashRegistration) {
+	phm.Lock()
+	defer phm.Unlock()
+
+	if phm.m[reg.hash] == reg {
+		delete(phm.m, reg.hash)
+		closeRegistration(reg)
+	}
+}
+
+func (phm *packetHashMap) del(hash string) bool {
+	phm.Lock()
+	defer phm.Unlock()
 
+	reg, exists := phm.m[hash]
+	if exists {
+		phm.remove(reg)
+		closeRegistration(reg)
 	}
 
 	return exists
 }
+
+// delRegistrations removes the keyed registrations made with Register, if they are still registered, under a single
+// lock.  Returns how many were removed.
+func (phm *packetHashMap) delRegistrations(regs []Registration) int {
+	phm.Lock()
+	defer phm.Unlock()
+
+	removed := 0
+	for _, r := range regs {
+		if r.key == "" {
+			continue
+		}
+		if reg, ok := phm.m[r.key]; ok && reg.id == r.id {
+			phm.remove(reg)
+			closeRegistration(reg)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (phm *packetHashMap) len() int {
+	phm.RLock()
+	defer phm.RUnlock()
+
+	return len(phm.m)
+}
@@ -0,0 +1,178 @@
+package beacon
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestRegisterHashWithTimeoutExpires(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	packetChan := make(chan gopacket.Packet, 1)
+	tc.RegisterHashWithTimeout("expiring", packetChan, 20*time.Millisecond)
+	tc.RegisterHash("forever", make(chan gopacket.Packet, 1))
+	if live := tc.LiveRegistrations(); live != 2 {
+		t.Fatalf("Expected 2 live registrations, got %d", live)
+	}
+
+	select {
+	case p, ok := <-packetChan:
+		if ok {
+			t.Fatalf("Expected the channel to be closed on expiry, got packet %v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Registration did not expire")
+	}
+
+	if live := tc.LiveRegistrations(); live != 1 {
+		t.Errorf("Expected 1 live registration after expiry, got %d", live)
+	}
+	if tc.UnregisterHash("expiring") {
+		t.Errorf("Expected the expired hash to already be unregistered")
+	}
+}
+
+func TestRegisterHashWithTimeoutDeliversBeforeDeadline(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+
+	idHash, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	packetChan := make(chan gopacket.Packet, 1)
+	tc.RegisterHashWithTimeout(string(idHash), packetChan, time.Second)
+
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+
+	if p, ok := <-packetChan; !ok || p == nil {
+		t.Fatalf("Expected the matched packet before the deadline")
+	}
+	if live := tc.LiveRegistrations(); live != 0 {
+		t.Errorf("Expected no live registrations after a match, got %d", live)
+	}
+	if tc.packetHashes.sweeper.len() != 0 {
+		t.Errorf("Expected the matched registration to be removed from the expiry heap")
+	}
+}
+
+func TestRegisterHashWithTimeoutReplacesRegistration(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	first := make(chan gopacket.Packet, 1)
+	second := make(chan gopacket.Packet, 1)
+	tc.RegisterHashWithTimeout("hash", first, 10*time.Millisecond)
+	tc.RegisterHashWithTimeout("hash", second, time.Hour)
+
+	select {
+	case _, ok := <-first:
+		if ok {
+			t.Errorf("Expected the replaced channel to be closed without a packet")
+		}
+	default:
+		t.Errorf("Expected the replaced channel to be closed as soon as it was replaced")
+	}
+
+	time.Sleep(5 * sweepInterval)
+	if live := tc.LiveRegistrations(); live != 1 {
+		t.Fatalf("Expected the replacement to stay registered, got %d live registrations", live)
+	}
+	if !tc.UnregisterHash("hash") {
+		t.Errorf("Expected the replacement registration to be found")
+	}
+	if _, ok := <-second; ok {
+		t.Errorf("Expected the replacement channel to be closed on unregister")
+	}
+}
+
+func TestRegisterPersistentHashDeliversDuplicates(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+
+	idHash, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	matches := make(chan Match, 4)
+	tc.RegisterPersistentHash(string(idHash), matches, 0)
+
+	for i := 1; i <= 3; i++ {
+		captureTime := time.Unix(int64(i), 0)
+		dp.Decode(packetBytes, gopacket.CaptureInfo{Timestamp: captureTime})
+		tc.dispatch(dp)
+
+		match := <-matches
+		if match.Seq != uint64(i) {
+			t.Errorf("Expected match %d to have seq %d, got %d", i, i, match.Seq)
+		}
+		if !match.CaptureInfo.Timestamp.Equal(captureTime) {
+			t.Errorf("Expected match %d to carry its capture timestamp %v, got %v", i, captureTime, match.CaptureInfo.Timestamp)
+		}
+		if match.Hasher != (BoomerangPacketHasher{}).Name() {
+			t.Errorf("Expected match %d to come from the boomerang hasher, got %s", i, match.Hasher)
+		}
+	}
+
+	stats, _ := tc.Stats()
+	if stats.Matched != 3 || stats.LiveRegistrations != 1 {
+		t.Errorf("Expected 3 matches and the registration to stay live, got %+v", stats)
+	}
+
+	if !tc.UnregisterHash(string(idHash)) {
+		t.Fatalf("Expected the persistent hash to be registered")
+	}
+	if _, ok := <-matches; ok {
+		t.Errorf("Expected matches to be closed on unregister")
+	}
+}
+
+func TestRegisterPersistentHashExpires(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+
+	idHash, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	// the type of the matches of persistent hashes before rules were unified still compiles
+	matches := make(chan HashMatch, 1)
+	tc.RegisterPersistentHash(string(idHash), matches, 20*time.Millisecond)
+
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+	tc.dispatch(dp)
+
+	timeout := time.After(time.Second)
+	var received []HashMatch
+	for done := false; !done; {
+		select {
+		case match, ok := <-matches:
+			if !ok {
+				done = true
+				continue
+			}
+			received = append(received, match)
+		case <-timeout:
+			t.Fatalf("Persistent registration did not expire")
+		}
+	}
+
+	if len(received) != 1 || received[0].Seq != 1 {
+		t.Errorf("Expected only the first match to be delivered, got %+v", received)
+	}
+	if live := tc.LiveRegistrations(); live != 0 {
+		t.Errorf("Expected no live registrations after expiry, got %d", live)
+	}
+}
+
+func TestRegisterPersistentHashClosesMatchesOnFailure(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	matches := make(chan HashMatch, 1)
+	tc.RegisterPersistentHash("", matches, 0)
+
+	select {
+	case _, ok := <-matches:
+		if ok {
+			t.Errorf("Expected matches to be closed without a match")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected matches to be closed when the hash can't be registered")
+	}
+}
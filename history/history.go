@@ -0,0 +1,398 @@
+// Package history records the distinct paths to monitored targets over time in a local bolt database, so that path
+// changes can be correlated with loss, and the path of a target at any past time can be looked up.
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trstruth/beacon"
+	bolt "go.etcd.io/bbolt"
+)
+
+var log = logrus.New()
+
+// bucket names within the bucket of a target
+var (
+	runsBucket  = []byte("runs")
+	pathsBucket = []byte("paths")
+)
+
+// changeBuffer is how many changes a subscriber buffers before changes are dropped
+const changeBuffer = 16
+
+// Run is a span of time over which every observation of a target saw the same path
+type Run struct {
+	Path      beacon.Path
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// PathRecord is a distinct path of a target, which may have been seen over several runs
+type PathRecord struct {
+	Path      beacon.Path
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Runs      int
+}
+
+// HopChange is a hop which differs between two paths, a nil IP is a hop which is missing from one of them
+type HopChange struct {
+	Index int
+	Old   net.IP
+	New   net.IP
+}
+
+// Change is a target moving from one path to another
+type Change struct {
+	Target string
+	Time   time.Time
+	Old    beacon.Path
+	New    beacon.Path
+	// Hops compares the paths hop by hop
+	Hops []HopChange
+	// Diff are the hops which were inserted, removed or substituted once the paths are aligned
+	Diff beacon.PathDiff
+}
+
+// String returns a one line summary of the change
+func (c Change) String() string {
+	return fmt.Sprintf("path changed from %s to %s: %s", c.Old, c.New, c.Diff)
+}
+
+// NewChange compares the old and new paths of a target hop by hop, and aligns them to find the hops which changed
+func NewChange(target string, at time.Time, old, new beacon.Path) Change {
+	change := Change{Target: target, Time: at, Old: old, New: new, Diff: old.Diff(new).Changed()}
+	for idx := 0; idx < len(old) || idx < len(new); idx++ {
+		var oldHop, newHop net.IP
+		if idx < len(old) {
+			oldHop = old[idx]
+		}
+		if idx < len(new) {
+			newHop = new[idx]
+		}
+		if !oldHop.Equal(newHop) {
+			change.Hops = append(change.Hops, HopChange{Index: idx, Old: oldHop, New: newHop})
+		}
+	}
+	return change
+}
+
+// Store keeps the path history of every target in a bolt database.  A database can only be opened by one Store at a
+// time.
+type Store struct {
+	db *bolt.DB
+
+	lock        sync.Mutex
+	subscribers map[chan Change]struct{}
+}
+
+// Open opens the database at path, creating it if it doesn't exist
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open path history %s: %s", path, err)
+	}
+	return &Store{db: db, subscribers: make(map[chan Change]struct{})}, nil
+}
+
+// Close closes the database, and the channels of every subscriber
+func (s *Store) Close() error {
+	s.lock.Lock()
+	for changes := range s.subscribers {
+		close(changes)
+		delete(s.subscribers, changes)
+	}
+	s.lock.Unlock()
+
+	return s.db.Close()
+}
+
+// Subscribe returns a channel which receives every change recorded from now on, and a function which stops the
+// subscription.  Changes are dropped if the subscriber falls behind.
+func (s *Store) Subscribe() (<-chan Change, func()) {
+	changes := make(chan Change, changeBuffer)
+
+	s.lock.Lock()
+	s.subscribers[changes] = struct{}{}
+	s.lock.Unlock()
+
+	return changes, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if _, ok := s.subscribers[changes]; ok {
+			delete(s.subscribers, changes)
+			close(changes)
+		}
+	}
+}
+
+func (s *Store) publish(change Change) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for changes := range s.subscribers {
+		select {
+		case changes <- change:
+		default:
+			log.Printf("Dropping path change of %s, a subscriber is falling behind\n", change.Target)
+		}
+	}
+}
+
+// Record notes that path was seen to target at a time.  Returns the change if the path differs from the last one
+// recorded, or nil if it is the first path of the target or the same path.
+func (s *Store) Record(target string, path beacon.Path, at time.Time) (*Change, error) {
+	var change *Change
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		targetBucket, err := tx.CreateBucketIfNotExists([]byte(target))
+		if err != nil {
+			return err
+		}
+		runs, err := targetBucket.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		paths, err := targetBucket.CreateBucketIfNotExists(pathsBucket)
+		if err != nil {
+			return err
+		}
+
+		key, value := runs.Cursor().Last()
+		var last *Run
+		if key != nil {
+			if last, err = decodeRun(value); err != nil {
+				return err
+			}
+		}
+
+		if last != nil && last.Path.Equal(path) {
+			last.LastSeen = at
+			if err := putRun(runs, key, last); err != nil {
+				return err
+			}
+			return updatePath(paths, path, at, false)
+		}
+
+		if last != nil {
+			c := NewChange(target, at, last.Path, path)
+			change = &c
+		}
+		if err := putRun(runs, timeKey(at), &Run{Path: path, FirstSeen: at, LastSeen: at}); err != nil {
+			return err
+		}
+		return updatePath(paths, path, at, true)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to record path of %s: %s", target, err)
+	}
+
+	if change != nil {
+		s.publish(*change)
+	}
+	return change, nil
+}
+
+// Targets returns the names of the targets with a history
+func (s *Store) Targets() ([]string, error) {
+	var targets []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			targets = append(targets, string(name))
+			return nil
+		})
+	})
+	return targets, err
+}
+
+// Runs returns the runs of a target which overlap the time between since and until, oldest first.  A zero since or
+// until leaves that end open.
+func (s *Store) Runs(target string, since, until time.Time) ([]Run, error) {
+	var runs []Run
+	err := s.view(target, func(targetBucket *bolt.Bucket) error {
+		cursor := targetBucket.Bucket(runsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			run, err := decodeRun(value)
+			if err != nil {
+				return err
+			}
+			if !until.IsZero() && run.FirstSeen.After(until) {
+				break
+			}
+			if since.IsZero() || !run.LastSeen.Before(since) {
+				runs = append(runs, *run)
+			}
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// Changes returns the changes of a target between since and until, oldest first.  A zero since or until leaves that
+// end open.
+func (s *Store) Changes(target string, since, until time.Time) ([]Change, error) {
+	runs, err := s.Runs(target, time.Time{}, until)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for idx := 1; idx < len(runs); idx++ {
+		if !since.IsZero() && runs[idx].FirstSeen.Before(since) {
+			continue
+		}
+		changes = append(changes, NewChange(target, runs[idx].FirstSeen, runs[idx-1].Path, runs[idx].Path))
+	}
+	return changes, nil
+}
+
+// PathAt returns the run of a target which was current at a time, which is the last one first seen at or before it.
+// Returns false if the target has no path recorded before the time.
+func (s *Store) PathAt(target string, at time.Time) (Run, bool, error) {
+	var run *Run
+	err := s.view(target, func(targetBucket *bolt.Bucket) error {
+		cursor := targetBucket.Bucket(runsBucket).Cursor()
+		seekKey := timeKey(at)
+		key, value := cursor.Seek(seekKey)
+		if key == nil {
+			key, value = cursor.Last()
+		} else if bytes.Compare(key, seekKey) > 0 {
+			key, value = cursor.Prev()
+		}
+		if key == nil {
+			return nil
+		}
+		var err error
+		run, err = decodeRun(value)
+		return err
+	})
+	if err != nil || run == nil {
+		return Run{}, false, err
+	}
+	return *run, true, nil
+}
+
+// Paths returns the distinct paths of a target, the first seen first
+func (s *Store) Paths(target string) ([]PathRecord, error) {
+	var records []PathRecord
+	err := s.view(target, func(targetBucket *bolt.Bucket) error {
+		return targetBucket.Bucket(pathsBucket).ForEach(func(_, value []byte) error {
+			record, err := decodePathRecord(value)
+			if err != nil {
+				return err
+			}
+			records = append(records, *record)
+			return nil
+		})
+	})
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].FirstSeen.Before(records[j].FirstSeen)
+	})
+	return records, err
+}
+
+// view runs fn on the bucket of a target, returning an error if the target has no history
+func (s *Store) view(target string, fn func(*bolt.Bucket) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		targetBucket := tx.Bucket([]byte(target))
+		if targetBucket == nil {
+			return fmt.Errorf("no path history for target %q", target)
+		}
+		return fn(targetBucket)
+	})
+}
+
+// updatePath extends the distinct path record of a path to at, newRun counts a new run of the path
+func updatePath(paths *bolt.Bucket, path beacon.Path, at time.Time, newRun bool) error {
+	key := []byte(path.String())
+	record := &PathRecord{Path: path, FirstSeen: at}
+	if value := paths.Get(key); value != nil {
+		var err error
+		if record, err = decodePathRecord(value); err != nil {
+			return err
+		}
+	}
+	record.LastSeen = at
+	if newRun {
+		record.Runs++
+	}
+
+	value, err := json.Marshal(encodePathRecord(record))
+	if err != nil {
+		return err
+	}
+	return paths.Put(key, value)
+}
+
+// timeKey orders runs by the time they were first seen
+func timeKey(at time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(at.UnixNano()))
+	return key
+}
+
+// storedRun and storedPath are the JSON forms of Run and PathRecord, with the hops which didn't respond as "*"
+type storedRun struct {
+	Path      []string  `json:"path"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type storedPath struct {
+	storedRun
+	Runs int `json:"runs"`
+}
+
+func putRun(runs *bolt.Bucket, key []byte, run *Run) error {
+	value, err := json.Marshal(storedRun{Path: pathStrings(run.Path), FirstSeen: run.FirstSeen, LastSeen: run.LastSeen})
+	if err != nil {
+		return err
+	}
+	return runs.Put(key, value)
+}
+
+func decodeRun(value []byte) (*Run, error) {
+	var stored storedRun
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return nil, fmt.Errorf("Failed to decode run: %s", err)
+	}
+	return &Run{Path: parsePath(stored.Path), FirstSeen: stored.FirstSeen, LastSeen: stored.LastSeen}, nil
+}
+
+func encodePathRecord(record *PathRecord) storedPath {
+	return storedPath{
+		storedRun: storedRun{Path: pathStrings(record.Path), FirstSeen: record.FirstSeen, LastSeen: record.LastSeen},
+		Runs:      record.Runs,
+	}
+}
+
+func decodePathRecord(value []byte) (*PathRecord, error) {
+	var stored storedPath
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return nil, fmt.Errorf("Failed to decode path: %s", err)
+	}
+	return &PathRecord{Path: parsePath(stored.Path), FirstSeen: stored.FirstSeen, LastSeen: stored.LastSeen, Runs: stored.Runs}, nil
+}
+
+func pathStrings(path beacon.Path) []string {
+	hops := make([]string, len(path))
+	for idx, hop := range path {
+		hops[idx] = beacon.HopString(hop)
+	}
+	return hops
+}
+
+func parsePath(hops []string) beacon.Path {
+	path := make(beacon.Path, len(hops))
+	for idx, hop := range hops {
+		path[idx] = net.ParseIP(hop)
+	}
+	return path
+}
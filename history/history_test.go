@@ -0,0 +1,175 @@
+package history
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstruth/beacon"
+)
+
+var (
+	pathA = beacon.Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}, net.IP{10, 0, 0, 3}}
+	pathB = beacon.Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 1, 2}, nil, net.IP{10, 0, 0, 3}}
+	start = time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func openStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	store, err := Open(filepath.Join(dir, "history.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func minutes(n int) time.Time {
+	return start.Add(time.Duration(n) * time.Minute)
+}
+
+// record stores pathA at minutes 0 and 1, pathB at 2 and 3 and pathA again at 4
+func record(t *testing.T, store *Store) []*Change {
+	var changes []*Change
+	for idx, path := range []beacon.Path{pathA, pathA, pathB, pathB, pathA} {
+		change, err := store.Record("edge", path, minutes(idx))
+		if err != nil {
+			t.Fatalf("Failed to record path: %s", err)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func TestRecordReturnsChanges(t *testing.T) {
+	store := openStore(t)
+	events, unsubscribe := store.Subscribe()
+	defer unsubscribe()
+
+	changes := record(t, store)
+	for _, idx := range []int{0, 1, 3} {
+		if changes[idx] != nil {
+			t.Errorf("Expected no change at minute %d, got %s", idx, changes[idx])
+		}
+	}
+	change := changes[2]
+	if change == nil {
+		t.Fatalf("Expected a change at minute 2")
+	}
+	expected := []HopChange{
+		{Index: 1, Old: pathA[1], New: pathB[1]},
+		{Index: 2, Old: pathA[2], New: nil},
+		{Index: 3, Old: nil, New: pathB[3]},
+	}
+	if len(change.Hops) != len(expected) {
+		t.Fatalf("Expected hop changes %v, got %v", expected, change.Hops)
+	}
+	for idx := range expected {
+		if change.Hops[idx].Index != expected[idx].Index || !change.Hops[idx].Old.Equal(expected[idx].Old) || !change.Hops[idx].New.Equal(expected[idx].New) {
+			t.Errorf("Expected hop change %v, got %v", expected[idx], change.Hops[idx])
+		}
+	}
+	// 10.0.0.2 may be the hop which didn't respond, so only 10.0.1.2 is known to be new
+	if len(change.Diff) != 1 || change.Diff.String() != "+1 10.0.1.2" {
+		t.Errorf("Unexpected aligned hop changes %s", change.Diff)
+	}
+
+	for _, at := range []time.Time{minutes(2), minutes(4)} {
+		select {
+		case event := <-events:
+			if !event.Time.Equal(at) {
+				t.Errorf("Expected a change event at %s, got %s", at, event.Time)
+			}
+		default:
+			t.Errorf("Expected a change event at %s", at)
+		}
+	}
+}
+
+func TestPathAt(t *testing.T) {
+	store := openStore(t)
+	record(t, store)
+
+	if _, ok, err := store.PathAt("edge", start.Add(-time.Second)); ok || err != nil {
+		t.Errorf("Expected no path before the first one was recorded, got %t, %v", ok, err)
+	}
+	cases := map[time.Time]beacon.Path{
+		minutes(0):                  pathA,
+		minutes(1).Add(time.Second): pathA,
+		minutes(2):                  pathB,
+		minutes(3).Add(time.Second): pathB,
+		minutes(10):                 pathA,
+	}
+	for at, expected := range cases {
+		run, ok, err := store.PathAt("edge", at)
+		if err != nil || !ok {
+			t.Fatalf("Expected a path at %s, got %t, %v", at, ok, err)
+		}
+		if !run.Path.Equal(expected) {
+			t.Errorf("Expected the path at %s to be %s, got %s", at, expected, run.Path)
+		}
+	}
+	if _, _, err := store.PathAt("core", start); err == nil {
+		t.Errorf("Expected an error for a target without a history")
+	}
+}
+
+func TestRunsPathsAndChanges(t *testing.T) {
+	store := openStore(t)
+	record(t, store)
+
+	runs, err := store.Runs("edge", time.Time{}, time.Time{})
+	if err != nil || len(runs) != 3 {
+		t.Fatalf("Expected 3 runs, got %v, %v", runs, err)
+	}
+	if !runs[1].Path.Equal(pathB) || !runs[1].FirstSeen.Equal(minutes(2)) || !runs[1].LastSeen.Equal(minutes(3)) {
+		t.Errorf("Expected pathB to be seen from minute 2 to 3, got %+v", runs[1])
+	}
+
+	paths, err := store.Paths("edge")
+	if err != nil || len(paths) != 2 {
+		t.Fatalf("Expected 2 distinct paths, got %v, %v", paths, err)
+	}
+	if !paths[0].Path.Equal(pathA) || paths[0].Runs != 2 || !paths[0].FirstSeen.Equal(minutes(0)) || !paths[0].LastSeen.Equal(minutes(4)) {
+		t.Errorf("Expected pathA to be seen over 2 runs from minute 0 to 4, got %+v", paths[0])
+	}
+
+	changes, err := store.Changes("edge", minutes(3), time.Time{})
+	if err != nil || len(changes) != 1 || !changes[0].New.Equal(pathA) {
+		t.Errorf("Expected the change back to pathA after minute 3, got %v, %v", changes, err)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	store := openStore(t)
+	record(t, store)
+
+	requests := map[string][]string{
+		"/history": {`["edge"]`},
+		"/history?target=edge&at=2021-07-01T12:02:30Z": {`"path":["10.0.0.1","10.0.1.2","*","10.0.0.3"]`},
+		"/history?target=edge": {
+			`"runs":2`,
+			`"hops":[{"index":1,"old":"10.0.0.2","new":"10.0.1.2"}`,
+			`"diff":[{"op":"inserted","old_index":-1,"new_index":1,"new":"10.0.1.2"}]`,
+		},
+	}
+	for url, expected := range requests {
+		w := httptest.NewRecorder()
+		store.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		for _, fragment := range expected {
+			if w.Code != 200 || !strings.Contains(w.Body.String(), fragment) {
+				t.Errorf("Expected %s to contain %s, got %d %s", url, fragment, w.Code, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package history
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/trstruth/beacon"
+)
+
+// the JSON forms of the history served over HTTP
+type jsonRun struct {
+	Path      []string  `json:"path"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type jsonPath struct {
+	jsonRun
+	Runs int `json:"runs"`
+}
+
+type jsonHopChange struct {
+	Index int    `json:"index"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type jsonHopDiff struct {
+	Op       string `json:"op"`
+	OldIndex int    `json:"old_index"`
+	NewIndex int    `json:"new_index"`
+	Old      string `json:"old,omitempty"`
+	New      string `json:"new,omitempty"`
+}
+
+type jsonChange struct {
+	Time time.Time       `json:"time"`
+	Old  []string        `json:"old"`
+	New  []string        `json:"new"`
+	Hops []jsonHopChange `json:"hops"`
+	Diff []jsonHopDiff   `json:"diff"`
+}
+
+type jsonHistory struct {
+	Target  string       `json:"target"`
+	Paths   []jsonPath   `json:"paths"`
+	Changes []jsonChange `json:"changes"`
+}
+
+// ServeHTTP serves the history as JSON.  Without a target query parameter it lists the targets, with one it returns
+// the distinct paths and changes of the target, and with an RFC 3339 at parameter as well the run current at that time.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		targets, err := s.Targets()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if targets == nil {
+			targets = []string{}
+		}
+		writeJSON(w, targets)
+		return
+	}
+
+	if atString := r.URL.Query().Get("at"); atString != "" {
+		at, err := time.Parse(time.RFC3339, atString)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		run, ok, err := s.PathAt(target, at)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if !ok {
+			http.Error(w, "no path was recorded at or before "+atString, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, jsonRun{Path: pathStrings(run.Path), FirstSeen: run.FirstSeen, LastSeen: run.LastSeen})
+		return
+	}
+
+	paths, err := s.Paths(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	changes, err := s.Changes(target, time.Time{}, time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	history := jsonHistory{Target: target, Paths: []jsonPath{}, Changes: []jsonChange{}}
+	for _, path := range paths {
+		history.Paths = append(history.Paths, jsonPath{
+			jsonRun: jsonRun{Path: pathStrings(path.Path), FirstSeen: path.FirstSeen, LastSeen: path.LastSeen},
+			Runs:    path.Runs,
+		})
+	}
+	for _, change := range changes {
+		jc := jsonChange{Time: change.Time, Old: pathStrings(change.Old), New: pathStrings(change.New)}
+		for _, hop := range change.Hops {
+			jc.Hops = append(jc.Hops, jsonHopChange{Index: hop.Index, Old: beacon.HopString(hop.Old), New: beacon.HopString(hop.New)})
+		}
+		for _, hop := range change.Diff {
+			jsonHop := jsonHopDiff{Op: hop.Op.String(), OldIndex: hop.OldIdx, NewIndex: hop.NewIdx}
+			if hop.OldIdx >= 0 {
+				jsonHop.Old = beacon.HopString(hop.Old)
+			}
+			if hop.NewIdx >= 0 {
+				jsonHop.New = beacon.HopString(hop.New)
+			}
+			jc.Diff = append(jc.Diff, jsonHop)
+		}
+		history.Changes = append(history.Changes, jc)
+	}
+	writeJSON(w, history)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write history: %s\n", err)
+	}
+}
@@ -377,6 +377,8 @@ func (j *JuniperLayer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback)
 	j.FlagNoL2 = (flags & JuniperFlagNoL2) == JuniperFlagNoL2
 
 	j.TLVLength = binary.BigEndian.Uint16(data[4:6])
+	// the layer may be reused by a DecodingLayerParser, so drop TLVs from the previous packet
+	j.TLVs = j.TLVs[:0]
 	headerLength := 6 + j.TLVLength
 	if uint16(len(data)) < headerLength {
 		df.SetTruncated()
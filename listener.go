@@ -1,12 +1,19 @@
 package beacon
 
 import (
+	"math"
 	"sync"
 
 	"github.com/google/gopacket"
 	"github.com/google/uuid"
 )
 
+// persistentListenerBuffer is the number of matches a persistent listener buffers before the receive path drops them
+const persistentListenerBuffer = 1024
+
+// listenerPriority runs listeners after every filter rule, so an exclusive rule still keeps packets from them
+const listenerPriority = math.MinInt32
+
 // PacketFilter represents a criteria that a packet can be said to meet.
 type PacketFilter func(packet gopacket.Packet, id []byte) bool
 
@@ -32,12 +39,13 @@ func NewListener(criteria PacketFilter) *Listener {
 // NewPersistentListener return a new listener with the given criteria,
 // a newly generated uuid and an initialized match channel.
 // PersistentListener differs from Listener in that it will not be removed
-// when a match is found.
+// when a match is found.  Matches which find the channel full are dropped and
+// counted in TransportStats.QueueDropped.
 func NewPersistentListener(criteria PacketFilter) *Listener {
 	return &Listener{
 		id:         uuid.New(),
 		Criteria:   criteria,
-		matchChan:  make(chan gopacket.Packet, 1),
+		matchChan:  make(chan gopacket.Packet, persistentListenerBuffer),
 		persistent: true,
 	}
 }
@@ -76,70 +84,115 @@ func (lm *ListenerMap) Load(key uuid.UUID) (value *Listener, ok bool) {
 
 // Delete deletes the value for a key.  no-op if key doesn't exist.
 func (lm *ListenerMap) Delete(key uuid.UUID) {
+	lm.DeleteAll(key)
+}
+
+// DeleteAll deletes the values for each of the keys under a single lock.  Keys which don't exist are ignored.
+func (lm *ListenerMap) DeleteAll(keys ...uuid.UUID) {
 	lm.Lock()
 	defer lm.Unlock()
 
-	if listener, ok := lm.m[key]; ok {
-		close(listener.matchChan)
+	lm.deleteLocked(keys...)
+}
+
+// deleteLocked deletes listeners and closes their match channels, the lock must be held
+func (lm *ListenerMap) deleteLocked(keys ...uuid.UUID) {
+	for _, key := range keys {
+		if listener, ok := lm.m[key]; ok {
+			close(listener.matchChan)
+		}
+		delete(lm.m, key)
 	}
-	delete(lm.m, key)
 }
 
 // Run passes the supplied packet to the criteria func of each listener in the listeners map
 // If the packet matches a listener, it is sent over the mapped channel, and the listener is deleted.
-func (lm *ListenerMap) Run(p gopacket.Packet) {
-	listenersToDelete := make([]*Listener, 0)
+// Returns true if the packet matched any listener.
+func (lm *ListenerMap) Run(p gopacket.Packet) bool {
+	var listenersToDelete []uuid.UUID
+	matchedPersistent := false
 
 	app := p.ApplicationLayer()
 	if app == nil {
 		// packet doesn't have an application layer or payload < 16 bytes
-		return
+		return false
 	}
 
 	id := app.Payload()
 
 	lm.Lock()
+	defer lm.Unlock()
 
 	for _, listener := range lm.m {
 		// packet meets criteria
 
 		if listener.Criteria(p, id) {
 			listener.matchChan <- p
-			if !listener.persistent {
-				listenersToDelete = append(listenersToDelete, listener)
+			if listener.persistent {
+				matchedPersistent = true
+			} else {
+				listenersToDelete = append(listenersToDelete, listener.id)
 			}
 		}
 	}
 
-	lm.Unlock()
+	lm.deleteLocked(listenersToDelete...)
 
-	for _, listener := range listenersToDelete {
-		// TODO: Each iteration of this loop will lock and unlock the listenerMap
-		// consider implementing bulk delete which only locks & unlocks once
-		go lm.Delete(listener.id)
+	return len(listenersToDelete) > 0 || matchedPersistent
+}
+
+// filter wraps the criteria of the listener in a Predicate.  The criteria needs a gopacket.Packet, which the
+// DecodedPacket materializes once however many listeners look at it.
+func (l *Listener) filter(dp *DecodedPacket) bool {
+	p := dp.Packet()
+	app := p.ApplicationLayer()
+	if app == nil {
+		// packet doesn't have an application layer or payload < 16 bytes
+		return false
 	}
+	return l.Criteria(p, app.Payload())
 }
 
 // RegisterListener attaches a packet listener to the current transport channel.
 // When the packet listener finds a packet matching its criteria, the packet will
-// be sent to the caller over the returned channel.
+// be sent to the caller over the returned channel.  Listeners are filter rules
+// which run after every other filter rule.
 func (tc *TransportChannel) RegisterListener(l *Listener) chan gopacket.Packet {
-	tc.listenerMap.Store(l.id, l)
+	tc.filters.add(&filterRule{
+		id:         l.id,
+		filter:     l.filter,
+		priority:   listenerPriority,
+		persistent: l.persistent,
+		packets:    l.matchChan,
+	}, nil, 0)
+	tc.startCapture()
 
 	return l.matchChan
 }
 
 // UnregisterListener removes an attached listener.
 func (tc *TransportChannel) UnregisterListener(l *Listener) uuid.UUID {
-	tc.listenerMap.Delete(l.id)
+	tc.UnregisterListeners(l)
 
 	return l.id
 }
 
-// ListenerCount returns an estimate of how many listeners are registered at
-// a given point in time.  Note that this is only an estimate as we do not
-// acquire the lock of the listenerMap in order to get its count, so the
-// listenerMap may be modified as we are reading it.
+// UnregisterListeners removes many attached listeners at once.
+func (tc *TransportChannel) UnregisterListeners(listeners ...*Listener) {
+	regs := make([]Registration, len(listeners))
+	for idx, l := range listeners {
+		regs[idx] = Registration{id: l.id}
+	}
+	tc.Unregister(regs...)
+}
+
+// ListenerCount returns how many listeners are registered at a given point in time.
 func (tc *TransportChannel) ListenerCount() int {
-	return len(tc.listenerMap.m)
+	count := 0
+	for _, rule := range tc.filters.load() {
+		if rule.packets != nil {
+			count++
+		}
+	}
+	return count
 }
@@ -203,8 +203,10 @@ func TestRunNoMatch(t *testing.T) {
 
 func TestListenerCount(t *testing.T) {
 	tc := TransportChannel{
-		listenerMap: NewListenerMap(),
+		packetHashes: NewPacketHashMap(),
 	}
+	// without capture handles capturing ends at once and removes every rule, so don't start it
+	tc.captureOnce.Do(func() {})
 	desiredBytes := []byte{156,
 		40,
 		214,
@@ -246,3 +248,25 @@ func TestListenerCount(t *testing.T) {
 		t.Errorf("Unregistered all listeners and expected ListenerCount() to be 0, got %d instead", numListeners)
 	}
 }
+
+func TestListenerCountWhileRegistering(t *testing.T) {
+	tc := TransportChannel{packetHashes: NewPacketHashMap()}
+	// without capture handles capturing ends at once and removes every rule, so don't start it
+	tc.captureOnce.Do(func() {})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l := NewListener(func(p gopacket.Packet, id []byte) bool { return false })
+			tc.RegisterListener(l)
+			tc.UnregisterListener(l)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if count := tc.ListenerCount(); count < 0 || count > 1 {
+			t.Fatalf("Expected atmost 1 listener, got %d", count)
+		}
+	}
+	<-done
+}
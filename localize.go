@@ -0,0 +1,230 @@
+package beacon
+
+import (
+	"fmt"
+	"math"
+	"net"
+)
+
+// defaultVerdictConfidence is the minimum confidence required before LocalizeLoss will blame a segment of the path
+const defaultVerdictConfidence = 0.95
+
+// HopResult holds the number of probes sent to and received back from a single hop of a probed path
+type HopResult struct {
+	Sent     int
+	Received int
+}
+
+// SuccessRate returns the fraction of probes to the hop which made it back, or 0 if nothing was sent
+func (h HopResult) SuccessRate() float64 {
+	if h.Sent == 0 {
+		return 0
+	}
+	return float64(h.Received) / float64(h.Sent)
+}
+
+// LossVerdictKind is an enum of the conclusions LocalizeLoss can draw about a path
+type LossVerdictKind int
+
+const (
+	// NoLoss means no statistically significant loss was seen on any hop
+	NoLoss LossVerdictKind = iota
+	// LossLocalized means loss was attributed to the segment between Near and Far
+	LossLocalized
+	// Inconclusive means there was loss, but not enough evidence to pin it to a segment
+	Inconclusive
+)
+
+// LossVerdict is the result of localizing loss over a probed path
+type LossVerdict struct {
+	Kind LossVerdictKind
+	// Near and Far are the last healthy hop and the first lossy hop.  Far is the first hop whose round trip
+	// is affected, so the fault is either the link between Near and Far or the node Far itself.
+	Near net.IP
+	Far  net.IP
+	// NearIdx and FarIdx are the indices of Near and Far in the probed path
+	NearIdx int
+	FarIdx  int
+	// LossRate is the estimated fraction of round trips lost at the faulty segment
+	LossRate float64
+	// Confidence is the probability that the drop in success rate at the faulty segment is not noise
+	Confidence float64
+	// RateLimited contains path indices of hops whose loss did not carry over to the hops behind them.
+	// These hops are most likely rate limiting or deprioritizing the probes and were ignored.
+	RateLimited []int
+}
+
+// String returns a human readable summary of the verdict
+func (v LossVerdict) String() string {
+	switch v.Kind {
+	case NoLoss:
+		return "no significant loss detected"
+	case LossLocalized:
+		return fmt.Sprintf("loss starts between %s and %s (%.1f%% loss, %.1f%% confidence)", v.Near, v.Far, 100*v.LossRate, 100*v.Confidence)
+	default:
+		return fmt.Sprintf("loss detected but could not be localized (best guess between %s and %s, %.1f%% confidence)", v.Near, v.Far, 100*v.Confidence)
+	}
+}
+
+// LocalizeLoss infers the most likely faulty link or node from the per-hop results of ProbeEachHopOfPath.
+// hops[i] must hold the results for path[i+1], since the round trip to path[i+1] traverses path[1]..path[i+1].
+// Because every round trip also crosses each hop in front of it, the true success rate can only decrease along
+// the path.  Hops that lose more than the hops behind them are treated as rate limited and ignored, the remaining
+// hops are fit with a non-increasing success rate, and the first statistically significant drop is reported.
+func LocalizeLoss(path Path, hops []HopResult) (LossVerdict, error) {
+	if len(path) < 2 {
+		return LossVerdict{}, fmt.Errorf("Path must have atleast 2 hops")
+	}
+	if len(hops) != len(path)-1 {
+		return LossVerdict{}, fmt.Errorf("Expected %d hop results for path of length %d, got %d", len(path)-1, len(path), len(hops))
+	}
+
+	verdict := LossVerdict{Kind: NoLoss}
+
+	// the source is treated as a perfect hop which every round trip starts from
+	candidates := []int{0}
+	counts := []HopResult{{}}
+	for idx, hop := range hops {
+		if hop.Sent == 0 {
+			continue
+		}
+		if isRateLimited(hop, hops[idx+1:]) {
+			verdict.RateLimited = append(verdict.RateLimited, idx+1)
+			continue
+		}
+		candidates = append(candidates, idx+1)
+		counts = append(counts, hop)
+	}
+
+	blocks := fitNonIncreasing(counts)
+
+	var best *LossVerdict
+	for b := 1; b < len(blocks); b++ {
+		prev, curr := blocks[b-1], blocks[b]
+		confidence := dropConfidence(prev.result, curr.result, prev.start == 0)
+		if confidence <= 0 {
+			continue
+		}
+
+		candidate := LossVerdict{
+			Kind:        LossLocalized,
+			NearIdx:     candidates[curr.start-1],
+			FarIdx:      candidates[curr.start],
+			LossRate:    1 - curr.rate/prev.rate,
+			Confidence:  confidence,
+			RateLimited: verdict.RateLimited,
+		}
+		candidate.Near = path[candidate.NearIdx]
+		candidate.Far = path[candidate.FarIdx]
+
+		if confidence >= defaultVerdictConfidence {
+			return candidate, nil
+		}
+		if best == nil || confidence > best.Confidence {
+			best = &candidate
+		}
+	}
+
+	if best != nil {
+		best.Kind = Inconclusive
+		return *best, nil
+	}
+
+	return verdict, nil
+}
+
+// isRateLimited returns true if any hop behind the given hop has a significantly better success rate
+func isRateLimited(hop HopResult, downstream []HopResult) bool {
+	for _, other := range downstream {
+		if other.Sent == 0 {
+			continue
+		}
+		if dropConfidence(other, hop, false) >= defaultVerdictConfidence {
+			return true
+		}
+	}
+	return false
+}
+
+type hopBlock struct {
+	start  int
+	result HopResult
+	rate   float64
+}
+
+// fitNonIncreasing pools adjacent hops until their success rates are non-increasing along the path.
+// This is the pool adjacent violators algorithm, weighted by the number of probes sent to each hop.
+// The first element is the source and is pinned to a success rate of 1.
+func fitNonIncreasing(counts []HopResult) []hopBlock {
+	blocks := []hopBlock{{start: 0, rate: 1}}
+	for idx := 1; idx < len(counts); idx++ {
+		blocks = append(blocks, hopBlock{start: idx, result: counts[idx], rate: counts[idx].SuccessRate()})
+		for len(blocks) > 2 && blocks[len(blocks)-1].rate > blocks[len(blocks)-2].rate {
+			last := blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+			merged := &blocks[len(blocks)-1]
+			merged.result.Sent += last.result.Sent
+			merged.result.Received += last.result.Received
+			merged.rate = merged.result.SuccessRate()
+		}
+	}
+	return blocks
+}
+
+// dropConfidence returns the one sided confidence that the success rate of b is lower than that of a.
+// If perfect is set, a is assumed to be lossless rather than estimated from its counts.
+func dropConfidence(a, b HopResult, perfect bool) float64 {
+	if b.Sent == 0 {
+		return 0
+	}
+	pb := b.SuccessRate()
+
+	if perfect {
+		if b.Received == b.Sent {
+			return 0
+		}
+		// the probability of seeing this many losses or fewer if the hop were lossless is zero,
+		// so measure against a small background loss rate instead to account for noise
+		const background = 0.005
+		return binomialLossConfidence(b, background)
+	}
+
+	if a.Sent == 0 {
+		return 0
+	}
+	pa := a.SuccessRate()
+	if pb >= pa {
+		return 0
+	}
+
+	pooled := float64(a.Received+b.Received) / float64(a.Sent+b.Sent)
+	stderr := math.Sqrt(pooled * (1 - pooled) * (1/float64(a.Sent) + 1/float64(b.Sent)))
+	if stderr == 0 {
+		return 0
+	}
+	z := (pa - pb) / stderr
+
+	return normalCDF(z)
+}
+
+// binomialLossConfidence returns the probability that a hop with the given background loss rate
+// would lose fewer probes than the hop in question did
+func binomialLossConfidence(hop HopResult, background float64) float64 {
+	lost := hop.Sent - hop.Received
+	cumulative := 0.0
+	for k := 0; k < lost; k++ {
+		cumulative += binomialPMF(hop.Sent, k, background)
+	}
+	return cumulative
+}
+
+func binomialPMF(n, k int, p float64) float64 {
+	lgN, _ := math.Lgamma(float64(n + 1))
+	lgK, _ := math.Lgamma(float64(k + 1))
+	lgNK, _ := math.Lgamma(float64(n - k + 1))
+	return math.Exp(lgN - lgK - lgNK + float64(k)*math.Log(p) + float64(n-k)*math.Log(1-p))
+}
+
+func normalCDF(z float64) float64 {
+	return 0.5 * (1 + math.Erf(z/math.Sqrt2))
+}
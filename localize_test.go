@@ -0,0 +1,122 @@
+package beacon
+
+import (
+	"net"
+	"testing"
+)
+
+var localizeTestPath = Path{
+	net.IP{10, 20, 30, 96},
+	net.IP{104, 44, 22, 235},
+	net.IP{104, 44, 19, 212},
+	net.IP{104, 44, 18, 224},
+	net.IP{104, 44, 7, 223},
+}
+
+func TestLocalizeLossNoLoss(t *testing.T) {
+	hops := []HopResult{{30, 30}, {30, 30}, {30, 30}, {30, 30}}
+
+	verdict, err := LocalizeLoss(localizeTestPath, hops)
+	if err != nil {
+		t.Errorf("Failed to localize loss: %s", err)
+		t.FailNow()
+	}
+
+	if verdict.Kind != NoLoss {
+		t.Errorf("Expected no loss verdict for a clean path, got: %s", verdict)
+	}
+}
+
+func TestLocalizeLossMidPath(t *testing.T) {
+	hops := []HopResult{{30, 30}, {30, 29}, {30, 15}, {30, 14}}
+
+	verdict, err := LocalizeLoss(localizeTestPath, hops)
+	if err != nil {
+		t.Errorf("Failed to localize loss: %s", err)
+		t.FailNow()
+	}
+
+	if verdict.Kind != LossLocalized {
+		t.Errorf("Expected loss to be localized, got: %s", verdict)
+		t.FailNow()
+	}
+
+	if verdict.NearIdx != 2 || verdict.FarIdx != 3 {
+		t.Errorf("Expected loss between hops 2 and 3, got %d and %d", verdict.NearIdx, verdict.FarIdx)
+	}
+
+	if !verdict.Near.Equal(localizeTestPath[2]) || !verdict.Far.Equal(localizeTestPath[3]) {
+		t.Errorf("Verdict hops %s and %s do not match path", verdict.Near, verdict.Far)
+	}
+
+	if verdict.Confidence < defaultVerdictConfidence {
+		t.Errorf("Expected confidence of atleast %f, got %f", defaultVerdictConfidence, verdict.Confidence)
+	}
+}
+
+func TestLocalizeLossFirstHop(t *testing.T) {
+	hops := []HopResult{{30, 20}, {30, 19}, {30, 21}, {30, 20}}
+
+	verdict, err := LocalizeLoss(localizeTestPath, hops)
+	if err != nil {
+		t.Errorf("Failed to localize loss: %s", err)
+		t.FailNow()
+	}
+
+	if verdict.Kind != LossLocalized || verdict.NearIdx != 0 || verdict.FarIdx != 1 {
+		t.Errorf("Expected loss between the source and the first hop, got: %s", verdict)
+	}
+}
+
+func TestLocalizeLossIgnoresRateLimitedHop(t *testing.T) {
+	hops := []HopResult{{30, 30}, {30, 5}, {30, 30}, {30, 29}}
+
+	verdict, err := LocalizeLoss(localizeTestPath, hops)
+	if err != nil {
+		t.Errorf("Failed to localize loss: %s", err)
+		t.FailNow()
+	}
+
+	if verdict.Kind == LossLocalized {
+		t.Errorf("Loss on a hop which recovers downstream should not be localized, got: %s", verdict)
+	}
+
+	if len(verdict.RateLimited) != 1 || verdict.RateLimited[0] != 2 {
+		t.Errorf("Expected hop 2 to be reported as rate limited, got %v", verdict.RateLimited)
+	}
+}
+
+func TestLocalizeLossRateLimitedBeforeFault(t *testing.T) {
+	hops := []HopResult{{30, 5}, {30, 30}, {30, 12}, {30, 11}}
+
+	verdict, err := LocalizeLoss(localizeTestPath, hops)
+	if err != nil {
+		t.Errorf("Failed to localize loss: %s", err)
+		t.FailNow()
+	}
+
+	if verdict.Kind != LossLocalized || verdict.NearIdx != 2 || verdict.FarIdx != 3 {
+		t.Errorf("Expected loss between hops 2 and 3, got: %s", verdict)
+	}
+}
+
+func TestLocalizeLossSingleDrop(t *testing.T) {
+	hops := []HopResult{{30, 30}, {30, 30}, {30, 29}, {30, 30}}
+
+	verdict, err := LocalizeLoss(localizeTestPath, hops)
+	if err != nil {
+		t.Errorf("Failed to localize loss: %s", err)
+		t.FailNow()
+	}
+
+	if verdict.Kind == LossLocalized {
+		t.Errorf("A single lost probe should not be enough to localize loss, got: %s", verdict)
+	}
+}
+
+func TestLocalizeLossMismatchedLength(t *testing.T) {
+	_, err := LocalizeLoss(localizeTestPath, []HopResult{{30, 30}})
+	if err == nil {
+		t.Errorf("Expected an error when the number of hop results does not match the path")
+	}
+}
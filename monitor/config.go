@@ -0,0 +1,257 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/trstruth/beacon"
+	"gopkg.in/yaml.v2"
+)
+
+// the defaults of a job which sets neither the field nor the defaults section of its config
+const (
+	defaultNumPackets = 10
+	defaultTimeout    = 3
+	defaultInterval   = time.Minute
+)
+
+// Discovery methods of a job with targets
+const (
+	// DiscoverTraceroute traces the path from the monitor with GetPathTo
+	DiscoverTraceroute = "traceroute"
+	// DiscoverFromSource traces the path from the source of the job with GetPathFromSourceToDest
+	DiscoverFromSource = "source"
+)
+
+// Config describes the monitoring jobs of a monitor, and is loaded from a YAML or JSON file with LoadConfig.  A field
+// which a job leaves unset is taken from Defaults.
+type Config struct {
+	Defaults JobConfig   `yaml:"defaults" json:"defaults"`
+	Jobs     []JobConfig `yaml:"jobs" json:"jobs"`
+}
+
+// JobConfig is a group of targets probed with the same settings
+type JobConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Targets are IPs or hosts whose path is discovered before every round
+	Targets []string `yaml:"targets" json:"targets"`
+	// Paths are comma separated lists of hops, starting with the source
+	Paths []string `yaml:"paths" json:"paths"`
+	// Discovery is DiscoverTraceroute or DiscoverFromSource
+	Discovery string `yaml:"discovery" json:"discovery"`
+	Source    string `yaml:"source" json:"source"`
+
+	NumPackets int      `yaml:"num_packets" json:"num_packets"`
+	Interval   Duration `yaml:"interval" json:"interval"`
+	// Timeout is in seconds
+	Timeout    int              `yaml:"timeout" json:"timeout"`
+	DSCP       uint8            `yaml:"dscp" json:"dscp"`
+	Thresholds ThresholdsConfig `yaml:"thresholds" json:"thresholds"`
+}
+
+// ThresholdsConfig is the config form of Thresholds
+type ThresholdsConfig struct {
+	LossRatio float64  `yaml:"loss_ratio" json:"loss_ratio"`
+	RTT       Duration `yaml:"rtt" json:"rtt"`
+}
+
+// Duration is a time.Duration written as a string such as "1m30s" in a config
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadConfig reads a config from a file, which is parsed as JSON if its name ends in .json and as YAML otherwise.
+// Unknown fields are rejected.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read config: %s", err)
+	}
+
+	config := &Config{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	} else {
+		err = yaml.UnmarshalStrict(data, config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse config %s: %s", path, err)
+	}
+	return config, nil
+}
+
+// Targets returns the targets of every job, named "<job>/<target or path>".  Hosts are resolved once, here.
+func (c *Config) Targets() ([]Target, error) {
+	var targets []Target
+	jobNames := make(map[string]bool)
+	for idx, job := range c.Jobs {
+		if job.Name == "" {
+			return nil, fmt.Errorf("job %d has no name", idx)
+		}
+		if jobNames[job.Name] {
+			return nil, fmt.Errorf("more than one job is named %q", job.Name)
+		}
+		jobNames[job.Name] = true
+
+		jobTargets, err := jobTargets(c.withDefaults(job))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid job %s: %s", job.Name, err)
+		}
+		targets = append(targets, jobTargets...)
+	}
+	return targets, nil
+}
+
+// withDefaults fills the unset fields of a job from the defaults section, and then the built in defaults
+func (c *Config) withDefaults(job JobConfig) JobConfig {
+	defaults := c.Defaults
+	if job.Discovery == "" {
+		job.Discovery = defaults.Discovery
+	}
+	if job.Source == "" {
+		job.Source = defaults.Source
+	}
+	if job.NumPackets == 0 {
+		job.NumPackets = defaults.NumPackets
+	}
+	if job.Interval == 0 {
+		job.Interval = defaults.Interval
+	}
+	if job.Timeout == 0 {
+		job.Timeout = defaults.Timeout
+	}
+	if job.DSCP == 0 {
+		job.DSCP = defaults.DSCP
+	}
+	if job.Thresholds.LossRatio == 0 {
+		job.Thresholds.LossRatio = defaults.Thresholds.LossRatio
+	}
+	if job.Thresholds.RTT == 0 {
+		job.Thresholds.RTT = defaults.Thresholds.RTT
+	}
+
+	if job.Discovery == "" {
+		job.Discovery = DiscoverTraceroute
+	}
+	if job.NumPackets == 0 {
+		job.NumPackets = defaultNumPackets
+	}
+	if job.Interval == 0 {
+		job.Interval = Duration(defaultInterval)
+	}
+	if job.Timeout == 0 {
+		job.Timeout = defaultTimeout
+	}
+	return job
+}
+
+func jobTargets(job JobConfig) ([]Target, error) {
+	if len(job.Targets) == 0 && len(job.Paths) == 0 {
+		return nil, fmt.Errorf("a job must have atleast one target or path")
+	}
+	if job.Thresholds.LossRatio < 0 || job.Thresholds.LossRatio > 1 {
+		return nil, fmt.Errorf("the loss ratio threshold must be between 0 and 1, got %v", job.Thresholds.LossRatio)
+	}
+
+	var source net.IP
+	switch job.Discovery {
+	case DiscoverTraceroute:
+	case DiscoverFromSource:
+		if job.Source == "" {
+			return nil, fmt.Errorf("discovery %q requires a source", DiscoverFromSource)
+		}
+		var err error
+		if source, err = beacon.ParseIPFromString(job.Source); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown discovery %q, expected %q or %q", job.Discovery, DiscoverTraceroute, DiscoverFromSource)
+	}
+
+	template := Target{
+		Source:     source,
+		NumPackets: job.NumPackets,
+		Timeout:    job.Timeout,
+		Interval:   time.Duration(job.Interval),
+		DSCP:       job.DSCP,
+		Thresholds: Thresholds{LossRatio: job.Thresholds.LossRatio, RTT: time.Duration(job.Thresholds.RTT)},
+	}
+
+	var targets []Target
+	for _, dest := range job.Targets {
+		destIP, err := beacon.ParseIPFromString(dest)
+		if err != nil {
+			return nil, err
+		}
+		target := template
+		target.Name = job.Name + "/" + dest
+		target.Dest = destIP
+		targets = append(targets, target)
+	}
+	for _, hops := range job.Paths {
+		path, err := parsePath(hops)
+		if err != nil {
+			return nil, err
+		}
+		target := template
+		// the source only applies to discovered paths
+		target.Source = nil
+		target.Name = job.Name + "/" + path.String()
+		target.Path = path
+		targets = append(targets, target)
+	}
+
+	for idx := range targets {
+		if err := targets[idx].validate(); err != nil {
+			return nil, fmt.Errorf("Invalid target %s: %s", targets[idx].Name, err)
+		}
+	}
+	return targets, nil
+}
+
+// parsePath parses a comma separated list of hops
+func parsePath(hops string) (beacon.Path, error) {
+	hopStrings := strings.Split(hops, ",")
+	path := make(beacon.Path, len(hopStrings))
+	for idx, hop := range hopStrings {
+		hopIP, err := beacon.ParseIPFromString(strings.TrimSpace(hop))
+		if err != nil {
+			return nil, err
+		}
+		path[idx] = hopIP
+	}
+	return path, nil
+}
@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "monitor")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %s", err)
+	}
+	return path
+}
+
+const testYAMLConfig = `
+defaults:
+  num_packets: 20
+  interval: 30s
+  thresholds:
+    loss_ratio: 0.05
+jobs:
+  - name: edge
+    targets: [10.0.0.3]
+    paths: ["10.0.0.1,10.0.0.2, 10.0.0.3"]
+    dscp: 46
+    thresholds:
+      rtt: 50ms
+  - name: third-party
+    discovery: source
+    source: 10.1.0.1
+    targets: [10.0.0.3]
+    timeout: 5
+`
+
+func TestLoadConfigYAML(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, "monitor.yaml", testYAMLConfig))
+	if err != nil {
+		t.Fatalf("Failed to load config: %s", err)
+	}
+	targets, err := config.Targets()
+	if err != nil {
+		t.Fatalf("Failed to get targets: %s", err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("Expected 3 targets, got %+v", targets)
+	}
+
+	dest, path, thirdParty := targets[0], targets[1], targets[2]
+	if dest.Name != "edge/10.0.0.3" || !dest.Dest.Equal(net.IP{10, 0, 0, 3}) || dest.Source != nil {
+		t.Errorf("Expected edge/10.0.0.3 to be discovered from the monitor, got %+v", dest)
+	}
+	if dest.NumPackets != 20 || dest.Interval != 30*time.Second || dest.Timeout != defaultTimeout || dest.DSCP != 46 {
+		t.Errorf("Expected the settings of edge/10.0.0.3 to be merged with the defaults, got %+v", dest)
+	}
+	if dest.Thresholds != (Thresholds{LossRatio: 0.05, RTT: 50 * time.Millisecond}) {
+		t.Errorf("Expected the thresholds of edge/10.0.0.3 to be merged with the defaults, got %+v", dest.Thresholds)
+	}
+	if !path.Path.Equal(testPath) || path.Name != "edge/"+testPath.String() {
+		t.Errorf("Expected a target for the path %s, got %+v", testPath, path)
+	}
+	if !thirdParty.Source.Equal(net.IP{10, 1, 0, 1}) || thirdParty.Timeout != 5 || thirdParty.DSCP != 0 {
+		t.Errorf("Expected third-party/10.0.0.3 to be discovered from its source, got %+v", thirdParty)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, "monitor.json", `{"jobs": [{"name": "edge", "targets": ["10.0.0.3"], "interval": "5m"}]}`))
+	if err != nil {
+		t.Fatalf("Failed to load config: %s", err)
+	}
+	targets, err := config.Targets()
+	if err != nil {
+		t.Fatalf("Failed to get targets: %s", err)
+	}
+	if len(targets) != 1 || targets[0].Interval != 5*time.Minute || targets[0].NumPackets != defaultNumPackets {
+		t.Errorf("Expected one target probed every 5m with the default number of packets, got %+v", targets)
+	}
+}
+
+func TestLoadConfigRejectsUnknownFields(t *testing.T) {
+	files := map[string]string{
+		"monitor.yaml": "jobs:\n  - name: edge\n    target: [10.0.0.3]\n",
+		"monitor.json": `{"jobs": [{"name": "edge", "target": ["10.0.0.3"]}]}`,
+	}
+	for name, content := range files {
+		if _, err := LoadConfig(writeConfig(t, name, content)); err == nil {
+			t.Errorf("Expected %s to be rejected for its unknown field", name)
+		}
+	}
+}
+
+func TestConfigTargetsInvalid(t *testing.T) {
+	invalid := map[string]Config{
+		"unnamed job":          {Jobs: []JobConfig{{Targets: []string{"10.0.0.3"}}}},
+		"duplicate job":        {Jobs: []JobConfig{{Name: "a", Targets: []string{"10.0.0.3"}}, {Name: "a", Targets: []string{"10.0.0.4"}}}},
+		"no targets":           {Jobs: []JobConfig{{Name: "a"}}},
+		"source discovery":     {Jobs: []JobConfig{{Name: "a", Discovery: DiscoverFromSource, Targets: []string{"10.0.0.3"}}}},
+		"unknown discovery":    {Jobs: []JobConfig{{Name: "a", Discovery: "ping", Targets: []string{"10.0.0.3"}}}},
+		"short path":           {Jobs: []JobConfig{{Name: "a", Paths: []string{"10.0.0.1"}}}},
+		"dscp":                 {Jobs: []JobConfig{{Name: "a", DSCP: 64, Targets: []string{"10.0.0.3"}}}},
+		"loss ratio":           {Jobs: []JobConfig{{Name: "a", Thresholds: ThresholdsConfig{LossRatio: 2}, Targets: []string{"10.0.0.3"}}}},
+		"negative num_packets": {Defaults: JobConfig{NumPackets: -1}, Jobs: []JobConfig{{Name: "a", Targets: []string{"10.0.0.3"}}}},
+	}
+	for name, config := range invalid {
+		if _, err := config.Targets(); err == nil {
+			t.Errorf("Expected the config with an invalid %s to be rejected", name)
+		}
+	}
+}
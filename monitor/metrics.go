@@ -0,0 +1,275 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trstruth/beacon"
+)
+
+// RTTBuckets are the upper bounds in seconds of the round trip time histogram of each hop
+var RTTBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// histogram counts observations into RTTBuckets
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(RTTBuckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for idx, bound := range RTTBuckets {
+		if v <= bound {
+			h.counts[idx]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// hopMetrics are the metrics of one hop of a target path
+type hopMetrics struct {
+	hop      net.IP
+	sent     uint64
+	received uint64
+	// loss is the loss ratio of the last round which sent packets to the hop
+	loss float64
+	rtt  *histogram
+	// lossExceeded and rttExceeded are set while the last round was worse than the thresholds of the target
+	lossExceeded bool
+	rttExceeded  bool
+}
+
+// targetMetrics are the metrics of one monitored target
+type targetMetrics struct {
+	path        beacon.Path
+	hops        []*hopMetrics
+	rounds      uint64
+	errors      uint64
+	pathChanges uint64
+}
+
+// Metrics holds the metrics of every target of a Monitor, and writes them in the Prometheus text format
+type Metrics struct {
+	lock    sync.Mutex
+	targets map[string]*targetMetrics
+}
+
+// NewMetrics returns an empty set of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{targets: make(map[string]*targetMetrics)}
+}
+
+func (m *Metrics) target(name string) *targetMetrics {
+	t, ok := m.targets[name]
+	if !ok {
+		t = &targetMetrics{}
+		m.targets[name] = t
+	}
+	return t
+}
+
+// setPath records the path a target is probed over.  When it differs from the previous path the change is counted,
+// and the hops of the previous path are forgotten.
+func (m *Metrics) setPath(name string, path beacon.Path) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	t := m.target(name)
+	if t.path.Equal(path) {
+		return
+	}
+	if t.path != nil {
+		t.pathChanges++
+	}
+	t.path = path
+	t.hops = make([]*hopMetrics, len(path)-1)
+	for idx := range t.hops {
+		t.hops[idx] = &hopMetrics{hop: path[idx+1], rtt: newHistogram()}
+	}
+}
+
+// observeRound records the results of probing the current path of a target once.  hops[i] holds the results for
+// hop i+1 of the path, and rtts[i] the round trip times of its successful probes.  Returns a description of each
+// threshold a hop started to exceed.
+func (m *Metrics) observeRound(name string, hops []beacon.HopResult, rtts [][]time.Duration, thresholds Thresholds) []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var alerts []string
+	t := m.target(name)
+	t.rounds++
+	for idx, result := range hops {
+		if idx >= len(t.hops) || result.Sent == 0 {
+			continue
+		}
+		hop := t.hops[idx]
+		hop.sent += uint64(result.Sent)
+		hop.received += uint64(result.Received)
+		hop.loss = 1 - result.SuccessRate()
+
+		var total time.Duration
+		for _, rtt := range rtts[idx] {
+			hop.rtt.observe(rtt.Seconds())
+			total += rtt
+		}
+
+		lossExceeded := thresholds.LossRatio > 0 && hop.loss > thresholds.LossRatio
+		if lossExceeded && !hop.lossExceeded {
+			alerts = append(alerts, fmt.Sprintf("loss ratio %.3f of hop %d (%s) exceeds %.3f", hop.loss, idx+1, hop.hop, thresholds.LossRatio))
+		}
+		hop.lossExceeded = lossExceeded
+
+		rttExceeded := false
+		if thresholds.RTT > 0 && len(rtts[idx]) > 0 {
+			mean := total / time.Duration(len(rtts[idx]))
+			rttExceeded = mean > thresholds.RTT
+			if rttExceeded && !hop.rttExceeded {
+				alerts = append(alerts, fmt.Sprintf("mean round trip time %s of hop %d (%s) exceeds %s", mean, idx+1, hop.hop, thresholds.RTT))
+			}
+		}
+		hop.rttExceeded = rttExceeded
+	}
+	return alerts
+}
+
+// observeError counts a round of a target which failed
+func (m *Metrics) observeError(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.target(name).errors++
+}
+
+// remove forgets the metrics of a target
+func (m *Metrics) remove(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.targets, name)
+}
+
+// WriteTo writes the metrics of every target in the Prometheus text format, followed by the receive counters of tc
+// if it isn't nil
+func (m *Metrics) WriteTo(w io.Writer, tc *beacon.TransportChannel) error {
+	m.lock.Lock()
+	names := make([]string, 0, len(m.targets))
+	for name := range m.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	family(&b, "beacon_probe_rounds_total", "counter", "Rounds of probes sent over the path of a target.")
+	for _, name := range names {
+		sample(&b, "beacon_probe_rounds_total", labels("target", name), float64(m.targets[name].rounds))
+	}
+	family(&b, "beacon_probe_round_errors_total", "counter", "Rounds of a target which failed to discover or probe its path.")
+	for _, name := range names {
+		sample(&b, "beacon_probe_round_errors_total", labels("target", name), float64(m.targets[name].errors))
+	}
+	family(&b, "beacon_path_changes_total", "counter", "Times the discovered path of a target changed.")
+	for _, name := range names {
+		sample(&b, "beacon_path_changes_total", labels("target", name), float64(m.targets[name].pathChanges))
+	}
+	family(&b, "beacon_path_hops", "gauge", "Number of hops on the current path of a target, not counting the source.")
+	for _, name := range names {
+		sample(&b, "beacon_path_hops", labels("target", name), float64(len(m.targets[name].hops)))
+	}
+
+	eachHop := func(f func(hopLabels []string, hop *hopMetrics)) {
+		for _, name := range names {
+			for idx, hop := range m.targets[name].hops {
+				f([]string{"target", name, "hop_index", strconv.Itoa(idx + 1), "hop", hop.hop.String()}, hop)
+			}
+		}
+	}
+	family(&b, "beacon_hop_probes_sent_total", "counter", "Probes sent to a hop.")
+	eachHop(func(l []string, hop *hopMetrics) {
+		sample(&b, "beacon_hop_probes_sent_total", labels(l...), float64(hop.sent))
+	})
+	family(&b, "beacon_hop_probes_received_total", "counter", "Probes which came back from a hop.")
+	eachHop(func(l []string, hop *hopMetrics) {
+		sample(&b, "beacon_hop_probes_received_total", labels(l...), float64(hop.received))
+	})
+	family(&b, "beacon_hop_loss_ratio", "gauge", "Fraction of the probes sent to a hop in the last round which were lost.")
+	eachHop(func(l []string, hop *hopMetrics) { sample(&b, "beacon_hop_loss_ratio", labels(l...), hop.loss) })
+	family(&b, "beacon_hop_rtt_seconds", "histogram", "Round trip time of the probes which came back from a hop.")
+	eachHop(func(l []string, hop *hopMetrics) {
+		bucket := append(l, "le", "")
+		for idx, bound := range RTTBuckets {
+			bucket[len(bucket)-1] = strconv.FormatFloat(bound, 'g', -1, 64)
+			sample(&b, "beacon_hop_rtt_seconds_bucket", labels(bucket...), float64(hop.rtt.counts[idx]))
+		}
+		bucket[len(bucket)-1] = "+Inf"
+		sample(&b, "beacon_hop_rtt_seconds_bucket", labels(bucket...), float64(hop.rtt.count))
+		sample(&b, "beacon_hop_rtt_seconds_sum", labels(l...), hop.rtt.sum)
+		sample(&b, "beacon_hop_rtt_seconds_count", labels(l...), float64(hop.rtt.count))
+	})
+	family(&b, "beacon_hop_threshold_exceeded", "gauge", "Whether the last round of a hop was worse than a threshold of its target.")
+	eachHop(func(l []string, hop *hopMetrics) {
+		sample(&b, "beacon_hop_threshold_exceeded", labels(append(l, "threshold", "loss_ratio")...), boolValue(hop.lossExceeded))
+		sample(&b, "beacon_hop_threshold_exceeded", labels(append(l, "threshold", "rtt")...), boolValue(hop.rttExceeded))
+	})
+	m.lock.Unlock()
+
+	if tc != nil {
+		// the counters are still written if some device failed to report its capture stats
+		stats, _ := tc.Stats()
+		transport := []struct {
+			name, kind, help string
+			value            float64
+		}{
+			{"beacon_transport_packets_received_total", "counter", "Packets read from the capture handles.", float64(stats.Received)},
+			{"beacon_transport_packets_matched_total", "counter", "Packets delivered to a registered hash, rule or listener.", float64(stats.Matched)},
+			{"beacon_transport_packets_unmatched_total", "counter", "Packets which nobody was waiting for.", float64(stats.Unmatched)},
+			{"beacon_transport_queue_dropped_total", "counter", "Packets dropped because a queue or subscription of beacon was full.", float64(stats.QueueDropped)},
+			{"beacon_transport_capture_dropped_total", "counter", "Packets the capture backend dropped before beacon read them.", float64(stats.CaptureDropped)},
+			{"beacon_transport_interface_dropped_total", "counter", "Packets the network interfaces dropped.", float64(stats.IfDropped)},
+			{"beacon_transport_live_registrations", "gauge", "Hashes and rules currently waiting for a packet.", float64(stats.LiveRegistrations)},
+		}
+		for _, metric := range transport {
+			family(&b, metric.name, metric.kind, metric.help)
+			sample(&b, metric.name, "", metric.value)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func family(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sample(b *strings.Builder, name, labels string, value float64) {
+	fmt.Fprintf(b, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats pairs of label names and values
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for idx := 0; idx+1 < len(pairs); idx += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[idx], labelEscaper.Replace(pairs[idx+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
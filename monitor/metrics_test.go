@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstruth/beacon"
+)
+
+var testPath = beacon.Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}, net.IP{10, 0, 0, 3}}
+
+func writeMetrics(t *testing.T, m *Metrics) string {
+	var b strings.Builder
+	if err := m.WriteTo(&b, nil); err != nil {
+		t.Fatalf("Failed to write metrics: %s", err)
+	}
+	return b.String()
+}
+
+func expectLines(t *testing.T, text string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("Expected the metrics to contain %q, got:\n%s", line, text)
+		}
+	}
+}
+
+func TestMetricsRecordRounds(t *testing.T) {
+	m := NewMetrics()
+	m.setPath("edge", testPath)
+	m.observeRound("edge",
+		[]beacon.HopResult{{Sent: 10, Received: 10}, {Sent: 10, Received: 8}},
+		[][]time.Duration{{2 * time.Millisecond}, {30 * time.Millisecond, 3 * time.Second}},
+		Thresholds{},
+	)
+	m.observeRound("edge",
+		[]beacon.HopResult{{Sent: 10, Received: 10}, {Sent: 10, Received: 9}},
+		[][]time.Duration{nil, nil},
+		Thresholds{},
+	)
+
+	expectLines(t, writeMetrics(t, m),
+		"# TYPE beacon_hop_rtt_seconds histogram",
+		`beacon_probe_rounds_total{target="edge"} 2`,
+		`beacon_path_changes_total{target="edge"} 0`,
+		`beacon_path_hops{target="edge"} 2`,
+		`beacon_hop_probes_sent_total{target="edge",hop_index="2",hop="10.0.0.3"} 20`,
+		`beacon_hop_probes_received_total{target="edge",hop_index="2",hop="10.0.0.3"} 17`,
+		`beacon_hop_loss_ratio{target="edge",hop_index="1",hop="10.0.0.2"} 0`,
+		`beacon_hop_rtt_seconds_bucket{target="edge",hop_index="1",hop="10.0.0.2",le="0.001"} 0`,
+		`beacon_hop_rtt_seconds_bucket{target="edge",hop_index="1",hop="10.0.0.2",le="0.0025"} 1`,
+		`beacon_hop_rtt_seconds_bucket{target="edge",hop_index="2",hop="10.0.0.3",le="2.5"} 1`,
+		`beacon_hop_rtt_seconds_bucket{target="edge",hop_index="2",hop="10.0.0.3",le="+Inf"} 2`,
+		`beacon_hop_rtt_seconds_count{target="edge",hop_index="2",hop="10.0.0.3"} 2`,
+	)
+	if text := writeMetrics(t, m); !strings.Contains(text, `beacon_hop_loss_ratio{target="edge",hop_index="2",hop="10.0.0.3"} 0.09`) {
+		t.Errorf("Expected the loss ratio of the last round, got:\n%s", text)
+	}
+}
+
+func TestMetricsCountPathChanges(t *testing.T) {
+	m := NewMetrics()
+	m.setPath("edge", testPath)
+	m.observeRound("edge", []beacon.HopResult{{Sent: 1, Received: 1}, {Sent: 1, Received: 1}}, make([][]time.Duration, 2), Thresholds{})
+	m.setPath("edge", testPath)
+
+	rerouted := beacon.Path{testPath[0], net.IP{10, 0, 1, 2}, testPath[2]}
+	m.setPath("edge", rerouted)
+
+	text := writeMetrics(t, m)
+	expectLines(t, text,
+		`beacon_path_changes_total{target="edge"} 1`,
+		`beacon_hop_probes_sent_total{target="edge",hop_index="1",hop="10.0.1.2"} 0`,
+	)
+	if strings.Contains(text, `hop="10.0.0.2"`) {
+		t.Errorf("Expected the hops of the old path to be forgotten, got:\n%s", text)
+	}
+}
+
+func TestMetricsThresholds(t *testing.T) {
+	m := NewMetrics()
+	m.setPath("edge", testPath)
+	thresholds := Thresholds{LossRatio: 0.1, RTT: 10 * time.Millisecond}
+
+	alerts := m.observeRound("edge",
+		[]beacon.HopResult{{Sent: 10, Received: 10}, {Sent: 10, Received: 5}},
+		[][]time.Duration{{20 * time.Millisecond, 30 * time.Millisecond}, {time.Millisecond}},
+		thresholds,
+	)
+	if len(alerts) != 2 {
+		t.Errorf("Expected an alert for the rtt of hop 1 and the loss of hop 2, got %q", alerts)
+	}
+	expectLines(t, writeMetrics(t, m),
+		`beacon_hop_threshold_exceeded{target="edge",hop_index="1",hop="10.0.0.2",threshold="rtt"} 1`,
+		`beacon_hop_threshold_exceeded{target="edge",hop_index="2",hop="10.0.0.3",threshold="loss_ratio"} 1`,
+		`beacon_hop_threshold_exceeded{target="edge",hop_index="2",hop="10.0.0.3",threshold="rtt"} 0`,
+	)
+
+	alerts = m.observeRound("edge",
+		[]beacon.HopResult{{Sent: 10, Received: 10}, {Sent: 10, Received: 6}},
+		[][]time.Duration{{time.Millisecond}, nil},
+		thresholds,
+	)
+	if len(alerts) != 0 {
+		t.Errorf("Expected no new alerts while the loss of hop 2 stays high, got %q", alerts)
+	}
+	expectLines(t, writeMetrics(t, m),
+		`beacon_hop_threshold_exceeded{target="edge",hop_index="1",hop="10.0.0.2",threshold="rtt"} 0`,
+		`beacon_hop_threshold_exceeded{target="edge",hop_index="2",hop="10.0.0.3",threshold="loss_ratio"} 1`,
+	)
+}
+
+func TestMetricsEscapeLabels(t *testing.T) {
+	m := NewMetrics()
+	m.observeError("a \"quoted\" \\ target\n")
+
+	expectLines(t, writeMetrics(t, m), `beacon_probe_round_errors_total{target="a \"quoted\" \\ target\n"} 1`)
+}
@@ -0,0 +1,347 @@
+// Package monitor probes a set of target paths continuously, and exposes the loss and round trip times of every hop
+// as Prometheus metrics.
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trstruth/beacon"
+	"github.com/trstruth/beacon/history"
+)
+
+var log = logrus.New()
+
+// Target is a path which is probed every Interval.  Either Path is set, or Dest is and the path to it is discovered
+// with a traceroute before every round, which is how path changes are found.
+type Target struct {
+	// Name labels the metrics of the target, it defaults to Dest or Path
+	Name string
+	// Path lists the hops to probe, starting with the source
+	Path beacon.Path
+	Dest net.IP
+	// Source discovers the path from Source to Dest with GetPathFromSourceToDest, instead of the path from the
+	// monitor with GetPathTo
+	Source net.IP
+	// NumPackets is sent to each hop every round
+	NumPackets int
+	// Timeout is in seconds
+	Timeout  int
+	Interval time.Duration
+	// DSCP marks the probes, see beacon.WithDSCP
+	DSCP       uint8
+	Thresholds Thresholds
+}
+
+// Thresholds flag the hops of a target whose last round was worse than them, a zero threshold is disabled
+type Thresholds struct {
+	LossRatio float64
+	// RTT is compared with the mean round trip time of a round
+	RTT time.Duration
+}
+
+func (t *Target) validate() error {
+	if (t.Path == nil) == (t.Dest == nil) {
+		return fmt.Errorf("a target must have exactly one of a path or a dest")
+	}
+	if t.Source != nil && t.Dest == nil {
+		return fmt.Errorf("a target with a source must have a dest to discover the path to")
+	}
+	if t.Path != nil && len(t.Path) < 2 {
+		return fmt.Errorf("the path of a target must have atleast 2 hops, got %d", len(t.Path))
+	}
+	if t.NumPackets < 1 || t.Timeout < 1 || t.Interval <= 0 {
+		return fmt.Errorf("a target must send atleast 1 packet with a positive timeout and interval")
+	}
+	if t.DSCP > 63 {
+		return fmt.Errorf("DSCP must be between 0 and 63, got %d", t.DSCP)
+	}
+	if t.Name == "" {
+		if t.Dest != nil {
+			t.Name = t.Dest.String()
+		} else {
+			t.Name = t.Path.String()
+		}
+	}
+	return nil
+}
+
+// Monitor probes targets over one shared TransportChannel, which has to capture both traceroute and boomerang
+// packets, see beacon.NewSharedTransportChannel
+type Monitor struct {
+	tc      *beacon.TransportChannel
+	metrics *Metrics
+	history *history.Store
+
+	lock    sync.Mutex
+	running map[string]*runningTarget
+	wg      sync.WaitGroup
+}
+
+type runningTarget struct {
+	target Target
+	stop   chan struct{}
+}
+
+// Option modifies a Monitor on construction
+type Option func(*Monitor)
+
+// WithHistory records the discovered path of every round of the targets with a Dest in a history store
+func WithHistory(store *history.Store) Option {
+	return func(m *Monitor) {
+		m.history = store
+	}
+}
+
+// New returns a Monitor with no targets
+func New(tc *beacon.TransportChannel, options ...Option) *Monitor {
+	m := &Monitor{
+		tc:      tc,
+		metrics: NewMetrics(),
+		running: make(map[string]*runningTarget),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// Metrics returns the metrics of the targets of the monitor
+func (m *Monitor) Metrics() *Metrics {
+	return m.metrics
+}
+
+// Add starts probing a target.  Returns an error if the target is invalid or another target has the same name.
+func (m *Monitor) Add(target Target) error {
+	if err := target.validate(); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.running[target.Name]; ok {
+		return fmt.Errorf("a target named %q is already being monitored", target.Name)
+	}
+	m.start(target)
+	return nil
+}
+
+// Update replaces the targets of the monitor.  Targets which are unchanged keep running with their metrics, the
+// others are removed or restarted.  Nothing changes if any of the targets is invalid.
+func (m *Monitor) Update(targets []Target) error {
+	// validate names the targets which don't have a name, so they are started from the validated copies
+	validated := make([]Target, 0, len(targets))
+	byName := make(map[string]Target, len(targets))
+	for _, target := range targets {
+		if err := target.validate(); err != nil {
+			return fmt.Errorf("Invalid target %s: %s", target.Name, err)
+		}
+		if _, ok := byName[target.Name]; ok {
+			return fmt.Errorf("more than one target is named %q", target.Name)
+		}
+		byName[target.Name] = target
+		validated = append(validated, target)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for name, running := range m.running {
+		if target, ok := byName[name]; ok && reflect.DeepEqual(target, running.target) {
+			delete(byName, name)
+			continue
+		}
+		m.removeLocked(name)
+	}
+	for _, target := range validated {
+		if _, ok := byName[target.Name]; ok {
+			m.start(target)
+		}
+	}
+	return nil
+}
+
+// start runs a target, the lock must be held
+func (m *Monitor) start(target Target) {
+	running := &runningTarget{target: target, stop: make(chan struct{})}
+	m.running[target.Name] = running
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.run(target, running.stop)
+	}()
+}
+
+// Remove stops probing a target and forgets its metrics.  A round in progress runs to completion in the background.
+// Returns false if no target has the name.
+func (m *Monitor) Remove(name string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.removeLocked(name)
+}
+
+func (m *Monitor) removeLocked(name string) bool {
+	running, ok := m.running[name]
+	if !ok {
+		return false
+	}
+	close(running.stop)
+	delete(m.running, name)
+	m.metrics.remove(name)
+	return true
+}
+
+// Stop removes every target, and waits for the rounds in progress to finish
+func (m *Monitor) Stop() {
+	m.lock.Lock()
+	for name, running := range m.running {
+		close(running.stop)
+		delete(m.running, name)
+	}
+	m.lock.Unlock()
+
+	m.wg.Wait()
+}
+
+// ServeHTTP serves the metrics of the monitor and its TransportChannel in the Prometheus text format
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := m.metrics.WriteTo(w, m.tc); err != nil {
+		log.Printf("Failed to write metrics: %s\n", err)
+	}
+}
+
+func (m *Monitor) run(target Target, stop chan struct{}) {
+	ticker := time.NewTicker(target.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.round(target, stop); err != nil && !stopped(stop) {
+			log.Printf("Failed to probe target %s: %s\n", target.Name, err)
+			m.metrics.observeError(target.Name)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// round probes each hop of the path of a target once.  A target which was removed in the meantime records nothing,
+// since a new target may have taken its name.
+func (m *Monitor) round(target Target, stop chan struct{}) error {
+	path := target.Path
+	if path == nil {
+		var err error
+		if path, err = m.discoverPath(target.Source, target.Dest, target.Timeout); err != nil {
+			return err
+		}
+	}
+	if stopped(stop) {
+		return nil
+	}
+	if target.Path == nil {
+		m.recordPath(target.Name, path)
+	}
+	m.metrics.setPath(target.Name, path)
+
+	hopToIdx := make(map[string]int)
+	for idx, hop := range path[1:] {
+		hopToIdx[hop.String()] = idx
+	}
+	hops := make([]beacon.HopResult, len(path)-1)
+	rtts := make([][]time.Duration, len(path)-1)
+
+	for res := range m.tc.ProbeEachHopOfPath(path, target.NumPackets, target.Timeout, beacon.WithDSCP(target.DSCP)) {
+		if res.Err != nil && res.IsFatal() {
+			// a fatal result is the only one sent, and the channel is left open
+			return res.Err
+		}
+		idx, ok := hopToIdx[res.Payload.DestIP.String()]
+		if !ok {
+			continue
+		}
+		hops[idx].Sent++
+		if res.Err == nil {
+			hops[idx].Received++
+			rtts[idx] = append(rtts[idx], res.Payload.RxTimestamp.Sub(res.Payload.TxTimestamp))
+		}
+	}
+
+	if stopped(stop) {
+		return nil
+	}
+	for _, alert := range m.metrics.observeRound(target.Name, hops, rtts, target.Thresholds) {
+		log.Warnf("Target %s: %s\n", target.Name, alert)
+	}
+	return nil
+}
+
+// recordPath adds a discovered path to the history of a target, if the monitor keeps one
+func (m *Monitor) recordPath(name string, path beacon.Path) {
+	if m.history == nil {
+		return
+	}
+	change, err := m.history.Record(name, path, time.Now())
+	if err != nil {
+		log.Printf("%s\n", err)
+		return
+	}
+	if change != nil {
+		log.Printf("Target %s: %s\n", name, change)
+	}
+}
+
+func stopped(stop chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// discoverPath traces the path to dest from the monitor, or from source if it isn't nil, leaving out the hops which
+// didn't respond.  The path starts with the address of the monitor, which the probes are sent from.
+func (m *Monitor) discoverPath(source, dest net.IP, timeout int) (beacon.Path, error) {
+	var vantageIP net.IP
+	var discovered beacon.Path
+	var err error
+	if source == nil {
+		if vantageIP, err = m.tc.SourceFor(dest); err != nil {
+			return nil, err
+		}
+		discovered, err = m.tc.GetPathTo(dest, timeout)
+	} else {
+		if vantageIP, err = m.tc.SourceFor(source); err != nil {
+			return nil, err
+		}
+		if discovered, err = m.tc.GetPathFromSourceToDest(source, dest, timeout); err == nil && len(discovered) > 0 && discovered[0].Equal(vantageIP) {
+			discovered = discovered[1:]
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to discover path to %s: %s", dest, err)
+	}
+
+	path := beacon.Path{vantageIP}
+	for _, hop := range discovered {
+		if hop != nil {
+			path = append(path, hop)
+		}
+	}
+	if len(path) < 2 {
+		return nil, fmt.Errorf("Found no hops to probe on the path to %s", dest)
+	}
+	return path, nil
+}
@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/trstruth/beacon"
+)
+
+func TestTargetValidate(t *testing.T) {
+	valid := []Target{
+		{Dest: net.IP{10, 0, 0, 3}, NumPackets: 1, Timeout: 1, Interval: time.Second},
+		{Path: testPath, NumPackets: 1, Timeout: 1, Interval: time.Second},
+	}
+	names := []string{"10.0.0.3", testPath.String()}
+	for idx, target := range valid {
+		if err := target.validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %s", target, err)
+		}
+		if target.Name != names[idx] {
+			t.Errorf("Expected the name to default to %q, got %q", names[idx], target.Name)
+		}
+	}
+
+	invalid := []Target{
+		{NumPackets: 1, Timeout: 1, Interval: time.Second},
+		{Dest: net.IP{10, 0, 0, 3}, Path: testPath, NumPackets: 1, Timeout: 1, Interval: time.Second},
+		{Path: testPath[:1], NumPackets: 1, Timeout: 1, Interval: time.Second},
+		{Dest: net.IP{10, 0, 0, 3}, Timeout: 1, Interval: time.Second},
+		{Dest: net.IP{10, 0, 0, 3}, NumPackets: 1, Timeout: 1},
+	}
+	for _, target := range invalid {
+		if err := target.validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", target)
+		}
+	}
+}
+
+func TestUpdateUnnamedTargets(t *testing.T) {
+	// a TransportChannel without a filter fails every round straight away
+	m := New(&beacon.TransportChannel{})
+	defer m.Stop()
+
+	other := beacon.Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 4}}
+	targets := []Target{
+		{Path: testPath, NumPackets: 1, Timeout: 1, Interval: time.Hour},
+		{Path: other, NumPackets: 1, Timeout: 1, Interval: time.Hour},
+	}
+	if err := m.Update(targets); err != nil {
+		t.Fatalf("Failed to update targets: %s", err)
+	}
+
+	m.lock.Lock()
+	running := m.running[testPath.String()]
+	if len(m.running) != 2 || running == nil || m.running[other.String()] == nil {
+		t.Errorf("Expected the targets to be named after their paths, got %v", m.running)
+	}
+	m.lock.Unlock()
+
+	if err := m.Update(targets[:1]); err != nil {
+		t.Fatalf("Failed to update targets: %s", err)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.running) != 1 || m.running[testPath.String()] != running {
+		t.Errorf("Expected the unchanged target to keep running and the other to be removed, got %v", m.running)
+	}
+}
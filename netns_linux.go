@@ -0,0 +1,62 @@
+package beacon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// netnsDir is where "ip netns add" bind mounts the namespaces it creates
+const netnsDir = "/var/run/netns"
+
+// InNetNS runs fn on a goroutine of its own, locked to a thread in the named network namespace, and waits for it.  The
+// thread is moved back to its own namespace afterwards, or exits with the goroutine if it can't be, so no other
+// goroutine ever runs in the namespace by accident.  Sockets fn opens stay in the namespace.  fn must not start
+// goroutines which expect to be in the namespace, since they run on other threads.  An empty name runs fn in the
+// current namespace.
+func InNetNS(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+
+	target, err := os.Open(filepath.Join(netnsDir, name))
+	if err != nil {
+		return fmt.Errorf("Failed to open network namespace %s: %s", name, err)
+	}
+	defer target.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		result <- runInNetNS(name, target, fn)
+	}()
+	return <-result
+}
+
+// runInNetNS runs fn with the locked thread of the calling goroutine in the target namespace.  The thread is only
+// unlocked once it is back in its own namespace, a goroutine which exits locked takes its thread down with it.
+func runInNetNS(name string, target *os.File, fn func() error) error {
+	origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("Failed to open the current network namespace: %s", err)
+	}
+	defer origin.Close()
+
+	if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("Failed to enter network namespace %s: %s", name, err)
+	}
+
+	fnErr := fn()
+
+	if err := unix.Setns(int(origin.Fd()), unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("Failed to leave network namespace %s: %s", name, err)
+	}
+	runtime.UnlockOSThread()
+
+	return fnErr
+}
@@ -0,0 +1,66 @@
+package beacon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestInNetNS(t *testing.T) {
+	ran := false
+	if err := InNetNS("", func() error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("Expected an empty name to run in the current namespace, got %v", err)
+	}
+	if err := InNetNS("beacon-missing", func() error { return nil }); err == nil {
+		t.Errorf("Expected an error entering a namespace which doesn't exist")
+	}
+
+	name := testNetNS(t)
+	defer exec.Command("ip", "netns", "delete", name).Run()
+
+	// the thread stays locked across InNetNS, so it can be checked to have stayed in its own namespace
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	before, err := os.Readlink("/proc/thread-self/ns/net")
+	if err != nil {
+		t.Fatalf("Failed to read the network namespace of the thread: %s", err)
+	}
+
+	var inside []net.Interface
+	err = InNetNS(name, func() error {
+		var err error
+		inside, err = net.Interfaces()
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to run in network namespace %s: %s", name, err)
+	}
+	if len(inside) != 1 || inside[0].Name != "lo" {
+		t.Errorf("Expected a new namespace to only have lo, got %v", inside)
+	}
+
+	if after, err := os.Readlink("/proc/thread-self/ns/net"); err != nil || after != before {
+		t.Errorf("Expected the thread to stay in %s, got %s (%v)", before, after, err)
+	}
+}
+
+// testNetNS creates a network namespace for a test to delete, running the ip commands given in it, and skips the test
+// if it can't
+func testNetNS(t *testing.T, commands ...string) string {
+	name := fmt.Sprintf("beacon-test-%d", os.Getpid())
+	if out, err := exec.Command("ip", "netns", "add", name).CombinedOutput(); err != nil {
+		t.Skipf("Failed to create a network namespace: %s %s", err, out)
+	}
+	for _, command := range commands {
+		args := append([]string{"-n", name}, strings.Fields(command)...)
+		if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+			exec.Command("ip", "netns", "delete", name).Run()
+			t.Skipf("Failed to run ip %s: %s %s", command, err, out)
+		}
+	}
+	return name
+}
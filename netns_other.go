@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package beacon
+
+import (
+	"fmt"
+)
+
+// InNetNS runs fn, network namespaces are only supported on linux so a non empty name is an error
+func InNetNS(name string, fn func() error) error {
+	if name != "" {
+		return fmt.Errorf("network namespaces are only supported on linux")
+	}
+	return fn()
+}
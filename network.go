@@ -0,0 +1,121 @@
+package beacon
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// NetworkContext is the network namespace and VRF a TransportChannel opens its sockets and capture handles in, and
+// routes are looked up in.  The zero value is the namespace of the process without a VRF.
+type NetworkContext struct {
+	// NetNS is the name of a network namespace created by "ip netns add", empty for the namespace of the process
+	NetNS string
+	// VRF is the VRF device raw sockets are bound to so they are routed with its table, empty for the main table
+	VRF string
+}
+
+// String returns the context as "netns blue vrf red", empty for the zero value
+func (nc NetworkContext) String() string {
+	s := ""
+	if nc.NetNS != "" {
+		s = "netns " + nc.NetNS
+	}
+	if nc.VRF != "" {
+		if s != "" {
+			s += " "
+		}
+		s += "vrf " + nc.VRF
+	}
+	return s
+}
+
+// Run runs fn in the network namespace of the context, see InNetNS
+func (nc NetworkContext) Run(fn func() error) error {
+	return InNetNS(nc.NetNS, fn)
+}
+
+// socket opens a raw socket in the context, bound to its VRF
+func (nc NetworkContext) socket(v6 bool) (int, error) {
+	fd := -1
+	err := nc.Run(func() error {
+		var err error
+		fd, err = rawSocket(v6)
+		return err
+	})
+	if err != nil {
+		return fd, err
+	}
+	if nc.VRF != "" {
+		if err := bindToDevice(fd, nc.VRF); err != nil {
+			syscall.Close(fd)
+			return -1, fmt.Errorf("Failed to bind socket to vrf %s: %s", nc.VRF, err)
+		}
+	}
+	return fd, nil
+}
+
+// GetInterfaceDeviceFromDestIP resolves the outbound interface to a destination in the context, see RouteTo
+func (nc NetworkContext) GetInterfaceDeviceFromDestIP(destIP net.IP) (string, error) {
+	route, err := nc.RouteTo(destIP, "")
+	if err != nil {
+		return "", err
+	}
+	return route.Interface, nil
+}
+
+// FindSourceIPForDest returns the source address the context routes the given dest IP from, see SourceFor
+func (nc NetworkContext) FindSourceIPForDest(dest net.IP) (net.IP, error) {
+	return nc.SourceFor(dest, "")
+}
+
+// interfaceWithAddr returns the name of the interface an address is assigned to
+func interfaceWithAddr(ip net.IP) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("Failed to list interfaces: %s", err)
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no interface has the address %s", ip)
+}
+
+// WithNetNS opens the capture handles and raw sockets of the TransportChannel inside a network namespace created by
+// "ip netns add".  Only supported on linux.
+func WithNetNS(name string) TransportChannelOption {
+	return func(tc *TransportChannel) error {
+		tc.network.NetNS = name
+		return nil
+	}
+}
+
+// WithVRF binds the raw sockets of the TransportChannel to a VRF device, so the probes are routed with the table of
+// the VRF.  Only supported on linux.
+func WithVRF(device string) TransportChannelOption {
+	return func(tc *TransportChannel) error {
+		tc.network.VRF = device
+		return nil
+	}
+}
+
+// WithNetworkContext sets both the network namespace and the VRF of the TransportChannel
+func WithNetworkContext(nc NetworkContext) TransportChannelOption {
+	return func(tc *TransportChannel) error {
+		tc.network = nc
+		return nil
+	}
+}
+
+// Network returns the network namespace and VRF the TransportChannel was created in
+func (tc *TransportChannel) Network() NetworkContext {
+	return tc.network
+}
@@ -0,0 +1,36 @@
+package beacon
+
+import (
+	"testing"
+)
+
+func TestNetworkContextString(t *testing.T) {
+	cases := []struct {
+		nc       NetworkContext
+		expected string
+	}{
+		{NetworkContext{}, ""},
+		{NetworkContext{NetNS: "blue"}, "netns blue"},
+		{NetworkContext{VRF: "red"}, "vrf red"},
+		{NetworkContext{NetNS: "blue", VRF: "red"}, "netns blue vrf red"},
+	}
+	for _, c := range cases {
+		if s := c.nc.String(); s != c.expected {
+			t.Errorf("Expected %+v to be %q, got %q", c.nc, c.expected, s)
+		}
+	}
+}
+
+func TestWithNetworkContext(t *testing.T) {
+	tc := &TransportChannel{}
+	WithNetNS("blue")(tc)
+	WithVRF("red")(tc)
+	if tc.Network() != (NetworkContext{NetNS: "blue", VRF: "red"}) {
+		t.Errorf("Expected netns blue vrf red, got %q", tc.Network())
+	}
+
+	WithNetworkContext(NetworkContext{VRF: "green"})(tc)
+	if tc.Network() != (NetworkContext{VRF: "green"}) {
+		t.Errorf("Expected vrf green, got %q", tc.Network())
+	}
+}
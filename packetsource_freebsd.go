@@ -6,5 +6,10 @@ import (
 )
 
 func CreatePacketSource(handle *pcap.Handle) *gopacket.PacketSource {
-	return gopacket.NewPacketSource(handle, JuniperLayerType)
+	return gopacket.NewPacketSource(handle, firstLayerType(handle))
+}
+
+// firstLayerType returns the layer type packets read from the handle should be decoded from
+func firstLayerType(handle *pcap.Handle) gopacket.LayerType {
+	return JuniperLayerType
 }
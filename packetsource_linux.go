@@ -1,3 +1,6 @@
+//go:build !nopcap
+// +build !nopcap
+
 package beacon
 
 import (
@@ -6,5 +9,10 @@ import (
 )
 
 func CreatePacketSource(handle *pcap.Handle) *gopacket.PacketSource {
-	return gopacket.NewPacketSource(handle, handle.LinkType())
+	return gopacket.NewPacketSource(handle, firstLayerType(handle))
+}
+
+// firstLayerType returns the layer type packets read from the handle should be decoded from
+func firstLayerType(handle *pcap.Handle) gopacket.LayerType {
+	return handle.LinkType().LayerType()
 }
@@ -1,10 +1,12 @@
 package beacon
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/gopacket"
@@ -14,11 +16,11 @@ import (
 // Path is a slice of IPs which represents a path through the network
 type Path []net.IP
 
-// String returns the string representation of a path
+// String returns the string representation of a path, with hops which didn't respond as "*"
 func (p Path) String() string {
 	stringIpArr := make([]string, len(p))
 	for idx, ip := range p {
-		stringIpArr[idx] = ip.String()
+		stringIpArr[idx] = HopString(ip)
 	}
 
 	stringBuilder := strings.Builder{}
@@ -62,6 +64,34 @@ type PathTerminator struct {
 	secondToLastIP net.IP
 }
 
+// TracerouteOption configures a traceroute
+type TracerouteOption func(*tracerouteConfig)
+
+type tracerouteConfig struct {
+	stop <-chan struct{}
+}
+
+// WithTracerouteStop stops a traceroute once stop is closed.  The hop in flight is abandoned and the PathChannel is
+// closed without it.
+func WithTracerouteStop(stop <-chan struct{}) TracerouteOption {
+	return func(cfg *tracerouteConfig) {
+		cfg.stop = stop
+	}
+}
+
+func newTracerouteConfig(options []TracerouteOption) tracerouteConfig {
+	var cfg tracerouteConfig
+	for _, option := range options {
+		option(&cfg)
+	}
+	return cfg
+}
+
+// stopped returns whether the traceroute was stopped
+func (cfg tracerouteConfig) stopped() bool {
+	return isClosed(cfg.stop)
+}
+
 func (tc *TransportChannel) newTraceroutePortPair() portPair {
 	tc.portLock.Lock()
 	defer tc.portLock.Unlock()
@@ -76,10 +106,10 @@ func (tc *TransportChannel) newTraceroutePortPair() portPair {
 }
 
 // GetPathTo returns a Path to a destination IP from the caller
-func (tc *TransportChannel) GetPathTo(destIP net.IP, timeout int) (Path, error) {
+func (tc *TransportChannel) GetPathTo(destIP net.IP, timeout int, options ...TracerouteOption) (Path, error) {
 	path := make([]net.IP, 0)
 
-	pc, err := tc.GetPathChannelTo(destIP, nil, timeout)
+	pc, err := tc.GetPathChannelTo(destIP, nil, timeout, options...)
 	if err != nil {
 		return path, err
 	}
@@ -92,10 +122,10 @@ func (tc *TransportChannel) GetPathTo(destIP net.IP, timeout int) (Path, error)
 }
 
 // GetPathFrom returns a Path from a destination IP back to the caller
-func (tc *TransportChannel) GetPathFrom(destIP net.IP, timeout int) (Path, error) {
+func (tc *TransportChannel) GetPathFrom(destIP net.IP, timeout int, options ...TracerouteOption) (Path, error) {
 	path := make([]net.IP, 0)
 
-	pc, err := tc.GetPathChannelFrom(destIP, timeout)
+	pc, err := tc.GetPathChannelFrom(destIP, timeout, options...)
 	if err != nil {
 		return path, err
 	}
@@ -108,10 +138,10 @@ func (tc *TransportChannel) GetPathFrom(destIP net.IP, timeout int) (Path, error
 }
 
 // GetPathFromSourceToDest returns a Path from a sourceIP to a destIP
-func (tc *TransportChannel) GetPathFromSourceToDest(sourceIP, destIP net.IP, timeout int) (Path, error) {
+func (tc *TransportChannel) GetPathFromSourceToDest(sourceIP, destIP net.IP, timeout int, options ...TracerouteOption) (Path, error) {
 	path := make([]net.IP, 0)
 
-	pc, err := tc.GetPathChannelFromSourceToDest(sourceIP, destIP, timeout)
+	pc, err := tc.GetPathChannelFromSourceToDest(sourceIP, destIP, timeout, options...)
 	if err != nil {
 		return path, err
 	}
@@ -139,6 +169,19 @@ func computeTraceRouteHashFromPacket(packet gopacket.Packet) (string, error) {
 	return string(contents), nil
 }
 
+func computeTraceRouteHashFromDecodedPacket(dp *DecodedPacket) ([]byte, error) {
+	udp, err := dp.QuotedUDP()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(udp.Contents) < 6 {
+		return nil, errShortQuotedUDP
+	}
+	// trim contents to ignore checksum, some routers recompute checksum and this breaks traceroute
+	return udp.Contents[:6], nil
+}
+
 func computeTraceRouteHash(bytes []byte, isV4 bool) (string, error) {
 	var packet gopacket.Packet
 	if isV4 {
@@ -151,9 +194,10 @@ func computeTraceRouteHash(bytes []byte, isV4 bool) (string, error) {
 }
 
 // GetPathChannelTo returns a PathChannel to a destination IP from the caller
-func (tc *TransportChannel) GetPathChannelTo(destIP, sourceIP net.IP, timeout int) (PathChannel, error) {
+func (tc *TransportChannel) GetPathChannelTo(destIP, sourceIP net.IP, timeout int, options ...TracerouteOption) (PathChannel, error) {
+	cfg := newTracerouteConfig(options)
 
-	if tc.filter != "icmp" && tc.filter != "icmp6" {
+	if !tc.filterIncludes("icmp") && !tc.filterIncludes("icmp6") {
 		errMsg := fmt.Sprintf("BPF filter must be icmp or icmp6: got %s instead", tc.filter)
 		return nil, errors.New(errMsg)
 	}
@@ -167,7 +211,7 @@ func (tc *TransportChannel) GetPathChannelTo(destIP, sourceIP net.IP, timeout in
 
 	var finalSourceIP net.IP
 	if sourceIP == nil {
-		foundSourceIP, err := FindSourceIPForDest(destIP)
+		foundSourceIP, err := tc.SourceFor(destIP)
 		if err != nil {
 			return pathChan, err
 		}
@@ -214,7 +258,7 @@ func (tc *TransportChannel) GetPathChannelTo(destIP, sourceIP net.IP, timeout in
 		trcrtString := "traceroute"
 		var sb strings.Builder
 		// using packet length as a unique key for each packet within a single traceroute
-		for ttl = 1; ttl <= 32; ttl++ {
+		for ttl = 1; ttl <= maxHops; ttl++ {
 
 			sb.WriteByte(trcrtString[(ttl-1)%uint8(len(trcrtString))])
 
@@ -243,6 +287,9 @@ func (tc *TransportChannel) GetPathChannelTo(destIP, sourceIP net.IP, timeout in
 			case <-time.After(time.Duration(timeout) * time.Second):
 				pathChan <- nil
 				tc.UnregisterHash(hash)
+			case <-cfg.stop:
+				tc.UnregisterHash(hash)
+				return
 			case term := <-done:
 				tc.UnregisterHash(hash)
 				if term.lastIP.Equal(term.secondToLastIP) {
@@ -282,65 +329,75 @@ func getSrcAndDstIP(packet gopacket.Packet, isV4 bool) (net.IP, net.IP) {
 }
 
 // GetPathChannelFrom returns a PathChannel from a destination IP back to the caller
-func (tc *TransportChannel) GetPathChannelFrom(destIP net.IP, timeout int) (PathChannel, error) {
-	if tc.filter != "icmp" && tc.filter != "icmp6" {
+func (tc *TransportChannel) GetPathChannelFrom(destIP net.IP, timeout int, options ...TracerouteOption) (PathChannel, error) {
+	cfg := newTracerouteConfig(options)
+	if !tc.filterIncludes("icmp") && !tc.filterIncludes("icmp6") {
 		errMsg := fmt.Sprintf("BPF filter must be icmp or icmp6: got %s instead", tc.filter)
 		return nil, errors.New(errMsg)
 	}
 
 	pathChan := make(PathChannel)
-	found := make(chan net.IP)
-	done := make(chan error)
 
-	localIP, err := tc.FindLocalIP()
+	localIP, err := tc.SourceFor(destIP)
+	if err != nil {
+		return pathChan, err
+	}
+
+	// the round trip probe expires on the hops of the reverse path, and the remote probe comes back as an echo request
+	// from the destination once its ttl covers the whole path.  Only the replies about the echo id of this traceroute
+	// are taken, the shared TransportChannel may be running others.
+	echoID := tc.newTracerouteEchoID()
+	sub, err := tc.Subscribe(func(dp *DecodedPacket) bool {
+		if !dp.Has(layers.LayerTypeICMPv4) || !dp.Has(layers.LayerTypeIPv4) {
+			return false
+		}
+		typeCode := int(dp.ICMPv4.TypeCode)
+		if !(typeCode == icmpTTLExceeded && dp.IPv4.DstIP.Equal(localIP)) && !(typeCode == icmpEchoRequest && dp.IPv4.SrcIP.Equal(destIP)) {
+			return false
+		}
+		id, _, ok := tracerouteEcho(&dp.ICMPv4)
+		return ok && id == echoID
+	}, tracerouteSubscriptionBuffer)
 	if err != nil {
 		return pathChan, err
 	}
 
 	go func() {
 		defer close(pathChan)
+		defer sub.Unsubscribe()
 		roundTripBuf := gopacket.NewSerializeBuffer()
 		remoteProbeBuf := gopacket.NewSerializeBuffer()
 
 		var ttl uint8
-		for ttl = 1; ttl <= 32; ttl++ {
-			err = buildEncapTraceroutePacket(localIP, destIP, localIP, localIP, ttl, []byte("Hello"), roundTripBuf)
+		for ttl = 1; ttl <= maxHops; ttl++ {
+			err := buildEncapTraceroutePacket(localIP, destIP, localIP, localIP, ttl, echoID, uint16(ttl), []byte("Hello"), roundTripBuf)
 			if err != nil {
-				done <- err
+				log.Printf("Failed to build round trip traceroute packet: %s\n", err)
+				return
 			}
-			err = buildEncapTraceroutePacket(localIP, destIP, destIP, localIP, ttl+1, []byte("Hello"), remoteProbeBuf)
+			err = buildEncapTraceroutePacket(localIP, destIP, destIP, localIP, ttl+1, echoID, uint16(ttl), []byte("Hello"), remoteProbeBuf)
 			if err != nil {
-				done <- err
+				log.Printf("Failed to build remote traceroute packet: %s\n", err)
+				return
 			}
 			tc.SendTo(roundTripBuf.Bytes(), destIP)
 			tc.SendTo(remoteProbeBuf.Bytes(), destIP)
 
-			select {
-			case ip := <-found:
-				pathChan <- ip
-			case <-time.After(time.Duration(timeout) * time.Millisecond):
-				pathChan <- nil
-			case <-done:
+			match, ok := awaitHop(sub.Packets(), uint16(ttl), time.Duration(timeout)*time.Millisecond, cfg.stop)
+			if cfg.stopped() {
 				return
 			}
-		}
-	}()
+			if !ok {
+				pathChan <- nil
+				continue
+			}
 
-	go func() {
-		for packet := range tc.rx() {
-			// TODO: consider using DecodingLayerParser https://godoc.org/github.com/google/gopacket#hdr-Fast_Decoding_With_DecodingLayerParser
-			icmpLayer := packet.Layer(layers.LayerTypeICMPv4)
-			ipv4Layer := packet.Layer(layers.LayerTypeIPv4)
-			icmp, _ := icmpLayer.(*layers.ICMPv4)
-			ip4, _ := ipv4Layer.(*layers.IPv4)
-
-			if int(icmp.TypeCode) == icmpTTLExceeded && ip4.DstIP.Equal(localIP) {
-				found <- ip4.SrcIP
-			} else if int(icmp.TypeCode) == icmpEchoRequest && ip4.SrcIP.Equal(destIP) {
-				found <- ip4.DstIP
-				done <- nil
+			srcIP, dstIP := getSrcAndDstIP(match.Packet, true)
+			if icmpType, _ := getTypeAndCode(match.Packet, true); icmpType == layers.ICMPv4TypeEchoRequest {
+				pathChan <- dstIP
 				return
 			}
+			pathChan <- srcIP
 		}
 	}()
 
@@ -348,59 +405,67 @@ func (tc *TransportChannel) GetPathChannelFrom(destIP net.IP, timeout int) (Path
 }
 
 // GetPathChannelFromSourceToDest returns a PathChannel from a sourceIP to a destIP
-func (tc *TransportChannel) GetPathChannelFromSourceToDest(sourceIP, destIP net.IP, timeout int) (PathChannel, error) {
-	if tc.filter != "icmp" {
+func (tc *TransportChannel) GetPathChannelFromSourceToDest(sourceIP, destIP net.IP, timeout int, options ...TracerouteOption) (PathChannel, error) {
+	cfg := newTracerouteConfig(options)
+	if !tc.filterIncludes("icmp") {
 		errMsg := fmt.Sprintf("BPF filter must be icmp: got %s instead", tc.filter)
 		return nil, errors.New(errMsg)
 	}
 
 	pathChan := make(PathChannel)
-	found := make(chan net.IP)
-	done := make(chan error)
 
-	localIP, err := tc.FindLocalIP()
+	// the hops and the destination reply to the address the probes are sent to the source from
+	localIP, err := tc.SourceFor(sourceIP)
 	if err != nil {
 		return pathChan, err
 	}
 
 	if sourceIP.Equal(localIP) {
-		return tc.GetPathChannelTo(destIP, nil, timeout)
+		return tc.GetPathChannelTo(destIP, nil, timeout, options...)
 	}
 
-	go func() {
-		for packet := range tc.rx() {
-			icmpLayer := packet.Layer(layers.LayerTypeICMPv4)
-			ipv4Layer := packet.Layer(layers.LayerTypeIPv4)
-			icmp, _ := icmpLayer.(*layers.ICMPv4)
-			ip4, _ := ipv4Layer.(*layers.IPv4)
-
-			if int(icmp.TypeCode) == icmpTTLExceeded && ip4.DstIP.Equal(localIP) {
-				found <- ip4.SrcIP
-			} else if int(icmp.TypeCode) == icmpEchoReply && ip4.SrcIP.Equal(destIP) {
-				found <- ip4.SrcIP
-				done <- nil
-				return
-			}
+	// probes from the source expire on the hops towards the destination, which finally replies to the source.  Only
+	// the replies about the echo id of this traceroute are taken.
+	echoID := tc.newTracerouteEchoID()
+	sub, err := tc.Subscribe(func(dp *DecodedPacket) bool {
+		if !dp.Has(layers.LayerTypeICMPv4) || !dp.Has(layers.LayerTypeIPv4) {
+			return false
 		}
-	}()
+		typeCode := int(dp.ICMPv4.TypeCode)
+		if !(typeCode == icmpTTLExceeded && dp.IPv4.DstIP.Equal(localIP)) && !(typeCode == icmpEchoReply && dp.IPv4.SrcIP.Equal(destIP)) {
+			return false
+		}
+		id, _, ok := tracerouteEcho(&dp.ICMPv4)
+		return ok && id == echoID
+	}, tracerouteSubscriptionBuffer)
+	if err != nil {
+		return pathChan, err
+	}
 
 	go func() {
 		defer close(pathChan)
+		defer sub.Unsubscribe()
 		var ttl uint8
-		for ttl = 1; ttl <= 32; ttl++ {
+		for ttl = 1; ttl <= maxHops; ttl++ {
 			buf := gopacket.NewSerializeBuffer()
 			payload := []byte("Hello")
 
-			buildEncapTraceroutePacket(localIP, sourceIP, localIP, destIP, ttl, payload, buf)
+			buildEncapTraceroutePacket(localIP, sourceIP, localIP, destIP, ttl, echoID, uint16(ttl), payload, buf)
 
 			tc.SendTo(buf.Bytes(), sourceIP)
 
-			select {
-			case ip := <-found:
-				pathChan <- ip
-			case <-time.After(time.Duration(timeout) * time.Millisecond):
+			match, ok := awaitHop(sub.Packets(), uint16(ttl), time.Duration(timeout)*time.Millisecond, cfg.stop)
+			if cfg.stopped() {
+				return
+			}
+			if !ok {
 				pathChan <- nil
-			case <-done:
+				continue
+			}
+
+			srcIP, _ := getSrcAndDstIP(match.Packet, true)
+			pathChan <- srcIP
+			if icmpType, _ := getTypeAndCode(match.Packet, true); icmpType == layers.ICMPv4TypeEchoReply {
 				return
 			}
 		}
@@ -408,3 +473,82 @@ func (tc *TransportChannel) GetPathChannelFromSourceToDest(sourceIP, destIP net.
 
 	return pathChan, nil
 }
+
+// newTracerouteEchoID picks the echo id of the probes of a reverse or third party traceroute
+func (tc *TransportChannel) newTracerouteEchoID() uint16 {
+	return uint16(atomic.AddUint32(&tc.echoIDs, 1))
+}
+
+// tracerouteEcho returns the id and sequence number of the echo probe of a reverse or third party traceroute an ICMP
+// message is about: the probe itself, the reply to it, or the probe quoted by a time exceeded message.  A time
+// exceeded message about anything else, such as a udp traceroute probe or an IP in IP boomerang, isn't about a probe.
+func tracerouteEcho(icmp *layers.ICMPv4) (uint16, uint16, bool) {
+	switch icmp.TypeCode.Type() {
+	case layers.ICMPv4TypeEchoRequest, layers.ICMPv4TypeEchoReply:
+		return icmp.Id, icmp.Seq, true
+	case layers.ICMPv4TypeTimeExceeded:
+		// routers quote the IP header of the expired probe and the first 8 bytes of its echo request
+		quoted := icmp.Payload
+		if len(quoted) < ipHeaderLen || quoted[0]>>4 != 4 {
+			return 0, 0, false
+		}
+		headerLen := int(quoted[0]&0x0f) * 4
+		if layers.IPProtocol(quoted[9]) != layers.IPProtocolICMPv4 || len(quoted) < headerLen+8 ||
+			quoted[headerLen] != layers.ICMPv4TypeEchoRequest {
+			return 0, 0, false
+		}
+		echo := quoted[headerLen:]
+		return binary.BigEndian.Uint16(echo[4:6]), binary.BigEndian.Uint16(echo[6:8]), true
+	}
+	return 0, 0, false
+}
+
+// awaitHop waits up to timeout for a reply about the probes of the hop with the given sequence number, skipping the
+// late replies about earlier hops
+func awaitHop(matches <-chan Match, seq uint16, timeout time.Duration, stop <-chan struct{}) (Match, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		match, ok := awaitMatch(matches, time.Until(deadline), stop)
+		if !ok {
+			return match, false
+		}
+		icmp, isICMP := match.Packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+		if !isICMP {
+			continue
+		}
+		if _, matchSeq, ok := tracerouteEcho(icmp); ok && matchSeq == seq {
+			return match, true
+		}
+	}
+}
+
+// maxHops is the highest TTL a traceroute probes
+const maxHops = 32
+
+// tracerouteSubscriptionBuffer is how many replies a traceroute buffers, late replies to earlier hops can pile up
+const tracerouteSubscriptionBuffer = 32
+
+// awaitMatch waits up to timeout for the next match delivered over matches, or until stop is closed
+func awaitMatch(matches <-chan Match, timeout time.Duration, stop <-chan struct{}) (Match, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case match, ok := <-matches:
+		return match, ok
+	case <-timer.C:
+		return Match{}, false
+	case <-stop:
+		return Match{}, false
+	}
+}
+
+// isClosed returns whether a stop channel was closed, a nil channel never is
+func isClosed(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
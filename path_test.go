@@ -3,6 +3,10 @@ package beacon
 import (
 	"net"
 	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 )
 
 func TestPathEqualTrue(t *testing.T) {
@@ -111,3 +115,158 @@ func TestSubPathNonExistentElement(t *testing.T) {
 		t.Error("When a nonexistent element is passed to Subpath, the result should be an empty path")
 	}
 }
+
+func TestFilterIncludes(t *testing.T) {
+	testCases := []struct {
+		filter    string
+		primitive string
+		expected  bool
+	}{
+		{"icmp", "icmp", true},
+		{"icmp6", "icmp", false},
+		{"icmp or icmp6", "icmp6", true},
+		{"icmp || icmp6 || ip[4:2] = 0x6d", "icmp", true},
+		{"ip[4:2] = 0x6d", "icmp", false},
+	}
+
+	for _, tc := range testCases {
+		channel := &TransportChannel{filter: tc.filter}
+		if actual := channel.filterIncludes(tc.primitive); actual != tc.expected {
+			t.Errorf("filterIncludes(%q) on filter %q: expected %t, got %t", tc.primitive, tc.filter, tc.expected, actual)
+		}
+	}
+}
+
+func TestPathDiff(t *testing.T) {
+	old := Path{
+		net.IP{10, 0, 0, 1},
+		net.IP{10, 0, 0, 2},
+		net.IP{10, 0, 0, 3},
+		net.IP{10, 0, 0, 4},
+		net.IP{10, 0, 0, 5},
+	}
+	newer := Path{
+		net.IP{10, 0, 0, 1},
+		nil,
+		net.IP{10, 0, 1, 3},
+		net.IP{10, 0, 1, 9},
+		net.IP{10, 0, 0, 5},
+		net.IP{10, 0, 0, 6},
+	}
+
+	diff := old.Diff(newer)
+	expected := []HopOp{HopEqual, HopUnknown, HopSubstituted, HopSubstituted, HopEqual, HopInserted}
+	if len(diff) != len(expected) {
+		t.Fatalf("Expected %d aligned hops, got %+v", len(expected), diff)
+	}
+	for idx, op := range expected {
+		if diff[idx].Op != op {
+			t.Errorf("Expected hop %d to be %s, got %s", idx, op, diff[idx].Op)
+		}
+	}
+	if diff.Equal() {
+		t.Errorf("Expected the paths to differ")
+	}
+	if s := diff.String(); s != "~2 10.0.0.3>10.0.1.3 ~3 10.0.0.4>10.0.1.9 +5 10.0.0.6" {
+		t.Errorf("Unexpected diff string %q", s)
+	}
+}
+
+func TestPathDiffInsertRemove(t *testing.T) {
+	old := Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}, net.IP{10, 0, 0, 3}}
+	newer := Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 9}, net.IP{10, 0, 0, 2}}
+
+	changed := old.Diff(newer).Changed()
+	if len(changed) != 2 || changed[0].Op != HopInserted || changed[0].NewIdx != 1 || changed[1].Op != HopRemoved || changed[1].OldIdx != 2 {
+		t.Errorf("Expected 10.0.0.9 to be inserted at 1 and 10.0.0.3 removed from 2, got %+v", changed)
+	}
+}
+
+func TestPathDiffToleratesTimeouts(t *testing.T) {
+	complete := Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}, net.IP{10, 0, 0, 3}}
+	timedOut := Path{net.IP{10, 0, 0, 1}, nil, net.IP{10, 0, 0, 3}}
+
+	if !complete.Diff(timedOut).Equal() || !timedOut.Diff(complete).Equal() {
+		t.Errorf("Expected %s and %s to align without changes", complete, timedOut)
+	}
+	if diff := complete.Diff(complete); len(diff) != 3 || !diff.Equal() {
+		t.Errorf("Expected a path to align with itself, got %+v", diff)
+	}
+	if diff := (Path{}).Diff(complete); len(diff) != 3 || diff[0].Op != HopInserted {
+		t.Errorf("Expected every hop to be inserted into an empty path, got %+v", diff)
+	}
+}
+
+func TestPathCommonPrefixSuffix(t *testing.T) {
+	p1 := Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}, net.IP{10, 0, 0, 3}, net.IP{10, 0, 0, 4}}
+	p2 := Path{net.IP{10, 0, 0, 1}, nil, net.IP{10, 0, 1, 3}, net.IP{10, 0, 0, 4}}
+
+	if n := p1.CommonPrefix(p2); n != 2 {
+		t.Errorf("Expected a common prefix of 2 hops, got %d", n)
+	}
+	if n := p1.CommonSuffix(p2); n != 1 {
+		t.Errorf("Expected a common suffix of 1 hop, got %d", n)
+	}
+	if n := p1.CommonSuffix(p1.Reverse().Reverse()); n != len(p1) {
+		t.Errorf("Expected reversing a path twice to return it, got a common suffix of %d", n)
+	}
+	if reversed := p1.Reverse(); !reversed[0].Equal(p1[3]) || !reversed[3].Equal(p1[0]) {
+		t.Errorf("Expected %s to be the reverse of %s", reversed, p1)
+	}
+}
+
+func TestPathStringTimedOutHop(t *testing.T) {
+	p := Path{net.IP{10, 0, 0, 1}, nil, net.IP{10, 0, 0, 3}}
+
+	if s := p.String(); s != "[10.0.0.1, *, 10.0.0.3]" {
+		t.Errorf("Expected a hop which didn't respond to be written as *, got %s", s)
+	}
+}
+
+func TestTracerouteEcho(t *testing.T) {
+	source := net.IP{10, 20, 30, 96}
+	dest := net.IP{104, 44, 19, 212}
+	router := net.IP{104, 44, 22, 235}
+
+	udpProbe := gopacket.NewSerializeBuffer()
+	if err := buildUDPTraceroutePacket(source, dest, layers.UDPPort(33440), layers.UDPPort(33450), 3, []byte("tra"), udpProbe); err != nil {
+		t.Fatalf("Failed to build traceroute packet: %s", err)
+	}
+	echoProbe := gopacket.NewSerializeBuffer()
+	if err := buildEncapTraceroutePacket(source, dest, dest, source, 3, 4242, 3, []byte("Hello"), echoProbe); err != nil {
+		t.Fatalf("Failed to build encapsulated traceroute packet: %s", err)
+	}
+
+	dp := NewDecodedPacket(layers.LayerTypeEthernet)
+	// the probe expires after it was decapsulated, so the router quotes the inner echo request
+	dp.Decode(createTestTTLExceededPacket(t, router, source, echoProbe.Bytes()[ipHeaderLen:]), gopacket.CaptureInfo{})
+	if id, seq, ok := tracerouteEcho(&dp.ICMPv4); !ok || id != 4242 || seq != 3 {
+		t.Errorf("Expected the reply to the echo probe to be about id 4242 seq 3, got %d %d (%t)", id, seq, ok)
+	}
+
+	dp.Decode(createTestTTLExceededPacket(t, router, source, udpProbe.Bytes()), gopacket.CaptureInfo{})
+	if _, _, ok := tracerouteEcho(&dp.ICMPv4); ok {
+		t.Errorf("Expected the reply to a udp traceroute probe not to be taken for an echo probe")
+	}
+	// a boomerang which expires before it is decapsulated is quoted along with its IP in IP header
+	dp.Decode(createTestTTLExceededPacket(t, router, source, echoProbe.Bytes()), gopacket.CaptureInfo{})
+	if _, _, ok := tracerouteEcho(&dp.ICMPv4); ok {
+		t.Errorf("Expected the reply to an IP in IP packet not to be taken for an echo probe")
+	}
+}
+
+func TestAwaitMatchStop(t *testing.T) {
+	stop := make(chan struct{})
+	close(stop)
+
+	start := time.Now()
+	if _, ok := awaitMatch(make(chan Match), time.Hour, stop); ok {
+		t.Errorf("Expected no match once stopped")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected a stopped wait to return straight away, took %s", elapsed)
+	}
+	if _, ok := awaitMatch(make(chan Match), time.Millisecond, nil); ok {
+		t.Errorf("Expected no match after the timeout")
+	}
+}
@@ -0,0 +1,208 @@
+package beacon
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// HopOp is how a hop of one path aligns with a hop of another
+type HopOp int
+
+const (
+	// HopEqual is a hop which is on both paths
+	HopEqual HopOp = iota
+	// HopUnknown aligns a hop with a hop which didn't respond on the other path, which may or may not be the same
+	HopUnknown
+	// HopSubstituted replaces a hop of the old path with a different one
+	HopSubstituted
+	// HopInserted is only on the new path
+	HopInserted
+	// HopRemoved is only on the old path
+	HopRemoved
+)
+
+func (op HopOp) String() string {
+	switch op {
+	case HopEqual:
+		return "equal"
+	case HopUnknown:
+		return "unknown"
+	case HopSubstituted:
+		return "substituted"
+	case HopInserted:
+		return "inserted"
+	case HopRemoved:
+		return "removed"
+	}
+	return fmt.Sprintf("HopOp(%d)", int(op))
+}
+
+// HopDiff is one step of the alignment of two paths.  OldIdx and NewIdx index the hop in each path, and are -1 for
+// the path the hop is missing from.
+type HopDiff struct {
+	Op     HopOp
+	OldIdx int
+	NewIdx int
+	Old    net.IP
+	New    net.IP
+}
+
+// PathDiff aligns two paths hop by hop, in path order
+type PathDiff []HopDiff
+
+// Changed returns the hops which were inserted, removed or substituted
+func (d PathDiff) Changed() PathDiff {
+	var changed PathDiff
+	for _, hop := range d {
+		if hop.Op != HopEqual && hop.Op != HopUnknown {
+			changed = append(changed, hop)
+		}
+	}
+	return changed
+}
+
+// Equal returns whether the paths align without any changes, treating hops which didn't respond as wildcards
+func (d PathDiff) Equal() bool {
+	return len(d.Changed()) == 0
+}
+
+// String returns a compact representation of the changes, such as "~1 10.0.0.2>10.0.1.2 +2 10.0.1.3 -3 10.0.0.4",
+// with the index of the new path for inserted and substituted hops and of the old path for removed hops
+func (d PathDiff) String() string {
+	var changes []string
+	for _, hop := range d.Changed() {
+		switch hop.Op {
+		case HopSubstituted:
+			changes = append(changes, fmt.Sprintf("~%d %s>%s", hop.NewIdx, HopString(hop.Old), HopString(hop.New)))
+		case HopInserted:
+			changes = append(changes, fmt.Sprintf("+%d %s", hop.NewIdx, HopString(hop.New)))
+		case HopRemoved:
+			changes = append(changes, fmt.Sprintf("-%d %s", hop.OldIdx, HopString(hop.Old)))
+		}
+	}
+	return strings.Join(changes, " ")
+}
+
+// HopString returns the string form of a hop, which is "*" for a hop that didn't respond
+func HopString(hop net.IP) string {
+	if hop == nil {
+		return "*"
+	}
+	return hop.String()
+}
+
+// hopsMatch returns whether two hops may be the same, which a hop that didn't respond may be
+func hopsMatch(a, b net.IP) bool {
+	return a == nil || b == nil || a.Equal(b)
+}
+
+// alignment costs, a substitution costs less than an insertion and a removal, but two substitutions cost more so a
+// shifted path aligns as the hop which shifted it
+const (
+	indelCost        = 2
+	substitutionCost = 3
+)
+
+// Diff aligns the path with a newer one at the lowest cost of insertions, removals and substitutions.  A hop which
+// didn't respond matches any hop, so a path with timeouts aligns with the same path without them.
+func (p Path) Diff(newer Path) PathDiff {
+	return p.align(newer, net.IP.Equal)
+}
+
+// align aligns the path with a newer one, substituting hops which same reports to be the same for free.  Hops which
+// didn't respond are never passed to same.
+func (p Path) align(newer Path, same func(a, b net.IP) bool) PathDiff {
+	matches := func(a, b net.IP) bool {
+		return a == nil || b == nil || same(a, b)
+	}
+
+	// cost[i][j] is the cost of aligning p[i:] with newer[j:]
+	cost := make([][]int, len(p)+1)
+	for i := range cost {
+		cost[i] = make([]int, len(newer)+1)
+	}
+	for i := len(p); i >= 0; i-- {
+		for j := len(newer); j >= 0; j-- {
+			switch {
+			case i == len(p):
+				cost[i][j] = (len(newer) - j) * indelCost
+			case j == len(newer):
+				cost[i][j] = (len(p) - i) * indelCost
+			default:
+				best := cost[i+1][j+1]
+				if !matches(p[i], newer[j]) {
+					best += substitutionCost
+				}
+				if c := cost[i+1][j] + indelCost; c < best {
+					best = c
+				}
+				if c := cost[i][j+1] + indelCost; c < best {
+					best = c
+				}
+				cost[i][j] = best
+			}
+		}
+	}
+
+	// walk the cheapest alignment from the start, preferring to align hops over inserting or removing them
+	var diff PathDiff
+	i, j := 0, 0
+	for i < len(p) || j < len(newer) {
+		if i < len(p) && j < len(newer) {
+			alignCost := cost[i+1][j+1]
+			if !matches(p[i], newer[j]) {
+				alignCost += substitutionCost
+			}
+			if alignCost == cost[i][j] {
+				op := HopSubstituted
+				if p[i] == nil || newer[j] == nil {
+					op = HopUnknown
+				} else if p[i].Equal(newer[j]) {
+					op = HopEqual
+				}
+				diff = append(diff, HopDiff{Op: op, OldIdx: i, NewIdx: j, Old: p[i], New: newer[j]})
+				i++
+				j++
+				continue
+			}
+		}
+		if i < len(p) && (j == len(newer) || cost[i+1][j]+indelCost == cost[i][j]) {
+			diff = append(diff, HopDiff{Op: HopRemoved, OldIdx: i, NewIdx: -1, Old: p[i]})
+			i++
+			continue
+		}
+		diff = append(diff, HopDiff{Op: HopInserted, OldIdx: -1, NewIdx: j, New: newer[j]})
+		j++
+	}
+	return diff
+}
+
+// CommonPrefix returns the number of leading hops which the paths share, treating hops which didn't respond as
+// wildcards
+func (p Path) CommonPrefix(other Path) int {
+	n := 0
+	for n < len(p) && n < len(other) && hopsMatch(p[n], other[n]) {
+		n++
+	}
+	return n
+}
+
+// CommonSuffix returns the number of trailing hops which the paths share, treating hops which didn't respond as
+// wildcards
+func (p Path) CommonSuffix(other Path) int {
+	n := 0
+	for n < len(p) && n < len(other) && hopsMatch(p[len(p)-1-n], other[len(other)-1-n]) {
+		n++
+	}
+	return n
+}
+
+// Reverse returns the path in the opposite direction, which lines a reverse traceroute up with a forward one
+func (p Path) Reverse() Path {
+	reversed := make(Path, len(p))
+	for idx, hop := range p {
+		reversed[len(p)-1-idx] = hop
+	}
+	return reversed
+}
@@ -0,0 +1,62 @@
+package beacon
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// RawIPLayer is a zero length layer for packets which start at the IP header without a link layer, as they are read
+// from an AF_PACKET datagram socket.  It dispatches to IPv4 or IPv6 based on the version nibble of the IP header.
+type RawIPLayer struct {
+	layers.BaseLayer
+	Version uint8
+}
+
+const RawIPLayerName = "RawIP"
+
+var RawIPLayerType = gopacket.RegisterLayerType(
+	26362,
+	gopacket.LayerTypeMetadata{
+		Name:    RawIPLayerName,
+		Decoder: gopacket.DecodeFunc(decodeRawIPLayer),
+	},
+)
+
+func (r *RawIPLayer) LayerType() gopacket.LayerType {
+	return RawIPLayerType
+}
+
+func (r *RawIPLayer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 1 {
+		df.SetTruncated()
+		return fmt.Errorf("Invalid raw IP packet. Length %d < 1", len(data))
+	}
+	r.Version = data[0] >> 4
+	r.BaseLayer = layers.BaseLayer{Contents: data[:0], Payload: data}
+	return nil
+}
+
+func (r *RawIPLayer) NextLayerType() gopacket.LayerType {
+	switch r.Version {
+	case 4:
+		return layers.LayerTypeIPv4
+	case 6:
+		return layers.LayerTypeIPv6
+	}
+	return gopacket.LayerTypeZero
+}
+
+func (r *RawIPLayer) CanDecode() gopacket.LayerClass {
+	return RawIPLayerType
+}
+
+func decodeRawIPLayer(data []byte, p gopacket.PacketBuilder) error {
+	rawIP := &RawIPLayer{}
+	if err := rawIP.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(rawIP)
+	return p.NextDecoder(rawIP.NextLayerType())
+}
@@ -0,0 +1,838 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.19.4
+// source: beacon.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ProbeMode int32
+
+const (
+	ProbeMode_ROUND_TRIP     ProbeMode = 0
+	ProbeMode_FORWARD_PINNED ProbeMode = 1
+	ProbeMode_REVERSE_PINNED ProbeMode = 2
+	ProbeMode_NATIVE         ProbeMode = 3
+)
+
+// Enum value maps for ProbeMode.
+var (
+	ProbeMode_name = map[int32]string{
+		0: "ROUND_TRIP",
+		1: "FORWARD_PINNED",
+		2: "REVERSE_PINNED",
+		3: "NATIVE",
+	}
+	ProbeMode_value = map[string]int32{
+		"ROUND_TRIP":     0,
+		"FORWARD_PINNED": 1,
+		"REVERSE_PINNED": 2,
+		"NATIVE":         3,
+	}
+)
+
+func (x ProbeMode) Enum() *ProbeMode {
+	p := new(ProbeMode)
+	*p = x
+	return p
+}
+
+func (x ProbeMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProbeMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_beacon_proto_enumTypes[0].Descriptor()
+}
+
+func (ProbeMode) Type() protoreflect.EnumType {
+	return &file_beacon_proto_enumTypes[0]
+}
+
+func (x ProbeMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProbeMode.Descriptor instead.
+func (ProbeMode) EnumDescriptor() ([]byte, []int) {
+	return file_beacon_proto_rawDescGZIP(), []int{0}
+}
+
+type TimestampSource int32
+
+const (
+	TimestampSource_TIMESTAMP_USERSPACE TimestampSource = 0
+	TimestampSource_TIMESTAMP_KERNEL    TimestampSource = 1
+	TimestampSource_TIMESTAMP_HARDWARE  TimestampSource = 2
+)
+
+// Enum value maps for TimestampSource.
+var (
+	TimestampSource_name = map[int32]string{
+		0: "TIMESTAMP_USERSPACE",
+		1: "TIMESTAMP_KERNEL",
+		2: "TIMESTAMP_HARDWARE",
+	}
+	TimestampSource_value = map[string]int32{
+		"TIMESTAMP_USERSPACE": 0,
+		"TIMESTAMP_KERNEL":    1,
+		"TIMESTAMP_HARDWARE":  2,
+	}
+)
+
+func (x TimestampSource) Enum() *TimestampSource {
+	p := new(TimestampSource)
+	*p = x
+	return p
+}
+
+func (x TimestampSource) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TimestampSource) Descriptor() protoreflect.EnumDescriptor {
+	return file_beacon_proto_enumTypes[1].Descriptor()
+}
+
+func (TimestampSource) Type() protoreflect.EnumType {
+	return &file_beacon_proto_enumTypes[1]
+}
+
+func (x TimestampSource) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TimestampSource.Descriptor instead.
+func (TimestampSource) EnumDescriptor() ([]byte, []int) {
+	return file_beacon_proto_rawDescGZIP(), []int{1}
+}
+
+type ProbeError int32
+
+const (
+	ProbeError_NONE       ProbeError = 0
+	ProbeError_TIMED_OUT  ProbeError = 1
+	ProbeError_SEND_ERROR ProbeError = 2
+)
+
+// Enum value maps for ProbeError.
+var (
+	ProbeError_name = map[int32]string{
+		0: "NONE",
+		1: "TIMED_OUT",
+		2: "SEND_ERROR",
+	}
+	ProbeError_value = map[string]int32{
+		"NONE":       0,
+		"TIMED_OUT":  1,
+		"SEND_ERROR": 2,
+	}
+)
+
+func (x ProbeError) Enum() *ProbeError {
+	p := new(ProbeError)
+	*p = x
+	return p
+}
+
+func (x ProbeError) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProbeError) Descriptor() protoreflect.EnumDescriptor {
+	return file_beacon_proto_enumTypes[2].Descriptor()
+}
+
+func (ProbeError) Type() protoreflect.EnumType {
+	return &file_beacon_proto_enumTypes[2]
+}
+
+func (x ProbeError) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProbeError.Descriptor instead.
+func (ProbeError) EnumDescriptor() ([]byte, []int) {
+	return file_beacon_proto_rawDescGZIP(), []int{2}
+}
+
+type TracerouteRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Dest string `protobuf:"bytes,1,opt,name=dest,proto3" json:"dest,omitempty"`
+	// source defaults to the address the agent routes to dest from
+	Source string `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"`
+	// timeout is in seconds, 0 uses the default of the agent
+	Timeout int32 `protobuf:"varint,3,opt,name=timeout,proto3" json:"timeout,omitempty"`
+}
+
+func (x *TracerouteRequest) Reset() {
+	*x = TracerouteRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beacon_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TracerouteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TracerouteRequest) ProtoMessage() {}
+
+func (x *TracerouteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_beacon_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TracerouteRequest.ProtoReflect.Descriptor instead.
+func (*TracerouteRequest) Descriptor() ([]byte, []int) {
+	return file_beacon_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *TracerouteRequest) GetDest() string {
+	if x != nil {
+		return x.Dest
+	}
+	return ""
+}
+
+func (x *TracerouteRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *TracerouteRequest) GetTimeout() int32 {
+	if x != nil {
+		return x.Timeout
+	}
+	return 0
+}
+
+type ReverseTracerouteRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Dest string `protobuf:"bytes,1,opt,name=dest,proto3" json:"dest,omitempty"`
+	// timeout is in seconds per hop, 0 uses the default of the agent
+	Timeout int32 `protobuf:"varint,2,opt,name=timeout,proto3" json:"timeout,omitempty"`
+}
+
+func (x *ReverseTracerouteRequest) Reset() {
+	*x = ReverseTracerouteRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beacon_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReverseTracerouteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReverseTracerouteRequest) ProtoMessage() {}
+
+func (x *ReverseTracerouteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_beacon_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReverseTracerouteRequest.ProtoReflect.Descriptor instead.
+func (*ReverseTracerouteRequest) Descriptor() ([]byte, []int) {
+	return file_beacon_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ReverseTracerouteRequest) GetDest() string {
+	if x != nil {
+		return x.Dest
+	}
+	return ""
+}
+
+func (x *ReverseTracerouteRequest) GetTimeout() int32 {
+	if x != nil {
+		return x.Timeout
+	}
+	return 0
+}
+
+// Hop is one hop of a traceroute
+type Hop struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// ttl counts the hops from 1
+	Ttl int32 `protobuf:"varint,1,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// ip is empty if the hop did not respond
+	Ip string `protobuf:"bytes,2,opt,name=ip,proto3" json:"ip,omitempty"`
+}
+
+func (x *Hop) Reset() {
+	*x = Hop{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beacon_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Hop) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hop) ProtoMessage() {}
+
+func (x *Hop) ProtoReflect() protoreflect.Message {
+	mi := &file_beacon_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hop.ProtoReflect.Descriptor instead.
+func (*Hop) Descriptor() ([]byte, []int) {
+	return file_beacon_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Hop) GetTtl() int32 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *Hop) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+type DiscoverAndProbeRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Source string `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	Dest   string `protobuf:"bytes,2,opt,name=dest,proto3" json:"dest,omitempty"`
+	// num_packets is sent to each hop, 0 uses the default of the agent
+	NumPackets int32 `protobuf:"varint,3,opt,name=num_packets,json=numPackets,proto3" json:"num_packets,omitempty"`
+	// timeout is in seconds, 0 uses the default of the agent
+	Timeout int32 `protobuf:"varint,4,opt,name=timeout,proto3" json:"timeout,omitempty"`
+}
+
+func (x *DiscoverAndProbeRequest) Reset() {
+	*x = DiscoverAndProbeRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beacon_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DiscoverAndProbeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiscoverAndProbeRequest) ProtoMessage() {}
+
+func (x *DiscoverAndProbeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_beacon_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiscoverAndProbeRequest.ProtoReflect.Descriptor instead.
+func (*DiscoverAndProbeRequest) Descriptor() ([]byte, []int) {
+	return file_beacon_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DiscoverAndProbeRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *DiscoverAndProbeRequest) GetDest() string {
+	if x != nil {
+		return x.Dest
+	}
+	return ""
+}
+
+func (x *DiscoverAndProbeRequest) GetNumPackets() int32 {
+	if x != nil {
+		return x.NumPackets
+	}
+	return 0
+}
+
+func (x *DiscoverAndProbeRequest) GetTimeout() int32 {
+	if x != nil {
+		return x.Timeout
+	}
+	return 0
+}
+
+type ProbeEachHopOfPathRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// path lists the hops to probe, starting with the agent
+	Path []string `protobuf:"bytes,1,rep,name=path,proto3" json:"path,omitempty"`
+	// num_packets is sent to each hop, 0 uses the default of the agent
+	NumPackets int32 `protobuf:"varint,2,opt,name=num_packets,json=numPackets,proto3" json:"num_packets,omitempty"`
+	// timeout is in seconds, 0 uses the default of the agent
+	Timeout int32 `protobuf:"varint,3,opt,name=timeout,proto3" json:"timeout,omitempty"`
+}
+
+func (x *ProbeEachHopOfPathRequest) Reset() {
+	*x = ProbeEachHopOfPathRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beacon_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProbeEachHopOfPathRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProbeEachHopOfPathRequest) ProtoMessage() {}
+
+func (x *ProbeEachHopOfPathRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_beacon_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProbeEachHopOfPathRequest.ProtoReflect.Descriptor instead.
+func (*ProbeEachHopOfPathRequest) Descriptor() ([]byte, []int) {
+	return file_beacon_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ProbeEachHopOfPathRequest) GetPath() []string {
+	if x != nil {
+		return x.Path
+	}
+	return nil
+}
+
+func (x *ProbeEachHopOfPathRequest) GetNumPackets() int32 {
+	if x != nil {
+		return x.NumPackets
+	}
+	return 0
+}
+
+func (x *ProbeEachHopOfPathRequest) GetTimeout() int32 {
+	if x != nil {
+		return x.Timeout
+	}
+	return 0
+}
+
+// ProbeResult is the outcome of one probe.  A fatal error ends the stream with an error status instead.
+type ProbeResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	DestIp      string                 `protobuf:"bytes,1,opt,name=dest_ip,json=destIp,proto3" json:"dest_ip,omitempty"`
+	Mode        ProbeMode              `protobuf:"varint,2,opt,name=mode,proto3,enum=beacon.rpc.ProbeMode" json:"mode,omitempty"`
+	Id          string                 `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	TxTimestamp *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=tx_timestamp,json=txTimestamp,proto3" json:"tx_timestamp,omitempty"`
+	RxTimestamp *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=rx_timestamp,json=rxTimestamp,proto3" json:"rx_timestamp,omitempty"`
+	Clock       TimestampSource        `protobuf:"varint,6,opt,name=clock,proto3,enum=beacon.rpc.TimestampSource" json:"clock,omitempty"`
+	ErrorType   ProbeError             `protobuf:"varint,7,opt,name=error_type,json=errorType,proto3,enum=beacon.rpc.ProbeError" json:"error_type,omitempty"`
+	// error describes why the probe failed, empty if it succeeded
+	Error string `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *ProbeResult) Reset() {
+	*x = ProbeResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beacon_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProbeResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProbeResult) ProtoMessage() {}
+
+func (x *ProbeResult) ProtoReflect() protoreflect.Message {
+	mi := &file_beacon_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProbeResult.ProtoReflect.Descriptor instead.
+func (*ProbeResult) Descriptor() ([]byte, []int) {
+	return file_beacon_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ProbeResult) GetDestIp() string {
+	if x != nil {
+		return x.DestIp
+	}
+	return ""
+}
+
+func (x *ProbeResult) GetMode() ProbeMode {
+	if x != nil {
+		return x.Mode
+	}
+	return ProbeMode_ROUND_TRIP
+}
+
+func (x *ProbeResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ProbeResult) GetTxTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.TxTimestamp
+	}
+	return nil
+}
+
+func (x *ProbeResult) GetRxTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.RxTimestamp
+	}
+	return nil
+}
+
+func (x *ProbeResult) GetClock() TimestampSource {
+	if x != nil {
+		return x.Clock
+	}
+	return TimestampSource_TIMESTAMP_USERSPACE
+}
+
+func (x *ProbeResult) GetErrorType() ProbeError {
+	if x != nil {
+		return x.ErrorType
+	}
+	return ProbeError_NONE
+}
+
+func (x *ProbeResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_beacon_proto protoreflect.FileDescriptor
+
+var file_beacon_proto_rawDesc = []byte{
+	0x0a, 0x0c, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0a,
+	0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x72, 0x70, 0x63, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x59, 0x0a, 0x11, 0x54,
+	0x72, 0x61, 0x63, 0x65, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x12, 0x0a, 0x04, 0x64, 0x65, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x64, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x18, 0x0a, 0x07,
+	0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x74,
+	0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x22, 0x48, 0x0a, 0x18, 0x52, 0x65, 0x76, 0x65, 0x72, 0x73,
+	0x65, 0x54, 0x72, 0x61, 0x63, 0x65, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x65, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x64, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75,
+	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74,
+	0x22, 0x27, 0x0a, 0x03, 0x48, 0x6f, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x74, 0x6c, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x03, 0x74, 0x74, 0x6c, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x70, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x70, 0x22, 0x80, 0x01, 0x0a, 0x17, 0x44, 0x69,
+	0x73, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x41, 0x6e, 0x64, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x12, 0x0a,
+	0x04, 0x64, 0x65, 0x73, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x64, 0x65, 0x73,
+	0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x6e, 0x75, 0x6d, 0x5f, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x6e, 0x75, 0x6d, 0x50, 0x61, 0x63, 0x6b, 0x65,
+	0x74, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x07, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x22, 0x6a, 0x0a, 0x19,
+	0x50, 0x72, 0x6f, 0x62, 0x65, 0x45, 0x61, 0x63, 0x68, 0x48, 0x6f, 0x70, 0x4f, 0x66, 0x50, 0x61,
+	0x74, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74,
+	0x68, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x1f, 0x0a,
+	0x0b, 0x6e, 0x75, 0x6d, 0x5f, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0a, 0x6e, 0x75, 0x6d, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x18,
+	0x0a, 0x07, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x07, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x22, 0xdf, 0x02, 0x0a, 0x0b, 0x50, 0x72, 0x6f,
+	0x62, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x64, 0x65, 0x73, 0x74,
+	0x5f, 0x69, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x64, 0x65, 0x73, 0x74, 0x49,
+	0x70, 0x12, 0x29, 0x0a, 0x04, 0x6d, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x15, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x50, 0x72, 0x6f,
+	0x62, 0x65, 0x4d, 0x6f, 0x64, 0x65, 0x52, 0x04, 0x6d, 0x6f, 0x64, 0x65, 0x12, 0x0e, 0x0a, 0x02,
+	0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x3d, 0x0a, 0x0c,
+	0x74, 0x78, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0b,
+	0x74, 0x78, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x3d, 0x0a, 0x0c, 0x72,
+	0x78, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0b, 0x72,
+	0x78, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x31, 0x0a, 0x05, 0x63, 0x6c,
+	0x6f, 0x63, 0x6b, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1b, 0x2e, 0x62, 0x65, 0x61, 0x63,
+	0x6f, 0x6e, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
+	0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x05, 0x63, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x35, 0x0a,
+	0x0a, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x16, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x50,
+	0x72, 0x6f, 0x62, 0x65, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x52, 0x09, 0x65, 0x72, 0x72, 0x6f, 0x72,
+	0x54, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x08, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x2a, 0x4f, 0x0a, 0x09, 0x50, 0x72,
+	0x6f, 0x62, 0x65, 0x4d, 0x6f, 0x64, 0x65, 0x12, 0x0e, 0x0a, 0x0a, 0x52, 0x4f, 0x55, 0x4e, 0x44,
+	0x5f, 0x54, 0x52, 0x49, 0x50, 0x10, 0x00, 0x12, 0x12, 0x0a, 0x0e, 0x46, 0x4f, 0x52, 0x57, 0x41,
+	0x52, 0x44, 0x5f, 0x50, 0x49, 0x4e, 0x4e, 0x45, 0x44, 0x10, 0x01, 0x12, 0x12, 0x0a, 0x0e, 0x52,
+	0x45, 0x56, 0x45, 0x52, 0x53, 0x45, 0x5f, 0x50, 0x49, 0x4e, 0x4e, 0x45, 0x44, 0x10, 0x02, 0x12,
+	0x0a, 0x0a, 0x06, 0x4e, 0x41, 0x54, 0x49, 0x56, 0x45, 0x10, 0x03, 0x2a, 0x58, 0x0a, 0x0f, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x17,
+	0x0a, 0x13, 0x54, 0x49, 0x4d, 0x45, 0x53, 0x54, 0x41, 0x4d, 0x50, 0x5f, 0x55, 0x53, 0x45, 0x52,
+	0x53, 0x50, 0x41, 0x43, 0x45, 0x10, 0x00, 0x12, 0x14, 0x0a, 0x10, 0x54, 0x49, 0x4d, 0x45, 0x53,
+	0x54, 0x41, 0x4d, 0x50, 0x5f, 0x4b, 0x45, 0x52, 0x4e, 0x45, 0x4c, 0x10, 0x01, 0x12, 0x16, 0x0a,
+	0x12, 0x54, 0x49, 0x4d, 0x45, 0x53, 0x54, 0x41, 0x4d, 0x50, 0x5f, 0x48, 0x41, 0x52, 0x44, 0x57,
+	0x41, 0x52, 0x45, 0x10, 0x02, 0x2a, 0x35, 0x0a, 0x0a, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x45, 0x72,
+	0x72, 0x6f, 0x72, 0x12, 0x08, 0x0a, 0x04, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x0d, 0x0a,
+	0x09, 0x54, 0x49, 0x4d, 0x45, 0x44, 0x5f, 0x4f, 0x55, 0x54, 0x10, 0x01, 0x12, 0x0e, 0x0a, 0x0a,
+	0x53, 0x45, 0x4e, 0x44, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x10, 0x02, 0x32, 0xc2, 0x02, 0x0a,
+	0x06, 0x42, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x12, 0x3e, 0x0a, 0x0a, 0x54, 0x72, 0x61, 0x63, 0x65,
+	0x72, 0x6f, 0x75, 0x74, 0x65, 0x12, 0x1d, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x72,
+	0x70, 0x63, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x65, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x48, 0x6f, 0x70, 0x30, 0x01, 0x12, 0x4c, 0x0a, 0x11, 0x52, 0x65, 0x76, 0x65, 0x72,
+	0x73, 0x65, 0x54, 0x72, 0x61, 0x63, 0x65, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x12, 0x24, 0x2e, 0x62,
+	0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x76, 0x65, 0x72, 0x73,
+	0x65, 0x54, 0x72, 0x61, 0x63, 0x65, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x72, 0x70, 0x63, 0x2e,
+	0x48, 0x6f, 0x70, 0x30, 0x01, 0x12, 0x52, 0x0a, 0x10, 0x44, 0x69, 0x73, 0x63, 0x6f, 0x76, 0x65,
+	0x72, 0x41, 0x6e, 0x64, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x12, 0x23, 0x2e, 0x62, 0x65, 0x61, 0x63,
+	0x6f, 0x6e, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x69, 0x73, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x41,
+	0x6e, 0x64, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x17,
+	0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x50, 0x72, 0x6f, 0x62,
+	0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x30, 0x01, 0x12, 0x56, 0x0a, 0x12, 0x50, 0x72, 0x6f,
+	0x62, 0x65, 0x45, 0x61, 0x63, 0x68, 0x48, 0x6f, 0x70, 0x4f, 0x66, 0x50, 0x61, 0x74, 0x68, 0x12,
+	0x25, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x50, 0x72, 0x6f,
+	0x62, 0x65, 0x45, 0x61, 0x63, 0x68, 0x48, 0x6f, 0x70, 0x4f, 0x66, 0x50, 0x61, 0x74, 0x68, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x17, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2e,
+	0x72, 0x70, 0x63, 0x2e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x30,
+	0x01, 0x42, 0x20, 0x5a, 0x1e, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f,
+	0x74, 0x72, 0x73, 0x74, 0x72, 0x75, 0x74, 0x68, 0x2f, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x2f,
+	0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_beacon_proto_rawDescOnce sync.Once
+	file_beacon_proto_rawDescData = file_beacon_proto_rawDesc
+)
+
+func file_beacon_proto_rawDescGZIP() []byte {
+	file_beacon_proto_rawDescOnce.Do(func() {
+		file_beacon_proto_rawDescData = protoimpl.X.CompressGZIP(file_beacon_proto_rawDescData)
+	})
+	return file_beacon_proto_rawDescData
+}
+
+var file_beacon_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_beacon_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_beacon_proto_goTypes = []interface{}{
+	(ProbeMode)(0),                    // 0: beacon.rpc.ProbeMode
+	(TimestampSource)(0),              // 1: beacon.rpc.TimestampSource
+	(ProbeError)(0),                   // 2: beacon.rpc.ProbeError
+	(*TracerouteRequest)(nil),         // 3: beacon.rpc.TracerouteRequest
+	(*ReverseTracerouteRequest)(nil),  // 4: beacon.rpc.ReverseTracerouteRequest
+	(*Hop)(nil),                       // 5: beacon.rpc.Hop
+	(*DiscoverAndProbeRequest)(nil),   // 6: beacon.rpc.DiscoverAndProbeRequest
+	(*ProbeEachHopOfPathRequest)(nil), // 7: beacon.rpc.ProbeEachHopOfPathRequest
+	(*ProbeResult)(nil),               // 8: beacon.rpc.ProbeResult
+	(*timestamppb.Timestamp)(nil),     // 9: google.protobuf.Timestamp
+}
+var file_beacon_proto_depIdxs = []int32{
+	0, // 0: beacon.rpc.ProbeResult.mode:type_name -> beacon.rpc.ProbeMode
+	9, // 1: beacon.rpc.ProbeResult.tx_timestamp:type_name -> google.protobuf.Timestamp
+	9, // 2: beacon.rpc.ProbeResult.rx_timestamp:type_name -> google.protobuf.Timestamp
+	1, // 3: beacon.rpc.ProbeResult.clock:type_name -> beacon.rpc.TimestampSource
+	2, // 4: beacon.rpc.ProbeResult.error_type:type_name -> beacon.rpc.ProbeError
+	3, // 5: beacon.rpc.Beacon.Traceroute:input_type -> beacon.rpc.TracerouteRequest
+	4, // 6: beacon.rpc.Beacon.ReverseTraceroute:input_type -> beacon.rpc.ReverseTracerouteRequest
+	6, // 7: beacon.rpc.Beacon.DiscoverAndProbe:input_type -> beacon.rpc.DiscoverAndProbeRequest
+	7, // 8: beacon.rpc.Beacon.ProbeEachHopOfPath:input_type -> beacon.rpc.ProbeEachHopOfPathRequest
+	5, // 9: beacon.rpc.Beacon.Traceroute:output_type -> beacon.rpc.Hop
+	5, // 10: beacon.rpc.Beacon.ReverseTraceroute:output_type -> beacon.rpc.Hop
+	8, // 11: beacon.rpc.Beacon.DiscoverAndProbe:output_type -> beacon.rpc.ProbeResult
+	8, // 12: beacon.rpc.Beacon.ProbeEachHopOfPath:output_type -> beacon.rpc.ProbeResult
+	9, // [9:13] is the sub-list for method output_type
+	5, // [5:9] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_beacon_proto_init() }
+func file_beacon_proto_init() {
+	if File_beacon_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_beacon_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TracerouteRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_beacon_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReverseTracerouteRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_beacon_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Hop); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_beacon_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DiscoverAndProbeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_beacon_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProbeEachHopOfPathRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_beacon_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProbeResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_beacon_proto_rawDesc,
+			NumEnums:      3,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_beacon_proto_goTypes,
+		DependencyIndexes: file_beacon_proto_depIdxs,
+		EnumInfos:         file_beacon_proto_enumTypes,
+		MessageInfos:      file_beacon_proto_msgTypes,
+	}.Build()
+	File_beacon_proto = out.File
+	file_beacon_proto_rawDesc = nil
+	file_beacon_proto_goTypes = nil
+	file_beacon_proto_depIdxs = nil
+}
@@ -0,0 +1,329 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.19.4
+// source: beacon.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// BeaconClient is the client API for Beacon service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BeaconClient interface {
+	// Traceroute streams the hops of the path from the agent to a destination
+	Traceroute(ctx context.Context, in *TracerouteRequest, opts ...grpc.CallOption) (Beacon_TracerouteClient, error)
+	// ReverseTraceroute streams the hops of the path from a destination back to the agent
+	ReverseTraceroute(ctx context.Context, in *ReverseTracerouteRequest, opts ...grpc.CallOption) (Beacon_ReverseTracerouteClient, error)
+	// DiscoverAndProbe traces the path to a destination, then probes each hop of it
+	DiscoverAndProbe(ctx context.Context, in *DiscoverAndProbeRequest, opts ...grpc.CallOption) (Beacon_DiscoverAndProbeClient, error)
+	// ProbeEachHopOfPath probes each hop of a path
+	ProbeEachHopOfPath(ctx context.Context, in *ProbeEachHopOfPathRequest, opts ...grpc.CallOption) (Beacon_ProbeEachHopOfPathClient, error)
+}
+
+type beaconClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBeaconClient(cc grpc.ClientConnInterface) BeaconClient {
+	return &beaconClient{cc}
+}
+
+func (c *beaconClient) Traceroute(ctx context.Context, in *TracerouteRequest, opts ...grpc.CallOption) (Beacon_TracerouteClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Beacon_ServiceDesc.Streams[0], "/beacon.rpc.Beacon/Traceroute", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &beaconTracerouteClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Beacon_TracerouteClient interface {
+	Recv() (*Hop, error)
+	grpc.ClientStream
+}
+
+type beaconTracerouteClient struct {
+	grpc.ClientStream
+}
+
+func (x *beaconTracerouteClient) Recv() (*Hop, error) {
+	m := new(Hop)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *beaconClient) ReverseTraceroute(ctx context.Context, in *ReverseTracerouteRequest, opts ...grpc.CallOption) (Beacon_ReverseTracerouteClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Beacon_ServiceDesc.Streams[1], "/beacon.rpc.Beacon/ReverseTraceroute", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &beaconReverseTracerouteClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Beacon_ReverseTracerouteClient interface {
+	Recv() (*Hop, error)
+	grpc.ClientStream
+}
+
+type beaconReverseTracerouteClient struct {
+	grpc.ClientStream
+}
+
+func (x *beaconReverseTracerouteClient) Recv() (*Hop, error) {
+	m := new(Hop)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *beaconClient) DiscoverAndProbe(ctx context.Context, in *DiscoverAndProbeRequest, opts ...grpc.CallOption) (Beacon_DiscoverAndProbeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Beacon_ServiceDesc.Streams[2], "/beacon.rpc.Beacon/DiscoverAndProbe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &beaconDiscoverAndProbeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Beacon_DiscoverAndProbeClient interface {
+	Recv() (*ProbeResult, error)
+	grpc.ClientStream
+}
+
+type beaconDiscoverAndProbeClient struct {
+	grpc.ClientStream
+}
+
+func (x *beaconDiscoverAndProbeClient) Recv() (*ProbeResult, error) {
+	m := new(ProbeResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *beaconClient) ProbeEachHopOfPath(ctx context.Context, in *ProbeEachHopOfPathRequest, opts ...grpc.CallOption) (Beacon_ProbeEachHopOfPathClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Beacon_ServiceDesc.Streams[3], "/beacon.rpc.Beacon/ProbeEachHopOfPath", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &beaconProbeEachHopOfPathClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Beacon_ProbeEachHopOfPathClient interface {
+	Recv() (*ProbeResult, error)
+	grpc.ClientStream
+}
+
+type beaconProbeEachHopOfPathClient struct {
+	grpc.ClientStream
+}
+
+func (x *beaconProbeEachHopOfPathClient) Recv() (*ProbeResult, error) {
+	m := new(ProbeResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BeaconServer is the server API for Beacon service.
+// All implementations must embed UnimplementedBeaconServer
+// for forward compatibility
+type BeaconServer interface {
+	// Traceroute streams the hops of the path from the agent to a destination
+	Traceroute(*TracerouteRequest, Beacon_TracerouteServer) error
+	// ReverseTraceroute streams the hops of the path from a destination back to the agent
+	ReverseTraceroute(*ReverseTracerouteRequest, Beacon_ReverseTracerouteServer) error
+	// DiscoverAndProbe traces the path to a destination, then probes each hop of it
+	DiscoverAndProbe(*DiscoverAndProbeRequest, Beacon_DiscoverAndProbeServer) error
+	// ProbeEachHopOfPath probes each hop of a path
+	ProbeEachHopOfPath(*ProbeEachHopOfPathRequest, Beacon_ProbeEachHopOfPathServer) error
+	mustEmbedUnimplementedBeaconServer()
+}
+
+// UnimplementedBeaconServer must be embedded to have forward compatible implementations.
+type UnimplementedBeaconServer struct {
+}
+
+func (UnimplementedBeaconServer) Traceroute(*TracerouteRequest, Beacon_TracerouteServer) error {
+	return status.Errorf(codes.Unimplemented, "method Traceroute not implemented")
+}
+func (UnimplementedBeaconServer) ReverseTraceroute(*ReverseTracerouteRequest, Beacon_ReverseTracerouteServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReverseTraceroute not implemented")
+}
+func (UnimplementedBeaconServer) DiscoverAndProbe(*DiscoverAndProbeRequest, Beacon_DiscoverAndProbeServer) error {
+	return status.Errorf(codes.Unimplemented, "method DiscoverAndProbe not implemented")
+}
+func (UnimplementedBeaconServer) ProbeEachHopOfPath(*ProbeEachHopOfPathRequest, Beacon_ProbeEachHopOfPathServer) error {
+	return status.Errorf(codes.Unimplemented, "method ProbeEachHopOfPath not implemented")
+}
+func (UnimplementedBeaconServer) mustEmbedUnimplementedBeaconServer() {}
+
+// UnsafeBeaconServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BeaconServer will
+// result in compilation errors.
+type UnsafeBeaconServer interface {
+	mustEmbedUnimplementedBeaconServer()
+}
+
+func RegisterBeaconServer(s grpc.ServiceRegistrar, srv BeaconServer) {
+	s.RegisterService(&Beacon_ServiceDesc, srv)
+}
+
+func _Beacon_Traceroute_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TracerouteRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BeaconServer).Traceroute(m, &beaconTracerouteServer{stream})
+}
+
+type Beacon_TracerouteServer interface {
+	Send(*Hop) error
+	grpc.ServerStream
+}
+
+type beaconTracerouteServer struct {
+	grpc.ServerStream
+}
+
+func (x *beaconTracerouteServer) Send(m *Hop) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Beacon_ReverseTraceroute_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReverseTracerouteRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BeaconServer).ReverseTraceroute(m, &beaconReverseTracerouteServer{stream})
+}
+
+type Beacon_ReverseTracerouteServer interface {
+	Send(*Hop) error
+	grpc.ServerStream
+}
+
+type beaconReverseTracerouteServer struct {
+	grpc.ServerStream
+}
+
+func (x *beaconReverseTracerouteServer) Send(m *Hop) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Beacon_DiscoverAndProbe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DiscoverAndProbeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BeaconServer).DiscoverAndProbe(m, &beaconDiscoverAndProbeServer{stream})
+}
+
+type Beacon_DiscoverAndProbeServer interface {
+	Send(*ProbeResult) error
+	grpc.ServerStream
+}
+
+type beaconDiscoverAndProbeServer struct {
+	grpc.ServerStream
+}
+
+func (x *beaconDiscoverAndProbeServer) Send(m *ProbeResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Beacon_ProbeEachHopOfPath_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ProbeEachHopOfPathRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BeaconServer).ProbeEachHopOfPath(m, &beaconProbeEachHopOfPathServer{stream})
+}
+
+type Beacon_ProbeEachHopOfPathServer interface {
+	Send(*ProbeResult) error
+	grpc.ServerStream
+}
+
+type beaconProbeEachHopOfPathServer struct {
+	grpc.ServerStream
+}
+
+func (x *beaconProbeEachHopOfPathServer) Send(m *ProbeResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Beacon_ServiceDesc is the grpc.ServiceDesc for Beacon service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Beacon_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "beacon.rpc.Beacon",
+	HandlerType: (*BeaconServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Traceroute",
+			Handler:       _Beacon_Traceroute_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReverseTraceroute",
+			Handler:       _Beacon_ReverseTraceroute_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "DiscoverAndProbe",
+			Handler:       _Beacon_DiscoverAndProbe_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ProbeEachHopOfPath",
+			Handler:       _Beacon_ProbeEachHopOfPath_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "beacon.proto",
+}
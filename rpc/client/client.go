@@ -0,0 +1,187 @@
+// Package client runs traceroutes and probes on remote beacon agents over gRPC.  Results come back over the same
+// channels the TransportChannel methods return, so code written against a local TransportChannel can drive an agent.
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trstruth/beacon"
+	"github.com/trstruth/beacon/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var log = logrus.New()
+
+// Client is a connection to a beacon agent
+type Client struct {
+	conn   *grpc.ClientConn
+	beacon rpc.BeaconClient
+}
+
+// Dial connects to the agent at target, see grpc.Dial for the options
+func Dial(target string, options ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.Dial(target, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, beacon: rpc.NewBeaconClient(conn)}, nil
+}
+
+// NewClient returns a Client which uses an existing connection, which the Client does not close
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{beacon: rpc.NewBeaconClient(conn)}
+}
+
+// Close closes the connection opened by Dial
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Traceroute returns a PathChannel to destIP from the agent, see TransportChannel.GetPathChannelTo.  sourceIP may be
+// nil, and a timeout of 0 uses the default of the agent.  Canceling ctx stops the traceroute and closes the channel.
+func (c *Client) Traceroute(ctx context.Context, destIP, sourceIP net.IP, timeout int) (beacon.PathChannel, error) {
+	req := &rpc.TracerouteRequest{Dest: destIP.String(), Timeout: int32(timeout)}
+	if sourceIP != nil {
+		req.Source = sourceIP.String()
+	}
+	stream, err := c.beacon.Traceroute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := awaitStart(stream); err != nil {
+		return nil, err
+	}
+	return receiveHops(ctx, stream), nil
+}
+
+// ReverseTraceroute returns a PathChannel from destIP back to the agent, see TransportChannel.GetPathChannelFrom.
+// The timeout is in seconds per hop, 0 uses the default of the agent.
+func (c *Client) ReverseTraceroute(ctx context.Context, destIP net.IP, timeout int) (beacon.PathChannel, error) {
+	stream, err := c.beacon.ReverseTraceroute(ctx, &rpc.ReverseTracerouteRequest{Dest: destIP.String(), Timeout: int32(timeout)})
+	if err != nil {
+		return nil, err
+	}
+	if err := awaitStart(stream); err != nil {
+		return nil, err
+	}
+	return receiveHops(ctx, stream), nil
+}
+
+// DiscoverAndProbe has the agent trace the path to dst and probe each hop of it, see
+// TransportChannel.DiscoverAndProbe.  An error which ends the stream early is sent as a fatal result.
+func (c *Client) DiscoverAndProbe(ctx context.Context, src, dst net.IP, numPackets, timeout int) (<-chan beacon.BoomerangResult, error) {
+	req := &rpc.DiscoverAndProbeRequest{Dest: dst.String(), NumPackets: int32(numPackets), Timeout: int32(timeout)}
+	if src != nil {
+		req.Source = src.String()
+	}
+	stream, err := c.beacon.DiscoverAndProbe(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := awaitStart(stream); err != nil {
+		return nil, err
+	}
+	return receiveResults(ctx, stream), nil
+}
+
+// ProbeEachHopOfPath has the agent probe each hop of path, which starts at the agent, see
+// TransportChannel.ProbeEachHopOfPath.  An error which ends the stream early is sent as a fatal result.
+func (c *Client) ProbeEachHopOfPath(ctx context.Context, path beacon.Path, numPackets, timeout int) (<-chan beacon.BoomerangResult, error) {
+	stream, err := c.beacon.ProbeEachHopOfPath(ctx, &rpc.ProbeEachHopOfPathRequest{
+		Path:       rpc.PathStrings(path),
+		NumPackets: int32(numPackets),
+		Timeout:    int32(timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := awaitStart(stream); err != nil {
+		return nil, err
+	}
+	return receiveResults(ctx, stream), nil
+}
+
+// awaitStart waits for the agent to start running a request.  The agent sends the StartedHeader once it has, and
+// ends the stream without it if the request failed.
+func awaitStart(stream grpc.ClientStream) error {
+	md, err := stream.Header()
+	if err != nil {
+		return err
+	}
+	if len(md.Get(rpc.StartedHeader)) > 0 {
+		return nil
+	}
+	if err := stream.RecvMsg(new(rpc.Hop)); err != nil && err != io.EOF {
+		return err
+	}
+	return status.Error(codes.Internal, "the agent ended the stream before starting the request")
+}
+
+type hopStream interface {
+	Recv() (*rpc.Hop, error)
+}
+
+func receiveHops(ctx context.Context, stream hopStream) beacon.PathChannel {
+	pathChan := make(beacon.PathChannel)
+	go func() {
+		defer close(pathChan)
+		for {
+			hop, err := stream.Recv()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				log.Printf("Failed to receive hop: %s\n", err)
+				return
+			}
+
+			select {
+			case pathChan <- hop.IP():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return pathChan
+}
+
+type probeResultStream interface {
+	Recv() (*rpc.ProbeResult, error)
+}
+
+func receiveResults(ctx context.Context, stream probeResultStream) <-chan beacon.BoomerangResult {
+	resultChan := make(chan beacon.BoomerangResult)
+	go func() {
+		defer close(resultChan)
+		for {
+			var res beacon.BoomerangResult
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err == nil {
+				res, err = msg.BoomerangResult()
+			}
+			if err != nil {
+				res = beacon.BoomerangResult{Err: err, ErrorType: beacon.BoomerangFatal}
+			}
+
+			select {
+			case resultChan <- res:
+			case <-ctx.Done():
+				return
+			}
+			if res.IsFatal() {
+				return
+			}
+		}
+	}()
+	return resultChan
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/trstruth/beacon"
+	"github.com/trstruth/beacon/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeAgent answers traceroutes with a fixed path and probes with one result per hop followed by a fatal error
+type fakeAgent struct {
+	rpc.UnimplementedBeaconServer
+	path []net.IP
+}
+
+func (a *fakeAgent) Traceroute(req *rpc.TracerouteRequest, stream rpc.Beacon_TracerouteServer) error {
+	if net.ParseIP(req.GetDest()) == nil {
+		return status.Error(codes.InvalidArgument, "dest is not an IP")
+	}
+	stream.SendHeader(metadata.Pairs(rpc.StartedHeader, "true"))
+	for idx, hop := range a.path {
+		stream.Send(rpc.NewHop(idx+1, hop))
+	}
+	return nil
+}
+
+func (a *fakeAgent) ProbeEachHopOfPath(req *rpc.ProbeEachHopOfPathRequest, stream rpc.Beacon_ProbeEachHopOfPathServer) error {
+	stream.SendHeader(metadata.Pairs(rpc.StartedHeader, "true"))
+	for _, hop := range req.GetPath()[1:] {
+		stream.Send(&rpc.ProbeResult{DestIp: hop})
+	}
+	return status.Error(codes.FailedPrecondition, "out of packets")
+}
+
+func newTestClient(t *testing.T, agent *fakeAgent) *Client {
+	listener := bufconn.Listen(1 << 16)
+	server := grpc.NewServer()
+	rpc.RegisterBeaconServer(server, agent)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	c, err := Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial the fake agent: %s", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClientTraceroute(t *testing.T) {
+	path := []net.IP{{10, 0, 0, 1}, nil, {10, 0, 0, 3}}
+	c := newTestClient(t, &fakeAgent{path: path})
+
+	pc, err := c.Traceroute(context.Background(), net.IP{10, 0, 0, 3}, nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to start traceroute: %s", err)
+	}
+
+	var got []net.IP
+	for hop := range pc {
+		got = append(got, hop)
+	}
+	if !beacon.Path(got).Equal(path) {
+		t.Errorf("Expected path %s, got %s", beacon.Path(path), beacon.Path(got))
+	}
+}
+
+func TestClientReturnsErrorsBeforeTheStreamStarts(t *testing.T) {
+	c := newTestClient(t, &fakeAgent{})
+
+	_, err := c.Traceroute(context.Background(), nil, nil, 0)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected the rejected request to return InvalidArgument, got %v", err)
+	}
+}
+
+func TestClientEndsProbeWithFatalResult(t *testing.T) {
+	c := newTestClient(t, &fakeAgent{})
+	path := beacon.Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}, net.IP{10, 0, 0, 3}}
+
+	resultChan, err := c.ProbeEachHopOfPath(context.Background(), path, 1, 0)
+	if err != nil {
+		t.Fatalf("Failed to start probe: %s", err)
+	}
+
+	var results []beacon.BoomerangResult
+	for res := range resultChan {
+		results = append(results, res)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected a result for each hop and a fatal result, got %+v", results)
+	}
+	for idx, res := range results[:2] {
+		if res.Err != nil || !res.Payload.DestIP.Equal(path[idx+1]) {
+			t.Errorf("Expected a successful probe of %s, got %+v", path[idx+1], res)
+		}
+	}
+	if last := results[2]; !last.IsFatal() || status.Code(last.Err) != codes.FailedPrecondition {
+		t.Errorf("Expected the stream error as a fatal result, got %+v", last)
+	}
+}
@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trstruth/beacon"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ParsePath parses the hops of a path, in the form they are sent over the wire
+func ParsePath(hops []string) (beacon.Path, error) {
+	path := make(beacon.Path, len(hops))
+	for idx, hop := range hops {
+		hopIP := net.ParseIP(hop)
+		if hopIP == nil {
+			return nil, fmt.Errorf("hop %d of the path is not an IP: %q", idx, hop)
+		}
+		path[idx] = hopIP
+	}
+	return path, nil
+}
+
+// PathStrings returns the hops of a path in the form they are sent over the wire
+func PathStrings(path beacon.Path) []string {
+	hops := make([]string, len(path))
+	for idx, hop := range path {
+		hops[idx] = hop.String()
+	}
+	return hops
+}
+
+// NewHop returns the message for the hop of a traceroute ttl hops away, hop is nil if it did not respond
+func NewHop(ttl int, hop net.IP) *Hop {
+	msg := &Hop{Ttl: int32(ttl)}
+	if hop != nil {
+		msg.Ip = hop.String()
+	}
+	return msg
+}
+
+// IP returns the address of the hop, or nil if it did not respond
+func (h *Hop) IP() net.IP {
+	return net.ParseIP(h.GetIp())
+}
+
+// NewProbeResult returns the message for the result of a boomerang
+func NewProbeResult(res beacon.BoomerangResult) *ProbeResult {
+	msg := &ProbeResult{
+		Mode:  ProbeMode(res.Payload.Mode),
+		Clock: TimestampSource(res.Payload.Clock),
+	}
+	if res.Payload.DestIP != nil {
+		msg.DestIp = res.Payload.DestIP.String()
+	}
+	if res.Payload.ID != uuid.Nil {
+		msg.Id = res.Payload.ID.String()
+	}
+	if !res.Payload.TxTimestamp.IsZero() {
+		msg.TxTimestamp = timestamppb.New(res.Payload.TxTimestamp)
+	}
+	if !res.Payload.RxTimestamp.IsZero() {
+		msg.RxTimestamp = timestamppb.New(res.Payload.RxTimestamp)
+	}
+	if res.Err != nil {
+		msg.Error = res.Err.Error()
+		msg.ErrorType = ProbeError_TIMED_OUT
+		if res.ErrorType == beacon.BoomerangSendError {
+			msg.ErrorType = ProbeError_SEND_ERROR
+		}
+	}
+	return msg
+}
+
+// BoomerangResult returns the result of the boomerang the message describes
+func (r *ProbeResult) BoomerangResult() (beacon.BoomerangResult, error) {
+	res := beacon.BoomerangResult{
+		Payload: beacon.BoomerangPayload{
+			DestIP: net.ParseIP(r.GetDestIp()),
+			Mode:   beacon.ProbeMode(r.GetMode()),
+			Clock:  beacon.TimestampSource(r.GetClock()),
+		},
+	}
+	if r.GetId() != "" {
+		id, err := uuid.Parse(r.GetId())
+		if err != nil {
+			return res, fmt.Errorf("Failed to parse probe id %q: %s", r.GetId(), err)
+		}
+		res.Payload.ID = id
+	}
+	if r.TxTimestamp != nil {
+		res.Payload.TxTimestamp = r.TxTimestamp.AsTime().In(time.Local)
+	}
+	if r.RxTimestamp != nil {
+		res.Payload.RxTimestamp = r.RxTimestamp.AsTime().In(time.Local)
+	}
+
+	switch r.GetErrorType() {
+	case ProbeError_NONE:
+	case ProbeError_TIMED_OUT:
+		res.Err = errors.New(r.GetError())
+		res.ErrorType = beacon.BoomerangTimedOut
+	case ProbeError_SEND_ERROR:
+		res.Err = errors.New(r.GetError())
+		res.ErrorType = beacon.BoomerangSendError
+	default:
+		return res, fmt.Errorf("unknown probe error type %d", r.GetErrorType())
+	}
+	return res, nil
+}
@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trstruth/beacon"
+)
+
+func TestProbeResultRoundTrip(t *testing.T) {
+	tx := time.Now()
+	results := []beacon.BoomerangResult{
+		{
+			Payload: beacon.BoomerangPayload{
+				DestIP:      net.IP{10, 0, 0, 1},
+				Mode:        beacon.ReversePinned,
+				ID:          uuid.New(),
+				TxTimestamp: tx,
+				RxTimestamp: tx.Add(1500 * time.Microsecond),
+				Clock:       beacon.KernelTimestamp,
+			},
+		},
+		{
+			Err:       errors.New("timed out"),
+			ErrorType: beacon.BoomerangTimedOut,
+			Payload:   beacon.BoomerangPayload{DestIP: net.ParseIP("2001:db8::1"), ID: uuid.New(), TxTimestamp: tx},
+		},
+		{
+			Err:       errors.New("no route to host"),
+			ErrorType: beacon.BoomerangSendError,
+			Payload:   beacon.BoomerangPayload{DestIP: net.IP{10, 0, 0, 2}, Mode: beacon.Native},
+		},
+	}
+
+	for _, want := range results {
+		got, err := NewProbeResult(want).BoomerangResult()
+		if err != nil {
+			t.Fatalf("Failed to convert %+v back: %s", want, err)
+		}
+
+		if !got.Payload.DestIP.Equal(want.Payload.DestIP) || got.Payload.Mode != want.Payload.Mode ||
+			got.Payload.ID != want.Payload.ID || got.Payload.Clock != want.Payload.Clock {
+			t.Errorf("Expected payload %+v, got %+v", want.Payload, got.Payload)
+		}
+		if !got.Payload.TxTimestamp.Equal(want.Payload.TxTimestamp) || !got.Payload.RxTimestamp.Equal(want.Payload.RxTimestamp) {
+			t.Errorf("Expected timestamps %s and %s, got %s and %s", want.Payload.TxTimestamp, want.Payload.RxTimestamp,
+				got.Payload.TxTimestamp, got.Payload.RxTimestamp)
+		}
+		if (got.Err == nil) != (want.Err == nil) || got.ErrorType != want.ErrorType {
+			t.Errorf("Expected error %v of type %d, got %v of type %d", want.Err, want.ErrorType, got.Err, got.ErrorType)
+		} else if got.Err != nil && got.Err.Error() != want.Err.Error() {
+			t.Errorf("Expected error %q, got %q", want.Err, got.Err)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	path := beacon.Path{net.IP{10, 0, 0, 1}, net.ParseIP("2001:db8::2")}
+
+	parsed, err := ParsePath(PathStrings(path))
+	if err != nil {
+		t.Fatalf("Failed to parse path: %s", err)
+	}
+	if !parsed.Equal(path) {
+		t.Errorf("Expected %s, got %s", path, parsed)
+	}
+
+	if _, err := ParsePath([]string{"10.0.0.1", "router1"}); err == nil {
+		t.Errorf("Expected a hop which isn't an IP to be rejected")
+	}
+}
@@ -0,0 +1,278 @@
+package rpc
+
+import (
+	"net"
+
+	"github.com/trstruth/beacon"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// StartedHeader is the header the server sends once it has started running a request, which tells clients the
+// request was accepted before the first result is ready
+const StartedHeader = "beacon-started"
+
+const (
+	defaultTimeout         = 3
+	defaultNumPackets      = 30
+	defaultMaxProbePackets = 1000
+)
+
+// Server serves the Beacon service from one TransportChannel shared by every RPC.  The TransportChannel has to
+// capture both traceroute and boomerang packets, see beacon.NewSharedTransportChannel.
+type Server struct {
+	UnimplementedBeaconServer
+	tc              *beacon.TransportChannel
+	timeout         int
+	maxProbePackets int
+	slots           chan struct{}
+}
+
+// ServerOption configures a Server
+type ServerOption func(*Server)
+
+// WithDefaultTimeout sets the timeout in seconds used by requests which don't set one
+func WithDefaultTimeout(timeout int) ServerOption {
+	return func(s *Server) {
+		s.timeout = timeout
+	}
+}
+
+// WithMaxProbePackets limits the number of packets a probe may send to each hop
+func WithMaxProbePackets(maxProbePackets int) ServerOption {
+	return func(s *Server) {
+		s.maxProbePackets = maxProbePackets
+	}
+}
+
+// WithSlots limits the RPCs running at once to the capacity of slots, which each running RPC holds an element of.
+// Sharing slots with other users of the TransportChannel puts one limit on all of them.  RPCs beyond the limit fail
+// with ResourceExhausted.
+func WithSlots(slots chan struct{}) ServerOption {
+	return func(s *Server) {
+		s.slots = slots
+	}
+}
+
+// NewServer returns a Server which runs RPCs on tc
+func NewServer(tc *beacon.TransportChannel, options ...ServerOption) *Server {
+	s := &Server{
+		tc:              tc,
+		timeout:         defaultTimeout,
+		maxProbePackets: defaultMaxProbePackets,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Register registers the Beacon service on a grpc.Server
+func (s *Server) Register(gs *grpc.Server) {
+	RegisterBeaconServer(gs, s)
+}
+
+// Traceroute streams the hops of GetPathChannelTo
+func (s *Server) Traceroute(req *TracerouteRequest, stream Beacon_TracerouteServer) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+
+	destIP, err := parseIP("dest", req.GetDest())
+	if err != nil {
+		return err
+	}
+	var sourceIP net.IP
+	if req.GetSource() != "" {
+		if sourceIP, err = parseIP("source", req.GetSource()); err != nil {
+			return err
+		}
+	}
+
+	pc, err := s.tc.GetPathChannelTo(destIP, sourceIP, s.timeoutOf(req.GetTimeout()), beacon.WithTracerouteStop(stream.Context().Done()))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Failed to start traceroute to %s: %s", destIP, err)
+	}
+	return sendHops(stream, pc)
+}
+
+// ReverseTraceroute streams the hops of GetPathChannelFrom
+func (s *Server) ReverseTraceroute(req *ReverseTracerouteRequest, stream Beacon_ReverseTracerouteServer) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+
+	destIP, err := parseIP("dest", req.GetDest())
+	if err != nil {
+		return err
+	}
+
+	// GetPathChannelFrom waits on each hop for timeout milliseconds
+	timeout := s.timeoutOf(req.GetTimeout()) * 1000
+
+	pc, err := s.tc.GetPathChannelFrom(destIP, timeout, beacon.WithTracerouteStop(stream.Context().Done()))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Failed to start reverse traceroute from %s: %s", destIP, err)
+	}
+	return sendHops(stream, pc)
+}
+
+// DiscoverAndProbe streams the results of DiscoverAndProbe
+func (s *Server) DiscoverAndProbe(req *DiscoverAndProbeRequest, stream Beacon_DiscoverAndProbeServer) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+
+	destIP, err := parseIP("dest", req.GetDest())
+	if err != nil {
+		return err
+	}
+	var sourceIP net.IP
+	if req.GetSource() != "" {
+		if sourceIP, err = parseIP("source", req.GetSource()); err != nil {
+			return err
+		}
+	}
+	numPackets, err := s.numPacketsOf(req.GetNumPackets())
+	if err != nil {
+		return err
+	}
+
+	resultChan, err := s.tc.DiscoverAndProbe(sourceIP, destIP, numPackets, s.timeoutOf(req.GetTimeout()), beacon.WithStop(stream.Context().Done()))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Failed to discover the path to %s: %s", destIP, err)
+	}
+	return sendResults(stream, resultChan)
+}
+
+// ProbeEachHopOfPath streams the results of ProbeEachHopOfPath
+func (s *Server) ProbeEachHopOfPath(req *ProbeEachHopOfPathRequest, stream Beacon_ProbeEachHopOfPathServer) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+
+	path, err := ParsePath(req.GetPath())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(path) < 2 {
+		return status.Errorf(codes.InvalidArgument, "a path must have atleast 2 hops, got %d", len(path))
+	}
+	numPackets, err := s.numPacketsOf(req.GetNumPackets())
+	if err != nil {
+		return err
+	}
+
+	return sendResults(stream, s.tc.ProbeEachHopOfPath(path, numPackets, s.timeoutOf(req.GetTimeout()), beacon.WithStop(stream.Context().Done())))
+}
+
+// acquire takes a slot for an RPC, or fails if they are all taken
+func (s *Server) acquire() error {
+	if s.slots == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+		return status.Errorf(codes.ResourceExhausted, "too many requests are running, try again later")
+	}
+}
+
+// release frees the slot of an RPC
+func (s *Server) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+func (s *Server) timeoutOf(timeout int32) int {
+	if timeout <= 0 {
+		return s.timeout
+	}
+	return int(timeout)
+}
+
+func (s *Server) numPacketsOf(numPackets int32) (int, error) {
+	if numPackets <= 0 {
+		return defaultNumPackets, nil
+	}
+	if int(numPackets) > s.maxProbePackets {
+		return 0, status.Errorf(codes.InvalidArgument, "a probe may send at most %d packets per hop, got %d", s.maxProbePackets, numPackets)
+	}
+	return int(numPackets), nil
+}
+
+func parseIP(field, s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s is not an IP: %q", field, s)
+	}
+	return ip, nil
+}
+
+type hopStream interface {
+	grpc.ServerStream
+	Send(*Hop) error
+}
+
+type probeResultStream interface {
+	grpc.ServerStream
+	Send(*ProbeResult) error
+}
+
+// sendHops streams a PathChannel after the StartedHeader.  If the client goes away the rest of the path is consumed in
+// the background, until the traceroute stops.
+func sendHops(stream hopStream, pc beacon.PathChannel) error {
+	if err := stream.SendHeader(metadata.Pairs(StartedHeader, "true")); err != nil {
+		go drainPathChannel(pc)
+		return err
+	}
+
+	ttl := 1
+	for hop := range pc {
+		if err := stream.Send(NewHop(ttl, hop)); err != nil {
+			go drainPathChannel(pc)
+			return err
+		}
+		ttl++
+	}
+	return nil
+}
+
+// sendResults streams the results of a probe after the StartedHeader, and ends the stream with an error status on a
+// fatal result
+func sendResults(stream probeResultStream, resultChan <-chan beacon.BoomerangResult) error {
+	if err := stream.SendHeader(metadata.Pairs(StartedHeader, "true")); err != nil {
+		go drainResults(resultChan)
+		return err
+	}
+
+	for res := range resultChan {
+		if res.Err != nil && res.IsFatal() {
+			// a fatal result is the only one sent, and the channel is left open
+			return status.Error(codes.FailedPrecondition, res.Err.Error())
+		}
+		if err := stream.Send(NewProbeResult(res)); err != nil {
+			go drainResults(resultChan)
+			return err
+		}
+	}
+	return nil
+}
+
+func drainPathChannel(pc beacon.PathChannel) {
+	for range pc {
+	}
+}
+
+func drainResults(resultChan <-chan beacon.BoomerangResult) {
+	for range resultChan {
+	}
+}
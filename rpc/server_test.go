@@ -0,0 +1,32 @@
+package rpc
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerSlots(t *testing.T) {
+	slots := make(chan struct{}, 1)
+	s := NewServer(nil, WithSlots(slots))
+
+	// a job of the HTTP API holds the only slot
+	slots <- struct{}{}
+	err := s.ProbeEachHopOfPath(&ProbeEachHopOfPathRequest{Path: []string{"10.0.0.1", "10.0.0.2"}}, nil)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected a request beyond the limit to fail with ResourceExhausted, got %v", err)
+	}
+	if len(slots) != 1 {
+		t.Errorf("Expected the rejected request not to take or free a slot, %d are taken", len(slots))
+	}
+
+	<-slots
+	if err := s.acquire(); err != nil {
+		t.Fatalf("Expected a free slot to be acquired, got %s", err)
+	}
+	s.release()
+	if len(slots) != 0 {
+		t.Errorf("Expected the released slot to be free, %d are taken", len(slots))
+	}
+}
@@ -0,0 +1,67 @@
+package beacon
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmsghdr mirrors struct mmsghdr, go pads it to the alignment of Msghdr the same way C does
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+// sendBuffers holds the message headers passed to sendmmsg, reused across flushes of a batch
+type sendBuffers struct {
+	hdrs   []mmsghdr
+	iovs   []unix.Iovec
+	addrs4 []unix.RawSockaddrInet4
+	addrs6 []unix.RawSockaddrInet6
+}
+
+// sendmmsg sends the packets at the given indices with a single syscall, and returns how many were sent.
+// If the first packet could not be sent the error is returned, otherwise the kernel stops at the first failure
+// and reports it on the next call.
+func (s *sendBuffers) sendmmsg(fd int, packets []batchedPacket, indices []int) (int, error) {
+	n := len(indices)
+	if cap(s.hdrs) < n {
+		s.hdrs = make([]mmsghdr, n)
+		s.iovs = make([]unix.Iovec, n)
+		s.addrs4 = make([]unix.RawSockaddrInet4, n)
+		s.addrs6 = make([]unix.RawSockaddrInet6, n)
+	}
+	s.hdrs, s.iovs = s.hdrs[:n], s.iovs[:n]
+	s.addrs4, s.addrs6 = s.addrs4[:n], s.addrs6[:n]
+
+	for i, idx := range indices {
+		packet := packets[idx]
+		hdr := &s.hdrs[i]
+		*hdr = mmsghdr{}
+
+		if len(packet.data) > 0 {
+			s.iovs[i].Base = &packet.data[0]
+		}
+		s.iovs[i].SetLen(len(packet.data))
+		hdr.hdr.Iov = &s.iovs[i]
+		hdr.hdr.SetIovlen(1)
+
+		if dest4 := packet.dest.To4(); dest4 != nil {
+			s.addrs4[i] = unix.RawSockaddrInet4{Family: unix.AF_INET}
+			copy(s.addrs4[i].Addr[:], dest4)
+			hdr.hdr.Name = (*byte)(unsafe.Pointer(&s.addrs4[i]))
+			hdr.hdr.Namelen = unix.SizeofSockaddrInet4
+		} else {
+			s.addrs6[i] = unix.RawSockaddrInet6{Family: unix.AF_INET6}
+			copy(s.addrs6[i].Addr[:], packet.dest.To16())
+			hdr.hdr.Name = (*byte)(unsafe.Pointer(&s.addrs6[i]))
+			hdr.hdr.Namelen = unix.SizeofSockaddrInet6
+		}
+	}
+
+	sent, _, errno := unix.Syscall6(unix.SYS_SENDMMSG, uintptr(fd), uintptr(unsafe.Pointer(&s.hdrs[0])), uintptr(n), 0, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(sent), nil
+}
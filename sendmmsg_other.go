@@ -0,0 +1,34 @@
+//go:build !linux
+// +build !linux
+
+package beacon
+
+import (
+	"syscall"
+)
+
+// sendBuffers is empty on platforms without sendmmsg, where batches are sent one packet at a time
+type sendBuffers struct{}
+
+// sendmmsg sends the packets at the given indices one at a time, and returns how many were sent before an error
+func (s *sendBuffers) sendmmsg(fd int, packets []batchedPacket, indices []int) (int, error) {
+	for i, idx := range indices {
+		packet := packets[idx]
+
+		var addr syscall.Sockaddr
+		if dest4 := packet.dest.To4(); dest4 != nil {
+			addr4 := &syscall.SockaddrInet4{}
+			copy(addr4.Addr[:], dest4)
+			addr = addr4
+		} else {
+			addr6 := &syscall.SockaddrInet6{}
+			copy(addr6.Addr[:], packet.dest.To16())
+			addr = addr6
+		}
+
+		if err := syscall.Sendto(fd, packet.data, 0, addr); err != nil {
+			return i, err
+		}
+	}
+	return len(indices), nil
+}
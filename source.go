@@ -0,0 +1,79 @@
+package beacon
+
+import (
+	"fmt"
+	"net"
+)
+
+// Route is the route the kernel selects to a destination
+type Route struct {
+	// Interface is the interface packets to the destination are sent out of
+	Interface string
+	// Source is the address packets to the destination are sent from, of the family of the destination
+	Source net.IP
+	// Gateway is the next hop, nil when the destination is directly connected
+	Gateway net.IP
+}
+
+// RouteTo looks up the route to dest in the routing table of the context, through device unless it is empty or
+// "any".  Within a VRF the table of the VRF is used.
+func (nc NetworkContext) RouteTo(dest net.IP, device string) (Route, error) {
+	if device == "any" {
+		device = ""
+	}
+	var route Route
+	err := nc.Run(func() error {
+		var err error
+		route, err = lookupRoute(dest, device, nc.VRF)
+		return err
+	})
+	if err != nil {
+		return route, fmt.Errorf("Failed to find a route to %s: %s", dest, err)
+	}
+	return route, nil
+}
+
+// SourceFor returns the address packets to dest are sent from, out of device unless it is empty or "any"
+func (nc NetworkContext) SourceFor(dest net.IP, device string) (net.IP, error) {
+	route, err := nc.RouteTo(dest, device)
+	if err != nil {
+		return nil, err
+	}
+	return route.Source, nil
+}
+
+// SourceFor returns the address packets to dest are sent from.  The route is looked up through the interface the
+// TransportChannel listens on when there is only one, and in its network namespace and VRF.
+func (tc *TransportChannel) SourceFor(dest net.IP) (net.IP, error) {
+	device := ""
+	if len(tc.deviceNames) == 1 {
+		device = tc.deviceNames[0]
+	}
+	return tc.network.SourceFor(dest, device)
+}
+
+// interfaceSource returns the address of an interface to send to dest from, preferring a global unicast one
+func interfaceSource(iface *net.Interface, dest net.IP) (net.IP, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get addresses of %s: %s", iface.Name, err)
+	}
+
+	var source net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || (ipNet.IP.To4() == nil) != (dest.To4() == nil) {
+			continue
+		}
+		if ipNet.IP.IsGlobalUnicast() {
+			return ipNet.IP, nil
+		}
+		if source == nil {
+			source = ipNet.IP
+		}
+	}
+	if source == nil {
+		return nil, fmt.Errorf("%s has no address of the family of %s", iface.Name, dest)
+	}
+	return source, nil
+}
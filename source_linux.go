@@ -0,0 +1,151 @@
+package beacon
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// routeRequestSeq numbers the route requests sent over netlink
+var routeRequestSeq uint32
+
+// lookupRoute asks the kernel for the route to dest over netlink, like "ip route get".  The lookup is pinned to
+// device, or else to the VRF device which selects the table of the VRF.
+func lookupRoute(dest net.IP, device string, vrf string) (Route, error) {
+	family, dst := unix.AF_INET, dest.To4()
+	if dst == nil {
+		family, dst = unix.AF_INET6, dest.To16()
+	}
+	if dst == nil {
+		return Route{}, fmt.Errorf("invalid destination %v", dest)
+	}
+
+	oif := device
+	if oif == "" {
+		oif = vrf
+	}
+	oifIndex := 0
+	if oif != "" {
+		iface, err := net.InterfaceByName(oif)
+		if err != nil {
+			return Route{}, fmt.Errorf("Couldn't find a device named %s: %s", oif, err)
+		}
+		oifIndex = iface.Index
+	}
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return Route{}, fmt.Errorf("Failed to open netlink socket: %s", err)
+	}
+	defer unix.Close(fd)
+
+	seq := atomic.AddUint32(&routeRequestSeq, 1)
+	request := newRouteRequest(family, dst, oifIndex, seq)
+	if err := unix.Sendto(fd, request, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return Route{}, fmt.Errorf("Failed to send route request: %s", err)
+	}
+
+	buf := make([]byte, 8192)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return Route{}, fmt.Errorf("Failed to receive route: %s", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return Route{}, fmt.Errorf("Failed to parse netlink message: %s", err)
+		}
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq {
+				continue
+			}
+			switch msg.Header.Type {
+			case unix.NLMSG_ERROR:
+				if len(msg.Data) < unix.SizeofNlMsgerr {
+					return Route{}, fmt.Errorf("truncated netlink error")
+				}
+				errno := (*unix.NlMsgerr)(unsafe.Pointer(&msg.Data[0])).Error
+				return Route{}, syscall.Errno(-errno)
+			case unix.RTM_NEWROUTE:
+				return parseRoute(&msg, dest)
+			}
+		}
+	}
+}
+
+// newRouteRequest builds an RTM_GETROUTE message for a single destination address, out of the interface with
+// index oif unless it is 0
+func newRouteRequest(family int, dst net.IP, oif int, seq uint32) []byte {
+	attrs := routeAttr(unix.RTA_DST, dst)
+	if oif != 0 {
+		index := uint32(oif)
+		attrs = append(attrs, routeAttr(unix.RTA_OIF, (*[4]byte)(unsafe.Pointer(&index))[:])...)
+	}
+
+	length := unix.SizeofNlMsghdr + unix.SizeofRtMsg + len(attrs)
+	buf := make([]byte, length)
+	*(*unix.NlMsghdr)(unsafe.Pointer(&buf[0])) = unix.NlMsghdr{
+		Len:   uint32(length),
+		Type:  unix.RTM_GETROUTE,
+		Flags: unix.NLM_F_REQUEST,
+		Seq:   seq,
+	}
+	*(*unix.RtMsg)(unsafe.Pointer(&buf[unix.SizeofNlMsghdr])) = unix.RtMsg{
+		Family:  uint8(family),
+		Dst_len: uint8(len(dst) * 8),
+	}
+	copy(buf[unix.SizeofNlMsghdr+unix.SizeofRtMsg:], attrs)
+	return buf
+}
+
+// routeAttr encodes a route attribute, padded to the netlink alignment
+func routeAttr(attrType uint16, value []byte) []byte {
+	length := unix.SizeofRtAttr + len(value)
+	buf := make([]byte, (length+unix.RTA_ALIGNTO-1) & ^(unix.RTA_ALIGNTO-1))
+	*(*unix.RtAttr)(unsafe.Pointer(&buf[0])) = unix.RtAttr{Len: uint16(length), Type: attrType}
+	copy(buf[unix.SizeofRtAttr:], value)
+	return buf
+}
+
+// parseRoute reads the interface, preferred source and gateway out of an RTM_NEWROUTE message.  A route without a
+// preferred source is sent from an address of its interface.
+func parseRoute(msg *syscall.NetlinkMessage, dest net.IP) (Route, error) {
+	attrs, err := syscall.ParseNetlinkRouteAttr(msg)
+	if err != nil {
+		return Route{}, fmt.Errorf("Failed to parse route attributes: %s", err)
+	}
+
+	var route Route
+	var iface *net.Interface
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.RTA_OIF:
+			if len(attr.Value) < 4 {
+				continue
+			}
+			index := *(*uint32)(unsafe.Pointer(&attr.Value[0]))
+			if iface, err = net.InterfaceByIndex(int(index)); err != nil {
+				return Route{}, fmt.Errorf("Couldn't find interface %d: %s", index, err)
+			}
+			route.Interface = iface.Name
+		case unix.RTA_PREFSRC:
+			route.Source = net.IP(append([]byte(nil), attr.Value...))
+		case unix.RTA_GATEWAY:
+			route.Gateway = net.IP(append([]byte(nil), attr.Value...))
+		}
+	}
+
+	if route.Source == nil {
+		if iface == nil {
+			return Route{}, fmt.Errorf("route has neither a source nor an interface")
+		}
+		if route.Source, err = interfaceSource(iface, dest); err != nil {
+			return Route{}, err
+		}
+	}
+	return route, nil
+}
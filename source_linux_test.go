@@ -0,0 +1,45 @@
+package beacon
+
+import (
+	"net"
+	"os/exec"
+	"testing"
+)
+
+func TestRouteToInNetNS(t *testing.T) {
+	name := testNetNS(t,
+		"link set lo up",
+		"addr add 10.9.0.2/24 dev lo",
+		"addr add 10.9.0.3/24 dev lo",
+		"route add 192.0.2.0/24 dev lo src 10.9.0.3",
+		"-6 addr add 2001:db8::2/64 dev lo nodad",
+		"-6 route add 2001:db8:1::/48 dev lo",
+	)
+	defer exec.Command("ip", "netns", "delete", name).Run()
+	nc := NetworkContext{NetNS: name}
+
+	cases := []struct {
+		dest   net.IP
+		source net.IP
+	}{
+		// the preferred source of the route, rather than the first address of the interface
+		{net.ParseIP("192.0.2.7"), net.ParseIP("10.9.0.3")},
+		{net.ParseIP("2001:db8:1::7"), net.ParseIP("2001:db8::2")},
+	}
+	for _, c := range cases {
+		for _, device := range []string{"", "any", "lo"} {
+			route, err := nc.RouteTo(c.dest, device)
+			if err != nil {
+				t.Errorf("Failed to find a route to %s through %q: %s", c.dest, device, err)
+				continue
+			}
+			if !route.Source.Equal(c.source) || route.Interface != "lo" {
+				t.Errorf("Expected %s to be routed out of lo from %s, got %+v", c.dest, c.source, route)
+			}
+		}
+	}
+
+	if _, err := nc.RouteTo(net.ParseIP("198.51.100.1"), ""); err == nil {
+		t.Errorf("Expected an error finding a route to an unreachable destination")
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+package beacon
+
+import (
+	"fmt"
+	"net"
+)
+
+// lookupRoute finds the route to dest without netlink.  Through a device the source is an address of the device,
+// otherwise a udp dial lets the kernel pick the source, and the interface is the one with that address.
+func lookupRoute(dest net.IP, device string, vrf string) (Route, error) {
+	if vrf != "" {
+		return Route{}, fmt.Errorf("VRFs are only supported on linux")
+	}
+
+	if device != "" {
+		iface, err := net.InterfaceByName(device)
+		if err != nil {
+			return Route{}, fmt.Errorf("Couldn't find a device named %s: %s", device, err)
+		}
+		source, err := interfaceSource(iface, dest)
+		if err != nil {
+			return Route{}, err
+		}
+		return Route{Interface: device, Source: source}, nil
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(dest.String(), "80"))
+	if err != nil {
+		return Route{}, fmt.Errorf("Failed to dial dest ip %s: %s", dest, err)
+	}
+	defer conn.Close()
+
+	source := conn.LocalAddr().(*net.UDPAddr).IP
+	device, err = interfaceWithAddr(source)
+	if err != nil {
+		return Route{}, err
+	}
+	return Route{Interface: device, Source: source}, nil
+}
@@ -0,0 +1,27 @@
+package beacon
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSourceFor(t *testing.T) {
+	loopback := net.IP{127, 0, 0, 1}
+	source, err := NetworkContext{}.SourceFor(loopback, "")
+	if err != nil {
+		t.Fatalf("Failed to find a source for %s: %s", loopback, err)
+	}
+	if !source.Equal(loopback) {
+		t.Errorf("Expected %s to be sent from itself, got %s", loopback, source)
+	}
+
+	// the address of the "any" device used to be looked up, which has none
+	tc := &TransportChannel{deviceNames: []string{"any"}}
+	if source, err := tc.SourceFor(loopback); err != nil || !source.Equal(loopback) {
+		t.Errorf("Expected a TransportChannel listening on any to send to %s from itself, got %s (%v)", loopback, source, err)
+	}
+
+	if _, err := (NetworkContext{}).SourceFor(loopback, "beacon-missing0"); err == nil {
+		t.Errorf("Expected an error finding a source through an interface which doesn't exist")
+	}
+}
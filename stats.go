@@ -0,0 +1,88 @@
+package beacon
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// TransportStats holds the counters of the receive path of a TransportChannel.  Comparing CaptureDropped and
+// QueueDropped against zero tells whether packets were lost by beacon itself rather than by the network.
+type TransportStats struct {
+	// Received is the number of packets read from the capture handles
+	Received uint64
+	// Matched is the number of packets delivered to a registered hash or listener
+	Matched uint64
+	// Unmatched is the number of packets which nobody was waiting for
+	Unmatched uint64
+	// QueueDropped is the number of packets dropped because a subscription of beacon was full
+	QueueDropped uint64
+	// CaptureDropped is the number of packets the capture backend dropped before beacon read them, summed over devices
+	CaptureDropped int
+	// IfDropped is the number of packets the network interfaces dropped, summed over devices
+	IfDropped int
+	// LiveRegistrations is the number of hashes and rules currently waiting for a packet
+	LiveRegistrations int
+	// Devices holds the capture statistics of each handle
+	Devices []DeviceStats
+}
+
+// DeviceStats holds the capture statistics of a single capture handle
+type DeviceStats struct {
+	Device string
+	CaptureStats
+}
+
+// String returns a human readable summary of the stats
+func (s TransportStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "received %d, matched %d, unmatched %d, dropped by beacon %d, dropped by capture %d, dropped by interface %d, live registrations %d\n",
+		s.Received, s.Matched, s.Unmatched, s.QueueDropped, s.CaptureDropped, s.IfDropped, s.LiveRegistrations)
+	for _, device := range s.Devices {
+		fmt.Fprintf(&b, "Stats for device %v:\n %+v\n", device.Device, device.CaptureStats)
+	}
+	return b.String()
+}
+
+// receiveCounters are updated atomically by the receive path, and allocated separately so they stay 64 bit aligned
+type receiveCounters struct {
+	received     uint64
+	matched      uint64
+	unmatched    uint64
+	queueDropped uint64
+}
+
+// Stats returns the counters of the receive path, and the statistics of each capture handle.  If the statistics of
+// a handle could not be read the error is returned along with everything else.
+func (tc *TransportChannel) Stats() (TransportStats, error) {
+	stats := TransportStats{
+		Received:     atomic.LoadUint64(&tc.counters.received),
+		Matched:      atomic.LoadUint64(&tc.counters.matched),
+		Unmatched:    atomic.LoadUint64(&tc.counters.unmatched),
+		QueueDropped: atomic.LoadUint64(&tc.counters.queueDropped),
+	}
+	if tc.packetHashes != nil {
+		stats.LiveRegistrations = tc.LiveRegistrations()
+	}
+
+	var firstErr error
+	for i, handle := range tc.handles {
+		if i >= len(tc.handleDevices) {
+			return stats, fmt.Errorf("Could not find device name for handle")
+		}
+
+		captureStats, err := handle.CaptureStats()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("Encountered an error trying to produce handle stats for %s: %s", tc.handleDevices[i], err)
+			}
+			continue
+		}
+
+		stats.CaptureDropped += captureStats.PacketsDropped
+		stats.IfDropped += captureStats.PacketsIfDropped
+		stats.Devices = append(stats.Devices, DeviceStats{Device: tc.handleDevices[i], CaptureStats: captureStats})
+	}
+
+	return stats, firstErr
+}
@@ -0,0 +1,131 @@
+package beacon
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// newDispatchTestTransportChannel returns a TransportChannel with just enough set up to dispatch packets
+func newDispatchTestTransportChannel() *TransportChannel {
+	tc := &TransportChannel{
+		packetHashes: NewPacketHashMap(),
+		useListeners: true,
+		counters:     &receiveCounters{},
+	}
+	tc.packetHashes.AttachHasher(BoomerangPacketHasher{})
+	// the tests feed dispatch themselves, registering must not start capturing
+	tc.captureOnce.Do(func() {})
+	return tc
+}
+
+func TestDispatchCountsMatchedAndUnmatched(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+
+	idHash, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	packetChan := make(chan gopacket.Packet, 1)
+	tc.RegisterHash(string(idHash), packetChan)
+
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+
+	_, otherBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	dp.Decode(otherBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+
+	stats, err := tc.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %s", err)
+	}
+	if stats.Received != 2 || stats.Matched != 1 || stats.Unmatched != 1 || stats.QueueDropped != 0 {
+		t.Errorf("Expected 2 received, 1 matched and 1 unmatched, got %+v", stats)
+	}
+}
+
+func TestDispatchCountsQueueDrops(t *testing.T) {
+	// nobody is receiving from the listener, so its channel fills up after one packet
+	tc := newDispatchTestTransportChannel()
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	l := NewPersistentListener(func(p gopacket.Packet, id []byte) bool { return true })
+	l.matchChan = make(chan gopacket.Packet, 1)
+	tc.RegisterListener(l)
+
+	for i := 0; i < 3; i++ {
+		_, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+		dp.Decode(packetBytes, gopacket.CaptureInfo{})
+		tc.dispatch(dp)
+	}
+
+	stats, _ := tc.Stats()
+	if stats.Received != 3 || stats.QueueDropped != 2 || stats.Unmatched != 0 {
+		t.Errorf("Expected 3 received and 2 dropped by the full listener channel, got %+v", stats)
+	}
+}
+
+func TestDispatchHandsOffToUnbufferedHashChannel(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+
+	// nobody is receiving on the unbuffered channel yet, so the hand off finishes in the background
+	idHash, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	packetChan := make(chan gopacket.Packet)
+	tc.RegisterHash(string(idHash), packetChan)
+
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+
+	if p, ok := <-packetChan; !ok || p == nil {
+		t.Errorf("Expected the packet to be handed off to the unbuffered channel")
+	}
+	stats, _ := tc.Stats()
+	if stats.Matched != 1 || stats.QueueDropped != 0 {
+		t.Errorf("Expected 1 matched and none dropped, got %+v", stats)
+	}
+}
+
+func TestDispatchCountsListenerMatches(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	matchChan := tc.RegisterListener(NewListener(func(p gopacket.Packet, id []byte) bool { return true }))
+
+	_, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+
+	if p, ok := <-matchChan; !ok || p == nil {
+		t.Errorf("Expected the packet to be handed to the listener")
+	}
+	if _, ok := <-matchChan; ok {
+		t.Errorf("Expected the channel of a one-shot listener to be closed after its match")
+	}
+	stats, _ := tc.Stats()
+	if stats.Matched != 1 || stats.Unmatched != 0 || tc.ListenerCount() != 0 {
+		t.Errorf("Expected the listener match to be counted and the listener removed, got %+v and %d listeners", stats, tc.ListenerCount())
+	}
+}
+
+func TestDispatchExclusiveFilterHidesPacketFromListeners(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+	dp := NewDecodedPacket(layers.LayerTypeIPv4)
+	matchChan := tc.RegisterListener(NewListener(func(p gopacket.Packet, id []byte) bool { return true }))
+	matches := make(chan Match, 1)
+	if _, err := tc.Register(Rule{Filter: func(dp *DecodedPacket) bool { return true }, Priority: -1, Exclusive: true}, matches); err != nil {
+		t.Fatalf("Failed to register the filter rule: %s", err)
+	}
+
+	_, packetBytes := createTestIncomingBoomerangPacket(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2})
+	dp.Decode(packetBytes, gopacket.CaptureInfo{})
+	tc.dispatch(dp)
+
+	if _, ok := <-matches; !ok {
+		t.Errorf("Expected the exclusive filter rule to match")
+	}
+	select {
+	case <-matchChan:
+		t.Errorf("Expected the exclusive filter rule to keep the packet from the listener")
+	default:
+	}
+}
@@ -0,0 +1,56 @@
+package beacon
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Subscription is an independent feed of the packets captured by a TransportChannel.  Every subscription whose filter
+// matches a packet receives it, so subscribers don't compete with each other or with the hashes and listeners of the
+// TransportChannel.  A subscriber which falls behind loses packets from its own buffer only, see Dropped.
+type Subscription struct {
+	tc      *TransportChannel
+	reg     Registration
+	packets chan Match
+	rule    *filterRule
+}
+
+// Subscribe returns a subscription to the captured packets which match filter, or to every packet if filter is nil,
+// buffering up to buffer packets.  The subscription lasts until Unsubscribe is called or capture stops, after which
+// its channel is closed.
+func (tc *TransportChannel) Subscribe(filter Predicate, buffer int) (*Subscription, error) {
+	if buffer < 1 {
+		return nil, fmt.Errorf("a subscription requires a buffer of atleast 1, got %d", buffer)
+	}
+	if filter == nil {
+		filter = func(dp *DecodedPacket) bool { return true }
+	}
+
+	sub := &Subscription{tc: tc, packets: make(chan Match, buffer)}
+	reg, err := tc.Register(Rule{Filter: filter, Persistent: true}, sub.packets)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to subscribe: %s", err)
+	}
+	sub.reg = reg
+	sub.rule = tc.filters.find(reg.id)
+
+	return sub, nil
+}
+
+// Packets returns the channel the subscription delivers packets over
+func (s *Subscription) Packets() <-chan Match {
+	return s.packets
+}
+
+// Dropped returns the number of matching packets which were dropped because the buffer of the subscription was full
+func (s *Subscription) Dropped() uint64 {
+	if s.rule == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.rule.dropped)
+}
+
+// Unsubscribe stops the subscription and closes its channel.  It is safe to call more than once.
+func (s *Subscription) Unsubscribe() {
+	s.tc.Unregister(s.reg)
+}
@@ -0,0 +1,98 @@
+package beacon
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestSubscribersEachReceiveEveryPacket(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	first, err := tc.Subscribe(nil, 4)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %s", err)
+	}
+	second, err := tc.Subscribe(nil, 4)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		dispatchTestPacket(tc)
+	}
+
+	for name, sub := range map[string]*Subscription{"first": first, "second": second} {
+		if received := len(sub.Packets()); received != 3 {
+			t.Errorf("Expected the %s subscriber to receive all 3 packets, got %d", name, received)
+		}
+	}
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	wanted := net.IP{10, 0, 0, 7}
+	sub, err := tc.Subscribe(func(dp *DecodedPacket) bool { return dp.IPv4.SrcIP.Equal(wanted) }, 4)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %s", err)
+	}
+
+	for _, src := range []net.IP{{10, 0, 0, 1}, wanted, {10, 0, 0, 3}} {
+		_, packetBytes := createTestIncomingBoomerangPacket(src, net.IP{10, 0, 0, 2})
+		dp := NewDecodedPacket(layers.LayerTypeIPv4)
+		dp.Decode(packetBytes, gopacket.CaptureInfo{})
+		tc.dispatch(dp)
+	}
+
+	if received := len(sub.Packets()); received != 1 {
+		t.Fatalf("Expected only the packet from %s, got %d packets", wanted, received)
+	}
+	match := <-sub.Packets()
+	if src, _ := getSrcAndDstIP(match.Packet, true); !src.Equal(wanted) {
+		t.Errorf("Expected the packet from %s, got one from %s", wanted, src)
+	}
+}
+
+func TestSubscriptionCountsDrops(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	slow, _ := tc.Subscribe(nil, 1)
+	fast, _ := tc.Subscribe(nil, 4)
+
+	for i := 0; i < 3; i++ {
+		dispatchTestPacket(tc)
+	}
+
+	if dropped := slow.Dropped(); dropped != 2 {
+		t.Errorf("Expected the slow subscriber to drop 2 packets, got %d", dropped)
+	}
+	if dropped := fast.Dropped(); dropped != 0 {
+		t.Errorf("Expected the fast subscriber not to drop packets, got %d", dropped)
+	}
+	if len(fast.Packets()) != 3 {
+		t.Errorf("Expected the slow subscriber not to hold back the fast one")
+	}
+
+	stats, _ := tc.Stats()
+	if stats.QueueDropped != 2 {
+		t.Errorf("Expected the drops to be counted, got %+v", stats)
+	}
+}
+
+func TestUnsubscribeClosesPackets(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+
+	sub, _ := tc.Subscribe(nil, 1)
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+
+	if _, ok := <-sub.Packets(); ok {
+		t.Errorf("Expected the packets channel to be closed")
+	}
+	if live := tc.LiveRegistrations(); live != 0 {
+		t.Errorf("Expected no live registrations after unsubscribing, got %d", live)
+	}
+}
@@ -0,0 +1,156 @@
+package beacon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TimestampSource is the clock a transmit or receive timestamp was taken from
+type TimestampSource int
+
+const (
+	// UserspaceTimestamp is taken by beacon with time.Now() once the send syscall returns
+	UserspaceTimestamp TimestampSource = iota
+	// KernelTimestamp is taken by the kernel as the packet is handed to or received from the driver
+	KernelTimestamp
+	// HardwareTimestamp is taken by the NIC as the packet leaves or arrives on the wire
+	HardwareTimestamp
+)
+
+// String returns the string representation of a TimestampSource
+func (s TimestampSource) String() string {
+	switch s {
+	case UserspaceTimestamp:
+		return "userspace"
+	case KernelTimestamp:
+		return "kernel"
+	case HardwareTimestamp:
+		return "hardware"
+	}
+	return "unknown"
+}
+
+// ParseTimestampSource parses the string representation of a TimestampSource
+func ParseTimestampSource(s string) (TimestampSource, error) {
+	for _, source := range []TimestampSource{UserspaceTimestamp, KernelTimestamp, HardwareTimestamp} {
+		if s == source.String() {
+			return source, nil
+		}
+	}
+	return UserspaceTimestamp, fmt.Errorf("unknown timestamp source %q, expected userspace, kernel or hardware", s)
+}
+
+// lessPrecise returns the less precise of two timestamp sources
+func lessPrecise(a, b TimestampSource) TimestampSource {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// txTimestampTimeout is how long a send waits for the kernel to report its transmit timestamp before falling back
+// to a userspace timestamp
+const txTimestampTimeout = 100 * time.Millisecond
+
+// WithTimestamping requests transmit and receive timestamps from the given source, so that round trip times are not
+// skewed by scheduling delays in userspace.  Kernel timestamps use SO_TIMESTAMPING on the raw sockets, and hardware
+// timestamps additionally enable timestamping on the NIC of each listening interface.  Where the requested source is
+// unavailable for either transmit or receive, both use the next most precise one so that a round trip time never mixes
+// the clock of the NIC with the system clock, BoomerangPayload.Clock reports which one a probe ended up with.
+// Only supported on linux.
+func WithTimestamping(source TimestampSource) TransportChannelOption {
+	return func(tc *TransportChannel) error {
+		tc.timestampSource = source
+		return nil
+	}
+}
+
+// txTimestamp is the time a packet was sent, and the clock it was taken from
+type txTimestamp struct {
+	ts     time.Time
+	source TimestampSource
+}
+
+// txTimestamper collects the transmit timestamps the kernel reports for packets sent on a socket.  The kernel
+// numbers packets in the order they are sent, so sends on the socket must go through send to keep track of the ids.
+type txTimestamper struct {
+	lock    sync.Mutex
+	fd      int
+	source  TimestampSource
+	next    uint32
+	waiters map[uint32]chan txTimestamp
+	done    chan struct{}
+}
+
+// send calls sendFn, which returns how many packets it sent, with the lock held so that ids are assigned in the same
+// order the kernel assigns them.  If want is set a waiter is registered for each packet sent.  Returns the id of
+// the first packet sent.
+func (t *txTimestamper) send(want bool, sendFn func() (int, error)) (uint32, int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	first := t.next
+	sent, err := sendFn()
+	t.next += uint32(sent)
+
+	if want {
+		for id := first; id != t.next; id++ {
+			t.waiters[id] = make(chan txTimestamp, 1)
+		}
+	}
+
+	return first, sent, err
+}
+
+// wait waits for the timestamp of the packet with the given id.  A timestamp which was already delivered is returned
+// even if the timeout has passed.
+func (t *txTimestamper) wait(id uint32, timeout time.Duration) (txTimestamp, bool) {
+	t.lock.Lock()
+	waiter, ok := t.waiters[id]
+	t.lock.Unlock()
+	if !ok {
+		return txTimestamp{}, false
+	}
+
+	defer func() {
+		t.lock.Lock()
+		delete(t.waiters, id)
+		t.lock.Unlock()
+	}()
+
+	select {
+	case stamp := <-waiter:
+		return stamp, true
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case stamp := <-waiter:
+		return stamp, true
+	case <-timer.C:
+		return txTimestamp{}, false
+	}
+}
+
+// deliver hands a timestamp reported by the kernel to whoever is waiting on it
+func (t *txTimestamper) deliver(id uint32, stamp txTimestamp) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if waiter, ok := t.waiters[id]; ok {
+		select {
+		case waiter <- stamp:
+		default:
+			// a timestamp was already delivered for this packet
+		}
+	}
+}
+
+// close stops collecting timestamps, the socket itself is closed by its owner
+func (t *txTimestamper) close() {
+	close(t.done)
+}
@@ -0,0 +1,155 @@
+package beacon
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// constants from linux/net_tstamp.h which x/sys/unix doesn't define
+const (
+	hwtstampTxOn      = 1
+	hwtstampFilterAll = 1
+)
+
+// hwtstampConfig mirrors struct hwtstamp_config
+type hwtstampConfig struct {
+	flags    int32
+	txType   int32
+	rxFilter int32
+}
+
+// ifreqData mirrors struct ifreq with the ifr_data member of its union set
+type ifreqData struct {
+	name [unix.IFNAMSIZ]byte
+	data uintptr
+	_    [16]byte
+}
+
+// newTxTimestamper enables SO_TIMESTAMPING on a socket and starts collecting the transmit timestamps it reports
+func newTxTimestamper(fd int, source TimestampSource) (*txTimestamper, error) {
+	flags := unix.SOF_TIMESTAMPING_OPT_ID | unix.SOF_TIMESTAMPING_OPT_TSONLY
+	switch source {
+	case KernelTimestamp:
+		flags |= unix.SOF_TIMESTAMPING_TX_SOFTWARE | unix.SOF_TIMESTAMPING_SOFTWARE
+	case HardwareTimestamp:
+		flags |= unix.SOF_TIMESTAMPING_TX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE
+	default:
+		return nil, fmt.Errorf("unsupported timestamp source %s", source)
+	}
+
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPING, flags); err != nil {
+		return nil, fmt.Errorf("Failed to enable SO_TIMESTAMPING: %s", err)
+	}
+
+	t := &txTimestamper{
+		fd:      fd,
+		source:  source,
+		waiters: make(map[uint32]chan txTimestamp),
+		done:    make(chan struct{}),
+	}
+	go t.run()
+
+	return t, nil
+}
+
+// run reads transmit timestamps off the error queue of the socket until the timestamper is closed
+// or the socket is closed from under it
+func (t *txTimestamper) run() {
+	buf := make([]byte, 64)
+	oob := make([]byte, 512)
+	for {
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+
+		// the error queue is always polled for, so no events need to be requested
+		fds := []unix.PollFd{{Fd: int32(t.fd)}}
+		n, err := unix.Poll(fds, 100)
+		if err == unix.EINTR || n == 0 {
+			continue
+		} else if err != nil {
+			return
+		}
+
+		_, oobn, _, _, err := unix.Recvmsg(t.fd, buf, oob, unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return
+		}
+
+		id, stamp, ok := t.parse(oob[:oobn])
+		if ok {
+			t.deliver(id, stamp)
+		}
+	}
+}
+
+// parse extracts the packet id and timestamp from the control messages of an error queue message
+func (t *txTimestamper) parse(oob []byte) (uint32, txTimestamp, bool) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, txTimestamp{}, false
+	}
+
+	var id uint32
+	var stamp txTimestamp
+	foundID, foundStamp := false, false
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == unix.SOL_SOCKET && msg.Header.Type == unix.SCM_TIMESTAMPING:
+			// struct scm_timestamping holds the software, deprecated and raw hardware timestamps in that order
+			if len(msg.Data) < int(3*unsafe.Sizeof(unix.Timespec{})) {
+				continue
+			}
+			ts := (*[3]unix.Timespec)(unsafe.Pointer(&msg.Data[0]))
+			if t.source == HardwareTimestamp && (ts[2].Sec != 0 || ts[2].Nsec != 0) {
+				stamp = txTimestamp{ts: time.Unix(int64(ts[2].Sec), int64(ts[2].Nsec)).UTC(), source: HardwareTimestamp}
+				foundStamp = true
+			} else if ts[0].Sec != 0 || ts[0].Nsec != 0 {
+				stamp = txTimestamp{ts: time.Unix(int64(ts[0].Sec), int64(ts[0].Nsec)).UTC(), source: KernelTimestamp}
+				foundStamp = true
+			}
+		case (msg.Header.Level == unix.SOL_IP && msg.Header.Type == unix.IP_RECVERR) ||
+			(msg.Header.Level == unix.SOL_IPV6 && msg.Header.Type == unix.IPV6_RECVERR):
+			if len(msg.Data) < int(unsafe.Sizeof(unix.SockExtendedErr{})) {
+				continue
+			}
+			serr := (*unix.SockExtendedErr)(unsafe.Pointer(&msg.Data[0]))
+			if serr.Origin != unix.SO_EE_ORIGIN_TIMESTAMPING {
+				continue
+			}
+			id = serr.Data
+			foundID = true
+		}
+	}
+
+	return id, stamp, foundID && foundStamp
+}
+
+// enableHardwareTimestamping turns on transmit and receive timestamping in the NIC of a device
+func enableHardwareTimestamping(device string) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("Failed to create socket: %s", err)
+	}
+	defer unix.Close(fd)
+
+	config := hwtstampConfig{txType: hwtstampTxOn, rxFilter: hwtstampFilterAll}
+	ifr := ifreqData{data: uintptr(unsafe.Pointer(&config))}
+	if len(device) >= len(ifr.name) {
+		return fmt.Errorf("device name %s is too long", device)
+	}
+	copy(ifr.name[:], device)
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCSHWTSTAMP, uintptr(unsafe.Pointer(&ifr)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to enable hardware timestamping on %s: %s", device, errno)
+	}
+	return nil
+}
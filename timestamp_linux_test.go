@@ -0,0 +1,108 @@
+package beacon
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKernelTxTimestamps(t *testing.T) {
+	tc := newBatchTestTransportChannel(t, KernelTimestamp)
+	defer tc.Close()
+	defer syscall.Close(tc.socket6FD)
+
+	if tc.timestamper == nil {
+		t.Skipf("Skipping, SO_TIMESTAMPING is unavailable")
+	}
+
+	dst := &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 9}
+	before := time.Now()
+
+	stamp, err := tc.sendTo(createTestUDPPacket(t, dst, []byte("single")), dst.IP, true)
+	if err != nil {
+		t.Fatalf("Failed to send packet: %s", err)
+	}
+	if stamp.source != KernelTimestamp {
+		t.Errorf("Expected a kernel tx timestamp, got a %s one", stamp.source)
+	}
+	if stamp.ts.Before(before) || stamp.ts.After(time.Now()) {
+		t.Errorf("Kernel tx timestamp %s is outside of the send", stamp.ts)
+	}
+
+	batch := tc.NewTxBatch(3)
+	for i := 0; i < 3; i++ {
+		batch.Queue(createTestUDPPacket(t, dst, []byte("batched")), dst.IP)
+	}
+	for idx, err := range batch.Flush() {
+		if err != nil {
+			t.Fatalf("Failed to send packet %d: %s", idx, err)
+		}
+		ts, source := batch.Timestamp(idx)
+		if source != KernelTimestamp {
+			t.Errorf("Expected a kernel tx timestamp for packet %d, got a %s one", idx, source)
+		}
+		if ts.Before(before) || ts.After(time.Now()) {
+			t.Errorf("Kernel tx timestamp %s of packet %d is outside of the send", ts, idx)
+		}
+	}
+
+	// a plain send still consumes an id, the next timestamped send must not pick up its timestamp
+	if err := tc.SendTo(createTestUDPPacket(t, dst, []byte("plain")), dst.IP); err != nil {
+		t.Fatalf("Failed to send packet: %s", err)
+	}
+	stamp, err = tc.sendTo(createTestUDPPacket(t, dst, []byte("after")), dst.IP, true)
+	if err != nil || stamp.source != KernelTimestamp {
+		t.Errorf("Expected a kernel tx timestamp after a plain send, got %s (%v)", stamp.source, err)
+	}
+}
+
+func TestTxTimestampsFollowRxFallback(t *testing.T) {
+	// hardware timestamping was enabled on the NIC, but a capture handle fell back to kernel timestamps
+	tc := &TransportChannel{
+		socketFailureMsgQueue: make(chan int, 16),
+		timestampSource:       HardwareTimestamp,
+		rxTimestampSource:     KernelTimestamp,
+	}
+	tc.matchTxTimestamps()
+	if _, err := tc.setupSocket("IPv4"); err != nil {
+		t.Skipf("Skipping, raw sockets are unavailable: %s", err)
+	}
+	defer tc.Close()
+
+	if tc.timestamper == nil {
+		t.Skipf("Skipping, SO_TIMESTAMPING is unavailable")
+	}
+	if tc.timestamper.source != KernelTimestamp {
+		t.Errorf("Expected tx timestamps to follow the rx fallback to kernel timestamps, got %s", tc.timestamper.source)
+	}
+}
+
+func TestRxTimestampsFollowTxFallback(t *testing.T) {
+	// the capture handles took hardware timestamps, but no tx timestamper could be set up
+	tc := &TransportChannel{
+		snaplen:           4800,
+		bufferSize:        1024 * 1024,
+		deviceNames:       []string{"lo"},
+		timeout:           100,
+		backend:           AFPacketBackend,
+		timestampSource:   HardwareTimestamp,
+		rxTimestampSource: HardwareTimestamp,
+	}
+	if err := tc.matchRxTimestamps(); err != nil {
+		t.Skipf("Skipping, capture handles are unavailable: %s", err)
+	}
+	defer tc.closeHandles()
+
+	if len(tc.handles) == 0 {
+		t.Fatalf("Expected the capture handles to be reopened")
+	}
+	if tc.timestampSource != UserspaceTimestamp || tc.rxTimestampSource != UserspaceTimestamp {
+		t.Errorf("Expected rx timestamps to follow the tx fallback to userspace timestamps, got %s tx and %s rx", tc.timestampSource, tc.rxTimestampSource)
+	}
+	for idx, handle := range tc.handles {
+		if source := handle.RxTimestampSource(); source == HardwareTimestamp {
+			t.Errorf("Expected handle %d to stop taking hardware timestamps", idx)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package beacon
+
+import (
+	"errors"
+)
+
+var errTimestampingUnsupported = errors.New("kernel and hardware timestamps are only supported on linux")
+
+func newTxTimestamper(fd int, source TimestampSource) (*txTimestamper, error) {
+	return nil, errTimestampingUnsupported
+}
+
+func enableHardwareTimestamping(device string) error {
+	return errTimestampingUnsupported
+}
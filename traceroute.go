@@ -8,6 +8,17 @@ import (
 // Traceroute between specified source and destination devices
 // sourceIP needs to be provided if source device is in a different Autonomous System and source IP cannot be determined automatically
 func Traceroute(destinationIP string, sourceIP string, timeout int, interfaceDevice string) ([]string, error) {
+	return TracerouteWithAnnotator(destinationIP, sourceIP, timeout, interfaceDevice, NewReverseDNS(0))
+}
+
+// TracerouteWithAnnotator performs a Traceroute, naming the destination and hops with annotator
+func TracerouteWithAnnotator(destinationIP string, sourceIP string, timeout int, interfaceDevice string, annotator HopAnnotator) ([]string, error) {
+	return TracerouteInNetwork(destinationIP, sourceIP, timeout, interfaceDevice, annotator, NetworkContext{})
+}
+
+// TracerouteInNetwork performs a Traceroute from within a network namespace and VRF, naming the destination and hops
+// with annotator
+func TracerouteInNetwork(destinationIP string, sourceIP string, timeout int, interfaceDevice string, annotator HopAnnotator, network NetworkContext) ([]string, error) {
 
 	var destIP net.IP = net.ParseIP(destinationIP)
 
@@ -18,15 +29,14 @@ func Traceroute(destinationIP string, sourceIP string, timeout int, interfaceDev
 
 	route := make([]string, 0)
 
-	destHostname, err := net.LookupAddr(destIP.String())
-	if err != nil {
+	if destName := annotator.Annotate(destIP).String(); destName == "" {
 		fmt.Printf("Doing traceroute to %s\n", destIP)
 	} else {
-		fmt.Printf("Doing traceroute to %s (%s)\n", destHostname[0], destIP)
+		fmt.Printf("Doing traceroute to %s (%s)\n", destName, destIP)
 	}
 
 	if interfaceDevice == "" {
-		discoveredOutboundInterface, err := GetInterfaceDeviceFromDestIP(destIP)
+		discoveredOutboundInterface, err := network.GetInterfaceDeviceFromDestIP(destIP)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to find an interface for %s: %s, explicitly provide an interface with -i", destIP.String(), err)
 		}
@@ -39,6 +49,7 @@ func Traceroute(destinationIP string, sourceIP string, timeout int, interfaceDev
 		WithHasher(V6TraceRouteHasher{}),
 		WithInterface(interfaceDevice),
 		WithTimeout(100),
+		WithNetworkContext(network),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("Error creating transport channel: %s", err)
@@ -48,7 +59,7 @@ func Traceroute(destinationIP string, sourceIP string, timeout int, interfaceDev
 	if len(sourceIP) > 0 {
 		srcIP = net.ParseIP(sourceIP)
 	} else {
-		srcIP, _ = FindSourceIPForDest(destIP)
+		srcIP, _ = tc.SourceFor(destIP)
 	}
 	route = append(route, srcIP.String())
 
@@ -58,23 +69,22 @@ func Traceroute(destinationIP string, sourceIP string, timeout int, interfaceDev
 	}
 
 	hopIdx := 1
-	for hop := range pc {
+	for hop := range AnnotatePathChannel(annotator, pc) {
 		fmt.Printf("%d: ", hopIdx)
 		hopIdx++
 
-		if hop == nil {
+		if hop.IP == nil {
 			fmt.Println("*")
 			route = append(route, "*")
 			continue
 		}
 
-		var hostname = "Unknown"
-		hostnames, err := net.LookupAddr(hop.String())
-		if err == nil && len(hostnames) > 0 {
-			hostname = hostnames[0]
+		var name = "Unknown"
+		if annotated := hop.Annotation.String(); annotated != "" {
+			name = annotated
 		}
-		fmt.Printf("%s (%s)\n", hostname, hop.String())
-		route = append(route, fmt.Sprintf("%s (%s)\n", hostname, hop.String()))
+		fmt.Printf("%s (%s)\n", name, hop.IP.String())
+		route = append(route, fmt.Sprintf("%s (%s)\n", name, hop.IP.String()))
 	}
 
 	return route, nil
@@ -24,9 +24,16 @@ type BoomerangResult struct {
 // this struct is designed to be JSON unmarshalled from the IP payload in the boomerang packet
 type BoomerangPayload struct {
 	DestIP      net.IP
+	Mode        ProbeMode
 	ID          uuid.UUID
 	TxTimestamp time.Time
 	RxTimestamp time.Time
+	// Clock is the least precise of the clocks TxTimestamp and RxTimestamp were taken from, see WithTimestamping
+	Clock TimestampSource
+	// RxInterface is the interface the probe came back on, empty if it timed out or the interface is unknown
+	RxInterface string
+	// TxInterface is the interface the probe was sent out of, empty if the routing table picked it
+	TxInterface string
 }
 
 // BoomerangErrorType is an enum of possible errors encountered during a run of boomerang
@@ -38,13 +45,143 @@ const (
 	sendError BoomerangErrorType = iota
 )
 
+// The BoomerangErrorTypes, for code outside of beacon which rebuilds results, such as the rpc client
+const (
+	BoomerangTimedOut  = timedOut
+	BoomerangFatal     = fatal
+	BoomerangSendError = sendError
+)
+
+// ProbeMode selects which legs of a boomerang are pinned to the probed path
+type ProbeMode int
+
+const (
+	// RoundTrip pins both the outbound and the return leg to the path
+	RoundTrip ProbeMode = iota
+	// ForwardPinned pins the outbound leg to the path and lets the return leg take the native route
+	ForwardPinned
+	// ReversePinned lets the outbound leg take the native route and pins the return leg to the path
+	ReversePinned
+	// Native lets both legs take the native route between the first and last hop of the path
+	Native
+)
+
+// ProbeModes lists every ProbeMode, in the order they are sent by ProbeEachHopOfPathDirectional
+var ProbeModes = []ProbeMode{RoundTrip, ForwardPinned, ReversePinned, Native}
+
+// String returns the string representation of a ProbeMode
+func (m ProbeMode) String() string {
+	switch m {
+	case RoundTrip:
+		return "round trip"
+	case ForwardPinned:
+		return "forward pinned"
+	case ReversePinned:
+		return "reverse pinned"
+	case Native:
+		return "native"
+	}
+	return "unknown"
+}
+
+// ProbeOption configures the packets sent by a probe
+type ProbeOption func(*probeConfig) error
+
+// probeConfig holds the settings ProbeOptions apply to each boomerang of a probe
+type probeConfig struct {
+	dscp            uint8
+	egressInterface string
+	sourceIP        net.IP
+	stop            <-chan struct{}
+}
+
+// WithDSCP marks every IP header of the probe packets with dscp, so that the probes are queued like the traffic of
+// that class on every leg of the path
+func WithDSCP(dscp uint8) ProbeOption {
+	return func(cfg *probeConfig) error {
+		if dscp > 63 {
+			return fmt.Errorf("DSCP must be between 0 and 63, got %d", dscp)
+		}
+		cfg.dscp = dscp
+		return nil
+	}
+}
+
+// WithEgressInterface sends the probe packets out of an interface, with a socket bound to it, instead of the one the
+// routing table picks for the first hop.  Only supported on linux.
+func WithEgressInterface(device string) ProbeOption {
+	return func(cfg *probeConfig) error {
+		if device == "" {
+			return errors.New("egress interface must not be empty")
+		}
+		cfg.egressInterface = device
+		return nil
+	}
+}
+
+// WithSourceIP sends the probe from a source address in place of the first hop of its path, which is where the
+// probe comes back to
+func WithSourceIP(source net.IP) ProbeOption {
+	return func(cfg *probeConfig) error {
+		if source == nil {
+			return errors.New("source IP must not be nil")
+		}
+		cfg.sourceIP = source
+		return nil
+	}
+}
+
+// WithStop stops sending probe packets once stop is closed.  The packets in flight are still awaited, and the result
+// channel is closed after them.
+func WithStop(stop <-chan struct{}) ProbeOption {
+	return func(cfg *probeConfig) error {
+		cfg.stop = stop
+		return nil
+	}
+}
+
+// stopped returns whether the probe was stopped
+func (cfg probeConfig) stopped() bool {
+	return isClosed(cfg.stop)
+}
+
+func newProbeConfig(options []ProbeOption) (probeConfig, error) {
+	var cfg probeConfig
+	for _, option := range options {
+		if err := option(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// buildPacket serializes a boomerang packet for the given path according to the mode, and returns
+// the IP the packet must first be sent to
+func (m ProbeMode) buildPacket(path Path, payload []byte, buf gopacket.SerializeBuffer) (net.IP, error) {
+	if len(path) < 2 {
+		return nil, errors.New("Path must have atleast 2 hops")
+	}
+
+	switch m {
+	case RoundTrip:
+		return path[1], CreateRoundTripPacketForPath(path, payload, buf)
+	case ForwardPinned:
+		return path[1], CreateForwardPacketForPath(path, payload, buf)
+	case ReversePinned:
+		return path[len(path)-1], CreateReversePacketForPath(path, payload, buf)
+	case Native:
+		return path[len(path)-1], CreateRoundTripPacketForPath(Path{path[0], path[len(path)-1]}, payload, buf)
+	}
+	return nil, fmt.Errorf("unknown probe mode %d", m)
+}
+
 // IsFatal returns true if the error is fatal, otherwise returns false
 func (b *BoomerangResult) IsFatal() bool {
 	return b.ErrorType == fatal
 }
 
 // DiscoverAndProbe first runs a traceroute from source to destination, then probes packets over the discovered path.
-func (tc *TransportChannel) DiscoverAndProbe(src, dst net.IP, numPackets, timeout int) (<-chan BoomerangResult, error) {
+func (tc *TransportChannel) DiscoverAndProbe(src, dst net.IP, numPackets, timeout int, options ...ProbeOption) (<-chan BoomerangResult, error) {
 
 	tracerouteTC, err := NewTransportChannel(
 		WithInterface("any"),
@@ -52,6 +189,7 @@ func (tc *TransportChannel) DiscoverAndProbe(src, dst net.IP, numPackets, timeou
 		WithHasher(V4TraceRouteHasher{}),
 		WithHasher(V6TraceRouteHasher{}),
 		UseListeners(false),
+		WithNetworkContext(tc.network),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create TransportChannel for traceroute: %s", err)
@@ -64,7 +202,7 @@ func (tc *TransportChannel) DiscoverAndProbe(src, dst net.IP, numPackets, timeou
 
 	tracerouteTC.Close()
 
-	srcIP, err := FindSourceIPForDest(dst)
+	srcIP, err := tc.SourceFor(dst)
 	if err != nil {
 		return nil, err
 	}
@@ -73,12 +211,12 @@ func (tc *TransportChannel) DiscoverAndProbe(src, dst net.IP, numPackets, timeou
 	path = append(prePath, path...)
 	log.Printf("found path: %v\n", path)
 
-	return tc.ProbeEachHopOfPath(path, numPackets, timeout), nil
+	return tc.ProbeEachHopOfPath(path, numPackets, timeout, options...), nil
 }
 
 // ProbeEachHopOfPath probes each hop in a path, but accepts a transport channel as an argument.  This allows the caller to share
 // one transport channel between many calls to Probe.  The supplied tranport channel must have a BPFFilter of "ip proto 4"
-func (tc *TransportChannel) ProbeEachHopOfPath(path Path, numPackets int, timeout int) <-chan BoomerangResult {
+func (tc *TransportChannel) ProbeEachHopOfPath(path Path, numPackets int, timeout int, options ...ProbeOption) <-chan BoomerangResult {
 	if !strings.Contains(tc.filter, "ip") && !strings.Contains(tc.filter, "ip6") {
 		resultChan := make(chan BoomerangResult)
 
@@ -92,7 +230,7 @@ func (tc *TransportChannel) ProbeEachHopOfPath(path Path, numPackets int, timeou
 
 	resultChannels := make([]chan BoomerangResult, len(path)-1)
 	for i := 2; i <= len(path); i++ {
-		resultChannels[i-2] = tc.Probe(path[0:i], numPackets, timeout)
+		resultChannels[i-2] = tc.Probe(path[0:i], numPackets, timeout, options...)
 	}
 
 	return Merge(resultChannels...)
@@ -100,7 +238,7 @@ func (tc *TransportChannel) ProbeEachHopOfPath(path Path, numPackets int, timeou
 
 // ProbeEachHopOfPathSync synchronously probes each hop in a path.  That is, it waits for each round of packets to come
 // back from each hop before sending the next round
-func (tc *TransportChannel) ProbeEachHopOfPathSync(path Path, numPackets int, timeout int) <-chan BoomerangResult {
+func (tc *TransportChannel) ProbeEachHopOfPathSync(path Path, numPackets int, timeout int, options ...ProbeOption) <-chan BoomerangResult {
 	if !strings.Contains(tc.filter, "ip") && !strings.Contains(tc.filter, "ip6") {
 		resultChan := make(chan BoomerangResult)
 
@@ -114,15 +252,18 @@ func (tc *TransportChannel) ProbeEachHopOfPathSync(path Path, numPackets int, ti
 
 	resultChan := make(chan BoomerangResult)
 
+	// an invalid option is reported by every boomerang, so its error doesn't need checking here
+	cfg, _ := newProbeConfig(options)
+
 	go func() {
 		defer close(resultChan)
-		for packetCount := 1; packetCount <= numPackets; packetCount++ {
+		for packetCount := 1; packetCount <= numPackets && !cfg.stopped(); packetCount++ {
 			var wg sync.WaitGroup
 			wg.Add(len(path) - 1)
 
 			for i := 2; i <= len(path); i++ {
 				go func(idx int) {
-					resultChan <- tc.Boomerang(path[0:idx], timeout)
+					resultChan <- tc.Boomerang(path[0:idx], timeout, options...)
 					wg.Done()
 				}(i)
 			}
@@ -135,13 +276,79 @@ func (tc *TransportChannel) ProbeEachHopOfPathSync(path Path, numPackets int, ti
 	return resultChan
 }
 
+// ProbeEachHopOfPathDirectional probes each hop in a path with every ProbeMode.  Comparing the success rate of the
+// pinned legs against the native ones allows loss to be attributed to the forward or reverse direction of a link,
+// see InferLossDirection.
+func (tc *TransportChannel) ProbeEachHopOfPathDirectional(path Path, numPackets int, timeout int, options ...ProbeOption) <-chan BoomerangResult {
+	if !strings.Contains(tc.filter, "ip") && !strings.Contains(tc.filter, "ip6") {
+		resultChan := make(chan BoomerangResult)
+
+		go func() {
+			errMsg := fmt.Sprintf("The supplied TransportChannel must contain an ip or ip6 BPFFilter. The supplied filter was: %s\n", tc.filter)
+			resultChan <- BoomerangResult{Err: fmt.Errorf(errMsg), ErrorType: fatal}
+		}()
+
+		return resultChan
+	}
+
+	resultChannels := make([]chan BoomerangResult, 0, len(ProbeModes)*(len(path)-1))
+	for i := 2; i <= len(path); i++ {
+		for _, mode := range ProbeModes {
+			resultChannels = append(resultChannels, tc.ProbeWithMode(path[0:i], mode, numPackets, timeout, options...))
+		}
+	}
+
+	return Merge(resultChannels...)
+}
+
+// ProbeEachHopOfPathBatched probes each hop in a path like ProbeEachHopOfPath, but sends one packet to every hop per
+// round with a single TxBatch.  Each round waits for every packet of the previous round to come back or time out, so
+// every hop has at most one packet in flight just like ProbeEachHopOfPath.
+func (tc *TransportChannel) ProbeEachHopOfPathBatched(path Path, numPackets int, timeout int, options ...ProbeOption) <-chan BoomerangResult {
+	if !strings.Contains(tc.filter, "ip") && !strings.Contains(tc.filter, "ip6") {
+		resultChan := make(chan BoomerangResult)
+
+		go func() {
+			errMsg := fmt.Sprintf("The supplied TransportChannel must contain an ip or ip6 BPFFilter. The supplied filter was: %s\n", tc.filter)
+			resultChan <- BoomerangResult{Err: fmt.Errorf(errMsg), ErrorType: fatal}
+		}()
+
+		return resultChan
+	}
+
+	paths := make([]Path, 0, len(path)-1)
+	for i := 2; i <= len(path); i++ {
+		paths = append(paths, path[0:i])
+	}
+
+	resultChan := make(chan BoomerangResult)
+	cfg, _ := newProbeConfig(options)
+
+	go func() {
+		defer close(resultChan)
+		for packetCount := 1; packetCount <= numPackets && !cfg.stopped(); packetCount++ {
+			for _, result := range tc.BoomerangBatch(paths, RoundTrip, timeout, options...) {
+				resultChan <- result
+			}
+		}
+	}()
+
+	return resultChan
+}
+
 // Probe generates traffic over a given path and returns a channel of boomerang results
-func (tc *TransportChannel) Probe(path Path, numPackets int, timeout int) chan BoomerangResult {
+func (tc *TransportChannel) Probe(path Path, numPackets int, timeout int, options ...ProbeOption) chan BoomerangResult {
+	return tc.ProbeWithMode(path, RoundTrip, numPackets, timeout, options...)
+}
+
+// ProbeWithMode generates traffic over a given path using the given ProbeMode and returns a channel of boomerang results
+func (tc *TransportChannel) ProbeWithMode(path Path, mode ProbeMode, numPackets int, timeout int, options ...ProbeOption) chan BoomerangResult {
 	resultChan := make(chan BoomerangResult)
+	cfg, _ := newProbeConfig(options)
 
 	go func() {
-		for i := 1; i <= numPackets; i++ {
-			result := tc.Boomerang(path, timeout)
+		for i := 1; i <= numPackets && !cfg.stopped(); i++ {
+			result := tc.BoomerangWithMode(path, mode, timeout, options...)
 			resultChan <- result
 		}
 		close(resultChan)
@@ -152,17 +359,15 @@ func (tc *TransportChannel) Probe(path Path, numPackets int, timeout int) chan B
 
 // Boomerang sends one packet which "boomerangs" over a given path.  For example, if the path is A,B,C,D the packet will travel
 // A -> B -> C -> D -> C -> B -> A
-func (tc *TransportChannel) Boomerang(path Path, timeout int) BoomerangResult {
-	resultChan := make(chan BoomerangResult)
-
-	id := uuid.New()
-	tagString := []byte("moby")
-	idMarshalled, _ := id.MarshalBinary() // no error is possible, this is just `return u[:], nil`
-	idBytes := append(tagString, idMarshalled...)
-	idHash := string(idBytes)
+func (tc *TransportChannel) Boomerang(path Path, timeout int, options ...ProbeOption) BoomerangResult {
+	return tc.BoomerangWithMode(path, RoundTrip, timeout, options...)
+}
 
-	buf := gopacket.NewSerializeBuffer()
-	err := CreateRoundTripPacketForPath(path, idBytes, buf)
+// BoomerangWithMode sends one packet over a given path, pinning the legs selected by mode to the path.  For example,
+// if the path is A,B,C,D and the mode is ForwardPinned, the packet will travel A -> B -> C -> D and then take whatever
+// route D uses to reach A.
+func (tc *TransportChannel) BoomerangWithMode(path Path, mode ProbeMode, timeout int, options ...ProbeOption) BoomerangResult {
+	b, err := newBoomerang(path, mode, options)
 	if err != nil {
 		return BoomerangResult{
 			Err:       err,
@@ -170,63 +375,203 @@ func (tc *TransportChannel) Boomerang(path Path, timeout int) BoomerangResult {
 		}
 	}
 
-	packetMatchChan := make(chan gopacket.Packet, 1)
-	tc.RegisterHash(idHash, packetMatchChan)
+	tc.RegisterHashWithTimeout(b.hash, b.match, time.Duration(timeout)*time.Second)
 
-	go func() {
-		timeOutDuration := time.Duration(timeout) * time.Second
-		timer := time.NewTimer(timeOutDuration)
+	stamp, err := b.send(tc)
+	if err != nil {
+		log.Printf("error in SendTo: %s\n", err)
+		tc.UnregisterHash(b.hash)
+		return b.sendFailed(err)
+	}
 
-		packetData := buf.Bytes()
+	return b.await(tc, stamp)
+}
 
-		err := tc.SendToPath(packetData, path)
+// BoomerangBatch sends one packet over each of the given paths with a single TxBatch, and waits for all of them
+// to come back.  The results are in the same order as the paths, a packet which could not be sent is reported
+// as a send error in the result for its path.
+func (tc *TransportChannel) BoomerangBatch(paths []Path, mode ProbeMode, timeout int, options ...ProbeOption) []BoomerangResult {
+	results := make([]BoomerangResult, len(paths))
+	boomerangs := make([]*boomerang, len(paths))
+	slots := make([]int, len(paths))
+	batch := tc.NewTxBatch(len(paths))
+
+	for idx, path := range paths {
+		b, err := newBoomerang(path, mode, options)
 		if err != nil {
-			log.Printf("error in SendToPath: %s\n", err)
-			tc.UnregisterHash(idHash)
-
-			resultChan <- BoomerangResult{
+			results[idx] = BoomerangResult{
 				Err:       err,
-				ErrorType: sendError,
-				Payload: BoomerangPayload{
-					DestIP: path[len(path)-1],
-				},
+				ErrorType: fatal,
 			}
-			return
+			continue
 		}
-		txTimestamp := time.Now().UTC()
 
-		select {
-		case matchedPacket := <-packetMatchChan:
-			// extract the rx timestamp from the packet metadta
-			packetMetadata := matchedPacket.Metadata()
+		tc.RegisterHashWithTimeout(b.hash, b.match, time.Duration(timeout)*time.Second)
+		boomerangs[idx] = b
+		if b.egress == "" {
+			slots[idx] = batch.Queue(b.packetData, b.firstHop)
+		}
+	}
 
-			payload := BoomerangPayload{
-				ID:          id,
-				DestIP:      path[len(path)-1],
-				TxTimestamp: txTimestamp,
-				RxTimestamp: packetMetadata.CaptureInfo.Timestamp,
-			}
+	// the batch sends on the shared sockets, so a boomerang bound to an interface is sent on its own
+	egressStamps := make(map[int]txTimestamp)
+	for idx, b := range boomerangs {
+		if b == nil || b.egress == "" {
+			continue
+		}
+		stamp, err := b.send(tc)
+		if err != nil {
+			log.Printf("error in SendTo: %s\n", err)
+			tc.UnregisterHash(b.hash)
+			results[idx] = b.sendFailed(err)
+			boomerangs[idx] = nil
+			continue
+		}
+		egressStamps[idx] = stamp
+	}
 
-			result := BoomerangResult{
-				Payload: payload,
-			}
+	errs := batch.Flush()
 
-			result.Payload.TxTimestamp = txTimestamp
-			resultChan <- result
-		case <-timer.C:
-			tc.UnregisterHash(idHash)
-			resultChan <- BoomerangResult{
-				Payload: BoomerangPayload{
-					ID:          id,
-					DestIP:      path[len(path)-1],
-					TxTimestamp: txTimestamp,
-					RxTimestamp: time.Now().UTC(),
-				},
-				Err:       errors.New("timed out waiting for packet from " + path[len(path)-1].String()),
-				ErrorType: timedOut,
-			}
+	// the registrations expire on their own, so the boomerangs can be awaited one after another without a timer or
+	// goroutine each
+	for idx, b := range boomerangs {
+		if b == nil {
+			continue
 		}
-	}()
 
-	return <-resultChan
+		if stamp, ok := egressStamps[idx]; ok {
+			results[idx] = b.await(tc, stamp)
+			continue
+		}
+
+		if err := errs[slots[idx]]; err != nil {
+			log.Printf("error in batched send: %s\n", err)
+			tc.UnregisterHash(b.hash)
+			results[idx] = b.sendFailed(err)
+			continue
+		}
+
+		var stamp txTimestamp
+		stamp.ts, stamp.source = batch.Timestamp(slots[idx])
+
+		results[idx] = b.await(tc, stamp)
+	}
+
+	return results
+}
+
+// boomerang is a single boomerang packet which has been built but not yet sent
+type boomerang struct {
+	path       Path
+	mode       ProbeMode
+	id         uuid.UUID
+	hash       string
+	packetData []byte
+	firstHop   net.IP
+	// egress is the interface the packet is sent out of, empty to let the routing table pick
+	egress string
+	match  chan gopacket.Packet
+}
+
+func newBoomerang(path Path, mode ProbeMode, options []ProbeOption) (*boomerang, error) {
+	cfg, err := newProbeConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.sourceIP != nil && len(path) > 0 {
+		if (cfg.sourceIP.To4() == nil) != (path[0].To4() == nil) {
+			return nil, fmt.Errorf("source IP %s is not of the same family as %s", cfg.sourceIP, path[0])
+		}
+		path = append(Path{cfg.sourceIP}, path[1:]...)
+	}
+
+	id := uuid.New()
+	tagString := []byte("moby")
+	idMarshalled, _ := id.MarshalBinary() // no error is possible, this is just `return u[:], nil`
+	idBytes := append(tagString, idMarshalled...)
+
+	buf := gopacket.NewSerializeBuffer()
+	firstHop, err := mode.buildPacket(path, idBytes, buf)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.dscp != 0 {
+		if err := setDSCP(buf.Bytes(), cfg.dscp); err != nil {
+			return nil, err
+		}
+	}
+
+	return &boomerang{
+		path:       path,
+		mode:       mode,
+		id:         id,
+		hash:       string(idBytes),
+		packetData: buf.Bytes(),
+		firstHop:   firstHop,
+		egress:     cfg.egressInterface,
+		match:      make(chan gopacket.Packet, 1),
+	}, nil
+}
+
+// send sends the boomerang out of its egress interface, or the shared socket if it doesn't have one
+func (b *boomerang) send(tc *TransportChannel) (txTimestamp, error) {
+	if b.egress != "" {
+		return tc.sendOut(b.packetData, b.firstHop, b.egress)
+	}
+	return tc.sendTo(b.packetData, b.firstHop, true)
+}
+
+// sendFailed returns the result for a boomerang which could not be sent
+func (b *boomerang) sendFailed(err error) BoomerangResult {
+	return BoomerangResult{
+		Err:       err,
+		ErrorType: sendError,
+		Payload: BoomerangPayload{
+			DestIP:      b.path[len(b.path)-1],
+			Mode:        b.mode,
+			TxInterface: b.egress,
+		},
+	}
+}
+
+// await waits for a sent boomerang to come back, or for its hash registration to expire
+func (b *boomerang) await(tc *TransportChannel, tx txTimestamp) BoomerangResult {
+	matchedPacket, ok := <-b.match
+	if !ok {
+		return BoomerangResult{
+			Payload: BoomerangPayload{
+				ID:          b.id,
+				DestIP:      b.path[len(b.path)-1],
+				Mode:        b.mode,
+				TxTimestamp: tx.ts,
+				TxInterface: b.egress,
+				RxTimestamp: time.Now().UTC(),
+				Clock:       UserspaceTimestamp,
+			},
+			Err:       errors.New("timed out waiting for packet from " + b.path[len(b.path)-1].String()),
+			ErrorType: timedOut,
+		}
+	}
+
+	// extract the rx timestamp from the packet metadta
+	packetMetadata := matchedPacket.Metadata()
+	rxTimestamp, clock := packetMetadata.CaptureInfo.Timestamp, lessPrecise(tx.source, tc.rxTimestampSource)
+	if tc.rxTimestampSource == HardwareTimestamp && tx.source != HardwareTimestamp {
+		// the tx timestamp of the packet was lost and fell back to the system clock, which can't be compared with
+		// the clock of the NIC
+		rxTimestamp, clock = time.Now().UTC(), UserspaceTimestamp
+	}
+
+	return BoomerangResult{
+		Payload: BoomerangPayload{
+			ID:          b.id,
+			DestIP:      b.path[len(b.path)-1],
+			Mode:        b.mode,
+			TxTimestamp: tx.ts,
+			RxTimestamp: rxTimestamp,
+			Clock:       clock,
+			RxInterface: tc.InterfaceName(packetMetadata.CaptureInfo.InterfaceIndex),
+			TxInterface: b.egress,
+		},
+	}
 }
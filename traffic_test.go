@@ -8,6 +8,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func createTestIncomingBoomerangPacket(sourceIP, destIP net.IP) ([]byte, []byte) {
@@ -181,3 +182,26 @@ func BenchmarkV6FindSourceIPForDest(b *testing.B) {
 		}
 	}
 }
+
+func TestProbeWithStop(t *testing.T) {
+	tc := newDispatchTestTransportChannel()
+	tc.filter = "ip"
+	path := Path{net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}, net.IP{10, 0, 0, 3}}
+
+	stop := make(chan struct{})
+	close(stop)
+	for name, results := range map[string]<-chan BoomerangResult{
+		"Probe":                     tc.Probe(path, 5, 1, WithStop(stop)),
+		"ProbeEachHopOfPath":        tc.ProbeEachHopOfPath(path, 5, 1, WithStop(stop)),
+		"ProbeEachHopOfPathBatched": tc.ProbeEachHopOfPathBatched(path, 5, 1, WithStop(stop)),
+	} {
+		select {
+		case res, ok := <-results:
+			if ok {
+				t.Errorf("Expected %s not to send after it was stopped, got %+v", name, res)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Expected %s to close its results once stopped", name)
+		}
+	}
+}
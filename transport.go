@@ -6,36 +6,48 @@ import (
 	"io"
 	"math/rand"
 	"net"
-	"os/exec"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
-
-	"github.com/google/gopacket"
-	"github.com/google/gopacket/pcap"
 )
 
 // TransportChannel is a struct which facilitates packet tx/rx
 type TransportChannel struct {
-	handles                []*pcap.Handle
-	packetSources          []*gopacket.PacketSource
-	packetHashes           *packetHashMap
-	listenerMap            *ListenerMap
-	portLock               sync.Mutex
-	packets                chan gopacket.Packet
+	handles        []captureHandle
+	handleDevices  []string
+	interfaceNames sync.Map
+	packetHashes   *packetHashMap
+	filters        filterRules
+	portLock       sync.Mutex
+	captureOnce    sync.Once
+	// socketLock guards the shared sockets and their timestampers, which are replaced when a send on them fails
+	socketLock             sync.RWMutex
 	socketFD               int
 	socketFailureMsgQueue  chan int
 	socket6FD              int
 	socket6FailureMsgQueue chan int
 	deviceNames            []string
+	discoverer             InterfaceDiscoverer
 	snaplen                int
 	bufferSize             int
 	srcPortOffset          int
+	echoIDs                uint32
 	dstPortOffset          int
 	filter                 string
 	timeout                int
 	useListeners           bool
+	backend                CaptureBackend
+	fanoutGroup            uint16
+	fanoutSockets          int
+	timestampSource        TimestampSource
+	rxTimestampSource      TimestampSource
+	timestamper            *txTimestamper
+	timestamper6           *txTimestamper
+	egressSockets          egressSockets
+	network                NetworkContext
+	handleIndexes          []int
+	counters               *receiveCounters
 }
 
 // TransportChannelOption modifies a TransportChannel struct
@@ -51,37 +63,15 @@ func WithBPFFilter(filter string) TransportChannelOption {
 	}
 }
 
-// WithInterface constructs an option to set the outbound interface to use for tx/rx
+// WithInterface constructs an option to set the outbound interface to use for tx/rx.  "bsdany" listens on every
+// interface with an ISIS adjacency on a Junos device, see JunosISISAdjacencies.
 func WithInterface(device string) TransportChannelOption {
+	if device == bsdanyDevice {
+		return WithInterfaceDiscoverer(JunosISISAdjacencies{})
+	}
 	return func(tc *TransportChannel) error {
-		if device == "bsdany" {
-			out, err := exec.Command("/usr/sbin/cli", "-c", "show isis adjacency").Output()
-			if err != nil {
-				return fmt.Errorf("Listening on bsdany: failed to show interfaces: %v", err)
-			}
-			tc.deviceNames = []string{}
-			lines := strings.Split(string(out), "\n")
-			if len(lines) < 2 {
-				return fmt.Errorf("Listening on bsdany: no available interfaces to listen on")
-			}
-			for _, line := range lines[1:] {
-				// Get device name, which will be at beginning of line, e.g. 'lo0:'
-				fields := strings.Fields(line)
-				if len(fields) == 5 {
-					device := strings.ReplaceAll(fields[0], ".0", "")
-
-					if len(device) > 0 {
-						tc.deviceNames = append(tc.deviceNames, device)
-						log.Printf("Listening on bsdany: added device %s to listen on\n", device)
-					}
-				}
-			}
-			if len(tc.deviceNames) == 0 {
-				return fmt.Errorf("Listening on bsdany: found no devices to listen on")
-			}
-		} else {
-			tc.deviceNames = []string{device}
-		}
+		tc.deviceNames = []string{device}
+		tc.discoverer = nil
 		return nil
 	}
 }
@@ -118,7 +108,8 @@ func WithHasher(hasher PacketHasher) TransportChannelOption {
 	}
 }
 
-// UseListeners sets up the TransportChannel for listener use or not
+// UseListeners sets whether the TransportChannel starts capturing as soon as it is created.  Without it, capture
+// starts once the first hash, rule or listener is registered.
 func UseListeners(useListeners bool) TransportChannelOption {
 	return func(tc *TransportChannel) error {
 		tc.useListeners = useListeners
@@ -137,10 +128,11 @@ func NewTransportChannel(options ...TransportChannelOption) (*TransportChannel,
 		filter:        "",
 		timeout:       100,
 		srcPortOffset: rand.Intn(maxPortOffset),
+		echoIDs:       rand.Uint32(),
 		dstPortOffset: rand.Intn(maxPortOffset),
-		listenerMap:   NewListenerMap(),
 		packetHashes:  NewPacketHashMap(),
 		useListeners:  true,
+		counters:      &receiveCounters{},
 	}
 
 	for _, opt := range options {
@@ -149,42 +141,30 @@ func NewTransportChannel(options ...TransportChannelOption) (*TransportChannel,
 		}
 	}
 
-	tc.packetSources = make([]*gopacket.PacketSource, len(tc.deviceNames))
-	tc.handles = make([]*pcap.Handle, len(tc.deviceNames))
-
-	for idx, deviceName := range tc.deviceNames {
-		inactive, err := pcap.NewInactiveHandle(deviceName)
-		if err != nil {
-			return nil, err
-		}
-		defer inactive.CleanUp()
-
-		if err := inactive.SetImmediateMode(true); err != nil {
-			return nil, err
-		} else if err := inactive.SetSnapLen(tc.snaplen); err != nil {
-			return nil, err
-		} else if err := inactive.SetBufferSize(tc.bufferSize); err != nil {
-			return nil, err
-		} else if err := inactive.SetTimeout(time.Millisecond * time.Duration(tc.timeout)); err != nil { // set negative timeout, mechanics described here: https://godoc.org/github.com/google/gopacket/pcap#hdr-PCAP_Timeouts
+	if tc.discoverer != nil {
+		if err := tc.discoverInterfaces(); err != nil {
 			return nil, err
 		}
+	}
 
-		handle, err := inactive.Activate()
-		if err != nil {
-			return nil, err
-		}
-		tc.handles[idx] = handle
-
-		if tc.filter != "" {
-			err = handle.SetBPFFilter(tc.filter)
+	if tc.timestampSource == HardwareTimestamp {
+		for _, deviceName := range tc.deviceNames {
+			err := tc.network.Run(func() error {
+				return enableHardwareTimestamping(deviceName)
+			})
 			if err != nil {
-				return nil, err
+				log.Printf("Falling back to kernel timestamps: %s", err)
+				tc.timestampSource = KernelTimestamp
+				break
 			}
 		}
+	}
 
-		tc.packetSources[idx] = CreatePacketSource(handle)
+	if err := tc.openCaptureHandles(); err != nil {
+		return nil, err
 	}
 
+	tc.matchTxTimestamps()
 	_, err := tc.setupSocket("IPv4")
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create IPv4 socket for TransportChannel: %s", err)
@@ -199,19 +179,79 @@ func NewTransportChannel(options ...TransportChannelOption) (*TransportChannel,
 	tc.socket6FailureMsgQueue = make(chan int)
 	go tc.renewSocket6FD()
 
+	if err := tc.matchRxTimestamps(); err != nil {
+		return nil, err
+	}
+
 	if tc.useListeners {
 		// activate listeners
-		go func() {
-			for packet := range tc.rx() {
-				go tc.packetHashes.run(packet)
-				go tc.listenerMap.Run(packet)
-			}
-		}()
+		tc.startCapture()
 	}
 
 	return tc, nil
 }
 
+// openCaptureHandles opens the capture handles of every device, and finds the clock they timestamp packets with
+func (tc *TransportChannel) openCaptureHandles() error {
+	tc.rxTimestampSource = tc.timestampSource
+	for idx, deviceName := range tc.deviceNames {
+		var handles []captureHandle
+		ifindex := 0
+		err := tc.network.Run(func() error {
+			var err error
+			handles, err = tc.openHandles(idx, deviceName)
+			ifindex = deviceIndex(deviceName)
+			return err
+		})
+		if err != nil {
+			tc.closeHandles()
+			return fmt.Errorf("Failed to open %s capture on %s: %s", tc.backend, deviceName, err)
+		}
+		for _, handle := range handles {
+			tc.rxTimestampSource = lessPrecise(tc.rxTimestampSource, handle.RxTimestampSource())
+			tc.handles = append(tc.handles, handle)
+			tc.handleDevices = append(tc.handleDevices, deviceName)
+			tc.handleIndexes = append(tc.handleIndexes, ifindex)
+		}
+	}
+	return nil
+}
+
+// matchTxTimestamps has the shared sockets timestamp packets with the clock of the capture handles, when a handle
+// fell back from the clock asked for.  The hardware clock of a NIC is separate from the system clock which kernel and
+// userspace timestamps read, so a round trip time must never subtract a reading of one from a reading of the other.
+func (tc *TransportChannel) matchTxTimestamps() {
+	tc.timestampSource = lessPrecise(tc.timestampSource, tc.rxTimestampSource)
+}
+
+// matchRxTimestamps reopens the capture handles on the clock of the shared sockets, when the sockets fell back from
+// the hardware clock the handles timestamp packets with, see matchTxTimestamps
+func (tc *TransportChannel) matchRxTimestamps() error {
+	tx := tc.txTimestampSource()
+	if tc.rxTimestampSource != HardwareTimestamp || tx == HardwareTimestamp {
+		return nil
+	}
+
+	log.Printf("Falling back to %s rx timestamps to match the tx timestamps", tx)
+	tc.timestampSource = tx
+	tc.closeHandles()
+	tc.handles, tc.handleDevices, tc.handleIndexes = nil, nil, nil
+	return tc.openCaptureHandles()
+}
+
+// txTimestampSource returns the clock the shared sockets timestamp packets with
+func (tc *TransportChannel) txTimestampSource() TimestampSource {
+	source := tc.timestampSource
+	for _, v6 := range []bool{false, true} {
+		_, timestamper := tc.sharedSocket(v6)
+		if timestamper == nil {
+			return UserspaceTimestamp
+		}
+		source = lessPrecise(source, timestamper.source)
+	}
+	return source
+}
+
 // NewBoomerangTransportChannel instantiates a new transport channel with an ip packet header (id:109) for the bpf
 func NewBoomerangTransportChannel(options ...TransportChannelOption) (*TransportChannel, error) {
 	BoomerangTCOptions := []TransportChannelOption{
@@ -223,39 +263,123 @@ func NewBoomerangTransportChannel(options ...TransportChannelOption) (*Transport
 	return NewTransportChannel(options...)
 }
 
+// NewSharedTransportChannel instantiates a transport channel which captures both traceroute replies and boomerangs,
+// so that one channel can be shared by traceroutes and probes running side by side in a long lived process
+func NewSharedTransportChannel(options ...TransportChannelOption) (*TransportChannel, error) {
+	sharedTCOptions := []TransportChannelOption{
+		WithBPFFilter(fmt.Sprintf("icmp || icmp6 || ip[4:2] = %s || ip6[48:4] = %s", boomerangSigV4, boomerangSigV6)),
+		WithHasher(BoomerangPacketHasher{}),
+		WithHasher(V4TraceRouteHasher{}),
+		WithHasher(V6TraceRouteHasher{}),
+	}
+
+	options = append(options, sharedTCOptions...)
+	return NewTransportChannel(options...)
+}
+
+// filterIncludes reports whether the BPF filter is the given primitive, or has it as one of its alternatives
+func (tc *TransportChannel) filterIncludes(primitive string) bool {
+	alternatives := strings.Split(strings.ReplaceAll(tc.filter, " or ", "||"), "||")
+	for _, alternative := range alternatives {
+		if strings.TrimSpace(alternative) == primitive {
+			return true
+		}
+	}
+	return false
+}
+
 func (tc *TransportChannel) setupSocket(socketType string) (int, error) {
 	if socketType == "IPv4" {
-		// open a raw socket
-		// http://man7.org/linux/man-pages/man7/raw.7.html
-		fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_RAW)
+		fd, err := tc.network.socket(false)
 		if err != nil {
-			return fd, fmt.Errorf("Failed to create v4 socket: %s", err)
-		}
-		// IPPROTO_RAW protocol implies IP_HDRINCL on linux, however on freebsd we must set it explicitly
-		// so that no IP header is automatically appended to the IP packets we craft
-		// https://www.freebsd.org/cgi/man.cgi?query=ip&sektion=4&manpath=FreeBSD+12.0-RELEASE
-		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_HDRINCL, 1); err != nil {
-			return fd, fmt.Errorf("Failed to set v4 socket option: %s", err)
+			return fd, err
 		}
+		tc.socketLock.Lock()
+		tc.timestamper = tc.attachTimestamper(fd, tc.timestamper)
 		tc.socketFD = fd
+		tc.socketLock.Unlock()
 		return fd, nil
 
 	} else if socketType == "IPv6" {
-		fd6, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_RAW, syscall.IPPROTO_RAW)
+		fd6, err := tc.network.socket(true)
 		if err != nil {
-			return fd6, fmt.Errorf("Failed to create v6 socket: %s", err)
+			return fd6, err
 		}
+		tc.socketLock.Lock()
+		tc.timestamper6 = tc.attachTimestamper(fd6, tc.timestamper6)
 		tc.socket6FD = fd6
+		tc.socketLock.Unlock()
 		return fd6, nil
 	}
 
 	return -1, fmt.Errorf("Failed to create socket: unrecognized socket type")
 }
 
+// sharedSocket returns the socket every packet of an address family is sent on, and its timestamper
+func (tc *TransportChannel) sharedSocket(v6 bool) (int, *txTimestamper) {
+	tc.socketLock.RLock()
+	defer tc.socketLock.RUnlock()
+
+	if v6 {
+		return tc.socket6FD, tc.timestamper6
+	}
+	return tc.socketFD, tc.timestamper
+}
+
+// rawSocket opens a raw socket which sends the IP packets we craft as they are, without adding a header
+func rawSocket(v6 bool) (int, error) {
+	if v6 {
+		fd6, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_RAW, syscall.IPPROTO_RAW)
+		if err != nil {
+			return fd6, fmt.Errorf("Failed to create v6 socket: %s", err)
+		}
+		return fd6, nil
+	}
+
+	// open a raw socket
+	// http://man7.org/linux/man-pages/man7/raw.7.html
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_RAW)
+	if err != nil {
+		return fd, fmt.Errorf("Failed to create v4 socket: %s", err)
+	}
+	// IPPROTO_RAW protocol implies IP_HDRINCL on linux, however on freebsd we must set it explicitly
+	// so that no IP header is automatically appended to the IP packets we craft
+	// https://www.freebsd.org/cgi/man.cgi?query=ip&sektion=4&manpath=FreeBSD+12.0-RELEASE
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_HDRINCL, 1); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("Failed to set v4 socket option: %s", err)
+	}
+	return fd, nil
+}
+
+// attachTimestamper starts collecting transmit timestamps for a new socket if they were asked for, and stops
+// collecting them for the socket it replaces
+func (tc *TransportChannel) attachTimestamper(fd int, previous *txTimestamper) *txTimestamper {
+	if previous != nil {
+		previous.close()
+	}
+	return socketTimestamper(fd, tc.timestampSource)
+}
+
+// socketTimestamper starts collecting transmit timestamps taken with source for a socket, returning nil if they are
+// taken in userspace
+func socketTimestamper(fd int, source TimestampSource) *txTimestamper {
+	if source == UserspaceTimestamp {
+		return nil
+	}
+
+	timestamper, err := newTxTimestamper(fd, source)
+	if err != nil {
+		log.Printf("Falling back to userspace tx timestamps: %s", err)
+		return nil
+	}
+	return timestamper
+}
+
 func (tc *TransportChannel) renewSocketFD() {
 	for {
 		brokenFD := <-tc.socketFailureMsgQueue
-		if brokenFD != tc.socketFD {
+		if current, _ := tc.sharedSocket(false); brokenFD != current {
 			continue
 		}
 		log.Println("Renewing SocketFD")
@@ -272,7 +396,7 @@ func (tc *TransportChannel) renewSocketFD() {
 func (tc *TransportChannel) renewSocket6FD() {
 	for {
 		broken6FD := <-tc.socket6FailureMsgQueue
-		if broken6FD != tc.socket6FD {
+		if current, _ := tc.sharedSocket(true); broken6FD != current {
 			continue
 		}
 		log.Println("Renewing socket6FD")
@@ -280,58 +404,48 @@ func (tc *TransportChannel) renewSocket6FD() {
 		if err != nil {
 			log.Printf("Failed to renew v6 socket FD: %s", err)
 		}
-		tc.socket6FD = fd6
 		if broken6FD != fd6 {
 			syscall.Close(broken6FD)
 		}
 	}
 }
 
-// Stats displays the stats exposed by the underlying packet handle of a TransportChannel.
-func (tc *TransportChannel) Stats() string {
-	statsList := ""
-	for i, handle := range tc.handles {
-		if i >= len(tc.deviceNames) {
-			return fmt.Sprintf("Could not find device name for handle")
-		}
-		dev := tc.deviceNames[i]
-		stats, err := handle.Stats()
-		if err != nil {
-			return fmt.Sprintf("Encountered an error trying to produce handle stats: %s", err)
-		}
-		statsList += fmt.Sprintf("Stats for device %v:\n %+v\n", dev, stats)
-	}
-
-	return statsList
+// startCapture starts reading packets from each of the handles, at most once per TransportChannel
+func (tc *TransportChannel) startCapture() {
+	tc.captureOnce.Do(func() {
+		go tc.capture()
+	})
 }
 
-// rx returns a packet channel over which packets will be pushed onto
-// this method is private to prevent users from interfering with the listeners
-func (tc *TransportChannel) rx() chan gopacket.Packet {
-	// return tc.packetSource.Packets()
-	if tc.packets == nil {
-		tc.packets = make(chan gopacket.Packet, 1000000)
-		go tc.packetsToChannel()
-	}
-	return tc.packets
-}
-
-// packetsToChannel reads in all packets from the packet source and sends them
-// to the given channel. This routine terminates when a non-temporary error
-// is returned by NextPacket().
-func (tc *TransportChannel) packetsToChannel() {
-	defer close(tc.packets)
+// capture reads in all packets from the handles and dispatches them. This routine terminates when
+// a non-temporary error is returned by every handle.
+func (tc *TransportChannel) capture() {
 	waitOnDevices := sync.WaitGroup{}
-	waitOnDevices.Add(len(tc.packetSources))
+	waitOnDevices.Add(len(tc.handles))
+
+	for idx, handle := range tc.handles {
+		ifindex := 0
+		if idx < len(tc.handleIndexes) {
+			ifindex = tc.handleIndexes[idx]
+		}
 
-	for _, packetSource := range tc.packetSources {
-		go func(p *gopacket.PacketSource) {
+		go func(h captureHandle, ifindex int) {
 			defer waitOnDevices.Done()
 
+			// each reader owns a view which every packet it reads is decoded into, so the
+			// receive path doesn't allocate for packets which nobody is waiting for
+			dp := NewDecodedPacket(h.FirstLayerType())
+
 			for {
-				packet, err := p.NextPacket()
+				data, ci, err := h.ZeroCopyReadPacketData()
 				if err == nil {
-					tc.packets <- packet
+					// a handle on a single interface tags the packets it reads with it, "any" reports the
+					// ingress interface of each packet itself with the afpacket backend
+					if ci.InterfaceIndex == 0 {
+						ci.InterfaceIndex = ifindex
+					}
+					dp.Decode(data, ci)
+					tc.dispatch(dp)
 					continue
 				}
 
@@ -356,44 +470,88 @@ func (tc *TransportChannel) packetsToChannel() {
 				// Sleep briefly and try again
 				time.Sleep(time.Millisecond * time.Duration(5))
 			}
-		}(packetSource)
+		}(handle, ifindex)
 	}
 
 	// Wait for all readers to exit so that packets chan doesn't close before that
 	waitOnDevices.Wait()
+
+	// nothing more will be captured, so let subscribers know
+	tc.filters.closeAll()
 }
 
 // SendTo sends a packet to the specified ip address
 func (tc *TransportChannel) SendTo(packetData []byte, destAddr net.IP) error {
-	var err error
+	_, err := tc.sendTo(packetData, destAddr, false)
+	return err
+}
+
+// sendTo sends a packet to the specified ip address, and returns the most precise transmit timestamp available
+// if wantTimestamp is set
+func (tc *TransportChannel) sendTo(packetData []byte, destAddr net.IP, wantTimestamp bool) (txTimestamp, error) {
+	var addr syscall.Sockaddr
+	var fd int
+	var failures chan int
+	var timestamper *txTimestamper
 
 	destAddrTo4 := destAddr.To4()
 	if destAddrTo4 == nil {
 		var destAddr16 [16]byte
 		copy(destAddr16[:], destAddr.To16()[:16])
-		addr := syscall.SockaddrInet6{
+		addr = &syscall.SockaddrInet6{
 			Addr: destAddr16,
 		}
-		fd6Int := tc.socket6FD
-		err = syscall.Sendto(fd6Int, packetData, 0, &addr)
-		if err != nil {
-			tc.socket6FailureMsgQueue <- fd6Int
-			return fmt.Errorf("Failed to send packetData to socket6FD: %s", err)
-		}
+		fd, timestamper = tc.sharedSocket(true)
+		failures = tc.socket6FailureMsgQueue
 	} else {
 		var destAddr4 [4]byte
 		copy(destAddr4[:], destAddrTo4)
-		addr := syscall.SockaddrInet4{
+		addr = &syscall.SockaddrInet4{
 			Addr: destAddr4,
 		}
-		fdInt := tc.socketFD
-		err = syscall.Sendto(fdInt, packetData, 0, &addr)
-		if err != nil {
-			tc.socketFailureMsgQueue <- fdInt
-			return fmt.Errorf("Failed to send packetData to socketFD: %s", err)
+		fd, timestamper = tc.sharedSocket(false)
+		failures = tc.socketFailureMsgQueue
+	}
+
+	stamp, fd, err := timestampedSend(fd, timestamper, packetData, addr, wantTimestamp)
+	if err != nil {
+		failures <- fd
+		if destAddrTo4 == nil {
+			return stamp, fmt.Errorf("Failed to send packetData to socket6FD: %s", err)
 		}
+		return stamp, fmt.Errorf("Failed to send packetData to socketFD: %s", err)
 	}
-	return nil
+	return stamp, nil
+}
+
+// timestampedSend sends a packet on a socket, through its timestamper unless it is nil, and returns the most precise
+// transmit timestamp available if wantTimestamp is set.  Also returns the socket the packet was sent on.
+func timestampedSend(fd int, timestamper *txTimestamper, packetData []byte, addr syscall.Sockaddr, wantTimestamp bool) (txTimestamp, int, error) {
+	var err error
+	var id uint32
+	if timestamper != nil {
+		// the timestamper numbers the packets sent on its socket, so it must see every send
+		fd = timestamper.fd
+		id, _, err = timestamper.send(wantTimestamp, func() (int, error) {
+			if err := syscall.Sendto(fd, packetData, 0, addr); err != nil {
+				return 0, err
+			}
+			return 1, nil
+		})
+	} else {
+		err = syscall.Sendto(fd, packetData, 0, addr)
+	}
+	stamp := txTimestamp{ts: time.Now().UTC(), source: UserspaceTimestamp}
+	if err != nil {
+		return stamp, fd, err
+	}
+
+	if timestamper != nil && wantTimestamp {
+		if kernelStamp, ok := timestamper.wait(id, txTimestampTimeout); ok {
+			stamp = kernelStamp
+		}
+	}
+	return stamp, fd, nil
 }
 
 // SendToPath sends a packet to the first hop in the specified path
@@ -406,33 +564,52 @@ func (tc *TransportChannel) SendToPath(packetData []byte, path Path) error {
 
 // Close cleans up resources for the transport channel instance
 func (tc *TransportChannel) Close() {
+	tc.socketLock.Lock()
 	syscall.Close(tc.socketFD)
+	if tc.timestamper != nil {
+		tc.timestamper.close()
+	}
+	if tc.timestamper6 != nil {
+		tc.timestamper6.close()
+	}
+	tc.socketLock.Unlock()
+	tc.egressSockets.close()
+	tc.closeHandles()
+}
+
+func (tc *TransportChannel) closeHandles() {
 	for _, handle := range tc.handles {
 		handle.Close()
 	}
 }
 
-// FindLocalIP finds the IP of the interface device of the TransportChannel instance
+// FindLocalIP finds the IP of the interface device of the TransportChannel instance.
+//
+// Deprecated: the first address of the device may be of the wrong family, and the "any" device has none, use
+// SourceFor instead.
 func (tc *TransportChannel) FindLocalIP() (net.IP, error) {
-	devices, err := pcap.FindAllDevs()
-	if err != nil {
-		return nil, err
-	}
+	var localIP net.IP
+	err := tc.network.Run(func() error {
+		iface, err := net.InterfaceByName(tc.deviceNames[0])
+		if err != nil {
+			return fmt.Errorf("Couldn't find a device named %s: %s", tc.deviceNames[0], err)
+		}
 
-	var eth0Device pcap.Interface
-	deviceFound := false
-	for _, device := range devices {
-		if device.Name == tc.deviceNames[0] {
-			deviceFound = true
-			eth0Device = device
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return fmt.Errorf("Failed to get addresses of %s: %s", tc.deviceNames[0], err)
 		}
-	}
-	if !deviceFound {
-		errMsg := fmt.Sprintf("Couldn't find a device named %s, or it did not have any addresses assigned to it", tc.deviceNames)
-		return nil, errors.New(errMsg)
-	}
 
-	return eth0Device.Addresses[0].IP, nil
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				localIP = ipNet.IP
+				return nil
+			}
+		}
+
+		return fmt.Errorf("Device %s did not have any addresses assigned to it", tc.deviceNames[0])
+	})
+	return localIP, err
 }
 
 // Interface returns the interface the TransportChannel is listening on
@@ -440,13 +617,56 @@ func (tc *TransportChannel) Interface() string {
 	return tc.deviceNames[0]
 }
 
+// Interfaces returns every interface the TransportChannel is listening on
+func (tc *TransportChannel) Interfaces() []string {
+	return tc.deviceNames
+}
+
+// InterfaceName returns the name of the interface a packet was received on, from the InterfaceIndex of its
+// CaptureInfo.  Returns "" if the interface is unknown.
+func (tc *TransportChannel) InterfaceName(index int) string {
+	if index <= 0 {
+		return ""
+	}
+	if name, ok := tc.interfaceNames.Load(index); ok {
+		return name.(string)
+	}
+
+	var name string
+	tc.network.Run(func() error {
+		if iface, err := net.InterfaceByIndex(index); err == nil {
+			name = iface.Name
+		}
+		return nil
+	})
+	tc.interfaceNames.Store(index, name)
+	return name
+}
+
+// deviceIndex returns the index of the interface a handle captures on, 0 for "any" or an interface the host doesn't
+// know by name, such as a pcap device on some platforms
+func deviceIndex(device string) int {
+	if device == "any" {
+		return 0
+	}
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return 0
+	}
+	return iface.Index
+}
+
 // Filter returns the BPF the TransportChannel uses
 func (tc *TransportChannel) Filter() string {
 	return tc.filter
 }
 
+// Version returns the version of the capture backend the TransportChannel uses
 func (tc *TransportChannel) Version() string {
-	return pcap.Version()
+	if tc.backend == AFPacketBackend || (tc.backend == DefaultBackend && defaultBackend == AFPacketBackend) {
+		return "AF_PACKET TPACKET_V3"
+	}
+	return pcapVersion()
 }
 
 func (tc *TransportChannel) GetFilter() string {
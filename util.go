@@ -1,13 +1,11 @@
 package beacon
 
 import (
-	"fmt"
 	"net"
 	"sync"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/routing"
 )
 
 type portPair struct {
@@ -31,8 +29,7 @@ func ParseIPFromString(s string) (net.IP, error) {
 	return ipAddrs[0], nil
 }
 
-// GetInterfaceDeviceFromDestString uses gopacket's routing package to attempt to
-// resolve the appropriate outbound interface to use given a destination string
+// GetInterfaceDeviceFromDestString resolves the appropriate outbound interface to use given a destination string
 func GetInterfaceDeviceFromDestString(dest string) (string, error) {
 	destIP, err := ParseIPFromString(dest)
 	if err != nil {
@@ -42,33 +39,15 @@ func GetInterfaceDeviceFromDestString(dest string) (string, error) {
 	return GetInterfaceDeviceFromDestIP(destIP)
 }
 
-// GetInterfaceDeviceFromDestIP uses gopacket's routing package to attempt to
-// resolve the appropriate outbound interface to use given a destination IP
+// GetInterfaceDeviceFromDestIP looks up the routing table to resolve the appropriate outbound interface to use given
+// a destination IP
 func GetInterfaceDeviceFromDestIP(destIP net.IP) (string, error) {
-	router, err := routing.New()
-	if err != nil {
-		return "", err
-	}
-	iface, _, _, err := router.Route(destIP)
-	if err != nil {
-		return "", err
-	}
-
-	return iface.Name, nil
+	return NetworkContext{}.GetInterfaceDeviceFromDestIP(destIP)
 }
 
-// FindSourceIPForDest performs a udp dial and inspects the resulting connection
-// to extract the preferred source IP to use for the given dest IP
+// FindSourceIPForDest looks up the routing table to find the preferred source IP to use for the given dest IP
 func FindSourceIPForDest(dest net.IP) (net.IP, error) {
-	conn, err := net.Dial("udp", fmt.Sprintf("[%s]:80", dest))
-	if err != nil {
-		return nil, fmt.Errorf("Failed to dial dest ip %s: %s", dest, err)
-	}
-	defer conn.Close()
-
-	sourceIP := conn.LocalAddr().(*net.UDPAddr).IP
-
-	return sourceIP, nil
+	return NetworkContext{}.FindSourceIPForDest(dest)
 }
 
 func Merge(resultChannels ...chan BoomerangResult) <-chan BoomerangResult {